@@ -35,6 +35,10 @@ var (
 	}, breakerLabels)
 )
 
+// logSampler samples the logs of breaker trips and state changes,
+// which could flood the logs when the upstream keeps flapping.
+var logSampler = log.NewSampler("breakerbp", log.DefaultSampling)
+
 // FailureRatioBreaker is a circuit breaker based on gobreaker that uses a low-water-mark and
 // % failure threshold to trip.
 type FailureRatioBreaker struct {
@@ -179,6 +183,9 @@ func (cb FailureRatioBreaker) shouldTrip(counts gobreaker.Counts) bool {
 	if counts.Requests > 0 && counts.Requests >= uint32(cb.minRequestsToTrip) {
 		failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
 		if failureRatio >= cb.failureThreshold {
+			if !logSampler.Allow("trip:" + cb.name) {
+				return true
+			}
 			slog.WarnContext(
 				cb.logContext,
 				"tripping circuit breaker",
@@ -200,6 +207,9 @@ func (cb FailureRatioBreaker) stateChanged(name string, from gobreaker.State, to
 		nameLabel: cb.name,
 	}).Set(value)
 
+	if !logSampler.Allow("state:" + cb.name) {
+		return
+	}
 	slog.InfoContext(
 		cb.logContext,
 		"circuit breaker state changed",
@@ -17,8 +17,11 @@ type channelPool struct {
 	maxClients int
 }
 
-// Make sure channelPool implements Pool interface.
-var _ Pool = (*channelPool)(nil)
+// Make sure channelPool implements Pool and Filler interfaces.
+var (
+	_ Pool   = (*channelPool)(nil)
+	_ Filler = (*channelPool)(nil)
+)
 
 // NewChannelPool creates a new client pool implemented via channel.
 func NewChannelPool(ctx context.Context, requiredInitialClients, bestEffortInitialClients, maxClients int, opener ClientOpener) (_ Pool, err error) {
@@ -159,6 +162,25 @@ func (cp *channelPool) Release(c Client) error {
 	}
 }
 
+// Fill implements Filler.
+func (cp *channelPool) Fill(n int) (int, error) {
+	var opened int
+	for len(cp.pool) < n && len(cp.pool)+int(cp.NumActiveClients()) < cp.maxClients {
+		c, err := cp.opener()
+		if err != nil {
+			return opened, err
+		}
+		select {
+		case cp.pool <- c:
+			opened++
+		default:
+			// Pool became full by the clients released concurrently.
+			return opened, c.Close()
+		}
+	}
+	return opened, nil
+}
+
 // Close closes the pool, and all allocated clients.
 func (cp *channelPool) Close() error {
 	var lastErr error
@@ -113,3 +113,75 @@ func TestChannelPoolWithOpenerFailure(t *testing.T) {
 		},
 	)
 }
+
+func TestChannelPoolFill(t *testing.T) {
+	var openerCalled atomic.Int32
+	var fail atomic.Bool
+	failure := errors.New("failed")
+	opener := func() (clientpool.Client, error) {
+		if fail.Load() {
+			return nil, failure
+		}
+		openerCalled.Add(1)
+		return &testClient{}, nil
+	}
+
+	const min, init, max = 0, 1, 3
+	pool, err := clientpool.NewChannelPool(context.Background(), min, init, max, opener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	filler := pool.(clientpool.Filler)
+
+	opened, err := filler.Fill(2)
+	if err != nil {
+		t.Fatalf("Fill returned error: %v", err)
+	}
+	if opened != 1 {
+		t.Errorf("Fill expected to open 1 client, got %d", opened)
+	}
+	checkActiveAndAllocated(t, pool, 0, 2)
+
+	// Fill never exceeds the max capacity of the pool, including the active
+	// clients.
+	c, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err = filler.Fill(max)
+	if err != nil {
+		t.Fatalf("Fill returned error: %v", err)
+	}
+	if opened != 1 {
+		t.Errorf("Fill expected to open 1 client, got %d", opened)
+	}
+	checkActiveAndAllocated(t, pool, 1, 2)
+	if err := pool.Release(c); err != nil {
+		t.Fatal(err)
+	}
+
+	checkActiveAndAllocated(t, pool, 0, 3)
+	if got, want := openerCalled.Load(), int32(3); got != want {
+		t.Errorf("Expected opener to be called %d times, got %d", want, got)
+	}
+
+	failing, err := clientpool.NewChannelPool(context.Background(), 0, 0, max, opener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		failing.Close()
+	})
+	fail.Store(true)
+	opened, err = failing.(clientpool.Filler).Fill(max)
+	if !errors.Is(err, failure) {
+		t.Errorf("Fill expected error %v, got %v", failure, err)
+	}
+	if opened != 0 {
+		t.Errorf("Fill expected to open 0 clients, got %d", opened)
+	}
+	checkActiveAndAllocated(t, failing, 0, 0)
+}
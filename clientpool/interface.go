@@ -28,3 +28,16 @@ type Pool interface {
 	NumAllocated() int32
 	IsExhausted() bool
 }
+
+// Filler is an optional interface a Pool can implement to open clients in
+// advance, so they are ready in the pool before they are needed.
+type Filler interface {
+	// Fill opens new clients until there are at least n idle clients in the
+	// pool, without exceeding the max capacity of the pool.
+	//
+	// It returns the number of clients opened, and the first error returned
+	// by the ClientOpener, if any.
+	//
+	// Calling Fill after Close will cause panic.
+	Fill(n int) (opened int, err error)
+}
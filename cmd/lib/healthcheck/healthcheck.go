@@ -2,16 +2,23 @@ package healthcheck
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
+	"github.com/reddit/baseplate.go/grpcbp"
 	"github.com/reddit/baseplate.go/httpbp"
 	"github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
 	"github.com/reddit/baseplate.go/thriftbp"
@@ -46,6 +53,7 @@ var checkers = map[string]interface{}{
 	"thrift": checker(checkThrift),
 	"wsgi":   checker(checkHTTP),
 	"http":   checker(checkHTTP),
+	"grpc":   checker(checkGRPC),
 }
 
 // Actual value type: baseplate.IsHealthyProbe
@@ -55,6 +63,13 @@ var probes = map[string]interface{}{
 	"startup":   baseplate.IsHealthyProbe_STARTUP,
 }
 
+// grpcHealthServices maps the probes to the grpc.health.v1 service names.
+var grpcHealthServices = map[baseplate.IsHealthyProbe]string{
+	baseplate.IsHealthyProbe_READINESS: grpcbp.HealthServiceReadiness,
+	baseplate.IsHealthyProbe_LIVENESS:  grpcbp.HealthServiceLiveness,
+	baseplate.IsHealthyProbe_STARTUP:   grpcbp.HealthServiceStartup,
+}
+
 // RunArgs is the more customizable version of Run.
 //
 // In production code it expects you to pass in os.Args as the arg.
@@ -78,7 +93,8 @@ func runArgs(args []string, output io.Writer) error {
 	addr := fs.String(
 		"endpoint",
 		"localhost:9090",
-		`The endpoint to find the service on, in "host:port" format without schema.`,
+		`The endpoint to find the service on, in "host:port" format without schema. `+
+			`For grpc type it can also be a unix socket, as "unix:///path/to/socket" or "/path/to/socket".`,
 	)
 	timeout := fs.Duration(
 		"timeout",
@@ -103,6 +119,21 @@ func runArgs(args []string, output io.Writer) error {
 		"probe",
 		fmt.Sprintf("The probe to check, one of %s.", probe.choicesString()),
 	)
+	useTLS := fs.Bool(
+		"tls",
+		false,
+		"Use TLS to connect to the service, only supported by grpc type.",
+	)
+	tlsSkipVerify := fs.Bool(
+		"tls-skip-verify",
+		false,
+		"Skip the verification of the server certificate when --tls is used.",
+	)
+	grpcService := fs.String(
+		"grpc-service",
+		"",
+		"The grpc.health.v1 service name to check for grpc type, overrides the one derived from --probe.",
+	)
 	if err := fs.Parse(args[1:]); err != nil {
 		return fmt.Errorf("failed to parse args: %w", err)
 	}
@@ -123,26 +154,43 @@ func runArgs(args []string, output io.Writer) error {
 		}
 		*addr = fs.Arg(1)
 	}
-	return check.getValue().(checker)(
-		*addr,
-		probe.getValue().(baseplate.IsHealthyProbe),
-		*timeout,
-	)
+	if *useTLS && check.value != "grpc" {
+		return fmt.Errorf("--tls is not supported by type %q", check.value)
+	}
+	return check.getValue().(checker)(checkArgs{
+		addr:          *addr,
+		probe:         probe.getValue().(baseplate.IsHealthyProbe),
+		timeout:       *timeout,
+		tls:           *useTLS,
+		tlsSkipVerify: *tlsSkipVerify,
+		grpcService:   *grpcService,
+	})
+}
+
+type checkArgs struct {
+	addr    string
+	probe   baseplate.IsHealthyProbe
+	timeout time.Duration
+
+	// Only used by grpc.
+	tls           bool
+	tlsSkipVerify bool
+	grpcService   string
 }
 
-type checker func(addr string, probe baseplate.IsHealthyProbe, timeout time.Duration) error
+type checker func(args checkArgs) error
 
-func checkThrift(addr string, probe baseplate.IsHealthyProbe, timeout time.Duration) error {
+func checkThrift(args checkArgs) error {
 	cfg := thriftbp.ClientPoolConfig{
-		Addr:               addr,
+		Addr:               args.addr,
 		InitialConnections: 1,
 		MaxConnections:     5,
-		ConnectTimeout:     timeout,
-		SocketTimeout:      timeout,
+		ConnectTimeout:     args.timeout,
+		SocketTimeout:      args.timeout,
 	}
 	pool, err := thriftbp.NewCustomClientPool(
 		cfg,
-		thriftbp.SingleAddressGenerator(addr),
+		thriftbp.SingleAddressGenerator(args.addr),
 		thrift.NewTHeaderProtocolFactoryConf(cfg.ToTConfiguration()),
 	)
 	if err != nil {
@@ -150,10 +198,10 @@ func checkThrift(addr string, probe baseplate.IsHealthyProbe, timeout time.Durat
 	}
 	defer pool.Close()
 	client := baseplate.NewBaseplateServiceV2Client(pool.TClient())
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), args.timeout)
 	defer cancel()
 	ret, err := client.IsHealthy(ctx, &baseplate.IsHealthyRequest{
-		Probe: &probe,
+		Probe: &args.probe,
 	})
 	if err != nil {
 		return fmt.Errorf("thrift IsHealthy request failed: %w", err)
@@ -164,11 +212,11 @@ func checkThrift(addr string, probe baseplate.IsHealthyProbe, timeout time.Durat
 	return nil
 }
 
-func checkHTTP(addr string, probe baseplate.IsHealthyProbe, timeout time.Duration) error {
+func checkHTTP(args checkArgs) error {
 	client := http.Client{
-		Timeout: timeout,
+		Timeout: args.timeout,
 	}
-	url := fmt.Sprintf(`http://%s/health?type=%v`, addr, probe)
+	url := fmt.Sprintf(`http://%s/health?type=%v`, args.addr, args.probe)
 	resp, err := client.Get(url)
 	if err != nil {
 		return fmt.Errorf("http request failed: %w", err)
@@ -192,3 +240,38 @@ func checkHTTP(addr string, probe baseplate.IsHealthyProbe, timeout time.Duratio
 	}
 	return nil
 }
+
+func checkGRPC(args checkArgs) error {
+	creds := insecure.NewCredentials()
+	if args.tls {
+		creds = credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: args.tlsSkipVerify,
+		})
+	}
+	target := args.addr
+	if strings.HasPrefix(target, "/") {
+		target = "unix://" + target
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	defer conn.Close()
+
+	service := args.grpcService
+	if service == "" {
+		service = grpcHealthServices[args.probe]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), args.timeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: service,
+	})
+	if err != nil {
+		return fmt.Errorf("grpc health check request failed: %w", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpc health check returned %v", resp.GetStatus())
+	}
+	return nil
+}
@@ -2,16 +2,22 @@ package healthcheck
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"github.com/reddit/baseplate.go/grpcbp"
 	"github.com/reddit/baseplate.go/httpbp"
 	"github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
 	"github.com/reddit/baseplate.go/thriftbp"
@@ -137,6 +143,82 @@ func httpService(healthy healthyMap) *service {
 	return s
 }
 
+type probeChecker struct {
+	healthy healthyMap
+	probe   baseplate.IsHealthyProbe
+}
+
+func (c probeChecker) IsHealthy(context.Context) bool {
+	return c.healthy[c.probe]
+}
+
+// grpcService creates a grpc service with the health service.
+//
+// network can be either "tcp" or "unix".
+func grpcService(healthy healthyMap, network string, useTLS bool) *service {
+	var wg sync.WaitGroup
+	var server *grpc.Server
+
+	s := new(service)
+	s.up = func(t *testing.T) {
+		t.Helper()
+
+		addr := "localhost:0"
+		if network == "unix" {
+			addr = filepath.Join(t.TempDir(), "grpc.sock")
+		}
+		listener, err := net.Listen(network, addr)
+		if err != nil {
+			t.Fatalf("Failed to create listener: %v", err)
+		}
+		s.addr = listener.Addr().String()
+		t.Logf("Listening on %v...", s.addr)
+
+		var opts []grpc.ServerOption
+		if useTLS {
+			// Borrow the self-signed certificate from httptest.
+			ts := httptest.NewUnstartedServer(nil)
+			ts.StartTLS()
+			cert := ts.TLS.Certificates[0]
+			ts.Close()
+			opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{cert},
+			})))
+		}
+		server = grpc.NewServer(opts...)
+		grpcbp.RegisterHealthService(server, grpcbp.HealthServiceArgs{
+			Checker: probeChecker{
+				healthy: healthy,
+				probe:   baseplate.IsHealthyProbe_READINESS,
+			},
+			Liveness: probeChecker{
+				healthy: healthy,
+				probe:   baseplate.IsHealthyProbe_LIVENESS,
+			},
+			Startup: probeChecker{
+				healthy: healthy,
+				probe:   baseplate.IsHealthyProbe_STARTUP,
+			},
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Serve(listener); err != nil {
+				t.Errorf("server.Serve returned error: %v", err)
+			}
+		}()
+	}
+	s.down = func(t *testing.T) {
+		t.Helper()
+
+		if server != nil {
+			server.Stop()
+		}
+		wg.Wait()
+	}
+	return s
+}
+
 func TestRunArgs(t *testing.T) {
 	const timeout = time.Millisecond * 100
 	for _, c := range []struct {
@@ -204,6 +286,65 @@ func TestRunArgs(t *testing.T) {
 				baseplate.IsHealthyProbe_STARTUP:   false,
 			}),
 		},
+		{
+			label:   "grpc",
+			args:    []string{"--type", "grpc"},
+			service: grpcService(allHealthy, "tcp", false),
+		},
+		{
+			label:   "all-unhealthy-grpc",
+			args:    []string{"--type", "grpc"},
+			err:     true,
+			service: grpcService(allUnhealthy, "tcp", false),
+		},
+		{
+			label: "startup-unhealthy-grpc-1",
+			args:  []string{"--type", "grpc", "--probe", "startup"},
+			err:   true,
+			service: grpcService(healthyMap{
+				baseplate.IsHealthyProbe_READINESS: true,
+				baseplate.IsHealthyProbe_LIVENESS:  true,
+				baseplate.IsHealthyProbe_STARTUP:   false,
+			}, "tcp", false),
+		},
+		{
+			label: "startup-unhealthy-grpc-2",
+			args:  []string{"--type", "grpc", "--probe", "liveness"},
+			err:   false, // This one checks liveness probe so it should report healthy
+			service: grpcService(healthyMap{
+				baseplate.IsHealthyProbe_READINESS: false,
+				baseplate.IsHealthyProbe_LIVENESS:  true,
+				baseplate.IsHealthyProbe_STARTUP:   false,
+			}, "tcp", false),
+		},
+		{
+			label:   "unknown-service-grpc",
+			args:    []string{"--type", "grpc", "--grpc-service", "foo"},
+			err:     true,
+			service: grpcService(allHealthy, "tcp", false),
+		},
+		{
+			label:   "unix-socket-grpc",
+			args:    []string{"--type", "grpc"},
+			service: grpcService(allHealthy, "unix", false),
+		},
+		{
+			label:   "tls-grpc",
+			args:    []string{"--type", "grpc", "--tls", "--tls-skip-verify"},
+			service: grpcService(allHealthy, "tcp", true),
+		},
+		{
+			label:   "tls-verify-grpc",
+			args:    []string{"--type", "grpc", "--tls"},
+			err:     true, // The self-signed certificate is not trusted
+			service: grpcService(allHealthy, "tcp", true),
+		},
+		{
+			label:   "tls-thrift",
+			args:    []string{"--tls"},
+			err:     true,
+			service: thriftService(allHealthy),
+		},
 		{
 			label: "help",
 			args:  []string{"-h"},
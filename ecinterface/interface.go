@@ -31,3 +31,15 @@ type FactoryArgs struct {
 
 // Factory is the callback used by baseplate.New to create the implementation.
 type Factory func(args FactoryArgs) (Interface, error)
+
+// OAuthClientIDGetter is an optional interface an Interface implementation can
+// implement to expose the OAuth client id of the edge context attached to the
+// context (e.g. to be used as a rate limit key by ratelimitbp).
+type OAuthClientIDGetter interface {
+	// OAuthClientID returns the OAuth client id of the edge context attached to
+	// ctx.
+	//
+	// It shall return ("", false) when there's no edge context attached to ctx,
+	// or the edge context has no OAuth client.
+	OAuthClientID(ctx context.Context) (id string, ok bool)
+}
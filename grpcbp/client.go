@@ -0,0 +1,125 @@
+package grpcbp
+
+import (
+	"github.com/avast/retry-go"
+	"google.golang.org/grpc"
+
+	"github.com/reddit/baseplate.go/breakerbp"
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/retrybp"
+	"github.com/reddit/baseplate.go/tracing"
+	"github.com/reddit/baseplate.go/transport"
+)
+
+// DefaultClientInterceptorsArgs defines the args used by
+// BaseplateDefaultClientUnaryInterceptors.
+type DefaultClientInterceptorsArgs struct {
+	// ServiceSlug is a short identifier for the gRPC service you are creating
+	// clients for. The preferred convention is to take the service's name,
+	// remove the 'Service' prefix, if present, and convert from camel case to
+	// all lower case, hyphen separated.
+	//
+	// Examples:
+	//
+	//	AuthenticationService -> authentication
+	//	ImageUploadService -> image-upload
+	ServiceSlug string
+
+	// The edge context implementation. Optional.
+	//
+	// If it's not set, the global one from ecinterface.Get will be used instead.
+	EdgeContextImpl ecinterface.Interface
+
+	// The Propagator used to inject the span headers into the request
+	// metadata. Optional.
+	//
+	// If it's not set, BaseplatePropagator will be used.
+	Propagator tracing.Propagator
+
+	// RetryOptions is the list of retry.Options to apply as the defaults for the
+	// RetryInterceptorUnary.
+	//
+	// Optional, default to retry.Attempts(1) (no retries).
+	RetryOptions []retry.Option
+
+	// RetryFilters is the list of retrybp.Filters deciding whether to retry the
+	// errors.
+	//
+	// Optional, default to DefaultRetryFilters().
+	RetryFilters []retrybp.Filter
+
+	// BreakerConfig is an optional circuit breaker configuration.
+	//
+	// If it's not set, no circuit breaker will be used.
+	BreakerConfig *breakerbp.Config
+
+	// The store and the path of the secret used to sign the forwarded baseplate
+	// headers.
+	//
+	// The baseplate headers interceptor is only added when both are set.
+	SecretsStore           SecretsStore
+	HeaderbpSigningKeyPath string
+}
+
+// BaseplateDefaultClientUnaryInterceptors returns the default unary client
+// interceptors that should be used by a baseplate gRPC client.
+//
+// Currently they are (in order):
+//
+// 1. ForwardEdgeContextUnary
+//
+// 2. MonitorInterceptorUnary with transport.WithRetrySlugSuffix
+//
+// 3. PrometheusUnaryClientInterceptor with transport.WithRetrySlugSuffix
+//
+// 4. RetryInterceptorUnary
+//
+// 5. CircuitBreakerInterceptorUnary (only when BreakerConfig is set)
+//
+// 6. MonitorInterceptorUnary
+//
+// 7. PrometheusUnaryClientInterceptor
+//
+// 8. ClientErrorInterceptorUnary
+//
+// 9. ClientBaseplateHeadersInterceptorUnary (only when both SecretsStore and
+// HeaderbpSigningKeyPath are set)
+//
+// They can be used with grpc.WithChainUnaryInterceptor when creating the
+// client connection.
+func BaseplateDefaultClientUnaryInterceptors(args DefaultClientInterceptorsArgs) []grpc.UnaryClientInterceptor {
+	interceptors := []grpc.UnaryClientInterceptor{
+		ForwardEdgeContextUnary(args.EdgeContextImpl),
+		MonitorInterceptorUnary(MonitorInterceptorArgs{
+			ServiceSlug: args.ServiceSlug + transport.WithRetrySlugSuffix,
+			Propagator:  args.Propagator,
+		}),
+		PrometheusUnaryClientInterceptor(args.ServiceSlug + transport.WithRetrySlugSuffix),
+		RetryInterceptorUnary(RetryInterceptorArgs{
+			Options: args.RetryOptions,
+			Filters: args.RetryFilters,
+		}),
+	}
+	if args.BreakerConfig != nil {
+		interceptors = append(
+			interceptors,
+			CircuitBreakerInterceptorUnary(breakerbp.NewFailureRatioBreaker(*args.BreakerConfig)),
+		)
+	}
+	interceptors = append(
+		interceptors,
+		MonitorInterceptorUnary(MonitorInterceptorArgs{
+			ServiceSlug: args.ServiceSlug,
+			Propagator:  args.Propagator,
+		}),
+		PrometheusUnaryClientInterceptor(args.ServiceSlug),
+		ClientErrorInterceptorUnary(),
+	)
+	if args.SecretsStore != nil && args.HeaderbpSigningKeyPath != "" {
+		interceptors = append(
+			interceptors,
+			ClientBaseplateHeadersInterceptorUnary(args.ServiceSlug, args.SecretsStore, args.HeaderbpSigningKeyPath),
+		)
+	}
+	return interceptors
+}
@@ -3,15 +3,24 @@ package grpcbp
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"sync"
 	"time"
 
+	"github.com/avast/retry-go"
 	"github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/reddit/baseplate.go/breakerbp"
 	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/headerbp"
 	"github.com/reddit/baseplate.go/prometheusbp"
+	"github.com/reddit/baseplate.go/retrybp"
+	"github.com/reddit/baseplate.go/secrets"
 	"github.com/reddit/baseplate.go/tracing"
 )
 
@@ -19,6 +28,13 @@ import (
 // MonitorInterceptorUnary function.
 type MonitorInterceptorArgs struct {
 	ServiceSlug string
+
+	// The Propagator used to inject the span headers into the request
+	// metadata, usually created by tracing.NewPropagators with
+	// BaseplatePropagator.
+	//
+	// If empty, BaseplatePropagator will be used.
+	Propagator tracing.Propagator
 }
 
 // MonitorInterceptorUnary is a client middleware that provides tracing and
@@ -42,7 +58,7 @@ func MonitorInterceptorUnary(args MonitorInterceptorArgs) grpc.UnaryClientInterc
 				Type: tracing.SpanTypeClient,
 			},
 		)
-		ctx = CreateGRPCContextFromSpan(ctx, tracing.AsSpan(span))
+		ctx = CreateGRPCContextFromSpanWithPropagator(ctx, tracing.AsSpan(span), args.Propagator)
 		defer func() {
 			span.FinishWithOptions(tracing.FinishOptions{
 				Ctx: ctx,
@@ -138,57 +154,425 @@ func PrometheusUnaryClientInterceptor(serverSlug string) grpc.UnaryClientInterce
 	) (err error) {
 		start := time.Now()
 		serviceName, method := serviceAndMethodSlug(fullMethod)
+		done := startClientRequest(serverSlug, serviceName, method, unary)
+		defer func() {
+			done(start, err)
+		}()
+		return invoker(ctx, fullMethod, req, reply, conn, opts...)
+	}
+}
 
-		activeRequestLabels := prometheus.Labels{
+// startClientRequest increases the grpc_client_active_requests gauge, and
+// returns the function to be called when the request is done to record the
+// result.
+func startClientRequest(serverSlug, serviceName, method, typ string) func(start time.Time, err error) {
+	activeRequestLabels := prometheus.Labels{
+		serviceLabel:    serviceName,
+		methodLabel:     method,
+		typeLabel:       typ,
+		clientNameLabel: serverSlug,
+	}
+	clientActiveRequests.With(activeRequestLabels).Inc()
+
+	return func(start time.Time, err error) {
+		success := prometheusbp.BoolString(err == nil)
+		status, _ := status.FromError(err)
+
+		latencyLabels := prometheus.Labels{
 			serviceLabel:    serviceName,
 			methodLabel:     method,
-			typeLabel:       unary,
+			typeLabel:       typ,
+			successLabel:    success,
 			clientNameLabel: serverSlug,
 		}
-		clientActiveRequests.With(activeRequestLabels).Inc()
 
-		defer func() {
-			success := prometheusbp.BoolString(err == nil)
-			status, _ := status.FromError(err)
-
-			latencyLabels := prometheus.Labels{
-				serviceLabel:    serviceName,
-				methodLabel:     method,
-				typeLabel:       unary,
-				successLabel:    success,
-				clientNameLabel: serverSlug,
-			}
+		clientLatencyDistribution.With(latencyLabels).Observe(time.Since(start).Seconds())
 
-			clientLatencyDistribution.With(latencyLabels).Observe(time.Since(start).Seconds())
-
-			totalRequestLabels := prometheus.Labels{
-				serviceLabel:    serviceName,
-				methodLabel:     method,
-				typeLabel:       unary,
-				successLabel:    success,
-				clientNameLabel: serverSlug,
-				codeLabel:       status.Code().String(),
-			}
-			clientTotalRequests.With(totalRequestLabels).Inc()
-			clientActiveRequests.With(activeRequestLabels).Dec()
-		}()
-		return invoker(ctx, fullMethod, req, reply, conn, opts...)
+		totalRequestLabels := prometheus.Labels{
+			serviceLabel:    serviceName,
+			methodLabel:     method,
+			typeLabel:       typ,
+			successLabel:    success,
+			clientNameLabel: serverSlug,
+			codeLabel:       status.Code().String(),
+		}
+		clientTotalRequests.With(totalRequestLabels).Inc()
+		clientActiveRequests.With(activeRequestLabels).Dec()
 	}
 }
 
 // PrometheusStreamClientInterceptor is a client-side interceptor that provides Prometheus
 // monitoring for Streaming RPCs.
 //
-// This is not implemented yet.
+// It emits the same metrics as PrometheusUnaryClientInterceptor, with
+// grpc_type being one of client_stream, server_stream and bidi_stream, so
+// grpc_client_active_requests is the number of active streams, and
+// grpc_client_latency_seconds is the duration of the streams. In addition, it
+// emits the following metrics for the messages of the streams, with
+// grpc_service, grpc_method, grpc_type and grpc_client_name labels:
+//
+// * grpc_client_stream_messages_sent_total counter
+//
+// * grpc_client_stream_messages_received_total counter
+//
+// * grpc_client_stream_sent_message_size_bytes histogram
+//
+// * grpc_client_stream_received_message_size_bytes histogram
+//
+// A stream is done when RecvMsg returns an error (io.EOF being success), when
+// the response of a stream without server streaming is received, or when ctx is
+// canceled, whichever comes first.
 func PrometheusStreamClientInterceptor(serverSlug string) grpc.StreamClientInterceptor {
 	return func(
 		ctx context.Context,
 		desc *grpc.StreamDesc,
 		conn *grpc.ClientConn,
-		method string,
+		fullMethod string,
 		streamer grpc.Streamer,
 		opts ...grpc.CallOption,
 	) (_ grpc.ClientStream, err error) {
-		return nil, errors.New("PrometheusStreamClientInterceptor: not implemented")
+		start := time.Now()
+		serviceName, method := serviceAndMethodSlug(fullMethod)
+		typ := streamType(desc.ClientStreams, desc.ServerStreams)
+		done := startClientRequest(serverSlug, serviceName, method, typ)
+
+		stream, err := streamer(ctx, desc, conn, fullMethod, opts...)
+		if err != nil {
+			done(start, err)
+			return nil, err
+		}
+
+		labels := prometheus.Labels{
+			serviceLabel:    serviceName,
+			methodLabel:     method,
+			typeLabel:       typ,
+			clientNameLabel: serverSlug,
+		}
+		s := &prometheusClientStream{
+			ClientStream:  stream,
+			serverStreams: desc.ServerStreams,
+			sent:          clientStreamMessagesSent.With(labels),
+			received:      clientStreamMessagesReceived.With(labels),
+			sentSize:      clientStreamSentMessageSize.With(labels),
+			receivedSize:  clientStreamReceivedMessageSize.With(labels),
+		}
+		s.done = func(err error) {
+			s.once.Do(func() {
+				done(start, err)
+			})
+		}
+		// Streams abandoned by the caller are done when ctx is canceled.
+		s.stop = context.AfterFunc(ctx, func() {
+			s.done(status.FromContextError(ctx.Err()).Err())
+		})
+		return s, nil
+	}
+}
+
+// prometheusClientStream is a grpc.ClientStream recording the metrics of the
+// messages sent and received, and the result of the stream when it's done.
+type prometheusClientStream struct {
+	grpc.ClientStream
+
+	serverStreams bool
+
+	sent, received         prometheus.Counter
+	sentSize, receivedSize prometheus.Observer
+
+	once sync.Once
+	done func(err error)
+	stop func() bool
+}
+
+func (s *prometheusClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		observeMessage(m, s.sent, s.sentSize)
+	}
+	return err
+}
+
+func (s *prometheusClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		observeMessage(m, s.received, s.receivedSize)
+		if !s.serverStreams {
+			s.finish(nil)
+		}
+	case errors.Is(err, io.EOF):
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *prometheusClientStream) finish(err error) {
+	s.stop()
+	s.done(err)
+}
+
+// ClientBaseplateHeadersInterceptorUnary is a client middleware that forwards
+// baseplate headers from the context to the outgoing request metadata, signed
+// with the secret at path in store.
+//
+// Any baseplate headers set in the outgoing metadata by the caller are removed,
+// only the baseplate headers received by the server are forwarded.
+func ClientBaseplateHeadersInterceptorUnary(client string, store SecretsStore, path string) grpc.UnaryClientInterceptor {
+	getSigningSecret := versionedSecretGetter(store, path)
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		ctx, err := forwardBaseplateHeaders(ctx, client, method, getSigningSecret)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// ClientBaseplateHeadersInterceptorStreaming is the streaming version of
+// ClientBaseplateHeadersInterceptorUnary.
+func ClientBaseplateHeadersInterceptorStreaming(client string, store SecretsStore, path string) grpc.StreamClientInterceptor {
+	getSigningSecret := versionedSecretGetter(store, path)
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		ctx, err := forwardBaseplateHeaders(ctx, client, method, getSigningSecret)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func forwardBaseplateHeaders(
+	ctx context.Context,
+	client string,
+	fullMethod string,
+	getSigningSecret func() *secrets.VersionedSecret,
+) (context.Context, error) {
+	service, method := serviceAndMethodSlug(fullMethod)
+	if headerbp.HasSetOutgoingHeaders(ctx, headerbp.WithGRPCClient(service, client, method)) {
+		return ctx, nil
+	}
+
+	signingSecret := getSigningSecret()
+	if signingSecret == nil {
+		return ctx, fmt.Errorf("signing secret is required to use baseplate headers")
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	for k := range md {
+		if headerbp.ShouldRemoveClientHeader(k,
+			headerbp.WithGRPCClient(service, client, method),
+		) {
+			delete(md, k)
+		}
+	}
+
+	signature, hasSignature := headerbp.HeaderSignatureFromContext(ctx)
+	var baseplateHeaders []string
+	ctx = headerbp.SetOutgoingHeaders(
+		ctx,
+		headerbp.WithGRPCClient(service, client, method),
+		headerbp.WithHeaderSetter(func(key, value string) {
+			if !hasSignature {
+				baseplateHeaders = append(baseplateHeaders, key)
+			}
+			md.Set(key, value)
+		}),
+	)
+	if len(baseplateHeaders) > 0 && !hasSignature {
+		_signature, err := headerbp.SignHeaders(ctx, *signingSecret, baseplateHeaders, mdGetter(md))
+		if err != nil {
+			return ctx, fmt.Errorf("signing baseplate headers: %w", err)
+		}
+		signature = _signature
+	}
+	if signature != "" {
+		md.Set(headerbp.SignatureHeaderGRPC, signature)
+	}
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+// ClientErrorInterceptorUnary is a client middleware that wraps the errors with
+// non-OK statuses returned by the server into *ClientError, so they can be
+// checked by retrybp filters.
+func ClientErrorInterceptorUnary() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return NewClientError(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// ClientErrorInterceptorStreaming is the streaming version of
+// ClientErrorInterceptorUnary.
+//
+// io.EOF returned by the stream at the end of the stream is returned as-is.
+func ClientErrorInterceptorStreaming() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, NewClientError(err)
+		}
+		return clientErrorStream{ClientStream: stream}, nil
+	}
+}
+
+// clientErrorStream is a grpc.ClientStream wrapping its errors with
+// NewClientError.
+type clientErrorStream struct {
+	grpc.ClientStream
+}
+
+func (s clientErrorStream) SendMsg(m interface{}) error {
+	return wrapStreamError(s.ClientStream.SendMsg(m))
+}
+
+func (s clientErrorStream) RecvMsg(m interface{}) error {
+	return wrapStreamError(s.ClientStream.RecvMsg(m))
+}
+
+func wrapStreamError(err error) error {
+	if err == nil || errors.Is(err, io.EOF) {
+		return err
+	}
+	return NewClientError(err)
+}
+
+// DefaultMinRetryBudget is the default RetryInterceptorArgs.MinRetryBudget.
+const DefaultMinRetryBudget = 10 * time.Millisecond
+
+// RetryInterceptorArgs are the arguments to be passed into the
+// RetryInterceptorUnary function.
+type RetryInterceptorArgs struct {
+	// The default retry.Options used by retrybp.Do, which can be overridden per
+	// call by retrybp.WithOptions.
+	//
+	// It should not include retry.RetryIf, use Filters instead.
+	//
+	// Optional, default to retry.Attempts(1) (no retries).
+	Options []retry.Option
+
+	// The filters deciding whether an error should be retried.
+	//
+	// Optional, default to DefaultRetryFilters().
+	Filters []retrybp.Filter
+
+	// No retry is attempted when the time left before the deadline of the call
+	// is shorter than MinRetryBudget (see DeadlineBudgetFilter).
+	//
+	// Optional, default to DefaultMinRetryBudget.
+	// Use a negative value to retry until the deadline.
+	MinRetryBudget time.Duration
+}
+
+// RetryInterceptorUnary is a client middleware that retries the requests with
+// retrybp.Do.
+//
+// It's deadline budget aware: as the deadline of the context is propagated to
+// the server on every attempt, it stops retrying when the time left before the
+// deadline is not enough for another attempt (see DeadlineBudgetFilter), in
+// addition to the decisions made by args.Filters.
+//
+// It should be used with ClientErrorInterceptorUnary as a later interceptor in
+// the chain, so the filters can check the *ClientError errors.
+func RetryInterceptorUnary(args RetryInterceptorArgs) grpc.UnaryClientInterceptor {
+	options := args.Options
+	if len(options) == 0 {
+		options = []retry.Option{retry.Attempts(1)}
+	}
+	filters := args.Filters
+	if len(filters) == 0 {
+		filters = DefaultRetryFilters()
+	}
+	minBudget := args.MinRetryBudget
+	if minBudget == 0 {
+		minBudget = DefaultMinRetryBudget
+	}
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		callFilters := make([]retrybp.Filter, 0, len(filters)+1)
+		callFilters = append(callFilters, DeadlineBudgetFilter(ctx, minBudget))
+		callFilters = append(callFilters, filters...)
+		callOptions := make([]retry.Option, 0, len(options)+1)
+		callOptions = append(callOptions, options...)
+		callOptions = append(callOptions, retrybp.Filters(callFilters...))
+		return retrybp.Do(
+			ctx,
+			func() error {
+				return invoker(ctx, method, req, reply, cc, opts...)
+			},
+			callOptions...,
+		)
+	}
+}
+
+// CircuitBreakerInterceptorUnary is a client middleware that handles circuit
+// breaking with the given breaker, usually a breakerbp.FailureRatioBreaker.
+//
+// Only the errors caused by an unhealthy server are counted as failures by the
+// breaker, which are the errors with Unknown, DeadlineExceeded,
+// ResourceExhausted, Internal, Unavailable and DataLoss codes, and the errors
+// without a status (e.g. connection errors). When the breaker is open, the
+// requests fail with gobreaker.ErrOpenState or gobreaker.ErrTooManyRequests,
+// which are retried by retrybp.BreakerErrorFilter.
+func CircuitBreakerInterceptorUnary(cb breakerbp.CircuitBreaker) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		var callErr error
+		_, err := cb.Execute(func() (interface{}, error) {
+			callErr = invoker(ctx, method, req, reply, cc, opts...)
+			if isBreakerFailure(callErr) {
+				return nil, callErr
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+		return callErr
 	}
 }
@@ -3,18 +3,28 @@ package grpcbp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/avast/retry-go"
 	pb "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
 	"github.com/opentracing/opentracing-go"
+	"github.com/sony/gobreaker"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
+	"github.com/reddit/baseplate.go/breakerbp"
+	"github.com/reddit/baseplate.go/ecinterface"
 	"github.com/reddit/baseplate.go/mqsend"
 	"github.com/reddit/baseplate.go/tracing"
+	"github.com/reddit/baseplate.go/transport"
 )
 
 func TestMonitorInterceptorUnary(t *testing.T) {
@@ -167,3 +177,204 @@ func drainRecorder(t *testing.T, recorder *mqsend.MockMessageQueue) []byte {
 	}
 	return msg
 }
+
+// flakyService returns the errors in order from Ping, then succeeds.
+type flakyService struct {
+	pb.TestServiceServer
+
+	errs  []error
+	calls atomic.Int64
+}
+
+func (s *flakyService) Ping(context.Context, *pb.PingRequest) (*pb.PingResponse, error) {
+	if i := int(s.calls.Add(1)) - 1; i < len(s.errs) {
+		return nil, s.errs[i]
+	}
+	return &pb.PingResponse{}, nil
+}
+
+func setupFlakyClient(t *testing.T, service *flakyService, interceptors ...grpc.UnaryClientInterceptor) pb.TestServiceClient {
+	t.Helper()
+
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	pb.RegisterTestServiceServer(s, service)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	return pb.NewTestServiceClient(setupClient(t, l, grpc.WithChainUnaryInterceptor(interceptors...)))
+}
+
+// metadataService records the incoming metadata of the last Ping.
+type metadataService struct {
+	pb.TestServiceServer
+
+	md metadata.MD
+}
+
+func (s *metadataService) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	return &pb.PingResponse{}, nil
+}
+
+func TestRetryInterceptorUnary(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	invalid := status.Error(codes.InvalidArgument, "invalid")
+
+	for _, c := range []struct {
+		name      string
+		errs      []error
+		timeout   time.Duration
+		wantCode  codes.Code
+		wantCalls int64
+	}{
+		{
+			name:      "retried",
+			errs:      []error{unavailable, unavailable},
+			wantCode:  codes.OK,
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts",
+			errs:      []error{unavailable, unavailable, unavailable},
+			wantCode:  codes.Unavailable,
+			wantCalls: 3,
+		},
+		{
+			name:      "not-retryable",
+			errs:      []error{invalid},
+			wantCode:  codes.InvalidArgument,
+			wantCalls: 1,
+		},
+		{
+			name:      "deadline-budget",
+			errs:      []error{unavailable},
+			timeout:   DefaultMinRetryBudget / 2,
+			wantCode:  codes.Unavailable,
+			wantCalls: 1,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			service := &flakyService{errs: c.errs}
+			client := setupFlakyClient(
+				t,
+				service,
+				RetryInterceptorUnary(RetryInterceptorArgs{
+					Options: []retry.Option{retry.Attempts(3)},
+				}),
+				ClientErrorInterceptorUnary(),
+			)
+
+			timeout := c.timeout
+			if timeout == 0 {
+				timeout = time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			_, err := client.Ping(ctx, &pb.PingRequest{})
+			if got := status.Code(err); got != c.wantCode {
+				t.Errorf("Expected code %v, got %v", c.wantCode, err)
+			}
+			if got := service.calls.Load(); got != c.wantCalls {
+				t.Errorf("Expected %d calls, got %d", c.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerInterceptorUnary(t *testing.T) {
+	breaker := breakerbp.NewFailureRatioBreaker(breakerbp.Config{
+		MinRequestsToTrip: 2,
+		FailureThreshold:  0.5,
+		Name:              "grpcbp-test",
+		Timeout:           time.Minute,
+	})
+	service := &flakyService{errs: []error{
+		status.Error(codes.InvalidArgument, "invalid"),
+		status.Error(codes.InvalidArgument, "invalid"),
+		status.Error(codes.Internal, "internal"),
+		status.Error(codes.Internal, "internal"),
+		status.Error(codes.Internal, "internal"),
+	}}
+	client := setupFlakyClient(t, service, CircuitBreakerInterceptorUnary(breaker), ClientErrorInterceptorUnary())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// InvalidArgument is not counted as failures, otherwise the breaker would
+	// be tripped before the second Internal.
+	for i, want := range []codes.Code{
+		codes.InvalidArgument,
+		codes.InvalidArgument,
+		codes.Internal,
+		codes.Internal,
+	} {
+		_, err := client.Ping(ctx, &pb.PingRequest{})
+		if got := status.Code(err); got != want {
+			t.Errorf("#%d: Expected code %v, got %v", i, want, err)
+		}
+	}
+	if _, err := client.Ping(ctx, &pb.PingRequest{}); !errors.Is(err, gobreaker.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gobreaker.ErrOpenState, err)
+	}
+	if got, want := service.calls.Load(), int64(4); got != want {
+		t.Errorf("Expected %d calls, got %d", want, got)
+	}
+}
+
+func TestBaseplateDefaultClientUnaryInterceptors(t *testing.T) {
+	service := &flakyService{errs: []error{
+		status.Error(codes.Unavailable, "unavailable"),
+	}}
+	client := setupFlakyClient(t, service, BaseplateDefaultClientUnaryInterceptors(DefaultClientInterceptorsArgs{
+		ServiceSlug:     "test",
+		EdgeContextImpl: ecinterface.Mock(),
+		RetryOptions:    []retry.Option{retry.Attempts(2)},
+		BreakerConfig: &breakerbp.Config{
+			MinRequestsToTrip: 10,
+			FailureThreshold:  1,
+			Name:              "grpcbp-default-test",
+		},
+	})...)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := client.Ping(ctx, &pb.PingRequest{}); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if got, want := service.calls.Load(), int64(2); got != want {
+		t.Errorf("Expected %d calls, got %d", want, got)
+	}
+}
+
+func TestBaseplateDefaultClientUnaryInterceptorsTracingHeaders(t *testing.T) {
+	ctx, _ := setupServerSpan(t)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	service := &metadataService{}
+	pb.RegisterTestServiceServer(s, service)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	client := pb.NewTestServiceClient(setupClient(t, l, grpc.WithChainUnaryInterceptor(
+		BaseplateDefaultClientUnaryInterceptors(DefaultClientInterceptorsArgs{
+			ServiceSlug:     "test",
+			EdgeContextImpl: ecinterface.Mock(),
+		})...,
+	)))
+
+	if _, err := client.Ping(ctx, &pb.PingRequest{}); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	for _, key := range []string{
+		transport.HeaderTracingTrace,
+		transport.HeaderTracingSpan,
+		transport.HeaderTracingParent,
+		transport.HeaderTracingFlags,
+		transport.HeaderTracingSampled,
+	} {
+		if got := service.md.Get(key); len(got) != 1 {
+			t.Errorf("Expected exactly 1 value for %q, got %q", key, got)
+		}
+	}
+}
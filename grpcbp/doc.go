@@ -6,9 +6,34 @@
 // propagation or initialization as well as forwarding EdgeRequestContext
 // according to the Baseplate specification.
 //
+// BaseplateDefaultClientUnaryInterceptors returns the default unary client
+// interceptors, including RetryInterceptorUnary and
+// CircuitBreakerInterceptorUnary, analogous to
+// thriftbp.BaseplateDefaultClientMiddlewares.
+//
 // # Servers
 //
+// NewBaseplateServer creates a baseplate.Server serving the registered gRPC
+// services with the default interceptors, the Health service and the server
+// reflection service, which can be run by baseplate.Serve.
+// NewTestBaseplateServer serves the same server on an in-memory listener for
+// tests.
+//
 // On the server side, this package provides middleware implementations for
 // EdgeRequestContext handling and tracing propagation according to Baseplate
 // specification.
+//
+// ServerBaseplateHeadersInterceptorUnary and
+// ClientBaseplateHeadersInterceptorUnary (and their streaming versions)
+// propagate the baseplate ("x-bp-") headers from the requests received by the
+// server to the requests sent by its clients, as in httpbp and thriftbp.
+//
+// ErrorMapperInterceptorUnary maps the errors returned by the handlers, e.g.
+// baseplate.Error thrift exceptions and httpbp.HTTPError, into gRPC statuses,
+// and ClientErrorInterceptorUnary wraps them back into *ClientError on the
+// client side to be used by retrybp filters.
+//
+// RegisterHealthService registers a grpc.health.v1 Health service backed by
+// baseplate.HealthChecker, which can be checked by the "grpc" type of the
+// Baseplate healthcheck command.
 package grpcbp
@@ -0,0 +1,455 @@
+package grpcbp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/avast/retry-go"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/reddit/baseplate.go/httpbp"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/retrybp"
+)
+
+// The domains of the errdetails.ErrorInfo details added by BaseplateErrorMapper
+// and HTTPErrorMapper.
+const (
+	ErrorDomainBaseplate = "baseplate.thrift"
+	ErrorDomainHTTP      = "baseplate.http"
+)
+
+// We create this interface instead of using baseplate.Error because we want it
+// to always match regardless of the version of the thrift file the user has put
+// in their repository.
+type baseplateError interface {
+	thrift.TException
+
+	IsSetCode() bool
+	GetCode() int32
+	GetMessage() string
+	GetDetails() map[string]string
+	IsSetRetryable() bool
+	GetRetryable() bool
+}
+
+var (
+	_ baseplateError = (*baseplatethrift.Error)(nil)
+)
+
+// ErrorMapper maps an error returned by a gRPC handler into the status returned
+// to the client.
+//
+// It shall return nil when it cannot make the decision,
+// so the next ErrorMapper in the chain created by ErrorMappers is used.
+type ErrorMapper func(err error) *status.Status
+
+// ErrorMappers returns an ErrorMapper trying the given mappers in order,
+// and returns the first non-nil status.
+func ErrorMappers(mappers ...ErrorMapper) ErrorMapper {
+	return func(err error) *status.Status {
+		for _, m := range mappers {
+			if s := m(err); s != nil {
+				return s
+			}
+		}
+		return nil
+	}
+}
+
+// DefaultErrorMapper is the default ErrorMapper used by the
+// ErrorMapperInterceptors. It's the chain of (in order):
+//
+// 1. StatusErrorMapper
+//
+// 2. ContextErrorMapper
+//
+// 3. BaseplateErrorMapper
+//
+// 4. HTTPErrorMapper
+//
+// Errors not handled by any of them are returned by gRPC with Unknown code.
+func DefaultErrorMapper(err error) *status.Status {
+	return defaultErrorMappers(err)
+}
+
+var defaultErrorMappers = ErrorMappers(
+	StatusErrorMapper,
+	ContextErrorMapper,
+	BaseplateErrorMapper,
+	HTTPErrorMapper,
+)
+
+// StatusErrorMapper returns the status of the errors created by the status
+// package, or any error (wrapped or not) implementing
+// GRPCStatus() *status.Status.
+func StatusErrorMapper(err error) *status.Status {
+	if s, ok := status.FromError(err); ok {
+		return s
+	}
+	return nil
+}
+
+// ContextErrorMapper maps context.Canceled and context.DeadlineExceeded into
+// Canceled and DeadlineExceeded codes.
+func ContextErrorMapper(err error) *status.Status {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	}
+	return nil
+}
+
+// BaseplateErrorMapper maps baseplate.Error thrift exceptions into the code
+// corresponding to their HTTP status code (see HTTPStatusToCode).
+//
+// The message of the status is the message of the error, and the status has an
+// errdetails.ErrorInfo detail with ErrorDomainBaseplate domain, the name of the
+// baseplate.ErrorCode (or the code itself for user defined codes) as reason,
+// and the details of the error as metadata.
+// If the error is retryable, the status also has an errdetails.RetryInfo
+// detail.
+func BaseplateErrorMapper(err error) *status.Status {
+	var bpErr baseplateError
+	if !errors.As(err, &bpErr) || !bpErr.IsSetCode() {
+		return nil
+	}
+	msg := bpErr.GetMessage()
+	if msg == "" {
+		msg = err.Error()
+	}
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Domain:   ErrorDomainBaseplate,
+			Reason:   baseplateReason(bpErr.GetCode()),
+			Metadata: bpErr.GetDetails(),
+		},
+	}
+	if bpErr.IsSetRetryable() && bpErr.GetRetryable() {
+		details = append(details, &errdetails.RetryInfo{})
+	}
+	return newStatus(HTTPStatusToCode(int(bpErr.GetCode())), msg, details...)
+}
+
+// HTTPErrorMapper maps httpbp.HTTPError into the code corresponding to its
+// HTTP status code (see HTTPStatusToCode).
+//
+// If the body of the response is *httpbp.ErrorResponse (as created by
+// httpbp.JSONError, httpbp.HTMLError and httpbp.RawError), the message of the
+// status is its explanation, and the status has an errdetails.ErrorInfo detail
+// with ErrorDomainHTTP domain, its reason, and its details as metadata.
+func HTTPErrorMapper(err error) *status.Status {
+	var httpErr httpbp.HTTPError
+	if !errors.As(err, &httpErr) {
+		return nil
+	}
+	resp := httpErr.Response()
+	code := HTTPStatusToCode(resp.Code)
+	var body *httpbp.ErrorResponse
+	switch b := resp.Body.(type) {
+	case *httpbp.ErrorResponse:
+		body = b
+	case httpbp.ErrorResponseJSONWrapper:
+		body = b.Error
+	}
+	if body == nil {
+		return status.New(code, http.StatusText(resp.Code))
+	}
+	return newStatus(code, body.Explanation, &errdetails.ErrorInfo{
+		Domain:   ErrorDomainHTTP,
+		Reason:   body.Reason,
+		Metadata: body.Details,
+	})
+}
+
+// HTTPStatusToCode returns the gRPC code corresponding to the HTTP status code,
+// used by BaseplateErrorMapper and HTTPErrorMapper.
+//
+// Client errors without a corresponding code are mapped into
+// FailedPrecondition, and server errors into Internal.
+func HTTPStatusToCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden, http.StatusUnavailableForLegalReasons:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusConflict, http.StatusLocked:
+		return codes.Aborted
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusTooEarly, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case 499: // Client closed request.
+		return codes.Canceled
+	}
+	switch {
+	case httpStatus >= 200 && httpStatus < 300:
+		return codes.OK
+	case httpStatus >= 400 && httpStatus < 500:
+		return codes.FailedPrecondition
+	case httpStatus >= 500 && httpStatus < 600:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+func baseplateReason(code int32) string {
+	if _, err := baseplatethrift.ErrorCodeFromString(baseplatethrift.ErrorCode(code).String()); err == nil {
+		return baseplatethrift.ErrorCode(code).String()
+	}
+	return strconv.Itoa(int(code))
+}
+
+func baseplateCode(reason string) (int32, bool) {
+	if code, err := baseplatethrift.ErrorCodeFromString(reason); err == nil {
+		return int32(code), true
+	}
+	code, err := strconv.ParseInt(reason, 10, 32)
+	return int32(code), err == nil
+}
+
+func newStatus(code codes.Code, msg string, details ...protoadapt.MessageV1) *status.Status {
+	s := status.New(code, msg)
+	if len(details) == 0 {
+		return s
+	}
+	withDetails, err := s.WithDetails(details...)
+	if err != nil {
+		// Should not happen as the details are always valid.
+		return s
+	}
+	return withDetails
+}
+
+// ClientError is the error returned by the ClientErrorInterceptors for the
+// non-OK statuses returned by the server, to be used by retrybp filters.
+//
+// It implements retrybp.RetryableError and retrybp.RetryAfterError.
+//
+// It unwraps to context.Canceled and context.DeadlineExceeded for Canceled and
+// DeadlineExceeded codes, and to *baseplate.Error for the statuses created by
+// BaseplateErrorMapper (which can be checked by thriftbp.BaseplateErrorFilter).
+type ClientError struct {
+	Status *status.Status
+}
+
+var (
+	_ retrybp.RetryableError  = (*ClientError)(nil)
+	_ retrybp.RetryAfterError = (*ClientError)(nil)
+)
+
+// NewClientError returns *ClientError for the errors with a non-OK status,
+// or err as-is otherwise.
+func NewClientError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() == codes.OK {
+		return err
+	}
+	return &ClientError{Status: s}
+}
+
+func (e *ClientError) Error() string {
+	return fmt.Sprintf(
+		"grpcbp.ClientError: code = %v desc = %s",
+		e.Status.Code(),
+		e.Status.Message(),
+	)
+}
+
+// GRPCStatus returns the status, so that status.FromError and status.Code work
+// with ClientError.
+func (e *ClientError) GRPCStatus() *status.Status {
+	return e.Status
+}
+
+// Retryable implements retrybp.RetryableError.
+//
+// It returns true (1) on any of the following conditions and no decision (0)
+// otherwise:
+//
+// - The status has an errdetails.RetryInfo detail
+//
+// - The code is Unavailable or ResourceExhausted
+func (e *ClientError) Retryable() int {
+	if e.retryInfo() != nil {
+		return 1
+	}
+	switch e.Status.Code() {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return 1
+	}
+	return 0
+}
+
+// RetryAfterDuration implements retrybp.RetryAfterError.
+//
+// It returns the retry delay of the errdetails.RetryInfo detail, if any.
+func (e *ClientError) RetryAfterDuration() time.Duration {
+	if info := e.retryInfo(); info != nil {
+		return info.GetRetryDelay().AsDuration()
+	}
+	return 0
+}
+
+// Unwrap returns the error corresponding to the status, if any.
+func (e *ClientError) Unwrap() error {
+	switch e.Status.Code() {
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	}
+	for _, d := range e.Status.Details() {
+		info, ok := d.(*errdetails.ErrorInfo)
+		if !ok || info.GetDomain() != ErrorDomainBaseplate {
+			continue
+		}
+		code, ok := baseplateCode(info.GetReason())
+		if !ok {
+			continue
+		}
+		bpErr := &baseplatethrift.Error{
+			Code:    thrift.Int32Ptr(code),
+			Message: thrift.StringPtr(e.Status.Message()),
+			Details: info.GetMetadata(),
+		}
+		if e.retryInfo() != nil {
+			bpErr.Retryable = thrift.BoolPtr(true)
+		}
+		return bpErr
+	}
+	return nil
+}
+
+func (e *ClientError) retryInfo() *errdetails.RetryInfo {
+	for _, d := range e.Status.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
+
+// NewRetryInfo returns an errdetails.RetryInfo detail with the given delay,
+// to be added to a status via status.WithDetails to tell the clients that the
+// request may be retried after the delay.
+func NewRetryInfo(delay time.Duration) *errdetails.RetryInfo {
+	return &errdetails.RetryInfo{
+		RetryDelay: durationpb.New(delay),
+	}
+}
+
+// WithDefaultRetryableCodes returns a list including the given codes and the
+// default retryable codes:
+//
+// 1. Unavailable
+//
+// 2. ResourceExhausted
+func WithDefaultRetryableCodes(c ...codes.Code) []codes.Code {
+	return append([]codes.Code{
+		codes.Unavailable,
+		codes.ResourceExhausted,
+	}, c...)
+}
+
+// StatusCodeFilter returns true if the given error has a gRPC status with one
+// of the given codes and false if it has a status with other codes, otherwise
+// it calls the next filter in the chain.
+func StatusCodeFilter(c ...codes.Code) retrybp.Filter {
+	codeMap := make(map[codes.Code]bool, len(c))
+	for _, code := range c {
+		codeMap[code] = true
+	}
+	return func(err error, next retry.RetryIfFunc) bool {
+		if s, ok := status.FromError(err); ok {
+			return codeMap[s.Code()]
+		}
+		return next(err)
+	}
+}
+
+// DeadlineBudgetFilter returns false if ctx has a deadline, and the time left
+// before the deadline is shorter than minBudget, or the RetryAfterDuration of
+// the error if it implements retrybp.RetryAfterError and it's longer,
+// otherwise it calls the next filter in the chain.
+//
+// It's used by RetryInterceptorUnary to avoid retries that are bound to fail
+// with DeadlineExceeded.
+func DeadlineBudgetFilter(ctx context.Context, minBudget time.Duration) retrybp.Filter {
+	return func(err error, next retry.RetryIfFunc) bool {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return next(err)
+		}
+		budget := minBudget
+		var raErr retrybp.RetryAfterError
+		if errors.As(err, &raErr) && raErr.RetryAfterDuration() > budget {
+			budget = raErr.RetryAfterDuration()
+		}
+		if time.Until(deadline) < budget {
+			return false
+		}
+		return next(err)
+	}
+}
+
+// DefaultRetryFilters returns the default retrybp.Filters used by
+// RetryInterceptorUnary, which are (in order):
+//
+// 1. retrybp.RetryableErrorFilter
+//
+// 2. retrybp.ContextErrorFilter
+//
+// 3. retrybp.BreakerErrorFilter
+//
+// 4. StatusCodeFilter(WithDefaultRetryableCodes()...)
+func DefaultRetryFilters() []retrybp.Filter {
+	return []retrybp.Filter{
+		retrybp.RetryableErrorFilter,
+		retrybp.ContextErrorFilter,
+		retrybp.BreakerErrorFilter,
+		StatusCodeFilter(WithDefaultRetryableCodes()...),
+	}
+}
+
+// isBreakerFailure reports whether err shall be counted as a failure by
+// CircuitBreakerInterceptorUnary.
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		// Not a status returned by the server, e.g. a connection error.
+		return !errors.Is(err, context.Canceled)
+	}
+	switch s.Code() {
+	case codes.Unknown,
+		codes.DeadlineExceeded,
+		codes.ResourceExhausted,
+		codes.Internal,
+		codes.Unavailable,
+		codes.DataLoss:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package grpcbp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	pb "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/reddit/baseplate.go"
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/httpbp"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+)
+
+type errorService struct {
+	pb.TestServiceServer
+
+	err error
+}
+
+func (s *errorService) Ping(context.Context, *pb.PingRequest) (*pb.PingResponse, error) {
+	return nil, s.err
+}
+
+func TestErrorMapping(t *testing.T) {
+	service := &errorService{}
+	_, lis, err := NewTestBaseplateServer(ServerArgs{
+		Baseplate: baseplate.NewTestBaseplate(baseplate.NewTestBaseplateArgs{
+			EdgeContextImpl: ecinterface.Mock(),
+		}),
+		RegisterServices: func(s *grpc.Server) {
+			pb.RegisterTestServiceServer(s, service)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestBaseplateServer: %v", err)
+	}
+	conn, err := NewTestClientConn(lis, grpc.WithUnaryInterceptor(ClientErrorInterceptorUnary()))
+	if err != nil {
+		t.Fatalf("NewTestClientConn: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	client := pb.NewTestServiceClient(conn)
+
+	retryStatus, _ := status.New(codes.Unavailable, "later").WithDetails(NewRetryInfo(time.Second))
+
+	for _, c := range []struct {
+		name       string
+		err        error
+		code       codes.Code
+		message    string
+		retryable  int
+		retryAfter time.Duration
+		unwrap     error
+		baseplate  *baseplatethrift.Error
+	}{
+		{
+			name: "baseplate",
+			err: fmt.Errorf("wrapped: %w", &baseplatethrift.Error{
+				Code:      thrift.Int32Ptr(int32(baseplatethrift.ErrorCode_TOO_MANY_REQUESTS)),
+				Message:   thrift.StringPtr("slow down"),
+				Retryable: thrift.BoolPtr(true),
+				Details:   map[string]string{"foo": "bar"},
+			}),
+			code:      codes.ResourceExhausted,
+			message:   "slow down",
+			retryable: 1,
+			baseplate: &baseplatethrift.Error{
+				Code:      thrift.Int32Ptr(int32(baseplatethrift.ErrorCode_TOO_MANY_REQUESTS)),
+				Message:   thrift.StringPtr("slow down"),
+				Retryable: thrift.BoolPtr(true),
+				Details:   map[string]string{"foo": "bar"},
+			},
+		},
+		{
+			name: "baseplate-user-defined",
+			err: &baseplatethrift.Error{
+				Code:    thrift.Int32Ptr(1001),
+				Message: thrift.StringPtr("custom"),
+			},
+			code:    codes.Unknown,
+			message: "custom",
+			baseplate: &baseplatethrift.Error{
+				Code:    thrift.Int32Ptr(1001),
+				Message: thrift.StringPtr("custom"),
+			},
+		},
+		{
+			name: "http",
+			err: httpbp.JSONError(
+				httpbp.NotFound().WithDetails(map[string]string{"id": "missing"}),
+				errors.New("not found"),
+			),
+			code:    codes.NotFound,
+			message: httpbp.NotFound().Explanation,
+		},
+		{
+			name:    "deadline",
+			err:     fmt.Errorf("wrapped: %w", context.DeadlineExceeded),
+			code:    codes.DeadlineExceeded,
+			message: "wrapped: context deadline exceeded",
+			unwrap:  context.DeadlineExceeded,
+		},
+		{
+			name:       "status",
+			err:        retryStatus.Err(),
+			code:       codes.Unavailable,
+			message:    "later",
+			retryable:  1,
+			retryAfter: time.Second,
+		},
+		{
+			name:    "unknown",
+			err:     errors.New("oops"),
+			code:    codes.Unknown,
+			message: "oops",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			service.err = c.err
+			_, err := client.Ping(context.Background(), &pb.PingRequest{})
+			var ce *ClientError
+			if !errors.As(err, &ce) {
+				t.Fatalf("Expected *ClientError, got %v", err)
+			}
+			if got := status.Code(err); got != c.code {
+				t.Errorf("Expected code %v, got %v", c.code, got)
+			}
+			if got := ce.Status.Message(); got != c.message {
+				t.Errorf("Expected message %q, got %q", c.message, got)
+			}
+			if got := ce.Retryable(); got != c.retryable {
+				t.Errorf("Expected Retryable %d, got %d", c.retryable, got)
+			}
+			if got := ce.RetryAfterDuration(); got != c.retryAfter {
+				t.Errorf("Expected RetryAfterDuration %v, got %v", c.retryAfter, got)
+			}
+			if c.unwrap != nil && !errors.Is(err, c.unwrap) {
+				t.Errorf("Expected error to wrap %v, got %v", c.unwrap, err)
+			}
+			var bpErr *baseplatethrift.Error
+			if errors.As(err, &bpErr) != (c.baseplate != nil) {
+				t.Fatalf("Expected baseplate error %v, got %v", c.baseplate, bpErr)
+			}
+			if c.baseplate != nil {
+				if bpErr.GetCode() != c.baseplate.GetCode() ||
+					bpErr.GetMessage() != c.baseplate.GetMessage() ||
+					bpErr.GetRetryable() != c.baseplate.GetRetryable() ||
+					!maps.Equal(bpErr.GetDetails(), c.baseplate.GetDetails()) {
+					t.Errorf("Expected baseplate error %v, got %v", c.baseplate, bpErr)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPStatusToCode(t *testing.T) {
+	for status, code := range map[int]codes.Code{
+		200:  codes.OK,
+		400:  codes.InvalidArgument,
+		401:  codes.Unauthenticated,
+		403:  codes.PermissionDenied,
+		404:  codes.NotFound,
+		409:  codes.Aborted,
+		418:  codes.FailedPrecondition,
+		429:  codes.ResourceExhausted,
+		500:  codes.Internal,
+		503:  codes.Unavailable,
+		504:  codes.DeadlineExceeded,
+		1000: codes.Unknown,
+	} {
+		if got := HTTPStatusToCode(status); got != code {
+			t.Errorf("HTTPStatusToCode(%d) expected %v, got %v", status, code, got)
+		}
+	}
+}
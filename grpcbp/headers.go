@@ -2,10 +2,13 @@ package grpcbp
 
 import (
 	"context"
+	"log/slog"
+	"strings"
 
 	"google.golang.org/grpc/metadata"
 
 	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/secrets"
 	"github.com/reddit/baseplate.go/transport"
 )
 
@@ -40,3 +43,73 @@ func GetHeader(md metadata.MD, key string) (string, bool) {
 	}
 	return "", false
 }
+
+// grpcUserAgentPrefix is the prefix of the user agent token grpc-go appends to
+// the "user-agent" header of every request.
+const grpcUserAgentPrefix = "grpc-go/"
+
+// CallerFromMetadata returns the calling service of the request, which is the
+// "User-Agent" (transport.HeaderUserAgent) header set by the client via
+// grpc.WithUserAgent.
+//
+// The user agent token appended by grpc-go itself (e.g. "grpc-go/1.64.0") is
+// not a calling service, so it's removed, and a request only carrying it has no
+// caller.
+func CallerFromMetadata(md metadata.MD) (string, bool) {
+	ua, _ := GetHeader(md, transport.HeaderUserAgent)
+	fields := strings.Fields(ua)
+	callers := fields[:0]
+	for _, f := range fields {
+		if !strings.HasPrefix(f, grpcUserAgentPrefix) {
+			callers = append(callers, f)
+		}
+	}
+	caller := strings.Join(callers, " ")
+	return caller, caller != ""
+}
+
+// mdGetter returns the getter of the first values of the metadata, used to
+// sign and verify baseplate headers.
+func mdGetter(md metadata.MD) func(string) string {
+	return func(key string) string {
+		value, _ := GetHeader(md, key)
+		return value
+	}
+}
+
+type untrustedHeadersKey struct{}
+
+func setUntrustedHeaders(ctx context.Context, h map[string]string) context.Context {
+	return context.WithValue(ctx, untrustedHeadersKey{}, h)
+}
+
+// GetUntrustedBaseplateHeaders returns the baseplate headers removed from an
+// untrusted request by the ServerBaseplateHeadersInterceptor.
+func GetUntrustedBaseplateHeaders(ctx context.Context) (map[string]string, bool) {
+	h, ok := ctx.Value(untrustedHeadersKey{}).(map[string]string)
+	return h, ok
+}
+
+// SecretsStore is the minimum interface required for the
+// ServerBaseplateHeadersInterceptor and ClientBaseplateHeadersInterceptor.
+//
+// *secrets.Store fulfills this interface but an interface is used so that a
+// service using v2 secrets can still use these interceptors if needed through
+// an interop library.
+type SecretsStore interface {
+	GetVersionedSecret(path string) (secrets.VersionedSecret, error)
+}
+
+func versionedSecretGetter(store SecretsStore, path string) func() *secrets.VersionedSecret {
+	return func() *secrets.VersionedSecret {
+		secret, err := store.GetVersionedSecret(path)
+		if err != nil {
+			slog.Error(
+				"Failed to get secret",
+				"path", path,
+				"err", err,
+			)
+		}
+		return &secret
+	}
+}
@@ -0,0 +1,32 @@
+package grpcbp
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/reddit/baseplate.go/transport"
+)
+
+func TestCallerFromMetadata(t *testing.T) {
+	for _, c := range []struct {
+		ua     string
+		caller string
+	}{
+		{ua: "", caller: ""},
+		{ua: "grpc-go/1.64.0", caller: ""},
+		{ua: "caller grpc-go/1.64.0", caller: "caller"},
+		{ua: "caller", caller: "caller"},
+	} {
+		t.Run(c.ua, func(t *testing.T) {
+			md := metadata.MD{}
+			if c.ua != "" {
+				md = metadata.Pairs(transport.HeaderUserAgent, c.ua)
+			}
+			caller, ok := CallerFromMetadata(md)
+			if caller != c.caller || ok != (c.caller != "") {
+				t.Errorf("CallerFromMetadata(%q) got (%q, %v), want %q", c.ua, caller, ok, c.caller)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package grpcbp
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/reddit/baseplate.go"
+)
+
+// The grpc.health.v1 service names mapped to Baseplate health check probes.
+//
+// They are used by the "grpc" checker of the healthcheck command
+// (cmd/lib/healthcheck) for the corresponding probes.
+// The empty service name reports the overall health of the server,
+// same as HealthServiceReadiness.
+const (
+	HealthServiceReadiness = "readiness"
+	HealthServiceLiveness  = "liveness"
+	HealthServiceStartup   = "startup"
+)
+
+// DefaultHealthWatchInterval is the default value of
+// HealthServiceArgs.WatchInterval.
+const DefaultHealthWatchInterval = 5 * time.Second
+
+// HealthServiceArgs defines the args used by RegisterHealthService.
+type HealthServiceArgs struct {
+	// Checker reports the readiness and the overall health of the server.
+	//
+	// Required.
+	Checker baseplate.HealthChecker
+
+	// Liveness reports the liveness of the server.
+	//
+	// Optional. If it's nil, the server is always reported as alive as long as
+	// it's able to respond to the health check.
+	Liveness baseplate.HealthChecker
+
+	// Startup reports whether the server finished starting up.
+	//
+	// Optional. If it's nil, Checker will be used instead.
+	Startup baseplate.HealthChecker
+
+	// WatchInterval is the interval to poll the checkers for Watch requests.
+	//
+	// Optional. If it's <= 0, DefaultHealthWatchInterval will be used instead.
+	WatchInterval time.Duration
+}
+
+// RegisterHealthService registers a grpc.health.v1 Health service backed by
+// baseplate.HealthChecker into the server.
+//
+// The service names are mapped to the checkers as:
+//
+// - "" (the overall health) and HealthServiceReadiness: args.Checker
+//
+// - HealthServiceLiveness: args.Liveness
+//
+// - HealthServiceStartup: args.Startup
+//
+// Checking other service names fails with NotFound code.
+func RegisterHealthService(s grpc.ServiceRegistrar, args HealthServiceArgs) {
+	healthpb.RegisterHealthServer(s, newHealthService(args))
+}
+
+type healthService struct {
+	healthpb.UnimplementedHealthServer
+
+	checkers map[string]baseplate.HealthChecker
+	interval time.Duration
+}
+
+func newHealthService(args HealthServiceArgs) *healthService {
+	startup := args.Startup
+	if startup == nil {
+		startup = args.Checker
+	}
+	liveness := args.Liveness
+	if liveness == nil {
+		liveness = alwaysHealthy{}
+	}
+	interval := args.WatchInterval
+	if interval <= 0 {
+		interval = DefaultHealthWatchInterval
+	}
+	return &healthService{
+		checkers: map[string]baseplate.HealthChecker{
+			"":                     args.Checker,
+			HealthServiceReadiness: args.Checker,
+			HealthServiceLiveness:  liveness,
+			HealthServiceStartup:   startup,
+		},
+		interval: interval,
+	}
+}
+
+func (hs *healthService) status(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, bool) {
+	checker, ok := hs.checkers[service]
+	if !ok {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, false
+	}
+	if checker.IsHealthy(ctx) {
+		return healthpb.HealthCheckResponse_SERVING, true
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING, true
+}
+
+// Check implements healthpb.HealthServer.
+func (hs *healthService) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s, ok := hs.status(ctx, req.GetService())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+	return &healthpb.HealthCheckResponse{Status: s}, nil
+}
+
+// List implements healthpb.HealthServer.
+func (hs *healthService) List(ctx context.Context, _ *healthpb.HealthListRequest) (*healthpb.HealthListResponse, error) {
+	resp := &healthpb.HealthListResponse{
+		Statuses: make(map[string]*healthpb.HealthCheckResponse, len(hs.checkers)),
+	}
+	for service := range hs.checkers {
+		s, _ := hs.status(ctx, service)
+		resp.Statuses[service] = &healthpb.HealthCheckResponse{Status: s}
+	}
+	return resp, nil
+}
+
+// Watch implements healthpb.HealthServer.
+//
+// The checkers are polled every WatchInterval,
+// and the status is sent to the client whenever it changes.
+func (hs *healthService) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(hs.interval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	for {
+		// Per grpc.health.v1 spec, unknown services are reported as
+		// SERVICE_UNKNOWN in Watch instead of failing the call.
+		s, _ := hs.status(ctx, req.GetService())
+		if s != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: s}); err != nil {
+				return err
+			}
+			last = s
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type alwaysHealthy struct{}
+
+func (alwaysHealthy) IsHealthy(context.Context) bool {
+	return true
+}
@@ -0,0 +1,101 @@
+package grpcbp
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeChecker struct {
+	healthy atomic.Bool
+}
+
+func (c *fakeChecker) IsHealthy(context.Context) bool {
+	return c.healthy.Load()
+}
+
+func setupHealthClient(t *testing.T, args HealthServiceArgs) healthpb.HealthClient {
+	t.Helper()
+
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	RegisterHealthService(s, args)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	return healthpb.NewHealthClient(setupClient(t, l))
+}
+
+func TestHealthServiceCheck(t *testing.T) {
+	readiness := &fakeChecker{}
+	startup := &fakeChecker{}
+	startup.healthy.Store(true)
+	client := setupHealthClient(t, HealthServiceArgs{
+		Checker: readiness,
+		Startup: startup,
+	})
+
+	for _, c := range []struct {
+		service  string
+		expected healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{service: "", expected: healthpb.HealthCheckResponse_NOT_SERVING},
+		{service: HealthServiceReadiness, expected: healthpb.HealthCheckResponse_NOT_SERVING},
+		{service: HealthServiceLiveness, expected: healthpb.HealthCheckResponse_SERVING},
+		{service: HealthServiceStartup, expected: healthpb.HealthCheckResponse_SERVING},
+	} {
+		t.Run(c.service, func(t *testing.T) {
+			resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: c.service})
+			if err != nil {
+				t.Fatalf("Check returned error: %v", err)
+			}
+			if resp.GetStatus() != c.expected {
+				t.Errorf("Expected status %v, got %v", c.expected, resp.GetStatus())
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "foo"})
+		if code := status.Code(err); code != codes.NotFound {
+			t.Errorf("Expected code %v, got %v (%v)", codes.NotFound, code, err)
+		}
+	})
+}
+
+func TestHealthServiceWatch(t *testing.T) {
+	checker := &fakeChecker{}
+	client := setupHealthClient(t, HealthServiceArgs{
+		Checker:       checker,
+		WatchInterval: time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: HealthServiceReadiness})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected initial status NOT_SERVING, got %v", resp.GetStatus())
+	}
+
+	checker.healthy.Store(true)
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected status SERVING after change, got %v", resp.GetStatus())
+	}
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
 
 	"github.com/reddit/baseplate.go/internal/prometheusbpint"
 	"github.com/reddit/baseplate.go/prometheusbp"
@@ -23,8 +25,36 @@ const (
 	unary        = "unary"
 	clientStream = "client_stream"
 	serverStream = "server_stream"
+	bidiStream   = "bidi_stream"
 )
 
+// streamType returns the grpc_type label value of a stream.
+func streamType(isClientStream, isServerStream bool) string {
+	switch {
+	case isClientStream && isServerStream:
+		return bidiStream
+	case isClientStream:
+		return clientStream
+	case isServerStream:
+		return serverStream
+	}
+	return unary
+}
+
+var messageSizeBuckets = []float64{
+	100,       // 100 B
+	500,       // 500 B
+	1 << 10,   // 1 KiB
+	4 << 10,   // 4 KiB
+	10 << 10,  // 10 KiB
+	50 << 10,  // 50 KiB
+	100 << 10, // 100 KiB
+	500 << 10, // 500 KiB
+	1 << 20,   // 1 MiB
+	5 << 20,   // 5 MiB
+	10 << 20,  // 10 MiB
+}
+
 var (
 	serverLatencyLabels = []string{
 		serviceLabel,
@@ -63,6 +93,36 @@ var (
 	}, serverActiveRequestsLabels)
 )
 
+var (
+	serverStreamMessagesLabels = []string{
+		serviceLabel,
+		methodLabel,
+		typeLabel,
+	}
+
+	serverStreamMessagesSent = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_stream_messages_sent_total",
+		Help: "Total number of stream messages sent by the server",
+	}, serverStreamMessagesLabels)
+
+	serverStreamMessagesReceived = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_stream_messages_received_total",
+		Help: "Total number of stream messages received by the server",
+	}, serverStreamMessagesLabels)
+
+	serverStreamSentMessageSize = promauto.With(prometheusbpint.GlobalRegistry).NewHistogramVec(prometheusbp.HistogramOpts{
+		Name:          "grpc_server_stream_sent_message_size_bytes",
+		Help:          "Size of the stream messages sent by the server",
+		LegacyBuckets: messageSizeBuckets,
+	}.ToPrometheus(), serverStreamMessagesLabels)
+
+	serverStreamReceivedMessageSize = promauto.With(prometheusbpint.GlobalRegistry).NewHistogramVec(prometheusbp.HistogramOpts{
+		Name:          "grpc_server_stream_received_message_size_bytes",
+		Help:          "Size of the stream messages received by the server",
+		LegacyBuckets: messageSizeBuckets,
+	}.ToPrometheus(), serverStreamMessagesLabels)
+)
+
 var (
 	clientLatencyLabels = []string{
 		serviceLabel,
@@ -104,6 +164,49 @@ var (
 	}, clientActiveRequestsLabels)
 )
 
+var (
+	clientStreamMessagesLabels = []string{
+		serviceLabel,
+		methodLabel,
+		typeLabel,
+		clientNameLabel,
+	}
+
+	clientStreamMessagesSent = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_stream_messages_sent_total",
+		Help: "Total number of stream messages sent by the client",
+	}, clientStreamMessagesLabels)
+
+	clientStreamMessagesReceived = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_stream_messages_received_total",
+		Help: "Total number of stream messages received by the client",
+	}, clientStreamMessagesLabels)
+
+	clientStreamSentMessageSize = promauto.With(prometheusbpint.GlobalRegistry).NewHistogramVec(prometheusbp.HistogramOpts{
+		Name:          "grpc_client_stream_sent_message_size_bytes",
+		Help:          "Size of the stream messages sent by the client",
+		LegacyBuckets: messageSizeBuckets,
+	}.ToPrometheus(), clientStreamMessagesLabels)
+
+	clientStreamReceivedMessageSize = promauto.With(prometheusbpint.GlobalRegistry).NewHistogramVec(prometheusbp.HistogramOpts{
+		Name:          "grpc_client_stream_received_message_size_bytes",
+		Help:          "Size of the stream messages received by the client",
+		LegacyBuckets: messageSizeBuckets,
+	}.ToPrometheus(), clientStreamMessagesLabels)
+)
+
+var (
+	panicRecoverLabels = []string{
+		serviceLabel,
+		methodLabel,
+	}
+
+	panicRecoverCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "grpcbp_server_recovered_panics_total",
+		Help: "The number of panics recovered from grpc server handlers",
+	}, panicRecoverLabels)
+)
+
 // serviceAndMethodSlug splits the UnaryServerInfo.FullMethod and returns
 // the package.service part separate from the method part.
 // ref: https://pkg.go.dev/google.golang.org/grpc#UnaryServerInfo
@@ -115,3 +218,14 @@ func serviceAndMethodSlug(fullMethod string) (service, method string) {
 	}
 	return split[0], split[1]
 }
+
+// messageSize returns the size of the encoded protobuf message.
+func messageSize(msg interface{}) (int, bool) {
+	switch m := msg.(type) {
+	case proto.Message:
+		return proto.Size(m), true
+	case protoadapt.MessageV1:
+		return proto.Size(protoadapt.MessageV2Of(m)), true
+	}
+	return 0, false
+}
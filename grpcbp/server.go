@@ -0,0 +1,383 @@
+package grpcbp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/reddit/baseplate.go"
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/tracing"
+)
+
+// DefaultStopTimeout is the timeout of the graceful stop of the server when
+// baseplate.Config.StopTimeout is not set, same as the one used by
+// baseplate.Serve.
+const DefaultStopTimeout = 30 * time.Second
+
+// DefaultServerInterceptorsArgs defines the args used by
+// DefaultServerUnaryInterceptors and DefaultServerStreamInterceptors.
+type DefaultServerInterceptorsArgs struct {
+	// The edge context implementation. Optional.
+	//
+	// If it's not set, the global one from ecinterface.Get will be used instead.
+	EdgeContextImpl ecinterface.Interface
+
+	// The Propagator used to extract the span headers from the request
+	// metadata. Optional.
+	//
+	// If it's not set, BaseplatePropagator will be used.
+	Propagator tracing.Propagator
+
+	// The store and the path of the secret used to verify the signature of the
+	// baseplate headers.
+	//
+	// The baseplate headers interceptor is only added when both are set.
+	SecretsStore           SecretsStore
+	HeaderbpSigningKeyPath string
+
+	// The ErrorMapper used to map the errors returned by the handlers into
+	// statuses. Optional.
+	//
+	// If it's not set, DefaultErrorMapper will be used.
+	ErrorMapper ErrorMapper
+}
+
+// DefaultServerUnaryInterceptors returns the default unary server interceptors
+// that should be used by a baseplate gRPC service.
+//
+// Currently they are (in order):
+//
+// 1. InjectServerSpanInterceptorUnaryWithArgs
+//
+// 2. InjectLogCorrelationInterceptorUnary
+//
+// 3. InjectEdgeContextInterceptorUnary
+//
+// 4. InjectPrometheusUnaryServerInterceptor
+//
+// 5. ErrorMapperInterceptorUnary
+//
+// 6. ServerBaseplateHeadersInterceptorUnary (only when both SecretsStore and
+// HeaderbpSigningKeyPath are set)
+//
+// Panic recovery is not included, as NewBaseplateServer always adds it as the
+// last interceptor.
+func DefaultServerUnaryInterceptors(args DefaultServerInterceptorsArgs) []grpc.UnaryServerInterceptor {
+	interceptors := []grpc.UnaryServerInterceptor{
+		InjectServerSpanInterceptorUnaryWithArgs(InjectServerSpanInterceptorArgs{
+			Propagator: args.Propagator,
+		}),
+		InjectLogCorrelationInterceptorUnary(),
+		InjectEdgeContextInterceptorUnary(args.EdgeContextImpl),
+		InjectPrometheusUnaryServerInterceptor(),
+		ErrorMapperInterceptorUnary(args.ErrorMapper),
+	}
+	if args.SecretsStore != nil && args.HeaderbpSigningKeyPath != "" {
+		interceptors = append(interceptors, ServerBaseplateHeadersInterceptorUnary(args.SecretsStore, args.HeaderbpSigningKeyPath))
+	}
+	return interceptors
+}
+
+// DefaultServerStreamInterceptors returns the default stream server
+// interceptors that should be used by a baseplate gRPC service.
+//
+// Currently they are (in order):
+//
+// 1. InjectServerSpanInterceptorStreamingWithArgs
+//
+// 2. InjectLogCorrelationInterceptorStreaming
+//
+// 3. InjectEdgeContextInterceptorStreaming
+//
+// 4. InjectPrometheusStreamServerInterceptor
+//
+// 5. ErrorMapperInterceptorStreaming
+//
+// 6. ServerBaseplateHeadersInterceptorStreaming (only when both SecretsStore
+// and HeaderbpSigningKeyPath are set)
+//
+// Panic recovery is not included, as NewBaseplateServer always adds it as the
+// last interceptor.
+func DefaultServerStreamInterceptors(args DefaultServerInterceptorsArgs) []grpc.StreamServerInterceptor {
+	interceptors := []grpc.StreamServerInterceptor{
+		InjectServerSpanInterceptorStreamingWithArgs(InjectServerSpanInterceptorArgs{
+			Propagator: args.Propagator,
+		}),
+		InjectLogCorrelationInterceptorStreaming(),
+		InjectEdgeContextInterceptorStreaming(args.EdgeContextImpl),
+		InjectPrometheusStreamServerInterceptor(""),
+		ErrorMapperInterceptorStreaming(args.ErrorMapper),
+	}
+	if args.SecretsStore != nil && args.HeaderbpSigningKeyPath != "" {
+		interceptors = append(interceptors, ServerBaseplateHeadersInterceptorStreaming(args.SecretsStore, args.HeaderbpSigningKeyPath))
+	}
+	return interceptors
+}
+
+// ServerArgs defines all of the arguments used to create a new gRPC Baseplate
+// server.
+type ServerArgs struct {
+	// Baseplate is a required argument to NewBaseplateServer and must be
+	// non-nil.
+	//
+	// The server listens on the Addr of its config, and uses its edge context
+	// implementation and secrets store.
+	Baseplate baseplate.Baseplate
+
+	// RegisterServices is required, it's called to register the gRPC services
+	// to the server, e.g.:
+	//
+	//     RegisterServices: func(s *grpc.Server) {
+	//         pb.RegisterMyServiceServer(s, myService)
+	//     },
+	RegisterServices func(s *grpc.Server)
+
+	// UnaryInterceptors and StreamInterceptors are optional, additional
+	// interceptors in addition to (and after) the default ones.
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
+
+	// ServerOptions are optional, additional options used to create the
+	// *grpc.Server, e.g. the credentials or the max message sizes.
+	ServerOptions []grpc.ServerOption
+
+	// Propagator is an optional Propagator used to extract the span headers from
+	// the request metadata.
+	//
+	// Defaults to BaseplatePropagator.
+	Propagator tracing.Propagator
+
+	// ErrorMapper is an optional ErrorMapper used to map the errors returned by
+	// the handlers into statuses.
+	//
+	// Defaults to DefaultErrorMapper.
+	ErrorMapper ErrorMapper
+
+	// HeaderbpSigningKeyPath is the optional path of the secret used to verify
+	// the signature of the baseplate headers in the secrets store of Baseplate.
+	//
+	// If it's not set, the baseplate headers are not propagated.
+	HeaderbpSigningKeyPath string
+
+	// Health defines the grpc.health.v1 Health service registered to the
+	// server.
+	//
+	// If Health.Checker is nil, the server is always reported as healthy as long
+	// as it's able to respond to the health check.
+	Health HealthServiceArgs
+
+	// DisableReflection disables the registration of the server reflection
+	// service.
+	DisableReflection bool
+}
+
+// ValidateAndSetDefaults checks the ServerArgs for any errors and sets any
+// default values.
+//
+// ValidateAndSetDefaults does not generally need to be called manually but can
+// be used for testing purposes. It is called as a part of setting up a new
+// Baseplate server.
+func (args ServerArgs) ValidateAndSetDefaults() (ServerArgs, error) {
+	var errs []error
+	if args.Baseplate == nil {
+		errs = append(errs, errors.New("argument Baseplate must be non-nil"))
+	}
+	if args.RegisterServices == nil {
+		errs = append(errs, errors.New("argument RegisterServices must be non-nil"))
+	}
+	if args.Health.Checker == nil {
+		args.Health.Checker = alwaysHealthy{}
+	}
+	return args, errors.Join(errs...)
+}
+
+// NewServer calls ValidateAndSetDefaults and returns a *grpc.Server with the
+// default interceptors, the additional interceptors and options, and all the
+// services registered.
+//
+// NewServer does not generally need to be called manually, use
+// NewBaseplateServer instead.
+func (args ServerArgs) NewServer() (*grpc.Server, error) {
+	args, err := args.ValidateAndSetDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultArgs := DefaultServerInterceptorsArgs{
+		EdgeContextImpl:        args.Baseplate.EdgeContextImpl(),
+		Propagator:             args.Propagator,
+		HeaderbpSigningKeyPath: args.HeaderbpSigningKeyPath,
+		ErrorMapper:            args.ErrorMapper,
+	}
+	if store := args.Baseplate.Secrets(); store != nil {
+		defaultArgs.SecretsStore = store
+	}
+	unary := DefaultServerUnaryInterceptors(defaultArgs)
+	unary = append(unary, args.UnaryInterceptors...)
+	// Always inject the panic recovery as the final interceptor in the chain.
+	// This allows it to capture any panics before other interceptors return and
+	// bubble up the panic as an error to those interceptors.
+	unary = append(unary, RecoverPanicInterceptorUnary())
+	stream := DefaultServerStreamInterceptors(defaultArgs)
+	stream = append(stream, args.StreamInterceptors...)
+	stream = append(stream, RecoverPanicInterceptorStreaming())
+
+	opts := make([]grpc.ServerOption, 0, len(args.ServerOptions)+2)
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	opts = append(opts, args.ServerOptions...)
+	srv := grpc.NewServer(opts...)
+
+	args.RegisterServices(srv)
+	RegisterHealthService(srv, args.Health)
+	if !args.DisableReflection {
+		reflection.Register(srv)
+	}
+	return srv, nil
+}
+
+// NewBaseplateServer returns a new gRPC implementation of a Baseplate server
+// with the given ServerArgs.
+//
+// The services are wrapped with the default interceptors as well as any
+// additional interceptors passed in. In addition, panics will be automatically
+// recovered from, reported, and returned to the client with Internal code.
+//
+// Close stops the server gracefully, waiting for the pending RPCs to finish for
+// up to the StopTimeout of the Baseplate config (DefaultStopTimeout if not set,
+// or forever if negative) before stopping the server forcefully.
+func NewBaseplateServer(args ServerArgs) (baseplate.Server, error) {
+	srv, err := args.NewServer()
+	if err != nil {
+		return nil, err
+	}
+	return &server{bp: args.Baseplate, srv: srv}, nil
+}
+
+type server struct {
+	bp  baseplate.Baseplate
+	srv *grpc.Server
+}
+
+func (s *server) Baseplate() baseplate.Baseplate {
+	return s.bp
+}
+
+func (s *server) Serve() error {
+	lis, err := net.Listen("tcp", s.bp.GetConfig().Addr)
+	if err != nil {
+		return fmt.Errorf("grpcbp: failed to listen: %w", err)
+	}
+	// Serve returns nil after GracefulStop and Stop.
+	return s.srv.Serve(lis)
+}
+
+func (s *server) Close() error {
+	return gracefulStop(s.srv, s.bp.GetConfig().StopTimeout)
+}
+
+// gracefulStop stops srv gracefully, or forcefully after timeout.
+func gracefulStop(srv *grpc.Server, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = DefaultStopTimeout
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.GracefulStop()
+	}()
+	if timeout < 0 {
+		<-done
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		srv.Stop()
+		<-done
+		return fmt.Errorf("grpcbp: graceful stop timed out after %v, stopped forcefully", timeout)
+	}
+}
+
+// DefaultTestBufferSize is the buffer size of the bufconn.Listener used by
+// NewTestBaseplateServer.
+const DefaultTestBufferSize = 1024 * 1024
+
+// NewTestBaseplateServer returns a new gRPC implementation of a Baseplate
+// server with the given ServerArgs that serves on an in-memory
+// bufconn.Listener rather than a real network address.
+//
+// The server is started when the test Baseplate server is created and does not
+// need to be started manually. Serve does not need to be called but will wait
+// until Close is called to exit if it is called.
+//
+// Use NewTestClientConn to create a client connected to the server.
+func NewTestBaseplateServer(args ServerArgs) (baseplate.Server, *bufconn.Listener, error) {
+	srv, err := args.NewServer()
+	if err != nil {
+		return nil, nil, err
+	}
+	lis := bufconn.Listen(DefaultTestBufferSize)
+	ts := &testServer{
+		bp:   args.Baseplate,
+		srv:  srv,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(ts.done)
+		ts.err = srv.Serve(lis)
+	}()
+	return ts, lis, nil
+}
+
+type testServer struct {
+	bp   baseplate.Baseplate
+	srv  *grpc.Server
+	done chan struct{}
+	err  error
+}
+
+func (s *testServer) Baseplate() baseplate.Baseplate {
+	return s.bp
+}
+
+func (s *testServer) Serve() error {
+	<-s.done
+	return s.err
+}
+
+func (s *testServer) Close() error {
+	err := gracefulStop(s.srv, s.bp.GetConfig().StopTimeout)
+	<-s.done
+	return err
+}
+
+// NewTestClientConn creates a *grpc.ClientConn connected to the
+// bufconn.Listener returned by NewTestBaseplateServer.
+//
+// opts are appended to the dialer and insecure transport credentials options
+// required by the connection.
+func NewTestClientConn(lis *bufconn.Listener, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	// passthrough:// is required, as NewClient defaults to the dns resolver.
+	return grpc.NewClient("passthrough://bufnet", opts...)
+}
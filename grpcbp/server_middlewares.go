@@ -2,18 +2,21 @@ package grpcbp
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/headerbp"
 	"github.com/reddit/baseplate.go/log"
 	"github.com/reddit/baseplate.go/prometheusbp"
+	"github.com/reddit/baseplate.go/secrets"
 	"github.com/reddit/baseplate.go/tracing"
 	"github.com/reddit/baseplate.go/transport"
 )
@@ -24,10 +27,31 @@ import (
 // If "User-Agent" (transport.HeaderUserAgent) header is set, the created
 // server span will also have "peer.service" (tracing.TagKeyPeerService) tag
 // set to its value.
+//
+// Only the Baseplate span headers are used,
+// use InjectServerSpanInterceptorUnaryWithArgs to support other header formats.
 func InjectServerSpanInterceptorUnary() grpc.UnaryServerInterceptor {
+	return InjectServerSpanInterceptorUnaryWithArgs(InjectServerSpanInterceptorArgs{})
+}
+
+// InjectServerSpanInterceptorArgs are the args to be passed into
+// InjectServerSpanInterceptorUnaryWithArgs.
+type InjectServerSpanInterceptorArgs struct {
+	// The Propagator used to extract the span headers from the request
+	// metadata, usually created by tracing.NewPropagators with
+	// BaseplatePropagator.
+	//
+	// If empty, BaseplatePropagator will be used.
+	Propagator tracing.Propagator
+}
+
+// InjectServerSpanInterceptorUnaryWithArgs is the same as
+// InjectServerSpanInterceptorUnary,
+// except that it allows the span header formats to be selected.
+func InjectServerSpanInterceptorUnaryWithArgs(args InjectServerSpanInterceptorArgs) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
 		m := methodSlug(info.FullMethod)
-		ctx, span := StartSpanFromGRPCContext(ctx, m)
+		ctx, span := StartSpanFromGRPCContextWithPropagator(ctx, m, args.Propagator)
 
 		if md, ok := metadata.FromIncomingContext(ctx); ok {
 			if value, ok := GetHeader(md, transport.HeaderTracingTrace); ok {
@@ -52,13 +76,84 @@ func InjectServerSpanInterceptorUnary() grpc.UnaryServerInterceptor {
 // server span will also have "peer.service" (tracing.TagKeyPeerService) tag
 // set to its value.
 //
-// This is not implemented yet.
+// Only the Baseplate span headers are used,
+// use InjectServerSpanInterceptorStreamingWithArgs to support other header
+// formats.
 func InjectServerSpanInterceptorStreaming() grpc.StreamServerInterceptor {
+	return InjectServerSpanInterceptorStreamingWithArgs(InjectServerSpanInterceptorArgs{})
+}
+
+// InjectServerSpanInterceptorStreamingWithArgs is the same as
+// InjectServerSpanInterceptorStreaming,
+// except that it allows the span header formats to be selected.
+func InjectServerSpanInterceptorStreamingWithArgs(args InjectServerSpanInterceptorArgs) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		m := methodSlug(info.FullMethod)
+		ctx, span := StartSpanFromGRPCContextWithPropagator(stream.Context(), m, args.Propagator)
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if value, ok := GetHeader(md, transport.HeaderUserAgent); ok {
+				span.SetTag(tracing.TagKeyPeerService, value)
+			}
+		}
+
+		defer func() {
+			span.FinishWithOptions(tracing.FinishOptions{
+				Ctx: ctx,
+				Err: err,
+			}.Convert())
+		}()
+		return handler(srv, contextServerStream{
+			ServerStream: stream,
+			ctx:          ctx,
+		})
+	}
+}
+
+// InjectLogCorrelationInterceptorUnary is a server middleware that attaches
+// log.CorrelationFields into the `next` context,
+// so that the logs of the request (via log.C and slog) carry the trace and
+// span ids of the server span, the method name and the caller (see
+// CallerFromMetadata).
+//
+// It should be used after InjectServerSpanInterceptorUnary.
+func InjectLogCorrelationInterceptorUnary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+		ctx = attachLogCorrelation(ctx, info.FullMethod)
+		return handler(ctx, req)
+	}
+}
+
+// InjectLogCorrelationInterceptorStreaming is the streaming version of
+// InjectLogCorrelationInterceptorUnary.
+func InjectLogCorrelationInterceptorStreaming() grpc.StreamServerInterceptor {
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		return errors.New("InjectServerSpanInterceptorStreaming: not implemented")
+		return handler(srv, contextServerStream{
+			ServerStream: stream,
+			ctx:          attachLogCorrelation(stream.Context(), info.FullMethod),
+		})
 	}
 }
 
+func attachLogCorrelation(ctx context.Context, fullMethod string) context.Context {
+	var caller string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		caller, _ = CallerFromMetadata(md)
+	}
+	return tracing.AttachLogCorrelation(ctx, methodSlug(fullMethod), caller)
+}
+
+// contextServerStream is a grpc.ServerStream with its context replaced.
+type contextServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (s contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
 // InjectEdgeContextInterceptorUnary is a server middleware that injects an
 // edge request context created from the gRPC headers set on the context.
 func InjectEdgeContextInterceptorUnary(impl ecinterface.Interface) grpc.UnaryServerInterceptor {
@@ -73,11 +168,15 @@ func InjectEdgeContextInterceptorUnary(impl ecinterface.Interface) grpc.UnarySer
 
 // InjectEdgeContextInterceptorStreaming is a server middleware that injects an
 // edge request context created from the gRPC headers set on the context.
-//
-// This is not implemented yet.
 func InjectEdgeContextInterceptorStreaming(impl ecinterface.Interface) grpc.StreamServerInterceptor {
+	if impl == nil {
+		impl = ecinterface.Get()
+	}
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		return errors.New("InjectEdgeContextInterceptorStreaming: not implemented")
+		return handler(srv, contextServerStream{
+			ServerStream: stream,
+			ctx:          InitializeEdgeContext(stream.Context(), impl),
+		})
 	}
 }
 
@@ -122,29 +221,20 @@ func InitializeEdgeContext(ctx context.Context, impl ecinterface.Interface) cont
 // called with a non-nil logger. Absent tracing related headers are always
 // silently ignored.
 func StartSpanFromGRPCContext(ctx context.Context, name string) (context.Context, *tracing.Span) {
-	var (
-		headers tracing.Headers
-		sampled bool
-	)
-
-	md, _ := metadata.FromIncomingContext(ctx)
-	if value, ok := GetHeader(md, transport.HeaderTracingTrace); ok {
-		headers.TraceID = value
-	}
-
-	if value, ok := GetHeader(md, transport.HeaderTracingSpan); ok {
-		headers.SpanID = value
-	}
-
-	if value, ok := GetHeader(md, transport.HeaderTracingFlags); ok {
-		headers.Flags = value
-	}
+	return StartSpanFromGRPCContextWithPropagator(ctx, name, BaseplatePropagator{})
+}
 
-	if value, ok := GetHeader(md, transport.HeaderTracingSampled); ok {
-		sampled = value == transport.HeaderTracingSampled
-		headers.Sampled = &sampled
+// StartSpanFromGRPCContextWithPropagator is the same as
+// StartSpanFromGRPCContext,
+// except that the span headers are extracted by the given propagator.
+//
+// If propagator is nil, BaseplatePropagator will be used.
+func StartSpanFromGRPCContextWithPropagator(ctx context.Context, name string, propagator tracing.Propagator) (context.Context, *tracing.Span) {
+	if propagator == nil {
+		propagator = BaseplatePropagator{}
 	}
-
+	md, _ := metadata.FromIncomingContext(ctx)
+	headers, _ := propagator.Extract(metadataCarrier(md))
 	return tracing.StartSpanFromHeaders(ctx, name, headers)
 }
 
@@ -170,49 +260,288 @@ func StartSpanFromGRPCContext(ctx context.Context, name string) (context.Context
 func InjectPrometheusUnaryServerInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
 		start := time.Now()
+		serviceName, method := serviceAndMethodSlug(info.FullMethod)
+		done := startServerRequest(serviceName, method, unary)
+		defer func() {
+			done(start, err)
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// startServerRequest increases the grpc_server_active_requests gauge, and
+// returns the function to be called when the request is done to record the
+// result.
+func startServerRequest(serviceName, method, typ string) func(start time.Time, err error) {
+	activeRequestLabels := prometheus.Labels{
+		serviceLabel: serviceName,
+		typeLabel:    typ,
+		methodLabel:  method,
+	}
+	serverActiveRequests.With(activeRequestLabels).Inc()
+
+	return func(start time.Time, err error) {
+		success := prometheusbp.BoolString(err == nil)
+		status, _ := status.FromError(err)
+
+		latencyLabels := prometheus.Labels{
+			serviceLabel: serviceName,
+			methodLabel:  method,
+			typeLabel:    typ,
+			successLabel: success,
+		}
+		serverLatencyDistribution.With(latencyLabels).Observe(time.Since(start).Seconds())
 
+		totalRequestLabels := prometheus.Labels{
+			serviceLabel: serviceName,
+			methodLabel:  method,
+			typeLabel:    typ,
+			successLabel: success,
+			codeLabel:    status.Code().String(),
+		}
+		serverTotalRequests.With(totalRequestLabels).Inc()
+		serverActiveRequests.With(activeRequestLabels).Dec()
+	}
+}
+
+// InjectPrometheusStreamServerInterceptor is a server middleware that tracks
+// Prometheus metrics for streaming RPCs.
+//
+// It emits the same metrics as InjectPrometheusUnaryServerInterceptor, with
+// grpc_type being one of client_stream, server_stream and bidi_stream, so
+// grpc_server_active_requests is the number of active streams, and
+// grpc_server_latency_seconds is the duration of the streams. In addition, it
+// emits the following metrics for the messages of the streams, with
+// grpc_service, grpc_method and grpc_type labels:
+//
+// * grpc_server_stream_messages_sent_total counter
+//
+// * grpc_server_stream_messages_received_total counter
+//
+// * grpc_server_stream_sent_message_size_bytes histogram
+//
+// * grpc_server_stream_received_message_size_bytes histogram
+//
+// serverSlug is not used, as the server metrics don't have the client name
+// label.
+func InjectPrometheusStreamServerInterceptor(serverSlug string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
 		serviceName, method := serviceAndMethodSlug(info.FullMethod)
+		typ := streamType(info.IsClientStream, info.IsServerStream)
+		done := startServerRequest(serviceName, method, typ)
+		defer func() {
+			done(start, err)
+		}()
 
-		activeRequestLabels := prometheus.Labels{
+		labels := prometheus.Labels{
 			serviceLabel: serviceName,
-			typeLabel:    unary,
 			methodLabel:  method,
+			typeLabel:    typ,
+		}
+		return handler(srv, prometheusServerStream{
+			ServerStream: stream,
+			sent:         serverStreamMessagesSent.With(labels),
+			received:     serverStreamMessagesReceived.With(labels),
+			sentSize:     serverStreamSentMessageSize.With(labels),
+			receivedSize: serverStreamReceivedMessageSize.With(labels),
+		})
+	}
+}
+
+// prometheusServerStream is a grpc.ServerStream recording the metrics of the
+// messages sent and received.
+type prometheusServerStream struct {
+	grpc.ServerStream
+
+	sent, received         prometheus.Counter
+	sentSize, receivedSize prometheus.Observer
+}
+
+func (s prometheusServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		observeMessage(m, s.sent, s.sentSize)
+	}
+	return err
+}
+
+func (s prometheusServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		observeMessage(m, s.received, s.receivedSize)
+	}
+	return err
+}
+
+func observeMessage(m interface{}, counter prometheus.Counter, size prometheus.Observer) {
+	counter.Inc()
+	if n, ok := messageSize(m); ok {
+		size.Observe(float64(n))
+	}
+}
+
+// ServerBaseplateHeadersInterceptorUnary is a server middleware that extracts
+// baseplate headers from the incoming request metadata and adds them to the
+// context to be forwarded by ClientBaseplateHeadersInterceptorUnary.
+//
+// The headers are only trusted when they are signed with the secret at path
+// in store. If the request is untrusted, the baseplate headers are removed from
+// the incoming metadata and added to the context instead, where they can be
+// retrieved using GetUntrustedBaseplateHeaders.
+func ServerBaseplateHeadersInterceptorUnary(store SecretsStore, path string) grpc.UnaryServerInterceptor {
+	getVerificationSecret := versionedSecretGetter(store, path)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+		ctx = extractBaseplateHeaders(ctx, info.FullMethod, getVerificationSecret())
+		return handler(ctx, req)
+	}
+}
+
+// ServerBaseplateHeadersInterceptorStreaming is the streaming version of
+// ServerBaseplateHeadersInterceptorUnary.
+func ServerBaseplateHeadersInterceptorStreaming(store SecretsStore, path string) grpc.StreamServerInterceptor {
+	getVerificationSecret := versionedSecretGetter(store, path)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, contextServerStream{
+			ServerStream: stream,
+			ctx:          extractBaseplateHeaders(stream.Context(), info.FullMethod, getVerificationSecret()),
+		})
+	}
+}
+
+func extractBaseplateHeaders(ctx context.Context, fullMethod string, verificationSecret *secrets.VersionedSecret) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var bpHeaderNames []string
+	for k := range md {
+		if headerbp.IsBaseplateHeader(k) {
+			bpHeaderNames = append(bpHeaderNames, k)
+		}
+	}
+
+	var trusted bool
+	if sig, ok := GetHeader(md, headerbp.SignatureHeaderGRPC); ok && verificationSecret != nil && len(bpHeaderNames) > 0 {
+		_ctx, err := headerbp.VerifyHeaders(ctx, *verificationSecret, sig, bpHeaderNames, mdGetter(md))
+		if err == nil {
+			trusted = true
+			ctx = _ctx
+		}
+	}
+	if !trusted {
+		untrusted := make(map[string]string)
+		if len(bpHeaderNames) > 0 {
+			md = md.Copy()
+			for _, k := range bpHeaderNames {
+				if v, ok := GetHeader(md, k); ok {
+					untrusted[k] = v
+				}
+				md.Delete(k)
+			}
+			ctx = metadata.NewIncomingContext(ctx, md)
+		}
+		return setUntrustedHeaders(ctx, untrusted)
+	}
+
+	service, method := serviceAndMethodSlug(fullMethod)
+	headers := headerbp.NewIncomingHeaders(
+		headerbp.WithGRPCService(service, method),
+	)
+	for _, k := range bpHeaderNames {
+		if v, ok := GetHeader(md, k); ok {
+			headers.RecordHeader(k, v)
 		}
-		serverActiveRequests.With(activeRequestLabels).Inc()
+	}
+	return headers.SetOnContext(ctx)
+}
 
+// RecoverPanicInterceptorUnary is a server middleware that recovers from any
+// panics, reports them to Sentry, records a metric indicating that the method
+// recovered from a panic, and returns an error with Internal code instead.
+//
+// The returned error only carries a generic message,
+// the panic itself is only logged and reported to Sentry.
+//
+// It's always added as the last interceptor by NewBaseplateServer, so it is the
+// first one when returning which lets the error bubble up into other
+// interceptors.
+func RecoverPanicInterceptorUnary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
 		defer func() {
-			success := prometheusbp.BoolString(err == nil)
-			status, _ := status.FromError(err)
-
-			latencyLabels := prometheus.Labels{
-				serviceLabel: serviceName,
-				methodLabel:  method,
-				typeLabel:    unary,
-				successLabel: success,
+			if r := recover(); r != nil {
+				err = recoveredPanicError(ctx, info.FullMethod, r)
 			}
-			serverLatencyDistribution.With(latencyLabels).Observe(time.Since(start).Seconds())
-
-			totalRequestLabels := prometheus.Labels{
-				serviceLabel: serviceName,
-				methodLabel:  method,
-				typeLabel:    unary,
-				successLabel: success,
-				codeLabel:    status.Code().String(),
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// RecoverPanicInterceptorStreaming is the streaming version of
+// RecoverPanicInterceptorUnary.
+func RecoverPanicInterceptorStreaming() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoveredPanicError(stream.Context(), info.FullMethod, r)
 			}
-			serverTotalRequests.With(totalRequestLabels).Inc()
-			serverActiveRequests.With(activeRequestLabels).Dec()
 		}()
+		return handler(srv, stream)
+	}
+}
 
-		return handler(ctx, req)
+func recoveredPanicError(ctx context.Context, fullMethod string, r interface{}) error {
+	var rErr error
+	if asErr, ok := r.(error); ok {
+		rErr = asErr
+	} else {
+		rErr = fmt.Errorf("panic in %q: %+v", fullMethod, r)
 	}
+	service, method := serviceAndMethodSlug(fullMethod)
+	log.ErrorWithSentry(
+		ctx,
+		"recovered from panic:",
+		rErr,
+		"grpc_service", service,
+		"grpc_method", method,
+	)
+	panicRecoverCounter.With(prometheus.Labels{
+		serviceLabel: service,
+		methodLabel:  method,
+	}).Inc()
+	return status.Error(codes.Internal, "internal error")
 }
 
-// InjectPrometheusStreamServerInterceptor is a server middleware that tracks
-// Prometheus metrics.
+// ErrorMapperInterceptorUnary is a server middleware that maps the errors
+// returned by the handlers into statuses via mapper.
 //
-// This is not implemented yet.
-func InjectPrometheusStreamServerInterceptor(serverSlug string) grpc.StreamServerInterceptor {
-	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
-		return errors.New("InjectPrometheusStreamServerInterceptor: not implemented")
+// If mapper is nil, DefaultErrorMapper will be used.
+// Errors the mapper returns nil for are returned as-is.
+func ErrorMapperInterceptorUnary(mapper ErrorMapper) grpc.UnaryServerInterceptor {
+	if mapper == nil {
+		mapper = DefaultErrorMapper
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, mapError(mapper, err)
+	}
+}
+
+// ErrorMapperInterceptorStreaming is the streaming version of
+// ErrorMapperInterceptorUnary.
+func ErrorMapperInterceptorStreaming(mapper ErrorMapper) grpc.StreamServerInterceptor {
+	if mapper == nil {
+		mapper = DefaultErrorMapper
+	}
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return mapError(mapper, handler(srv, stream))
+	}
+}
+
+func mapError(mapper ErrorMapper, err error) error {
+	if err == nil {
+		return nil
+	}
+	if s := mapper(err); s != nil {
+		return s.Err()
 	}
+	return err
 }
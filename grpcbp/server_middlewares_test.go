@@ -4,19 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
 	"testing"
 	"time"
 
 	pb "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/headerbp"
 	"github.com/reddit/baseplate.go/internal/prometheusbpint/spectest"
+	"github.com/reddit/baseplate.go/log"
 	"github.com/reddit/baseplate.go/mqsend"
 	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+	"github.com/reddit/baseplate.go/secrets"
 	"github.com/reddit/baseplate.go/tracing"
 	"github.com/reddit/baseplate.go/transport"
 )
@@ -95,6 +104,37 @@ func TestInjectServerSpanInterceptorUnary(t *testing.T) {
 	})
 }
 
+func TestInjectLogCorrelationInterceptorUnary(t *testing.T) {
+	ctx, span := tracing.StartTopLevelServerSpan(context.Background(), "test")
+	defer span.Stop(ctx, nil)
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(transport.HeaderUserAgent, "caller grpc-go/1.64.0"))
+
+	var got log.CorrelationFields
+	interceptor := InjectLogCorrelationInterceptorUnary()
+	_, err := interceptor(
+		ctx,
+		nil,
+		&grpc.UnaryServerInfo{FullMethod: "/test.Service/Ping"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			got, _ = log.CorrelationFromContext(ctx)
+			return nil, nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := log.CorrelationFields{
+		TraceID:  span.TraceID(),
+		SpanID:   span.ID(),
+		Endpoint: "Ping",
+		Caller:   "caller",
+	}
+	if got != want {
+		t.Errorf("Got correlation fields %+v, want %+v", got, want)
+	}
+}
+
 func TestInjectEdgeContextInterceptorUnary(t *testing.T) {
 	impl := ecinterface.Mock()
 
@@ -180,7 +220,8 @@ func (t *mockService) PingEmpty(ctx context.Context, req *pb.Empty) (*pb.PingRes
 }
 
 func (t *mockService) PingList(req *pb.PingRequest, c pb.TestService_PingListServer) error {
-	panic("not implemented")
+	t.ctx = c.Context()
+	return c.Send(&pb.PingResponse{})
 }
 func (t *mockService) PingStream(c pb.TestService_PingStreamServer) error {
 	panic("not implemented")
@@ -309,3 +350,394 @@ func TestInjectPrometheusUnaryServerClientInterceptor(t *testing.T) {
 		})
 	}
 }
+
+type streamService struct {
+	pb.TestServiceServer
+}
+
+func (s *streamService) PingList(req *pb.PingRequest, c pb.TestService_PingListServer) error {
+	for i := 0; i < 3; i++ {
+		if err := c.Send(&pb.PingResponse{Value: req.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *streamService) PingStream(c pb.TestService_PingStreamServer) error {
+	for {
+		req, err := c.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.Send(&pb.PingResponse{Value: req.Value}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestInjectPrometheusStreamServerClientInterceptor(t *testing.T) {
+	const (
+		serviceName = "mwitkow.testproto.TestService"
+		serverSlug  = "example-preference-server"
+	)
+
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(grpc.StreamInterceptor(InjectPrometheusStreamServerInterceptor(serverSlug)))
+	pb.RegisterTestServiceServer(s, &streamService{})
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	client := pb.NewTestServiceClient(setupClient(t, l, grpc.WithStreamInterceptor(
+		PrometheusStreamClientInterceptor(serverSlug),
+	)))
+
+	testCases := []struct {
+		name     string
+		method   string
+		typ      string
+		sent     int
+		received int
+		call     func(ctx context.Context) error
+	}{
+		{
+			name:     "server-stream",
+			method:   "PingList",
+			typ:      serverStream,
+			sent:     1,
+			received: 3,
+			call: func(ctx context.Context) error {
+				stream, err := client.PingList(ctx, &pb.PingRequest{Value: "foo"})
+				if err != nil {
+					return err
+				}
+				for {
+					if _, err := stream.Recv(); errors.Is(err, io.EOF) {
+						return nil
+					} else if err != nil {
+						return err
+					}
+				}
+			},
+		},
+		{
+			name:     "bidi-stream",
+			method:   "PingStream",
+			typ:      bidiStream,
+			sent:     2,
+			received: 2,
+			call: func(ctx context.Context) error {
+				stream, err := client.PingStream(ctx)
+				if err != nil {
+					return err
+				}
+				for i := 0; i < 2; i++ {
+					if err := stream.Send(&pb.PingRequest{Value: "foo"}); err != nil {
+						return err
+					}
+					if _, err := stream.Recv(); err != nil {
+						return err
+					}
+				}
+				if err := stream.CloseSend(); err != nil {
+					return err
+				}
+				if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+					return fmt.Errorf("expected io.EOF, got %w", err)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			serverLabels := prometheus.Labels{
+				serviceLabel: serviceName,
+				methodLabel:  tt.method,
+				typeLabel:    tt.typ,
+			}
+			clientLabels := maps.Clone(serverLabels)
+			clientLabels[clientNameLabel] = serverSlug
+			withResult := func(labels prometheus.Labels, code bool) prometheus.Labels {
+				labels = maps.Clone(labels)
+				labels[successLabel] = "true"
+				if code {
+					labels[codeLabel] = "OK"
+				}
+				return labels
+			}
+
+			defer promtest.NewPrometheusMetricTest(t, "server latency", serverLatencyDistribution, withResult(serverLabels, false)).CheckSampleCountDelta(1)
+			defer promtest.NewPrometheusMetricTest(t, "server rpc count", serverTotalRequests, withResult(serverLabels, true)).CheckDelta(1)
+			defer promtest.NewPrometheusMetricTest(t, "server active requests", serverActiveRequests, serverLabels).CheckDelta(0)
+			defer promtest.NewPrometheusMetricTest(t, "server sent", serverStreamMessagesSent, serverLabels).CheckDelta(float64(tt.received))
+			defer promtest.NewPrometheusMetricTest(t, "server received", serverStreamMessagesReceived, serverLabels).CheckDelta(float64(tt.sent))
+			defer promtest.NewPrometheusMetricTest(t, "server sent size", serverStreamSentMessageSize, serverLabels).CheckSampleCountDelta(tt.received)
+			defer promtest.NewPrometheusMetricTest(t, "server received size", serverStreamReceivedMessageSize, serverLabels).CheckSampleCountDelta(tt.sent)
+			defer promtest.NewPrometheusMetricTest(t, "client latency", clientLatencyDistribution, withResult(clientLabels, false)).CheckSampleCountDelta(1)
+			defer promtest.NewPrometheusMetricTest(t, "client rpc count", clientTotalRequests, withResult(clientLabels, true)).CheckDelta(1)
+			defer promtest.NewPrometheusMetricTest(t, "client active requests", clientActiveRequests, clientLabels).CheckDelta(0)
+			defer promtest.NewPrometheusMetricTest(t, "client sent", clientStreamMessagesSent, clientLabels).CheckDelta(float64(tt.sent))
+			defer promtest.NewPrometheusMetricTest(t, "client received", clientStreamMessagesReceived, clientLabels).CheckDelta(float64(tt.received))
+			defer promtest.NewPrometheusMetricTest(t, "client sent size", clientStreamSentMessageSize, clientLabels).CheckSampleCountDelta(tt.sent)
+			defer promtest.NewPrometheusMetricTest(t, "client received size", clientStreamReceivedMessageSize, clientLabels).CheckSampleCountDelta(tt.received)
+			defer spectest.ValidateSpec(t, "grpc", "server")
+			defer spectest.ValidateSpec(t, "grpc", "client")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := tt.call(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestPrometheusStreamClientInterceptorCanceled(t *testing.T) {
+	const serverSlug = "example-preference-server"
+
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	pb.RegisterTestServiceServer(s, &streamService{})
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	client := pb.NewTestServiceClient(setupClient(t, l, grpc.WithStreamInterceptor(
+		PrometheusStreamClientInterceptor(serverSlug),
+	)))
+
+	labels := prometheus.Labels{
+		serviceLabel:    "mwitkow.testproto.TestService",
+		methodLabel:     "PingStream",
+		typeLabel:       bidiStream,
+		clientNameLabel: serverSlug,
+	}
+	totalLabels := maps.Clone(labels)
+	totalLabels[successLabel] = "false"
+	totalLabels[codeLabel] = codes.Canceled.String()
+	activeTest := promtest.NewPrometheusMetricTest(t, "client active requests", clientActiveRequests, labels)
+	totalTest := promtest.NewPrometheusMetricTest(t, "client rpc count", clientTotalRequests, totalLabels)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := client.PingStream(ctx); err != nil {
+		t.Fatalf("PingStream: %v", err)
+	}
+	activeTest.CheckDelta(1)
+
+	// The abandoned stream is done when ctx is canceled.
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	activeTest.CheckDelta(0)
+	totalTest.CheckDelta(1)
+}
+
+func TestTracePropagation(t *testing.T) {
+	for _, format := range []tracing.PropagationFormat{
+		tracing.PropagationFormatBaseplate,
+		tracing.PropagationFormatW3C,
+		tracing.PropagationFormatB3,
+		tracing.PropagationFormatB3Multi,
+	} {
+		t.Run(string(format), func(t *testing.T) {
+			propagator, err := tracing.NewPropagators(BaseplatePropagator{}, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l, service := setupServer(t, grpc.UnaryInterceptor(
+				InjectServerSpanInterceptorUnaryWithArgs(InjectServerSpanInterceptorArgs{
+					Propagator: propagator,
+				}),
+			))
+			conn := setupClient(t, l, grpc.WithUnaryInterceptor(
+				MonitorInterceptorUnary(MonitorInterceptorArgs{
+					ServiceSlug: "test",
+					Propagator:  propagator,
+				}),
+			))
+			client := pb.NewTestServiceClient(conn)
+
+			initTracing(t)
+			ctx, parent := tracing.StartTopLevelServerSpan(context.Background(), "parent")
+			parent.SetDebug(true)
+			if _, err := client.Ping(ctx, &pb.PingRequest{}); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+
+			span := opentracing.SpanFromContext(service.ctx)
+			if span == nil {
+				t.Fatal("no span in server context")
+			}
+			got := tracing.AsSpan(span)
+			// The parent uses 64-bit decimal ids, which are converted to hex by the
+			// non-baseplate formats.
+			id, err := strconv.ParseUint(parent.TraceID(), 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := map[tracing.PropagationFormat]string{
+				tracing.PropagationFormatBaseplate: parent.TraceID(),
+				tracing.PropagationFormatW3C:       fmt.Sprintf("%032x", id),
+				tracing.PropagationFormatB3:        fmt.Sprintf("%016x", id),
+				tracing.PropagationFormatB3Multi:   fmt.Sprintf("%016x", id),
+			}[format]
+			if got.TraceID() != expected {
+				t.Errorf("Expected trace id %q, got %q", expected, got.TraceID())
+			}
+			if !got.Sampled() {
+				t.Error("Expected the server span to be sampled")
+			}
+			if got.ParentID() == "" {
+				t.Error("Expected the server span to have a parent")
+			}
+		})
+	}
+}
+
+const headerbpSecretPath = "secret/baseplate/headerbp/signature-key"
+
+func newHeaderbpSecretsStore(t *testing.T) *secrets.Store {
+	t.Helper()
+	store, _, err := secrets.NewTestSecrets(context.Background(), map[string]secrets.GenericSecret{
+		headerbpSecretPath: {
+			Type:     secrets.VersionedType,
+			Current:  "dGVzdA==", // test
+			Encoding: secrets.Base64Encoding,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create test secrets: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store
+}
+
+// forwardedHeaders returns the baseplate headers that would be forwarded by
+// the client middlewares with ctx.
+func forwardedHeaders(ctx context.Context) map[string]string {
+	headers := make(map[string]string)
+	headerbp.SetOutgoingHeaders(ctx, headerbp.WithHeaderSetter(func(k, v string) {
+		headers[k] = v
+	}))
+	return headers
+}
+
+func TestBaseplateHeadersInterceptors(t *testing.T) {
+	store := newHeaderbpSecretsStore(t)
+	secret, err := store.GetVersionedSecret(headerbpSecretPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(t *testing.T, md metadata.MD) {
+		t.Helper()
+		var names []string
+		for k := range md {
+			names = append(names, k)
+		}
+		sig, err := headerbp.SignHeaders(context.Background(), secret, names, func(k string) string {
+			v, _ := GetHeader(md, k)
+			return v
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		md.Set(headerbp.SignatureHeaderGRPC, sig)
+	}
+	expected := map[string]string{
+		"x-bp-from-edge": "true",
+		"x-bp-test":      "foo",
+	}
+
+	l, service := setupServer(
+		t,
+		grpc.UnaryInterceptor(ServerBaseplateHeadersInterceptorUnary(store, headerbpSecretPath)),
+		grpc.StreamInterceptor(ServerBaseplateHeadersInterceptorStreaming(store, headerbpSecretPath)),
+	)
+	client := pb.NewTestServiceClient(setupClient(t, l))
+	forwardingClient := pb.NewTestServiceClient(setupClient(
+		t,
+		l,
+		grpc.WithUnaryInterceptor(ClientBaseplateHeadersInterceptorUnary("test", store, headerbpSecretPath)),
+		grpc.WithStreamInterceptor(ClientBaseplateHeadersInterceptorStreaming("test", store, headerbpSecretPath)),
+	))
+
+	t.Run("trusted", func(t *testing.T) {
+		md := metadata.New(expected)
+		sign(t, md)
+		if _, err := client.Ping(metadata.NewOutgoingContext(context.Background(), md), &pb.PingRequest{}); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+		if got := forwardedHeaders(service.ctx); !maps.Equal(got, expected) {
+			t.Errorf("Expected headers %v, got %v", expected, got)
+		}
+		if _, ok := headerbp.HeaderSignatureFromContext(service.ctx); !ok {
+			t.Error("Expected signature on the context")
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		md := metadata.New(expected)
+		md.Set(headerbp.SignatureHeaderGRPC, "1.invalid")
+		if _, err := client.Ping(metadata.NewOutgoingContext(context.Background(), md), &pb.PingRequest{}); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+		if got := forwardedHeaders(service.ctx); len(got) != 0 {
+			t.Errorf("Expected no headers to be forwarded, got %v", got)
+		}
+		if got, _ := GetUntrustedBaseplateHeaders(service.ctx); !maps.Equal(got, expected) {
+			t.Errorf("Expected untrusted headers %v, got %v", expected, got)
+		}
+		incoming, _ := metadata.FromIncomingContext(service.ctx)
+		for k := range expected {
+			if v := incoming.Get(k); len(v) > 0 {
+				t.Errorf("Expected %q to be removed from the metadata, got %v", k, v)
+			}
+		}
+	})
+
+	t.Run("forward", func(t *testing.T) {
+		md := metadata.New(expected)
+		sign(t, md)
+		if _, err := client.Ping(metadata.NewOutgoingContext(context.Background(), md), &pb.PingRequest{}); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+
+		// New baseplate headers set by the caller are not forwarded.
+		ctx := metadata.AppendToOutgoingContext(context.WithoutCancel(service.ctx), "x-bp-new", "bar")
+		if _, err := forwardingClient.Ping(ctx, &pb.PingRequest{}); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+		if got := forwardedHeaders(service.ctx); !maps.Equal(got, expected) {
+			t.Errorf("Expected headers %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("sign", func(t *testing.T) {
+		// Headers without a signature on the context, e.g. set by an edge service,
+		// are signed by the client.
+		h := headerbp.NewIncomingHeaders()
+		for k, v := range expected {
+			h.RecordHeader(k, v)
+		}
+		ctx := h.SetOnContext(context.Background())
+
+		stream, err := forwardingClient.PingList(ctx, &pb.PingRequest{})
+		if err != nil {
+			t.Fatalf("PingList: %v", err)
+		}
+		for {
+			if _, err := stream.Recv(); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+		}
+		if got := forwardedHeaders(service.ctx); !maps.Equal(got, expected) {
+			t.Errorf("Expected headers %v, got %v", expected, got)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package grpcbp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	pb "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/reddit/baseplate.go"
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+)
+
+func newTestBaseplateServer(t *testing.T, args ServerArgs) (pb.TestServiceClient, *grpc.ClientConn, *mockService) {
+	t.Helper()
+
+	service := &mockService{}
+	args.Baseplate = baseplate.NewTestBaseplate(baseplate.NewTestBaseplateArgs{
+		Config: baseplate.Config{
+			StopTimeout: time.Second,
+		},
+		EdgeContextImpl: ecinterface.Mock(),
+	})
+	args.RegisterServices = func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	}
+	srv, lis, err := NewTestBaseplateServer(args)
+	if err != nil {
+		t.Fatalf("NewTestBaseplateServer: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := srv.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	})
+	conn, err := NewTestClientConn(lis)
+	if err != nil {
+		t.Fatalf("NewTestClientConn: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return pb.NewTestServiceClient(conn), conn, service
+}
+
+func TestNewBaseplateServer(t *testing.T) {
+	client, conn, service := newTestBaseplateServer(t, ServerArgs{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	t.Run("unary", func(t *testing.T) {
+		if _, err := client.Ping(ctx, &pb.PingRequest{}); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+		if service.ctx == nil {
+			t.Fatal("Expected the request to be handled")
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		stream, err := client.PingList(ctx, &pb.PingRequest{})
+		if err != nil {
+			t.Fatalf("PingList: %v", err)
+		}
+		for {
+			if _, err := stream.Recv(); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		defer promtest.NewPrometheusMetricTest(t, "recovered panics", panicRecoverCounter, prometheus.Labels{
+			serviceLabel: "mwitkow.testproto.TestService",
+			methodLabel:  "PingEmpty",
+		}).CheckDelta(1)
+
+		_, err := client.PingEmpty(ctx, &pb.Empty{})
+		if got := status.Code(err); got != codes.Internal {
+			t.Errorf("Expected code %v, got %v", codes.Internal, err)
+		}
+		if got := status.Convert(err).Message(); got != "internal error" {
+			t.Errorf("Expected the panic not to be sent to the client, got message %q", got)
+		}
+		stream, err := client.PingStream(ctx)
+		if err != nil {
+			t.Fatalf("PingStream: %v", err)
+		}
+		_, err = stream.Recv()
+		if got := status.Code(err); got != codes.Internal {
+			t.Errorf("Expected code %v, got %v", codes.Internal, err)
+		}
+	})
+
+	t.Run("health", func(t *testing.T) {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected status %v, got %v", healthpb.HealthCheckResponse_SERVING, resp.Status)
+		}
+	})
+
+	t.Run("reflection", func(t *testing.T) {
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		if err != nil {
+			t.Fatalf("ServerReflectionInfo: %v", err)
+		}
+		if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		services := make(map[string]bool)
+		for _, s := range resp.GetListServicesResponse().GetService() {
+			services[s.Name] = true
+		}
+		for _, name := range []string{
+			"mwitkow.testproto.TestService",
+			healthpb.Health_ServiceDesc.ServiceName,
+		} {
+			if !services[name] {
+				t.Errorf("Expected service %q in %v", name, services)
+			}
+		}
+	})
+}
+
+func TestNewBaseplateServerDisableReflection(t *testing.T) {
+	_, conn, _ := newTestBaseplateServer(t, ServerArgs{DisableReflection: true})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+	_, err = stream.Recv()
+	if got := status.Code(err); got != codes.Unimplemented {
+		t.Errorf("Expected code %v, got %v", codes.Unimplemented, err)
+	}
+}
+
+func TestServerArgsValidateAndSetDefaults(t *testing.T) {
+	if _, err := (ServerArgs{}).ValidateAndSetDefaults(); err == nil {
+		t.Error("Expected error for empty ServerArgs, got nil")
+	}
+}
+
+type blockingService struct {
+	pb.TestServiceServer
+
+	started chan struct{}
+}
+
+func (s *blockingService) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	close(s.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGracefulStopTimeout(t *testing.T) {
+	service := &blockingService{started: make(chan struct{})}
+	srv, lis, err := NewTestBaseplateServer(ServerArgs{
+		Baseplate: baseplate.NewTestBaseplate(baseplate.NewTestBaseplateArgs{
+			Config: baseplate.Config{
+				StopTimeout: 10 * time.Millisecond,
+			},
+			EdgeContextImpl: ecinterface.Mock(),
+		}),
+		RegisterServices: func(s *grpc.Server) {
+			pb.RegisterTestServiceServer(s, service)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTestBaseplateServer: %v", err)
+	}
+	conn, err := NewTestClientConn(lis)
+	if err != nil {
+		t.Fatalf("NewTestClientConn: %v", err)
+	}
+	defer conn.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := pb.NewTestServiceClient(conn).Ping(context.Background(), &pb.PingRequest{})
+		errs <- err
+	}()
+	<-service.started
+
+	if err := srv.Close(); err == nil {
+		t.Error("Expected Close to time out, got nil")
+	}
+	if err := <-errs; err == nil {
+		t.Error("Expected the pending request to fail, got nil")
+	}
+	if err := srv.Serve(); err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
@@ -13,31 +13,92 @@ import (
 
 // CreateGRPCContextFromSpan injects span info into a context object that can
 // be used in gRPC client code.
+//
+// The span headers overwrite any span headers already in the outgoing
+// metadata of ctx, so nested client spans (e.g. the retry and the attempt
+// spans) don't send multiple values for the same header.
 func CreateGRPCContextFromSpan(ctx context.Context, span *tracing.Span) context.Context {
-	kvs := []string{
-		transport.HeaderTracingTrace, span.TraceID(),
-		transport.HeaderTracingSpan, span.ID(),
-		transport.HeaderTracingFlags, strconv.FormatInt(span.Flags(), 10),
-	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(transport.HeaderTracingTrace, span.TraceID())
+	md.Set(transport.HeaderTracingSpan, span.ID())
+	md.Set(transport.HeaderTracingFlags, strconv.FormatInt(span.Flags(), 10))
 
 	if span.ParentID() != "" {
-		kvs = append(kvs, transport.HeaderTracingParent, span.ParentID())
+		md.Set(transport.HeaderTracingParent, span.ParentID())
 	} else {
-		md, _ := metadata.FromIncomingContext(ctx)
 		md.Delete(transport.HeaderTracingParent)
-		ctx = metadata.NewOutgoingContext(ctx, md)
 	}
 
 	if span.Sampled() {
-		kvs = append(kvs, transport.HeaderTracingSampled, transport.HeaderTracingSampledTrue)
+		md.Set(transport.HeaderTracingSampled, transport.HeaderTracingSampledTrue)
 	} else {
-		md, _ := metadata.FromIncomingContext(ctx)
 		md.Delete(transport.HeaderTracingSampled)
-		ctx = metadata.NewOutgoingContext(ctx, md)
 	}
 
-	return metadata.AppendToOutgoingContext(ctx, kvs...)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// CreateGRPCContextFromSpanWithPropagator is the same as
+// CreateGRPCContextFromSpan,
+// except that the span headers are injected by the given propagator.
+//
+// If propagator is nil, BaseplatePropagator will be used.
+func CreateGRPCContextFromSpanWithPropagator(ctx context.Context, span *tracing.Span, propagator tracing.Propagator) context.Context {
+	if propagator == nil {
+		return CreateGRPCContextFromSpan(ctx, span)
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	propagator.Inject(span, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// BaseplatePropagator is the tracing.Propagator for the Baseplate gRPC span
+// headers (Trace, Span, Parent, Flags and Sampled).
+//
+// It's the default propagator used by the server and client interceptors,
+// and can be combined with other formats by tracing.NewPropagators.
+type BaseplatePropagator struct{}
+
+var _ tracing.Propagator = BaseplatePropagator{}
+
+// Extract implements tracing.Propagator.
+func (BaseplatePropagator) Extract(carrier tracing.HeaderCarrier) (tracing.Headers, bool) {
+	var headers tracing.Headers
+	headers.TraceID = carrier.Get(transport.HeaderTracingTrace)
+	headers.SpanID = carrier.Get(transport.HeaderTracingSpan)
+	headers.Flags = carrier.Get(transport.HeaderTracingFlags)
+	if value := carrier.Get(transport.HeaderTracingSampled); value != "" {
+		sampled := value == transport.HeaderTracingSampledTrue
+		headers.Sampled = &sampled
+	}
+	return headers, headers.AnySet()
+}
+
+// Inject implements tracing.Propagator.
+func (BaseplatePropagator) Inject(span *tracing.Span, carrier tracing.HeaderCarrier) {
+	carrier.Set(transport.HeaderTracingTrace, span.TraceID())
+	carrier.Set(transport.HeaderTracingSpan, span.ID())
+	carrier.Set(transport.HeaderTracingFlags, strconv.FormatInt(span.Flags(), 10))
+	if span.ParentID() != "" {
+		carrier.Set(transport.HeaderTracingParent, span.ParentID())
+	}
+	if span.Sampled() {
+		carrier.Set(transport.HeaderTracingSampled, transport.HeaderTracingSampledTrue)
+	}
+}
+
+// metadataCarrier adapts metadata.MD into tracing.HeaderCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	value, _ := GetHeader(metadata.MD(c), key)
+	return value
+}
 
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
 }
 
 func methodSlug(method string) string {
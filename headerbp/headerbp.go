@@ -14,6 +14,8 @@ const (
 	headerPrefixLower         = "x-bp-"
 
 	SignatureHeaderCanonicalHTTP = "X-Rddt-Headerbp-Signature"
+	// SignatureHeaderGRPC is the signature header as gRPC metadata key, which must be lowercase.
+	SignatureHeaderGRPC = "x-rddt-headerbp-signature"
 
 	signatureVersion = 1
 )
@@ -128,6 +130,20 @@ func setHeadersOnContext(ctx context.Context, headers map[string]string) context
 	return context.WithValue(ctx, headersKey{}, headers)
 }
 
+// IncomingHeader returns the value of the baseplate header received by the
+// server, as attached to the context by IncomingHeaders.SetOnContext.
+//
+// The server middlewares only attach the headers they trust (e.g. the headers
+// with a valid signature for http servers).
+func IncomingHeader(ctx context.Context, key string) (string, bool) {
+	headers, ok := ctx.Value(headersKey{}).(map[string]string)
+	if !ok {
+		return "", false
+	}
+	v, ok := headers[normalizeKey(key, false)]
+	return v, ok
+}
+
 // ShouldRemoveClientHeader checks if the header is allowlisted and returns if the header should be removed
 func ShouldRemoveClientHeader(name string, options ...CheckClientHeaderOption) bool {
 	cfg := &shouldRemoveClientHeaders{}
@@ -350,6 +366,39 @@ func WithThriftClient(service, client, method string) CommonHeaderOption {
 	}
 }
 
+func WithGRPCService(service, method string) CommonHeaderOption {
+	cc := commonOption{
+		RPCType: "grpc",
+		Service: service,
+		Method:  method,
+	}
+	return &commonOption{
+		applyToNewIncomingHeaders: func(headers *newIncomingHeaders) {
+			headers.commonOption = cc
+		},
+	}
+}
+
+func WithGRPCClient(service, client, method string) CommonHeaderOption {
+	cc := commonOption{
+		RPCType: "grpc",
+		Service: service,
+		Client:  client,
+		Method:  method,
+	}
+	return &commonOption{
+		applyToCheckClientHeaders: func(headers *shouldRemoveClientHeaders) {
+			headers.commonOption = cc
+		},
+		applyToSetOutgoingHeaders: func(headers *setOutgoingHeaders) {
+			headers.commonOption = cc
+		},
+		applyToHasSetOutgoingHeaders: func(headers *hasSetOutgoingHeaders) {
+			headers.commonOption = cc
+		},
+	}
+}
+
 func WithHeaderSetter(setter func(key, value string)) SetOutgoingHeadersOption {
 	return &setOutgoingHeaders{
 		commonOption: commonOption{
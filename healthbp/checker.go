@@ -0,0 +1,71 @@
+package healthbp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/reddit/baseplate.go"
+)
+
+// Checker checks the health of a single dependency.
+//
+// CheckHealth should return nil when the dependency is healthy,
+// and an error explaining the failure otherwise.
+// It should respect the deadline of ctx.
+type Checker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// CheckerFunc is an adapter to allow the use of ordinary functions as Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// CheckHealth implements Checker.
+func (f CheckerFunc) CheckHealth(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ErrUnhealthy is the error reported by the Checker returned by
+// FromHealthChecker when the underlying baseplate.HealthChecker is unhealthy.
+var ErrUnhealthy = errors.New("healthbp: unhealthy")
+
+// FromHealthChecker adapts a baseplate.HealthChecker (e.g. a kafkabp consumer
+// or baseplate.Drainer) into a Checker.
+func FromHealthChecker(hc baseplate.HealthChecker) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if hc.IsHealthy(ctx) {
+			return nil
+		}
+		return ErrUnhealthy
+	})
+}
+
+// ExhaustibleClientPool is the subset of thriftbp.ClientPool (and other client
+// pools) used by ClientPoolChecker.
+type ExhaustibleClientPool interface {
+	IsExhausted() bool
+}
+
+// ClientPoolChecker returns a Checker that reports unhealthy when the client
+// pool is exhausted.
+func ClientPoolChecker(pool ExhaustibleClientPool) Checker {
+	return CheckerFunc(func(_ context.Context) error {
+		if pool.IsExhausted() {
+			return errors.New("healthbp: client pool exhausted")
+		}
+		return nil
+	})
+}
+
+// FreshnessChecker returns a Checker that reports unhealthy when the time
+// returned by lastUpdated is older than maxAge,
+// for example with secrets.Store.LastUpdated.
+func FreshnessChecker(lastUpdated func() time.Time, maxAge time.Duration) Checker {
+	return CheckerFunc(func(_ context.Context) error {
+		if age := time.Since(lastUpdated()); age > maxAge {
+			return fmt.Errorf("healthbp: last updated %v ago, exceeding max age %v", age.Round(time.Second), maxAge)
+		}
+		return nil
+	})
+}
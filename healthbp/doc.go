@@ -0,0 +1,32 @@
+// Package healthbp provides composite health checks built from named
+// dependency checks.
+//
+// Services register the checks of their dependencies (thrift client pools,
+// redis, kafka consumers, secrets freshness, etc.) into a Registry,
+// each with its own timeout, cache TTL, criticality and the probes it applies
+// to.
+// The Registry then reports the aggregated health of each probe type
+// (readiness, liveness and startup),
+// and serves a JSON report explaining which dependency failed:
+//
+//	registry := healthbp.NewRegistry()
+//	registry.MustRegister(healthbp.Check{
+//	  Name:     "redis",
+//	  Critical: true,
+//	  Timeout:  100 * time.Millisecond,
+//	  CacheTTL: time.Second,
+//	  Checker: healthbp.CheckerFunc(func(ctx context.Context) error {
+//	    return redisClient.Ping(ctx).Err()
+//	  }),
+//	})
+//	registry.MustRegister(healthbp.Check{
+//	  Name:    "secrets",
+//	  Checker: healthbp.FreshnessChecker(secretsStore.LastUpdated, time.Hour),
+//	})
+//	healthbp.RegisterAdminHandler(registry)
+//
+// Registry implements baseplate.HealthChecker for the readiness probe,
+// and Registry.ProbeChecker returns the baseplate.HealthChecker for other
+// probes, so it can be used with the health check handlers of httpbp,
+// thriftbp and grpcbp.
+package healthbp
@@ -0,0 +1,301 @@
+package healthbp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reddit/baseplate.go"
+	"github.com/reddit/baseplate.go/httpbp"
+	"github.com/reddit/baseplate.go/internal/admin"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+)
+
+// Probe is the type of the health check probes.
+//
+// Its values are the same as the IsHealthyProbe enum defined in Baseplate
+// spec, which is also what httpbp.GetHealthCheckProbe returns.
+type Probe int64
+
+// Probe values.
+const (
+	ProbeReadiness = Probe(baseplatethrift.IsHealthyProbe_READINESS)
+	ProbeLiveness  = Probe(baseplatethrift.IsHealthyProbe_LIVENESS)
+	ProbeStartup   = Probe(baseplatethrift.IsHealthyProbe_STARTUP)
+)
+
+func (p Probe) String() string {
+	return strings.ToLower(baseplatethrift.IsHealthyProbe(p).String())
+}
+
+// DefaultTimeout is the default value of Check.Timeout.
+const DefaultTimeout = time.Second
+
+// AdminPath is the path RegisterAdminHandler registers the Registry to.
+const AdminPath = "/health"
+
+// Check defines a named dependency check to be registered into a Registry.
+type Check struct {
+	// Name of the check, must be non-empty and unique in the Registry.
+	Name string
+
+	// The Checker doing the actual check, required.
+	Checker Checker
+
+	// Timeout of a single check.
+	//
+	// Optional, if it's <= 0, DefaultTimeout will be used instead.
+	// When the timeout is reached the check is reported unhealthy,
+	// even if Checker does not respect the deadline of the context.
+	Timeout time.Duration
+
+	// If CacheTTL > 0, the result of the check is cached for that long and
+	// Checker will not be called again until the cached result expires.
+	CacheTTL time.Duration
+
+	// When Critical is true, the failure of this check fails the aggregated
+	// health of the probes.
+	// Failures of non-critical checks are only reported in the Report.
+	Critical bool
+
+	// The probes this check applies to.
+	//
+	// Optional, if it's empty the check only applies to ProbeReadiness.
+	Probes []Probe
+}
+
+// CheckResult is the result of a single Check.
+type CheckResult struct {
+	Name     string `json:"name"`
+	Healthy  bool   `json:"healthy"`
+	Critical bool   `json:"critical"`
+	// The error returned by the Checker, only set when it's unhealthy.
+	Error string `json:"error,omitempty"`
+	// Whether this result is served from the cache.
+	Cached    bool          `json:"cached"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// Report is the aggregated result of all the checks of a probe.
+type Report struct {
+	Probe string `json:"probe"`
+	// Healthy is true when all the critical checks are healthy.
+	Healthy bool          `json:"healthy"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// Registry is a registry of named dependency checks.
+//
+// It should be created by NewRegistry.
+type Registry struct {
+	lock   sync.RWMutex
+	checks []*registeredCheck
+}
+
+var (
+	_ baseplate.HealthChecker = (*Registry)(nil)
+	_ http.Handler            = (*Registry)(nil)
+)
+
+// NewRegistry creates a new, empty Registry.
+//
+// An empty Registry always reports healthy.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register registers a new check into the Registry.
+//
+// It returns an error if the check is missing name or Checker, or another
+// check with the same name is already registered.
+func (r *Registry) Register(check Check) error {
+	if check.Name == "" {
+		return errors.New("healthbp.Registry.Register: check name is required")
+	}
+	if check.Checker == nil {
+		return fmt.Errorf("healthbp.Registry.Register: Checker is required for check %q", check.Name)
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = DefaultTimeout
+	}
+	if len(check.Probes) == 0 {
+		check.Probes = []Probe{ProbeReadiness}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, c := range r.checks {
+		if c.check.Name == check.Name {
+			return fmt.Errorf("healthbp.Registry.Register: check %q already registered", check.Name)
+		}
+	}
+	r.checks = append(r.checks, &registeredCheck{check: check})
+	return nil
+}
+
+// MustRegister calls Register and panics if it returns an error.
+func (r *Registry) MustRegister(check Check) {
+	if err := r.Register(check); err != nil {
+		panic(err)
+	}
+}
+
+// Check runs all the checks applying to the probe concurrently,
+// and returns the aggregated Report.
+//
+// The checks in the Report are in the order they were registered.
+func (r *Registry) Check(ctx context.Context, probe Probe) Report {
+	r.lock.RLock()
+	checks := make([]*registeredCheck, 0, len(r.checks))
+	for _, c := range r.checks {
+		if c.appliesTo(probe) {
+			checks = append(checks, c)
+		}
+	}
+	r.lock.RUnlock()
+
+	report := Report{
+		Probe:   probe.String(),
+		Healthy: true,
+		Checks:  make([]CheckResult, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}()
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Critical && !result.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// IsHealthy implements baseplate.HealthChecker for ProbeReadiness.
+func (r *Registry) IsHealthy(ctx context.Context) bool {
+	return r.Check(ctx, ProbeReadiness).Healthy
+}
+
+// ProbeChecker returns the baseplate.HealthChecker for the given probe.
+func (r *Registry) ProbeChecker(probe Probe) baseplate.HealthChecker {
+	return probeChecker{
+		registry: r,
+		probe:    probe,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+//
+// It serves the Report of the probe specified by the "type" query
+// (httpbp.HealthCheckProbeQuery) as JSON,
+// with http status code 200 when healthy and 503 otherwise.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	probe, err := httpbp.GetHealthCheckProbe(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report := r.Check(req.Context(), Probe(probe))
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// RegisterAdminHandler registers the Registry to the internal admin server
+// at AdminPath.
+//
+// It should be called at most once, as the admin server panics on duplicated
+// registrations.
+func RegisterAdminHandler(r *Registry) {
+	admin.Mux.Handle(AdminPath, r)
+}
+
+type probeChecker struct {
+	registry *Registry
+	probe    Probe
+}
+
+func (pc probeChecker) IsHealthy(ctx context.Context) bool {
+	return pc.registry.Check(ctx, pc.probe).Healthy
+}
+
+type registeredCheck struct {
+	check Check
+
+	// lock serializes the runs of the check,
+	// so concurrent probes share the cached result instead of calling the
+	// Checker concurrently.
+	lock   sync.Mutex
+	cached *CheckResult
+}
+
+func (c *registeredCheck) appliesTo(probe Probe) bool {
+	for _, p := range c.check.Probes {
+		if p == probe {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *registeredCheck) run(ctx context.Context) CheckResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cached != nil && time.Since(c.cached.CheckedAt) < c.check.CacheTTL {
+		result := *c.cached
+		result.Cached = true
+		return result
+	}
+
+	start := time.Now()
+	err := c.checkWithTimeout(ctx)
+	result := CheckResult{
+		Name:      c.check.Name,
+		Healthy:   err == nil,
+		Critical:  c.check.Critical,
+		CheckedAt: start,
+		Duration:  time.Since(start),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if c.check.CacheTTL > 0 {
+		c.cached = &result
+	}
+	return result
+}
+
+func (c *registeredCheck) checkWithTimeout(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.check.Timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("healthbp: check panicked: %v", r)
+			}
+		}()
+		errCh <- c.check.Checker.CheckHealth(ctx)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("healthbp: check timed out after %v: %w", c.check.Timeout, ctx.Err())
+	}
+}
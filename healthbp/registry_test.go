@@ -0,0 +1,176 @@
+package healthbp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/reddit/baseplate.go"
+	"github.com/reddit/baseplate.go/healthbp"
+)
+
+type countingChecker struct {
+	calls atomic.Int64
+	err   atomic.Pointer[error]
+}
+
+func (c *countingChecker) CheckHealth(context.Context) error {
+	c.calls.Add(1)
+	if err := c.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (c *countingChecker) fail(err error) {
+	c.err.Store(&err)
+}
+
+func TestRegistry(t *testing.T) {
+	critical := &countingChecker{}
+	optional := &countingChecker{}
+	optional.fail(errors.New("cache unavailable"))
+	drainer := baseplate.Drainer()
+
+	registry := healthbp.NewRegistry()
+	registry.MustRegister(healthbp.Check{
+		Name:     "db",
+		Checker:  critical,
+		Critical: true,
+		CacheTTL: time.Hour,
+	})
+	registry.MustRegister(healthbp.Check{
+		Name:    "cache",
+		Checker: optional,
+	})
+	registry.MustRegister(healthbp.Check{
+		Name:     "drainer",
+		Checker:  healthbp.FromHealthChecker(drainer),
+		Critical: true,
+		Probes:   []healthbp.Probe{healthbp.ProbeReadiness, healthbp.ProbeLiveness},
+	})
+	registry.MustRegister(healthbp.Check{
+		Name: "slow",
+		Checker: healthbp.CheckerFunc(func(context.Context) error {
+			time.Sleep(time.Hour)
+			return nil
+		}),
+		Critical: true,
+		Timeout:  time.Millisecond,
+		Probes:   []healthbp.Probe{healthbp.ProbeStartup},
+	})
+
+	ctx := context.Background()
+
+	report := registry.Check(ctx, healthbp.ProbeReadiness)
+	if !report.Healthy {
+		t.Errorf("Expected readiness to be healthy with only non-critical failures, got %+v", report)
+	}
+	if len(report.Checks) != 3 {
+		t.Fatalf("Expected 3 readiness checks, got %+v", report.Checks)
+	}
+	if c := report.Checks[1]; c.Name != "cache" || c.Healthy || c.Error != "cache unavailable" {
+		t.Errorf("Unexpected cache check result %+v", c)
+	}
+
+	// The failure of the cached check is not observed until the cache expires.
+	critical.fail(errors.New("db down"))
+	report = registry.Check(ctx, healthbp.ProbeReadiness)
+	if !report.Healthy || !report.Checks[0].Cached {
+		t.Errorf("Expected cached healthy db check result, got %+v", report.Checks[0])
+	}
+	if n := critical.calls.Load(); n != 1 {
+		t.Errorf("Expected db checker to be called once, got %d", n)
+	}
+
+	drainer.Close()
+	if registry.IsHealthy(ctx) {
+		t.Error("Expected readiness to be unhealthy after drainer closed")
+	}
+	if registry.ProbeChecker(healthbp.ProbeLiveness).IsHealthy(ctx) {
+		t.Error("Expected liveness to be unhealthy after drainer closed")
+	}
+
+	report = registry.Check(ctx, healthbp.ProbeStartup)
+	if report.Healthy || len(report.Checks) != 1 {
+		t.Errorf("Expected startup to be unhealthy because of the timeout, got %+v", report)
+	}
+}
+
+func TestRegistryRegisterErrors(t *testing.T) {
+	registry := healthbp.NewRegistry()
+	checker := healthbp.CheckerFunc(func(context.Context) error { return nil })
+	if err := registry.Register(healthbp.Check{Checker: checker}); err == nil {
+		t.Error("Expected error for missing name")
+	}
+	if err := registry.Register(healthbp.Check{Name: "foo"}); err == nil {
+		t.Error("Expected error for missing checker")
+	}
+	if err := registry.Register(healthbp.Check{Name: "foo", Checker: checker}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(healthbp.Check{Name: "foo", Checker: checker}); err == nil {
+		t.Error("Expected error for duplicated name")
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	registry := healthbp.NewRegistry()
+	registry.MustRegister(healthbp.Check{
+		Name:     "pool",
+		Checker:  healthbp.ClientPoolChecker(exhaustedPool{}),
+		Critical: true,
+		Probes:   []healthbp.Probe{healthbp.ProbeLiveness},
+	})
+
+	for _, c := range []struct {
+		query      string
+		statusCode int
+		checks     int
+	}{
+		{query: "", statusCode: http.StatusOK, checks: 0},
+		{query: "?type=liveness", statusCode: http.StatusServiceUnavailable, checks: 1},
+		{query: "?type=foo", statusCode: http.StatusBadRequest},
+	} {
+		t.Run(c.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, healthbp.AdminPath+c.query, nil))
+			if w.Code != c.statusCode {
+				t.Errorf("Expected status code %d, got %d", c.statusCode, w.Code)
+			}
+			if c.statusCode == http.StatusBadRequest {
+				return
+			}
+			var report healthbp.Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to decode report %q: %v", w.Body.String(), err)
+			}
+			if len(report.Checks) != c.checks {
+				t.Errorf("Expected %d checks, got %+v", c.checks, report)
+			}
+		})
+	}
+}
+
+func TestFreshnessChecker(t *testing.T) {
+	now := time.Now()
+	checker := healthbp.FreshnessChecker(func() time.Time { return now }, time.Minute)
+	if err := checker.CheckHealth(context.Background()); err != nil {
+		t.Errorf("Expected fresh, got %v", err)
+	}
+	now = now.Add(-time.Hour)
+	if err := checker.CheckHealth(context.Background()); err == nil {
+		t.Error("Expected stale error, got nil")
+	}
+}
+
+type exhaustedPool struct{}
+
+func (exhaustedPool) IsExhausted() bool {
+	return true
+}
@@ -1,6 +1,8 @@
 package httpbp
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -13,15 +15,18 @@ import (
 	"time"
 
 	"github.com/avast/retry-go"
+	"github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/reddit/baseplate.go/headerbp"
 	"github.com/reddit/baseplate.go/internal/faults"
+	"github.com/reddit/baseplate.go/internal/singleflight"
 	"github.com/reddit/baseplate.go/secrets"
 
 	"github.com/reddit/baseplate.go/breakerbp"
 	//lint:ignore SA1019 This library is internal only, not actually deprecated
 	"github.com/reddit/baseplate.go/internalv2compat"
 	"github.com/reddit/baseplate.go/retrybp"
+	"github.com/reddit/baseplate.go/tracing"
 	"github.com/reddit/baseplate.go/transport"
 )
 
@@ -281,6 +286,97 @@ func MaxConcurrency(maxConcurrency int64) ClientMiddleware {
 	}
 }
 
+// CoalesceRequests is a middleware that collapses concurrent identical GET
+// requests into a single request to the server (also known as singleflight),
+// and fans out its response to all the callers.
+//
+// This is useful to protect the upstream service from a burst of identical
+// reads, for example on a cache miss storm.
+//
+// Requests are identical when they have the same URL and the same values of
+// the keyHeaders. Any header that changes the response (e.g. Authorization)
+// MUST be listed in keyHeaders, otherwise the callers could receive the
+// responses meant for other callers.
+// Requests with other methods, or with a body, are always passed through.
+//
+// The shared request is sent with the context values of the first caller, but
+// without its deadline, and it's only canceled when all the callers waiting on
+// it are gone.
+// Every caller only waits on the shared request until its own context is
+// done, so the callers with later deadlines still get the response after the
+// first caller gave up.
+//
+// The response body of the shared request is read into memory, and every
+// caller gets its own copy of the response.
+//
+// The callers joining an in-flight request are counted in
+// httpbp_client_coalesced_requests_total counter, with the serverSlug arg as
+// the http_client_name label.
+func CoalesceRequests(serverSlug string, keyHeaders ...string) ClientMiddleware {
+	var group singleflight.Group[coalescedResponse]
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet || (req.Body != nil && req.Body != http.NoBody) {
+				return next.RoundTrip(req)
+			}
+
+			r, shared, err := group.Do(req.Context(), coalesceKey(req, keyHeaders), func(ctx context.Context) (coalescedResponse, error) {
+				resp, err := next.RoundTrip(req.WithContext(ctx))
+				if err != nil {
+					return coalescedResponse{}, err
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					return coalescedResponse{}, err
+				}
+				return coalescedResponse{resp: resp, body: body}, nil
+			})
+			if shared {
+				clientCoalescedRequestsCounter.With(prometheus.Labels{
+					methodLabel:     req.Method,
+					clientNameLabel: serverSlug,
+				}).Inc()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return r.copy(req), nil
+		})
+	}
+}
+
+// coalescedResponse is a response shared by the coalesced callers, with the
+// body already read.
+type coalescedResponse struct {
+	resp *http.Response
+	body []byte
+}
+
+// copy returns a copy of the response for req.
+func (r coalescedResponse) copy(req *http.Request) *http.Response {
+	resp := *r.resp
+	resp.Header = r.resp.Header.Clone()
+	resp.Trailer = r.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(r.body))
+	resp.Request = req
+	return &resp
+}
+
+func coalesceKey(req *http.Request, keyHeaders []string) string {
+	var sb strings.Builder
+	sb.WriteString(req.Method)
+	sb.WriteString(" ")
+	sb.WriteString(req.URL.String())
+	for _, h := range keyHeaders {
+		sb.WriteString("\n")
+		sb.WriteString(http.CanonicalHeaderKey(h))
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(req.Header.Values(h), ", "))
+	}
+	return sb.String()
+}
+
 var monitorClientLoggingOnce sync.Once
 
 // MonitorClient is an HTTP client middleware that wraps HTTP requests in a
@@ -301,6 +397,54 @@ func MonitorClient(slug string) ClientMiddleware {
 	}
 }
 
+// InjectSpanHeaders is an HTTP client middleware that injects the trace
+// context of the span found in the request context into the request headers,
+// in the header formats of the given propagator.
+//
+// The span found in the request context becomes the parent of the server span
+// on the other side. MonitorClient only creates a client span when the v2
+// tracing http client middleware is injected (see MonitorClient), so without it
+// that's usually the server span of the incoming request being handled, unless
+// the caller starts a client span itself, for example:
+//
+//	span, ctx := opentracing.StartSpanFromContext(
+//	  ctx,
+//	  "service.endpoint",
+//	  tracing.SpanTypeOption{Type: tracing.SpanTypeClient},
+//	)
+//	defer span.Finish()
+//
+// When the v2 tracing http client middleware is injected, use it after
+// MonitorClient so the client span will be the parent instead.
+// Requests without a span in their context are sent as-is.
+//
+// If propagator is nil, BaseplatePropagator will be used.
+// Use tracing.NewPropagators to send the headers in multiple formats,
+// for example when calling a service instrumented by OpenTelemetry:
+//
+//	propagator, err := tracing.NewPropagators(
+//	  httpbp.BaseplatePropagator{},
+//	  tracing.PropagationFormatBaseplate,
+//	  tracing.PropagationFormatW3C,
+//	)
+func InjectSpanHeaders(propagator tracing.Propagator) ClientMiddleware {
+	if propagator == nil {
+		propagator = BaseplatePropagator{}
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			span := opentracing.SpanFromContext(req.Context())
+			if span == nil {
+				return next.RoundTrip(req)
+			}
+			// RoundTrippers should not modify the original request.
+			req = req.Clone(req.Context())
+			propagator.Inject(tracing.AsSpan(span), req.Header)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
 // PrometheusClientMetrics returns a middleware that tracks Prometheus metrics for client http.
 //
 // It emits the following prometheus metrics:
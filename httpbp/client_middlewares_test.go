@@ -2,22 +2,27 @@ package httpbp
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/avast/retry-go"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sony/gobreaker"
 
 	"github.com/reddit/baseplate.go/breakerbp"
 	"github.com/reddit/baseplate.go/internal/faults"
+	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+	"github.com/reddit/baseplate.go/tracing"
 )
 
 func TestNewClient(t *testing.T) {
@@ -367,6 +372,137 @@ func TestMaxConcurrency(t *testing.T) {
 	}
 }
 
+func TestCoalesceRequests(t *testing.T) {
+	const n = 5
+	defer promtest.NewPrometheusMetricTest(t, "coalesced", clientCoalescedRequestsCounter, prometheus.Labels{
+		methodLabel:     http.MethodGet,
+		clientNameLabel: t.Name(),
+	}).CheckDelta(2 * (n - 1))
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("X-User", r.Header.Get("X-User"))
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: CoalesceRequests(t.Name(), "X-User")(http.DefaultTransport),
+	}
+
+	var wg sync.WaitGroup
+	for _, user := range []string{"foo", "bar"} {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, err := http.NewRequest(http.MethodGet, server.URL+"/path", nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				req.Header.Set("X-User", user)
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				if string(body) != "/path" {
+					t.Errorf("Expected body %q, got %q", "/path", body)
+				}
+				if got := resp.Header.Get("X-User"); got != user {
+					t.Errorf("Expected the response for %q, got %q", user, got)
+				}
+			}()
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the upstream requests")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Give the other requests time to join the in-flight requests.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected one upstream request per distinct X-User header, got %d", got)
+	}
+
+	t.Run("post", func(t *testing.T) {
+		before := calls.Load()
+		for i := 0; i < 2; i++ {
+			resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			DrainAndClose(resp.Body)
+		}
+		if got := calls.Load() - before; got != 2 {
+			t.Errorf("Expected POST requests to be passed through, got %d upstream requests", got)
+		}
+	})
+}
+
+func TestCoalesceRequestsCallerDeadline(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: CoalesceRequests(t.Name())(http.DefaultTransport),
+	}
+
+	first := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			DrainAndClose(resp.Body)
+		}
+		first <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the upstream request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("Expected the first request to succeed, got %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", got)
+	}
+}
+
 func TestCircuitBreaker(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		const code = http.StatusInternalServerError
@@ -541,3 +677,59 @@ func TestFaultInjection(t *testing.T) {
 		})
 	}
 }
+
+func TestInjectSpanHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	propagator, err := tracing.NewPropagators(
+		BaseplatePropagator{},
+		tracing.PropagationFormatBaseplate,
+		tracing.PropagationFormatB3Multi,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Transport: WrapTransport(nil, InjectSpanHeaders(propagator)),
+	}
+
+	t.Run("no-span", func(t *testing.T) {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if v := got.Get(TraceIDHeader); v != "" {
+			t.Errorf("Expected no %s header, got %q", TraceIDHeader, v)
+		}
+	})
+
+	t.Run("span", func(t *testing.T) {
+		ctx, span := tracing.StartTopLevelServerSpan(context.Background(), "test")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if v := got.Get(TraceIDHeader); v != span.TraceID() {
+			t.Errorf("Expected %s header %q, got %q", TraceIDHeader, span.TraceID(), v)
+		}
+		if v := got.Get(SpanIDHeader); v != span.ID() {
+			t.Errorf("Expected %s header %q, got %q", SpanIDHeader, span.ID(), v)
+		}
+		if v := got.Get(tracing.B3TraceIDHeader); v == "" {
+			t.Errorf("Expected %s header to be set", tracing.B3TraceIDHeader)
+		}
+		if len(req.Header) != 0 {
+			t.Errorf("Expected original request headers to be untouched, got %v", req.Header)
+		}
+	})
+}
@@ -0,0 +1,501 @@
+package httpbp
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// AcceptEncodingHeader is the 'Accept-Encoding' header key.
+	AcceptEncodingHeader = "Accept-Encoding"
+
+	// ContentEncodingHeader is the 'Content-Encoding' header key.
+	ContentEncodingHeader = "Content-Encoding"
+
+	// VaryHeader is the 'Vary' header key.
+	VaryHeader = "Vary"
+)
+
+// The content encodings supported by Compression and DecompressRequest.
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingZstd    = "zstd"
+)
+
+// DefaultCompressionEncodings is the default list of encodings used by
+// Compression, in the order of preference.
+var DefaultCompressionEncodings = []string{
+	EncodingZstd,
+	EncodingGzip,
+	EncodingDeflate,
+}
+
+// DefaultCompressionContentTypes is the default list of Content-Type prefixes
+// compressed by Compression.
+var DefaultCompressionContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"image/svg+xml",
+}
+
+// DefaultCompressionMinSize is the default minimal size of the response bodies
+// compressed by Compression.
+const DefaultCompressionMinSize = 1024
+
+// CompressionArgs defines the args used by Compression.
+type CompressionArgs struct {
+	// Encodings is the list of encodings to negotiate with the Accept-Encoding
+	// header of the requests, in the order of preference when the client
+	// accepts multiple of them with the same weight.
+	//
+	// Supported encodings are EncodingGzip, EncodingDeflate and EncodingZstd,
+	// other values are ignored.
+	//
+	// Optional, default to DefaultCompressionEncodings.
+	Encodings []string
+
+	// MinSize is the minimal size of the response bodies to be compressed.
+	//
+	// Optional, default to DefaultCompressionMinSize.
+	MinSize int
+
+	// ContentTypes is the allowlist of Content-Type prefixes to be compressed.
+	//
+	// If the handler does not set the Content-Type header, it's detected by
+	// http.DetectContentType.
+	//
+	// Optional, default to DefaultCompressionContentTypes.
+	ContentTypes []string
+}
+
+// Compression returns a Middleware compressing the response bodies with the
+// encoding negotiated via the Accept-Encoding header of the request.
+//
+// The response bodies are buffered until they reach args.MinSize, so small
+// responses are sent uncompressed. Responses with a Content-Type not in the
+// allowlist, with the Content-Encoding header already set, or with a status
+// code without a body are never compressed. Flushing the response before
+// reaching args.MinSize starts the compression right away, so streamed
+// responses are still compressed.
+//
+// The http.Flusher, http.Hijacker and http.Pusher interfaces of the original
+// http.ResponseWriter are preserved, flushing the compressor first on Flush.
+//
+// Compression only compresses the responses written by the handlers it wraps,
+// the error responses written by the Baseplate implementation of http.Handler
+// for the errors returned by the handlers are not compressed.
+func Compression(args CompressionArgs) Middleware {
+	encodings := args.Encodings
+	if len(encodings) == 0 {
+		encodings = DefaultCompressionEncodings
+	}
+	supported := make([]string, 0, len(encodings))
+	for _, encoding := range encodings {
+		encoding = strings.ToLower(encoding)
+		if _, ok := encoderPools[encoding]; ok {
+			supported = append(supported, encoding)
+		}
+	}
+	minSize := args.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	contentTypes := args.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultCompressionContentTypes
+	}
+
+	return func(name string, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add(VaryHeader, AcceptEncodingHeader)
+			if r.Method == http.MethodHead {
+				return next(ctx, w, r)
+			}
+			encoding := negotiateEncoding(r.Header.Values(AcceptEncodingHeader), supported)
+			if encoding == "" {
+				return next(ctx, w, r)
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        minSize,
+				contentTypes:   contentTypes,
+			}
+			defer cw.close()
+			return next(ctx, wrapResponseWriter(w, cw), r)
+		}
+	}
+}
+
+// negotiateEncoding returns the encoding with the highest weight in the
+// Accept-Encoding header values, or an empty string if none is acceptable.
+//
+// Ties are broken by the order of supported.
+func negotiateEncoding(accept []string, supported []string) string {
+	if len(accept) == 0 {
+		return ""
+	}
+	weights := make(map[string]float64)
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" {
+				continue
+			}
+			weight := 1.0
+			for _, param := range strings.Split(params, ";") {
+				if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+					var err error
+					if weight, err = strconv.ParseFloat(q, 64); err != nil {
+						weight = 0
+					}
+				}
+			}
+			weights[coding] = weight
+		}
+	}
+
+	var (
+		best       string
+		bestWeight float64
+	)
+	for _, encoding := range supported {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight = weights["*"]
+		}
+		if weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+	return best
+}
+
+type encoder interface {
+	io.WriteCloser
+
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip: {
+		New: func() any {
+			return gzip.NewWriter(nil)
+		},
+	},
+	EncodingDeflate: {
+		New: func() any {
+			return zlib.NewWriter(nil)
+		},
+	},
+	EncodingZstd: {
+		New: func() any {
+			// Only returns errors on invalid options.
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			return w
+		},
+	},
+}
+
+// compressWriter is the http.ResponseWriter used by Compression.
+//
+// It buffers the writes until it decides whether to compress the response or
+// not, which happens when the buffer reaches minSize, the response is flushed,
+// or the handler returns.
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding     string
+	minSize      int
+	contentTypes []string
+
+	code    int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || code < http.StatusOK {
+		// Informational responses are passed through as-is.
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.code == 0 {
+		cw.code = code
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide decides whether to compress the response, then writes the header and
+// the buffered body.
+func (cw *compressWriter) decide(ended bool) error {
+	cw.decided = true
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	h := cw.Header()
+	if h.Get(ContentTypeHeader) == "" && len(cw.buf) > 0 {
+		h.Set(ContentTypeHeader, http.DetectContentType(cw.buf))
+	}
+	if cw.shouldCompress(ended) {
+		h.Del("Content-Length")
+		h.Set(ContentEncodingHeader, cw.encoding)
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) shouldCompress(ended bool) bool {
+	switch cw.code {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	h := cw.Header()
+	if h.Get(ContentEncodingHeader) != "" {
+		return false
+	}
+	if ended && len(cw.buf) < cw.minSize {
+		return false
+	}
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < cw.minSize {
+		return false
+	}
+	contentType := h.Get(ContentTypeHeader)
+	for _, prefix := range cw.contentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// close writes the remaining buffered body and finishes the compression.
+func (cw *compressWriter) close() {
+	if !cw.decided && (cw.code != 0 || len(cw.buf) > 0) {
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// DefaultMaxDecompressedRequestBytes is the default max size of the request
+// bodies decompressed by DecompressRequest.
+const DefaultMaxDecompressedRequestBytes = 10 << 20 // 10 MiB
+
+// ErrUnsupportedContentEncoding is the error returned by
+// NewDecompressingReader when the content encoding is not supported.
+var ErrUnsupportedContentEncoding = errors.New("httpbp: unsupported content encoding")
+
+// NewDecompressingReader returns an io.ReadCloser decompressing body encoded
+// with the content encoding.
+//
+// To protect against decompression bombs, reading more than maxBytes
+// decompressed bytes from it returns an *http.MaxBytesError, which is mapped to
+// a 413 error response by JSONHandler.
+//
+// Supported encodings are EncodingGzip, EncodingDeflate and EncodingZstd.
+// An empty encoding or "identity" only applies the size limit.
+// It returns an error wrapping ErrUnsupportedContentEncoding for other
+// encodings.
+//
+// Closing the returned io.ReadCloser also closes body.
+func NewDecompressingReader(body io.ReadCloser, encoding string, maxBytes int64) (io.ReadCloser, error) {
+	var (
+		r      io.Reader
+		closer func() error
+	)
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		r = body
+	case EncodingGzip:
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("httpbp: invalid gzip body: %w", err)
+		}
+		r, closer = zr, zr.Close
+	case EncodingDeflate:
+		zr, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("httpbp: invalid deflate body: %w", err)
+		}
+		r, closer = zr, zr.Close
+	case EncodingZstd:
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("httpbp: invalid zstd body: %w", err)
+		}
+		r = zr
+		closer = func() error {
+			zr.Close()
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentEncoding, encoding)
+	}
+	return &decompressingReader{
+		r:      r,
+		n:      maxBytes,
+		limit:  maxBytes,
+		closer: closer,
+		body:   body,
+	}, nil
+}
+
+type decompressingReader struct {
+	r      io.Reader
+	n      int64
+	limit  int64
+	err    error
+	closer func() error
+	body   io.Closer
+}
+
+func (d *decompressingReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read one more byte than the remaining limit to detect bodies exceeding it.
+	if int64(len(p)) > d.n+1 {
+		p = p[:d.n+1]
+	}
+	n, err := d.r.Read(p)
+	if int64(n) <= d.n {
+		d.n -= int64(n)
+		d.err = err
+		return n, err
+	}
+	n = int(d.n)
+	d.n = 0
+	d.err = &http.MaxBytesError{Limit: d.limit}
+	return n, d.err
+}
+
+func (d *decompressingReader) Close() error {
+	var errs []error
+	if d.closer != nil {
+		errs = append(errs, d.closer())
+	}
+	errs = append(errs, d.body.Close())
+	return errors.Join(errs...)
+}
+
+// DecompressRequestArgs defines the args used by DecompressRequest.
+type DecompressRequestArgs struct {
+	// MaxBytes is the max size of the decompressed request bodies.
+	//
+	// Optional, default to DefaultMaxDecompressedRequestBytes.
+	MaxBytes int64
+}
+
+// DecompressRequest returns a Middleware decompressing the request bodies
+// according to their Content-Encoding header via NewDecompressingReader.
+//
+// Requests with unsupported encodings are rejected with a 415 error, and
+// requests with malformed compressed bodies are rejected with a 400 error.
+func DecompressRequest(args DecompressRequestArgs) Middleware {
+	maxBytes := args.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxDecompressedRequestBytes
+	}
+	return func(name string, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			encoding := r.Header.Get(ContentEncodingHeader)
+			if encoding == "" || r.Body == nil || r.Body == http.NoBody {
+				return next(ctx, w, r)
+			}
+			body, err := NewDecompressingReader(r.Body, encoding, maxBytes)
+			if err != nil {
+				resp := BadRequest()
+				if errors.Is(err, ErrUnsupportedContentEncoding) {
+					resp = UnsupportedMediaType()
+				}
+				return JSONError(
+					resp.WithDetails(map[string]string{
+						ContentEncodingHeader: encoding,
+					}),
+					err,
+				)
+			}
+			defer body.Close()
+
+			r = r.Clone(ctx)
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del(ContentEncodingHeader)
+			r.Header.Del("Content-Length")
+			return next(ctx, w, r)
+		}
+	}
+}
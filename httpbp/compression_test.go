@@ -0,0 +1,217 @@
+package httpbp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/reddit/baseplate.go/httpbp"
+)
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+	handler := func(contentType, body string, flush bool) httpbp.HandlerFunc {
+		return func(_ context.Context, w http.ResponseWriter, _ *http.Request) error {
+			if contentType != "" {
+				w.Header().Set(httpbp.ContentTypeHeader, contentType)
+			}
+			if flush {
+				io.WriteString(w, body[:10])
+				w.(http.Flusher).Flush()
+				body = body[10:]
+			}
+			_, err := io.WriteString(w, body)
+			return err
+		}
+	}
+
+	for _, c := range []struct {
+		name           string
+		accept         string
+		contentType    string
+		body           string
+		flush          bool
+		expectEncoding string
+	}{
+		{
+			name:           "gzip",
+			accept:         "gzip",
+			contentType:    httpbp.JSONContentType,
+			body:           large,
+			expectEncoding: httpbp.EncodingGzip,
+		},
+		{
+			name:           "preference",
+			accept:         "deflate, gzip, zstd",
+			body:           large,
+			expectEncoding: httpbp.EncodingZstd,
+		},
+		{
+			name:           "weights",
+			accept:         "zstd;q=0.5, deflate;q=0.8, *;q=0.1",
+			body:           large,
+			expectEncoding: httpbp.EncodingDeflate,
+		},
+		{
+			name:           "wildcard",
+			accept:         "*",
+			body:           large,
+			expectEncoding: httpbp.EncodingZstd,
+		},
+		{
+			name:   "no-accept-encoding",
+			body:   large,
+			accept: "",
+		},
+		{
+			name:   "unsupported",
+			accept: "br, gzip;q=0",
+			body:   large,
+		},
+		{
+			name:   "small",
+			accept: "gzip",
+			body:   "hello",
+		},
+		{
+			name:        "content-type",
+			accept:      "gzip",
+			contentType: "image/png",
+			body:        large,
+		},
+		{
+			name:           "flush",
+			accept:         "gzip",
+			body:           "hello world",
+			flush:          true,
+			expectEncoding: httpbp.EncodingGzip,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := httpbp.NewHandler(
+				"test",
+				handler(c.contentType, c.body, c.flush),
+				httpbp.Compression(httpbp.CompressionArgs{}),
+			)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.accept != "" {
+				req.Header.Set(httpbp.AcceptEncodingHeader, c.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+			if got := resp.Header.Get(httpbp.ContentEncodingHeader); got != c.expectEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", c.expectEncoding, got)
+			}
+			if got := resp.Header.Get(httpbp.VaryHeader); got != httpbp.AcceptEncodingHeader {
+				t.Errorf("Expected Vary header %q, got %q", httpbp.AcceptEncodingHeader, got)
+			}
+			if c.flush != w.Flushed {
+				t.Errorf("Expected flushed to be %v, got %v", c.flush, w.Flushed)
+			}
+			if c.expectEncoding != "" && w.Body.Len() >= len(c.body) && !c.flush {
+				t.Errorf("Expected compressed body, got %d bytes", w.Body.Len())
+			}
+
+			body, err := httpbp.NewDecompressingReader(resp.Body, c.expectEncoding, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.body {
+				t.Errorf("Expected body %q, got %q", c.body, got)
+			}
+		})
+	}
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	type echo struct {
+		Message string `json:"message"`
+	}
+	handler := httpbp.NewHandler(
+		"test",
+		httpbp.JSONHandler(func(_ context.Context, req echo) (echo, error) {
+			return req, nil
+		}),
+		httpbp.DecompressRequest(httpbp.DecompressRequestArgs{MaxBytes: 64}),
+	)
+
+	for _, c := range []struct {
+		name     string
+		encoding string
+		body     []byte
+		code     int
+		expected string
+	}{
+		{
+			name:     "gzip",
+			encoding: httpbp.EncodingGzip,
+			body:     gzipBytes(t, `{"message":"hello"}`),
+			code:     http.StatusOK,
+			expected: `{"message":"hello"}`,
+		},
+		{
+			name:     "identity",
+			body:     []byte(`{"message":"hello"}`),
+			code:     http.StatusOK,
+			expected: `{"message":"hello"}`,
+		},
+		{
+			name:     "bomb",
+			encoding: httpbp.EncodingGzip,
+			body:     gzipBytes(t, `{"message":"`+strings.Repeat("a", 1<<20)+`"}`),
+			code:     http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "malformed",
+			encoding: httpbp.EncodingGzip,
+			body:     []byte("hello"),
+			code:     http.StatusBadRequest,
+		},
+		{
+			name:     "unsupported",
+			encoding: "br",
+			body:     []byte("hello"),
+			code:     http.StatusUnsupportedMediaType,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(c.body))
+			if c.encoding != "" {
+				req.Header.Set(httpbp.ContentEncodingHeader, c.encoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != c.code {
+				t.Fatalf("Expected code %d, got %d: %s", c.code, w.Code, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); c.expected != "" && got != c.expected {
+				t.Errorf("Expected body %q, got %q", c.expected, got)
+			}
+		})
+	}
+}
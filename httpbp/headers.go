@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/reddit/baseplate.go/secrets"
 	"github.com/reddit/baseplate.go/signing"
+	"github.com/reddit/baseplate.go/tracing"
 )
 
 const (
@@ -121,6 +123,41 @@ var (
 	_ Headers = SpanHeaders{}
 )
 
+// BaseplatePropagator is the tracing.Propagator for the Baseplate HTTP span
+// headers (X-Trace, X-Span, X-Parent, X-Flags and X-Sampled).
+//
+// It's the default propagator used by InjectServerSpan and InjectSpanHeaders,
+// and can be combined with other formats by tracing.NewPropagators.
+type BaseplatePropagator struct{}
+
+var _ tracing.Propagator = BaseplatePropagator{}
+
+// Extract implements tracing.Propagator.
+func (BaseplatePropagator) Extract(carrier tracing.HeaderCarrier) (tracing.Headers, bool) {
+	var headers tracing.Headers
+	headers.TraceID = carrier.Get(TraceIDHeader)
+	headers.SpanID = carrier.Get(SpanIDHeader)
+	headers.Flags = carrier.Get(SpanFlagsHeader)
+	if value := carrier.Get(SpanSampledHeader); value != "" {
+		sampled := value == spanSampledTrue
+		headers.Sampled = &sampled
+	}
+	return headers, headers.AnySet()
+}
+
+// Inject implements tracing.Propagator.
+func (BaseplatePropagator) Inject(span *tracing.Span, carrier tracing.HeaderCarrier) {
+	carrier.Set(TraceIDHeader, span.TraceID())
+	carrier.Set(SpanIDHeader, span.ID())
+	carrier.Set(SpanFlagsHeader, strconv.FormatInt(span.Flags(), 10))
+	if span.ParentID() != "" {
+		carrier.Set(ParentIDHeader, span.ParentID())
+	}
+	if span.Sampled() {
+		carrier.Set(SpanSampledHeader, spanSampledTrue)
+	}
+}
+
 // HeaderTrustHandler provides an interface PopulateBaseplateRequestContext to
 // verify that it should trust the HTTP headers it receives.
 type HeaderTrustHandler interface {
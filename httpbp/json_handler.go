@@ -0,0 +1,219 @@
+package httpbp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxJSONRequestBytes is the default max size of the request bodies
+// decoded by JSONHandler.
+const DefaultMaxJSONRequestBytes = 1 << 20 // 1 MiB
+
+// Validator is the interface implemented by the request types of JSONHandler
+// that need to be validated after being decoded.
+//
+// Validate can be implemented with either a value or a pointer receiver.
+type Validator interface {
+	Validate() error
+}
+
+// FieldErrors is an error mapping invalid fields to error messages.
+//
+// When returned (or wrapped) by Validator.Validate, they are used as the
+// Details of the 422 error response returned by JSONHandler.
+//
+// The messages of the errors returned by Validate are returned to the caller
+// either way, so they should be something you are comfortable presenting to an
+// end-user.
+type FieldErrors map[string]string
+
+// Error implements error.
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var sb strings.Builder
+	sb.WriteString("httpbp: invalid fields: ")
+	for i, field := range fields {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(field)
+		sb.WriteString(": ")
+		sb.WriteString(e[field])
+	}
+	return sb.String()
+}
+
+// JSONHandlerArgs defines the args used by JSONHandlerWithArgs.
+type JSONHandlerArgs struct {
+	// MaxRequestBytes is the max size of the request body.
+	//
+	// Requests with larger bodies are rejected with a 413 error.
+	//
+	// Optional, default to DefaultMaxJSONRequestBytes.
+	MaxRequestBytes int64
+
+	// DisallowUnknownFields rejects the requests containing fields that are not
+	// in the request type with a 400 error.
+	DisallowUnknownFields bool
+
+	// Code is the status code of the successful responses.
+	//
+	// Optional, default to http.StatusOK (200).
+	Code int
+}
+
+// JSONHandler calls JSONHandlerWithArgs with the default args.
+func JSONHandler[Req, Resp any](handle func(ctx context.Context, req Req) (Resp, error)) HandlerFunc {
+	return JSONHandlerWithArgs(JSONHandlerArgs{}, handle)
+}
+
+// JSONHandlerWithArgs adapts a function over typed request and response
+// structs into a HandlerFunc.
+//
+// The returned HandlerFunc:
+//
+// 1. Decodes the JSON request body into Req, with the size limit in args.
+// An empty body leaves Req as the zero value.
+// Malformed bodies are rejected with a 400 error (BadRequest),
+// with the invalid fields in the Details when possible.
+//
+// When Req is a pointer type, an empty or null body is rejected with a 400
+// error (BadRequest), so handle never gets a nil Req.
+//
+// 2. Calls Validate if Req (or a pointer to Req) implements Validator.
+// Validation errors are returned as a 422 error (UnprocessableEntity),
+// with the FieldErrors as the Details if the error is a FieldErrors,
+// or the error message as the "body" detail otherwise.
+//
+// 3. Calls handle and writes the Resp returned as JSON.
+// Errors returned by handle are returned as-is, so handle can return an
+// HTTPError to customize the error response.
+//
+// The context passed to handle is the one passed to the HandlerFunc,
+// so PathParam and friends can be used to read the path parameters.
+func JSONHandlerWithArgs[Req, Resp any](args JSONHandlerArgs, handle func(ctx context.Context, req Req) (Resp, error)) HandlerFunc {
+	maxBytes := args.MaxRequestBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxJSONRequestBytes
+	}
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var req Req
+		if err := decodeJSONRequest(w, r, maxBytes, args.DisallowUnknownFields, &req); err != nil {
+			return err
+		}
+		if isNilPointer(&req) {
+			return JSONError(
+				BadRequest().WithDetails(map[string]string{
+					bodyDetailsKey: "required",
+				}),
+				errors.New("httpbp: empty or null JSON request"),
+			)
+		}
+		if err := validate(&req); err != nil {
+			return validationError(err)
+		}
+
+		resp, err := handle(ctx, req)
+		if err != nil {
+			return err
+		}
+		return WriteJSON(w, NewResponse(resp).WithCode(args.Code))
+	}
+}
+
+// isNilPointer returns true if Req is a pointer type and *req is nil, e.g. when
+// the request body is empty or null.
+func isNilPointer[Req any](req *Req) bool {
+	v := reflect.ValueOf(req).Elem()
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// validate calls Validate if either Req or *Req implements Validator.
+func validate[Req any](req *Req) error {
+	if v, ok := any(*req).(Validator); ok {
+		return v.Validate()
+	}
+	if v, ok := any(req).(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+func decodeJSONRequest(w http.ResponseWriter, r *http.Request, maxBytes int64, disallowUnknownFields bool, v any) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	if disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return decodeError(err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("unexpected data after the JSON value")
+		}
+		return decodeError(err)
+	}
+	return nil
+}
+
+const bodyDetailsKey = "body"
+
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return JSONError(
+			PayloadTooLarge().WithDetails(map[string]string{
+				bodyDetailsKey: fmt.Sprintf("must be at most %d bytes", maxBytesErr.Limit),
+			}),
+			err,
+		)
+	}
+
+	details := make(map[string]string, 1)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		details[typeErr.Field] = fmt.Sprintf("must be %s, got %s", typeErr.Type, typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json does not export the error type for unknown fields.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		details[field] = "unknown field"
+	default:
+		details[bodyDetailsKey] = "invalid JSON"
+	}
+	return JSONError(
+		BadRequest().WithDetails(details),
+		fmt.Errorf("httpbp: failed to decode JSON request: %w", err),
+	)
+}
+
+func validationError(err error) error {
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		return JSONError(UnprocessableEntity().WithDetails(fieldErrs), err)
+	}
+	return JSONError(
+		UnprocessableEntity().WithDetails(map[string]string{
+			bodyDetailsKey: err.Error(),
+		}),
+		err,
+	)
+}
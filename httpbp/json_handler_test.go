@@ -0,0 +1,222 @@
+package httpbp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/reddit/baseplate.go/httpbp"
+)
+
+type greetRequest struct {
+	Name  string `json:"name"`
+	Times int    `json:"times"`
+}
+
+func (r *greetRequest) Validate() error {
+	errs := httpbp.FieldErrors{}
+	if r.Name == "" {
+		errs["name"] = "required"
+	}
+	if r.Times < 0 {
+		errs["times"] = "must be >= 0"
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestJSONHandler(t *testing.T) {
+	greet := func(_ context.Context, req greetRequest) (greetResponse, error) {
+		if req.Name == "teapot" {
+			return greetResponse{}, httpbp.JSONError(httpbp.Teapot(), errors.New("teapot"))
+		}
+		return greetResponse{
+			Greeting: "hello " + strings.Repeat(req.Name, max(req.Times, 1)),
+		}, nil
+	}
+	handler := httpbp.NewHandler("greet", httpbp.JSONHandlerWithArgs(
+		httpbp.JSONHandlerArgs{
+			MaxRequestBytes:       64,
+			DisallowUnknownFields: true,
+			Code:                  http.StatusCreated,
+		},
+		greet,
+	))
+
+	for _, c := range []struct {
+		name    string
+		body    string
+		code    int
+		resp    greetResponse
+		reason  string
+		details map[string]string
+	}{
+		{
+			name: "success",
+			body: `{"name":"foo","times":2}`,
+			code: http.StatusCreated,
+			resp: greetResponse{Greeting: "hello foofoo"},
+		},
+		{
+			name:    "empty-body",
+			code:    http.StatusUnprocessableEntity,
+			reason:  "UNPROCESSABLE_ENTITY",
+			details: map[string]string{"name": "required"},
+		},
+		{
+			name:    "validation",
+			body:    `{"times":-1}`,
+			code:    http.StatusUnprocessableEntity,
+			reason:  "UNPROCESSABLE_ENTITY",
+			details: map[string]string{"name": "required", "times": "must be >= 0"},
+		},
+		{
+			name:    "malformed",
+			body:    `{"name":`,
+			code:    http.StatusBadRequest,
+			reason:  "BAD_REQUEST",
+			details: map[string]string{"body": "invalid JSON"},
+		},
+		{
+			name:    "trailing-data",
+			body:    `{"name":"foo"} {}`,
+			code:    http.StatusBadRequest,
+			reason:  "BAD_REQUEST",
+			details: map[string]string{"body": "invalid JSON"},
+		},
+		{
+			name:    "wrong-type",
+			body:    `{"name":"foo","times":"1"}`,
+			code:    http.StatusBadRequest,
+			reason:  "BAD_REQUEST",
+			details: map[string]string{"times": "must be int, got string"},
+		},
+		{
+			name:    "unknown-field",
+			body:    `{"name":"foo","foo":1}`,
+			code:    http.StatusBadRequest,
+			reason:  "BAD_REQUEST",
+			details: map[string]string{"foo": "unknown field"},
+		},
+		{
+			name:    "too-large",
+			body:    `{"name":"` + strings.Repeat("a", 64) + `"}`,
+			code:    http.StatusRequestEntityTooLarge,
+			reason:  "PAYLOAD_TOO_LARGE",
+			details: map[string]string{"body": "must be at most 64 bytes"},
+		},
+		{
+			name:   "handler-error",
+			body:   `{"name":"teapot"}`,
+			code:   http.StatusTeapot,
+			reason: "TEAPOT",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader(c.body))
+			if c.body == "" {
+				req.Body = http.NoBody
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != c.code {
+				t.Fatalf("Expected code %d, got %d: %s", c.code, w.Code, w.Body.String())
+			}
+			if c.reason == "" {
+				var resp greetResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(resp, c.resp); diff != "" {
+					t.Errorf("Response mismatch (-got +want):\n%s", diff)
+				}
+				return
+			}
+			var wrapper httpbp.ErrorResponseJSONWrapper
+			if err := json.Unmarshal(w.Body.Bytes(), &wrapper); err != nil {
+				t.Fatal(err)
+			}
+			resp := wrapper.Error
+			if resp.Reason != c.reason {
+				t.Errorf("Expected reason %q, got %q", c.reason, resp.Reason)
+			}
+			if diff := cmp.Diff(resp.Details, c.details); diff != "" {
+				t.Errorf("Details mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONHandlerPointerRequest(t *testing.T) {
+	handler := httpbp.NewHandler("greet", httpbp.JSONHandler(
+		func(_ context.Context, req *greetRequest) (greetResponse, error) {
+			return greetResponse{Greeting: "hello " + req.Name}, nil
+		},
+	))
+
+	for _, c := range []struct {
+		name    string
+		body    string
+		code    int
+		details map[string]string
+	}{
+		{
+			name: "success",
+			body: `{"name":"foo"}`,
+			code: http.StatusOK,
+		},
+		{
+			name:    "validation",
+			body:    `{"times":-1}`,
+			code:    http.StatusUnprocessableEntity,
+			details: map[string]string{"name": "required", "times": "must be >= 0"},
+		},
+		{
+			name:    "null",
+			body:    `null`,
+			code:    http.StatusBadRequest,
+			details: map[string]string{"body": "required"},
+		},
+		{
+			name:    "empty-body",
+			code:    http.StatusBadRequest,
+			details: map[string]string{"body": "required"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader(c.body))
+			if c.body == "" {
+				req.Body = http.NoBody
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != c.code {
+				t.Fatalf("Expected code %d, got %d: %s", c.code, w.Code, w.Body.String())
+			}
+			if c.details == nil {
+				return
+			}
+			var wrapper httpbp.ErrorResponseJSONWrapper
+			if err := json.Unmarshal(w.Body.Bytes(), &wrapper); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(wrapper.Error.Details, c.details); diff != "" {
+				t.Errorf("Details mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
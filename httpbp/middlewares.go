@@ -23,6 +23,7 @@ import (
 	"github.com/reddit/baseplate.go/log"
 	"github.com/reddit/baseplate.go/metricsbp"
 	"github.com/reddit/baseplate.go/prometheusbp"
+	"github.com/reddit/baseplate.go/ratelimitbp"
 	"github.com/reddit/baseplate.go/tracing"
 )
 
@@ -75,6 +76,9 @@ type DefaultMiddlewareArgs struct {
 //
 //  1. InjectEdgeRequestContext
 //  2. PrometheusServerMetrics
+//
+// InjectLogCorrelation is not included, as it must come after the server span
+// is injected. NewBaseplateServer adds it after ServerArgs.Middlewares.
 func DefaultMiddleware(args DefaultMiddlewareArgs) []Middleware {
 	if args.TrustHandler == nil {
 		args.TrustHandler = NeverTrustHeaders{}
@@ -85,15 +89,15 @@ func DefaultMiddleware(args DefaultMiddlewareArgs) []Middleware {
 	}
 }
 
-func isHeaderSet(h http.Header, key string) bool {
-	return len(h.Values(key)) > 0
-}
-
 // StartSpanFromTrustedRequest starts a server span using the Span headers from
 // the given request if the provided HeaderTrustHandler confirms that they can
 // be trusted and the Span headers are provided, otherwise it starts a new
 // server span.
 //
+// Only the Baseplate span headers are used,
+// use StartSpanFromTrustedRequestWithPropagator to support other header
+// formats.
+//
 // StartSpanFromTrustedRequest is used by InjectServerSpan and should not
 // generally be used directly but is provided for testing purposes or use cases
 // that are not covered by Baseplate.
@@ -103,23 +107,28 @@ func StartSpanFromTrustedRequest(
 	truster HeaderTrustHandler,
 	r *http.Request,
 ) (context.Context, *tracing.Span) {
-	var spanHeaders tracing.Headers
-	var sampled bool
+	return StartSpanFromTrustedRequestWithPropagator(ctx, name, truster, BaseplatePropagator{}, r)
+}
+
+// StartSpanFromTrustedRequestWithPropagator is the same as
+// StartSpanFromTrustedRequest,
+// except that the span headers are extracted by the given propagator.
+//
+// If propagator is nil, BaseplatePropagator will be used.
+func StartSpanFromTrustedRequestWithPropagator(
+	ctx context.Context,
+	name string,
+	truster HeaderTrustHandler,
+	propagator tracing.Propagator,
+	r *http.Request,
+) (context.Context, *tracing.Span) {
+	if propagator == nil {
+		propagator = BaseplatePropagator{}
+	}
 
+	var spanHeaders tracing.Headers
 	if truster.TrustSpan(r) {
-		if isHeaderSet(r.Header, TraceIDHeader) {
-			spanHeaders.TraceID = r.Header.Get(TraceIDHeader)
-		}
-		if isHeaderSet(r.Header, SpanIDHeader) {
-			spanHeaders.SpanID = r.Header.Get(SpanIDHeader)
-		}
-		if isHeaderSet(r.Header, SpanFlagsHeader) {
-			spanHeaders.Flags = r.Header.Get(SpanFlagsHeader)
-		}
-		if isHeaderSet(r.Header, SpanSampledHeader) {
-			sampled = r.Header.Get(SpanSampledHeader) == spanSampledTrue
-			spanHeaders.Sampled = &sampled
-		}
+		spanHeaders, _ = propagator.Extract(r.Header)
 	}
 
 	return tracing.StartSpanFromHeaders(ctx, name, spanHeaders)
@@ -145,10 +154,47 @@ func httpErrorSuppressor(err error) bool {
 // If the function returns an error that's an HTTPError with a status code < 500,
 // then it will not be passed to span.Stop, otherwise it will.
 //
+// Only the Baseplate span headers are used,
+// use InjectServerSpanWithArgs to support other header formats.
+//
 // InjectServerSpan should generally not be used directly, instead use the
 // NewBaseplateServer function which will automatically include InjectServerSpan
 // as one of the Middlewares to wrap your handlers in.
 func InjectServerSpan(truster HeaderTrustHandler) Middleware {
+	return InjectServerSpanWithArgs(InjectServerSpanArgs{
+		TrustHandler: truster,
+	})
+}
+
+// InjectServerSpanArgs are the args to be passed into InjectServerSpanWithArgs
+// function.
+type InjectServerSpanArgs struct {
+	// The HeaderTrustHandler to use.
+	// If empty, NeverTrustHeaders will be used instead.
+	TrustHandler HeaderTrustHandler
+
+	// The Propagator used to extract the span headers from the request,
+	// usually created by tracing.NewPropagators with BaseplatePropagator.
+	//
+	// For example, to accept W3C Trace Context headers from services
+	// instrumented by OpenTelemetry in addition to the Baseplate headers:
+	//
+	//	propagator, err := tracing.NewPropagators(
+	//	  httpbp.BaseplatePropagator{},
+	//	  tracing.PropagationFormatBaseplate,
+	//	  tracing.PropagationFormatW3C,
+	//	)
+	//
+	// Please note that the headers are only extracted when TrustHandler
+	// trusts the span headers of the request.
+	//
+	// If empty, BaseplatePropagator will be used.
+	Propagator tracing.Propagator
+}
+
+// InjectServerSpanWithArgs is the same as InjectServerSpan,
+// except that it allows the span header formats to be selected.
+func InjectServerSpanWithArgs(args InjectServerSpanArgs) Middleware {
 	if internalv2compat.V2TracingHTTPServerMiddleware() != nil {
 		// Skip span middleware, because v2 needs the endpoint.  The v2 middleware is injected at the endpoint level.
 		return func(name string, next HandlerFunc) HandlerFunc {
@@ -156,11 +202,16 @@ func InjectServerSpan(truster HeaderTrustHandler) Middleware {
 		}
 	}
 
+	truster := args.TrustHandler
+	if truster == nil {
+		truster = NeverTrustHeaders{}
+	}
+	propagator := args.Propagator
 	// TODO: make a breaking change to allow us to pass in a Suppressor
 	var suppressor errorsbp.Suppressor = httpErrorSuppressor
 	return func(name string, next HandlerFunc) HandlerFunc {
 		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) (err error) {
-			ctx, span := StartSpanFromTrustedRequest(ctx, name, truster, r)
+			ctx, span := StartSpanFromTrustedRequestWithPropagator(ctx, name, truster, propagator, r)
 			defer func() {
 				span.FinishWithOptions(tracing.FinishOptions{
 					Ctx: ctx,
@@ -245,6 +296,60 @@ func InjectEdgeRequestContext(args InjectEdgeRequestContextArgs) Middleware {
 	}
 }
 
+// InjectLogCorrelation is a Middleware that attaches log.CorrelationFields
+// into the context object,
+// so that the logs of the request (via log.C and slog) carry the trace and
+// span ids of the server span, the endpoint name and the caller (from the
+// "User-Agent" header).
+//
+// It must be used after the server span is injected (e.g. by InjectServerSpan),
+// otherwise the trace and span ids are empty.
+//
+// InjectLogCorrelation should generally not be used directly, instead use the
+// NewBaseplateServer function which will automatically include
+// InjectLogCorrelation as one of the Middlewares to wrap your handlers in,
+// after ServerArgs.Middlewares.
+func InjectLogCorrelation(name string, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		ctx = tracing.AttachLogCorrelation(ctx, name, r.UserAgent())
+		return next(ctx, w, r)
+	}
+}
+
+// RateLimit returns a Middleware rejecting the requests exceeding the rate
+// limits of the limiter.
+//
+// The rejected requests get a 429 error response (TooManyRequests) with the
+// Retry-After header set.
+//
+// The caller of the request (for ratelimitbp.CallerKey) is read from the
+// verified baseplate headers (see ratelimitbp.IncomingCaller), falling back to
+// the "User-Agent" header when there's none, so RateLimit should be used after
+// ServerBaseplateHeadersMiddleware.
+// ratelimitbp.OAuthClientKey relies on the InjectEdgeRequestContext
+// middleware, so RateLimit should be used after DefaultMiddleware,
+// e.g. in ServerArgs.Middlewares.
+func RateLimit(limiter *ratelimitbp.Limiter) Middleware {
+	return func(name string, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx = ratelimitbp.WithCaller(ctx, ratelimitbp.IncomingCaller(ctx, r.UserAgent()))
+			if err := limiter.Allow(ctx); err != nil {
+				var limited *ratelimitbp.LimitedError
+				if errors.As(err, &limited) {
+					// Retry-After only supports whole seconds.
+					retryAfter := limited.RetryAfter.Truncate(time.Second)
+					if retryAfter < limited.RetryAfter {
+						retryAfter += time.Second
+					}
+					return JSONError(TooManyRequests().Retryable(w, retryAfter), err)
+				}
+				return err
+			}
+			return next(ctx, w, r)
+		}
+	}
+}
+
 // SupportedMethods returns a middleware that checks if the request is made
 // using one of the given HTTP methods.
 //
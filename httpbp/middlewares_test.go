@@ -13,8 +13,11 @@ import (
 
 	"github.com/reddit/baseplate.go"
 	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/headerbp"
 	"github.com/reddit/baseplate.go/httpbp"
 	"github.com/reddit/baseplate.go/log"
+	"github.com/reddit/baseplate.go/ratelimitbp"
+	"github.com/reddit/baseplate.go/tracing"
 )
 
 func TestWrap(t *testing.T) {
@@ -96,6 +99,94 @@ func TestInjectEdgeRequestContext(t *testing.T) {
 	}
 }
 
+func TestInjectLogCorrelation(t *testing.T) {
+	ctx, span := tracing.StartTopLevelServerSpan(context.Background(), "test")
+	defer span.Stop(ctx, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "caller")
+
+	var got log.CorrelationFields
+	handle := httpbp.Wrap(
+		"endpoint",
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			got, _ = log.CorrelationFromContext(ctx)
+			return nil
+		},
+		httpbp.InjectLogCorrelation,
+	)
+	if err := handle(ctx, httptest.NewRecorder(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	want := log.CorrelationFields{
+		TraceID:  span.TraceID(),
+		SpanID:   span.ID(),
+		Endpoint: "endpoint",
+		Caller:   "caller",
+	}
+	if got != want {
+		t.Errorf("Got correlation fields %+v, want %+v", got, want)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimitbp.NewLimiter(ratelimitbp.Config{
+		Classes: map[string]ratelimitbp.ClassConfig{
+			ratelimitbp.KeyClassCaller: {
+				Default: &ratelimitbp.Limit{Rate: 0.5},
+			},
+		},
+	}, ratelimitbp.LimiterArgs{})
+	handler := httpbp.NewHandler(
+		"test",
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			return nil
+		},
+		// Stands in for ServerBaseplateHeadersMiddleware with verified headers.
+		func(name string, next httpbp.HandlerFunc) httpbp.HandlerFunc {
+			return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				headers := headerbp.NewIncomingHeaders()
+				for k, v := range r.Header {
+					headers.RecordHeader(k, v[0])
+				}
+				return next(headers.SetOnContext(ctx), w, r)
+			}
+		},
+		httpbp.RateLimit(limiter),
+	)
+
+	for _, c := range []struct {
+		caller     string
+		bpCaller   string
+		code       int
+		retryAfter string
+	}{
+		{caller: "foo", code: http.StatusOK},
+		{caller: "foo", code: http.StatusTooManyRequests, retryAfter: "2"},
+		{caller: "bar", code: http.StatusOK},
+		{code: http.StatusOK},
+		{code: http.StatusOK},
+		// The caller from the baseplate headers takes precedence over User-Agent.
+		{caller: "baz", bpCaller: "qux", code: http.StatusOK},
+		{caller: "other", bpCaller: "qux", code: http.StatusTooManyRequests, retryAfter: "2"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", c.caller)
+		if c.bpCaller != "" {
+			r.Header.Set(ratelimitbp.CallerHeader, c.bpCaller)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%q: expected code %d, got %d", c.caller, c.code, w.Code)
+		}
+		if got := w.Header().Get(httpbp.RetryAfterHeader); got != c.retryAfter {
+			t.Errorf("%q: expected Retry-After %q, got %q", c.caller, c.retryAfter, got)
+		}
+	}
+}
+
 func TestSupportedMethods(t *testing.T) {
 	t.Parallel()
 
@@ -357,3 +448,69 @@ func (p *pushableResponseRecorder) Push(target string, opts *http.PushOptions) e
 	p.Pushed = true
 	return nil
 }
+
+func TestStartSpanFromTrustedRequestWithPropagator(t *testing.T) {
+	propagator, err := tracing.NewPropagators(
+		httpbp.BaseplatePropagator{},
+		tracing.PropagationFormatBaseplate,
+		tracing.PropagationFormatW3C,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		label           string
+		truster         httpbp.HeaderTrustHandler
+		headers         map[string]string
+		expectedTraceID string
+		expectedParent  string
+	}{
+		{
+			label:   "baseplate",
+			truster: httpbp.AlwaysTrustHeaders{},
+			headers: map[string]string{
+				httpbp.TraceIDHeader: "12345",
+				httpbp.SpanIDHeader:  "67890",
+			},
+			expectedTraceID: "12345",
+			expectedParent:  "67890",
+		},
+		{
+			label:   "w3c",
+			truster: httpbp.AlwaysTrustHeaders{},
+			headers: map[string]string{
+				tracing.W3CTraceParentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			expectedParent:  "00f067aa0ba902b7",
+		},
+		{
+			label:   "untrusted",
+			truster: httpbp.NeverTrustHeaders{},
+			headers: map[string]string{
+				tracing.W3CTraceParentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range c.headers {
+				r.Header.Set(k, v)
+			}
+			_, span := httpbp.StartSpanFromTrustedRequestWithPropagator(
+				context.Background(),
+				"test",
+				c.truster,
+				propagator,
+				r,
+			)
+			if c.expectedTraceID != "" && span.TraceID() != c.expectedTraceID {
+				t.Errorf("Expected trace id %q, got %q", c.expectedTraceID, span.TraceID())
+			}
+			if span.ParentID() != c.expectedParent {
+				t.Errorf("Expected parent id %q, got %q", c.expectedParent, span.ParentID())
+			}
+		})
+	}
+}
@@ -127,6 +127,16 @@ var (
 	}, clientActiveRequestsLabels)
 )
 
+var (
+	clientCoalescedRequestsCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "httpbp_client_coalesced_requests_total",
+		Help: "The number of http client requests served by the response of another identical in-flight request",
+	}, []string{
+		methodLabel,
+		clientNameLabel,
+	})
+)
+
 var (
 	panicRecoverLabels = []string{
 		methodLabel,
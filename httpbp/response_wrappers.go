@@ -12,11 +12,19 @@ const (
 	pusher
 )
 
+// wrapResponseWriter returns wrapped with the optional interfaces implemented
+// by orig.
+//
+// If wrapped implements http.Flusher itself (e.g. to flush its own buffers
+// first), its Flush is used instead of the one of orig.
 func wrapResponseWriter(orig, wrapped http.ResponseWriter) http.ResponseWriter {
 	var w optionalResponseWriter
 	f, isFlusher := orig.(http.Flusher)
 	if isFlusher {
 		w |= flusher
+		if wf, ok := wrapped.(http.Flusher); ok {
+			f = wf
+		}
 	}
 	h, isHijacker := orig.(http.Hijacker)
 	if isHijacker {
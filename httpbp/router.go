@@ -0,0 +1,341 @@
+package httpbp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	//lint:ignore SA1019 This library is internal only, not actually deprecated
+	"github.com/reddit/baseplate.go/internalv2compat"
+)
+
+// Router is an EndpointRegistry routing requests by HTTP method and path
+// template, built on top of the patterns of http.ServeMux.
+//
+// Routes are registered with path templates using the http.ServeMux wildcard
+// syntax, e.g. "/users/{id}" or "/files/{path...}", and the values of the
+// wildcards can be read from the context via PathParam and its typed variants.
+//
+// The path template of a route (including the prefix of its group) is used as
+// the "name" passed to all the Middleware wrapping its HandlerFunc, so it's
+// used as the endpoint label of PrometheusServerMetrics and the name of the
+// server span, instead of the raw URL.
+//
+// When a request matches the path template of a route but not any of its
+// methods, Router responds with a 405 error with the Allow header set.
+// If GET is registered to a route, HEAD will be supported automatically.
+//
+// A Router should be created via NewRouter and passed to NewBaseplateServer via
+// ServerArgs.Router, which will wrap all its routes with the default Baseplate
+// Middleware as well as ServerArgs.Middlewares. All the routes must be
+// registered before the server starts.
+type Router struct {
+	prefix      string
+	middlewares []Middleware
+	state       *routerState
+}
+
+// routerState is shared by a Router and all its groups.
+type routerState struct {
+	mux    *http.ServeMux
+	routes map[string]*route
+
+	// middlewares set by SetupEndpoints to wrap all the routes.
+	middlewares []Middleware
+}
+
+// NewRouter creates a new Router wrapping all its routes with the given
+// middlewares.
+func NewRouter(middlewares ...Middleware) *Router {
+	return &Router{
+		middlewares: middlewares,
+		state: &routerState{
+			mux:    http.NewServeMux(),
+			routes: make(map[string]*route),
+		},
+	}
+}
+
+// Group returns a Router registering routes under the path prefix to the same
+// Router, wrapped by the middlewares of r followed by the given middlewares.
+//
+// prefix can be empty to only add middlewares to a group of routes.
+func (r *Router) Group(prefix string, middlewares ...Middleware) *Router {
+	return &Router{
+		prefix:      joinRoutePath(r.prefix, prefix),
+		middlewares: append(r.middlewares[:len(r.middlewares):len(r.middlewares)], middlewares...),
+		state:       r.state,
+	}
+}
+
+// Route registers handle to the path template and method, wrapped by the
+// middlewares of the Router followed by the given middlewares.
+//
+// Like http.ServeMux.Handle, it panics if the method is not a valid HTTP method,
+// the path template is invalid, or the method is already registered to the
+// path template.
+func (r *Router) Route(method, pathTemplate string, handle HandlerFunc, middlewares ...Middleware) {
+	method = strings.ToUpper(method)
+	if !allHTTPMethods[method] {
+		panic(fmt.Sprintf("httpbp: invalid method %q for route %q", method, pathTemplate))
+	}
+	if handle == nil {
+		panic(fmt.Sprintf("httpbp: nil HandlerFunc for route %s %q", method, pathTemplate))
+	}
+	pathTemplate = joinRoutePath(r.prefix, pathTemplate)
+
+	rt, ok := r.state.routes[pathTemplate]
+	if !ok {
+		params, err := routeParams(pathTemplate)
+		if err != nil {
+			panic(fmt.Sprintf("httpbp: %v", err))
+		}
+		rt = &route{
+			path:    pathTemplate,
+			params:  params,
+			methods: make(map[string]routeMethod),
+		}
+		r.state.mux.Handle(pathTemplate, rt)
+		r.state.routes[pathTemplate] = rt
+	}
+	if _, ok := rt.methods[method]; ok {
+		panic(fmt.Sprintf("httpbp: route %s %q is already registered", method, pathTemplate))
+	}
+
+	wrappers := make([]Middleware, 0, len(r.middlewares)+len(middlewares))
+	wrappers = append(wrappers, r.middlewares...)
+	wrappers = append(wrappers, middlewares...)
+	rt.methods[method] = routeMethod{
+		handle:      handle,
+		middlewares: wrappers,
+	}
+	rt.compile(r.state.middlewares)
+}
+
+// Get registers a GET (and HEAD) route, see Route for details.
+func (r *Router) Get(pathTemplate string, handle HandlerFunc, middlewares ...Middleware) {
+	r.Route(http.MethodGet, pathTemplate, handle, middlewares...)
+}
+
+// Post registers a POST route, see Route for details.
+func (r *Router) Post(pathTemplate string, handle HandlerFunc, middlewares ...Middleware) {
+	r.Route(http.MethodPost, pathTemplate, handle, middlewares...)
+}
+
+// Put registers a PUT route, see Route for details.
+func (r *Router) Put(pathTemplate string, handle HandlerFunc, middlewares ...Middleware) {
+	r.Route(http.MethodPut, pathTemplate, handle, middlewares...)
+}
+
+// Patch registers a PATCH route, see Route for details.
+func (r *Router) Patch(pathTemplate string, handle HandlerFunc, middlewares ...Middleware) {
+	r.Route(http.MethodPatch, pathTemplate, handle, middlewares...)
+}
+
+// Delete registers a DELETE route, see Route for details.
+func (r *Router) Delete(pathTemplate string, handle HandlerFunc, middlewares ...Middleware) {
+	r.Route(http.MethodDelete, pathTemplate, handle, middlewares...)
+}
+
+// Handle implements EndpointRegistry by registering the handler to the
+// underlying http.ServeMux as-is.
+//
+// It's used to register ServerArgs.Endpoints when ServerArgs.Router is set.
+func (r *Router) Handle(pattern string, handler http.Handler) {
+	r.state.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.state.mux.ServeHTTP(w, req)
+}
+
+// setMiddlewares sets the middlewares wrapping all the routes of the Router,
+// outside of the middlewares of the routes themselves.
+func (r *Router) setMiddlewares(middlewares []Middleware) {
+	r.state.middlewares = middlewares
+	for _, rt := range r.state.routes {
+		rt.compile(middlewares)
+	}
+}
+
+var (
+	_ EndpointRegistry = (*Router)(nil)
+)
+
+type routeMethod struct {
+	handle      HandlerFunc
+	middlewares []Middleware
+}
+
+// route is the http.Handler registered to the http.ServeMux for a path
+// template, dispatching requests by their methods.
+type route struct {
+	path    string
+	params  []string
+	methods map[string]routeMethod
+
+	handler http.Handler
+}
+
+// compile rebuilds the handler of the route with the given outer middlewares.
+func (rt *route) compile(outer []Middleware) {
+	handlers := make(map[string]HandlerFunc, len(rt.methods)+1)
+	allowed := make([]string, 0, len(rt.methods))
+	for method, m := range rt.methods {
+		// recoverPanik is always the final middleware in the chain, see
+		// httpHandlerFactory.NewHandler.
+		wrappers := make([]Middleware, 0, len(m.middlewares)+1)
+		wrappers = append(wrappers, m.middlewares...)
+		wrappers = append(wrappers, recoverPanik)
+		handlers[method] = Wrap(rt.path, m.handle, wrappers...)
+		allowed = append(allowed, method)
+	}
+	if _, ok := handlers[http.MethodHead]; !ok {
+		if get, ok := handlers[http.MethodGet]; ok {
+			handlers[http.MethodHead] = get
+		}
+	}
+	sort.Strings(allowed)
+
+	// The 405 responses are still wrapped by the outer middlewares so they are
+	// reported by the metrics of the route.
+	notAllowed := Wrap(
+		rt.path,
+		func(context.Context, http.ResponseWriter, *http.Request) error {
+			return nil
+		},
+		SupportedMethods(allowed[0], allowed[1:]...),
+	)
+	dispatch := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if handle, ok := handlers[r.Method]; ok {
+			return handle(ctx, w, r)
+		}
+		return notAllowed(ctx, w, r)
+	}
+
+	var h http.Handler = handler{handle: Wrap(rt.path, dispatch, outer...)}
+	if mw := internalv2compat.V2TracingHTTPServerMiddleware(); mw != nil {
+		h = mw(rt.path, h)
+	}
+	rt.handler = h
+}
+
+func (rt *route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(rt.params) > 0 {
+		params := make(map[string]string, len(rt.params))
+		for _, name := range rt.params {
+			params[name] = r.PathValue(name)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+	}
+	rt.handler.ServeHTTP(w, r)
+}
+
+// joinRoutePath joins the prefix of a group with a path template, keeping the
+// trailing slash of the path template.
+func joinRoutePath(prefix, pathTemplate string) string {
+	if prefix == "" {
+		return pathTemplate
+	}
+	if pathTemplate == "" {
+		return prefix
+	}
+	joined := path.Join(prefix, pathTemplate)
+	if strings.HasSuffix(pathTemplate, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// routeParams returns the names of the wildcards in the path template.
+//
+// Methods and hosts are not allowed in the path template as they are handled
+// by the Router.
+func routeParams(pathTemplate string) ([]string, error) {
+	if !strings.HasPrefix(pathTemplate, "/") {
+		return nil, fmt.Errorf("path template %q must start with \"/\"", pathTemplate)
+	}
+	var params []string
+	for _, segment := range strings.Split(pathTemplate, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(segment[1:len(segment)-1], "...")
+		if name == "$" {
+			continue
+		}
+		params = append(params, name)
+	}
+	return params, nil
+}
+
+type pathParamsKey struct{}
+
+// PathParams returns the values of all the path parameters of the route
+// matching the request, keyed by their names.
+//
+// It returns nil if the request was not routed by a Router or the route has no
+// path parameters.
+func PathParams(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(pathParamsKey{}).(map[string]string)
+	return params
+}
+
+// PathParam returns the value of the path parameter with the given name of the
+// route matching the request, e.g. "id" for "/users/{id}".
+//
+// It returns an empty string if there's no such path parameter.
+func PathParam(ctx context.Context, name string) string {
+	return PathParams(ctx)[name]
+}
+
+// ParsePathParam returns the value of the path parameter with the given name
+// parsed by parse.
+//
+// If the path parameter does not exist or parse returns an error, the error
+// returned is a 400 HTTPError with the name of the path parameter in its
+// details, so it can be returned by the HandlerFunc as-is.
+func ParsePathParam[T any](ctx context.Context, name string, parse func(string) (T, error)) (T, error) {
+	var zero T
+	value, ok := PathParams(ctx)[name]
+	if !ok {
+		return zero, pathParamError(name, "missing", fmt.Errorf("httpbp: path parameter %q not found", name))
+	}
+	v, err := parse(value)
+	if err != nil {
+		return zero, pathParamError(name, "invalid", fmt.Errorf("httpbp: invalid path parameter %q: %w", name, err))
+	}
+	return v, nil
+}
+
+// PathParamInt returns the value of the path parameter with the given name
+// parsed as a base 10 int64.
+//
+// See ParsePathParam for the errors returned.
+func PathParamInt(ctx context.Context, name string) (int64, error) {
+	return ParsePathParam(ctx, name, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+}
+
+// PathParamUint returns the value of the path parameter with the given name
+// parsed as a base 10 uint64.
+//
+// See ParsePathParam for the errors returned.
+func PathParamUint(ctx context.Context, name string) (uint64, error) {
+	return ParsePathParam(ctx, name, func(s string) (uint64, error) {
+		return strconv.ParseUint(s, 10, 64)
+	})
+}
+
+func pathParamError(name, detail string, cause error) error {
+	return JSONError(
+		BadRequest().WithDetails(map[string]string{name: detail}),
+		cause,
+	)
+}
@@ -0,0 +1,248 @@
+package httpbp_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/reddit/baseplate.go"
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/httpbp"
+)
+
+// tagMiddleware appends the tag to the X-Tags response header.
+func tagMiddleware(tag string) httpbp.Middleware {
+	return func(_ string, next httpbp.HandlerFunc) httpbp.HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add("X-Tags", tag)
+			return next(ctx, w, r)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	router := httpbp.NewRouter(tagMiddleware("root"))
+	router.Get("/users/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		id, err := httpbp.PathParamInt(ctx, "id")
+		if err != nil {
+			return err
+		}
+		return httpbp.WriteRawContent(w, httpbp.NewResponse(fmt.Sprintf("user %d", id)), httpbp.PlainTextContentType)
+	})
+	api := router.Group("/api/v1", tagMiddleware("api"))
+	api.Put(
+		"/files/{path...}",
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			return httpbp.WriteRawContent(w, httpbp.NewResponse("file "+httpbp.PathParam(ctx, "path")), httpbp.PlainTextContentType)
+		},
+		tagMiddleware("route"),
+	)
+	api.Delete("/files/{path...}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return nil
+	})
+
+	for _, c := range []struct {
+		method string
+		path   string
+		code   int
+		body   string
+		tags   []string
+		allow  string
+	}{
+		{
+			method: http.MethodGet,
+			path:   "/users/42",
+			code:   http.StatusOK,
+			body:   "user 42",
+			tags:   []string{"root"},
+		},
+		{
+			method: http.MethodHead,
+			path:   "/users/42",
+			code:   http.StatusOK,
+			tags:   []string{"root"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/users/foo",
+			code:   http.StatusBadRequest,
+			body:   `"id":"invalid"`,
+			tags:   []string{"root"},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/users/42",
+			code:   http.StatusMethodNotAllowed,
+			allow:  "GET,HEAD",
+		},
+		{
+			method: http.MethodPut,
+			path:   "/api/v1/files/a/b.txt",
+			code:   http.StatusOK,
+			body:   "file a/b.txt",
+			tags:   []string{"root", "api", "route"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/api/v1/files/a/b.txt",
+			code:   http.StatusMethodNotAllowed,
+			allow:  "DELETE,PUT",
+		},
+		{
+			method: http.MethodGet,
+			path:   "/foo",
+			code:   http.StatusNotFound,
+		},
+	} {
+		t.Run(c.method+" "+c.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+			if w.Code != c.code {
+				t.Errorf("Expected code %d, got %d", c.code, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), c.body) {
+				t.Errorf("Expected body to contain %q, got %q", c.body, w.Body.String())
+			}
+			if got, want := strings.Join(w.Header().Values("X-Tags"), ","), strings.Join(c.tags, ","); got != want {
+				t.Errorf("Expected middlewares %q, got %q", want, got)
+			}
+			if got := w.Header().Get(httpbp.AllowHeader); got != c.allow {
+				t.Errorf("Expected Allow header %q, got %q", c.allow, got)
+			}
+		})
+	}
+}
+
+func TestRouterPanics(t *testing.T) {
+	handle := func(context.Context, http.ResponseWriter, *http.Request) error {
+		return nil
+	}
+	for _, c := range []struct {
+		name     string
+		register func(*httpbp.Router)
+	}{
+		{
+			name: "invalid-method",
+			register: func(r *httpbp.Router) {
+				r.Route("FOO", "/foo", handle)
+			},
+		},
+		{
+			name: "invalid-path",
+			register: func(r *httpbp.Router) {
+				r.Get("foo", handle)
+			},
+		},
+		{
+			name: "duplicate",
+			register: func(r *httpbp.Router) {
+				r.Get("/foo/{id}", handle)
+				r.Group("/foo").Get("/{id}", handle)
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected panic")
+				}
+			}()
+			c.register(httpbp.NewRouter())
+		})
+	}
+}
+
+func TestRouterServerArgs(t *testing.T) {
+	store := newSecretsStore(t)
+	defer store.Close()
+
+	bp := baseplate.NewTestBaseplate(baseplate.NewTestBaseplateArgs{
+		Config:          baseplate.Config{Addr: ":8080"},
+		Store:           store,
+		EdgeContextImpl: ecinterface.Mock(),
+	})
+
+	var (
+		lock  sync.Mutex
+		names []string
+	)
+	recordName := func(name string, next httpbp.HandlerFunc) httpbp.HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			lock.Lock()
+			names = append(names, name)
+			lock.Unlock()
+			return next(ctx, w, r)
+		}
+	}
+
+	router := httpbp.NewRouter()
+	router.Group("/api").Get("/users/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return httpbp.WriteRawContent(w, httpbp.NewResponse(httpbp.PathParam(ctx, "id")), httpbp.PlainTextContentType)
+	})
+
+	if _, err := (httpbp.ServerArgs{
+		Baseplate:        bp,
+		Router:           router,
+		EndpointRegistry: http.NewServeMux(),
+	}).ValidateAndSetDefaults(); err == nil {
+		t.Error("Expected error for a different EndpointRegistry, got nil")
+	}
+
+	server, ts, err := httpbp.NewTestBaseplateServer(httpbp.ServerArgs{
+		Baseplate: bp,
+		Router:    router,
+		Endpoints: map[httpbp.Pattern]httpbp.Endpoint{
+			"/health": {
+				Name:    "health",
+				Methods: []string{http.MethodGet},
+				Handle: func(context.Context, http.ResponseWriter, *http.Request) error {
+					return nil
+				},
+			},
+		},
+		Middlewares: []httpbp.Middleware{recordName},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	for _, c := range []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{method: http.MethodGet, path: "/api/users/abc", code: http.StatusOK, body: "abc"},
+		{method: http.MethodPost, path: "/api/users/abc", code: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/health", code: http.StatusOK},
+	} {
+		req, err := http.NewRequest(c.method, ts.URL+c.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.code {
+			t.Errorf("%s %s: expected code %d, got %d", c.method, c.path, c.code, resp.StatusCode)
+		}
+		if c.body != "" && string(body) != c.body {
+			t.Errorf("%s %s: expected body %q, got %q", c.method, c.path, c.body, body)
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if got, want := strings.Join(names, ","), "/api/users/{id},/api/users/{id},health"; got != want {
+		t.Errorf("Expected endpoint names %q, got %q", want, got)
+	}
+}
@@ -124,6 +124,16 @@ type ServerArgs struct {
 	// server will not handle any Endpoints.
 	Endpoints map[Pattern]Endpoint
 
+	// Router is an optional Router with routes registered by method and path
+	// template.
+	//
+	// The routes will be wrapped by the same default Baseplate Middleware and
+	// Middlewares as Endpoints.
+	//
+	// If Router is set, it's also used as the EndpointRegistry, so
+	// EndpointRegistry must be either left empty or set to the same Router.
+	Router *Router
+
 	// EndpointRegistry is an optional argument that can be used to customize
 	// the EndpointRegistry used by the Baseplate HTTP server.
 	//
@@ -140,6 +150,9 @@ type ServerArgs struct {
 
 	// Middlewares is optional, additional Middleware that will wrap any
 	// HandlerFuncs registered to the server using server.Handle.
+	//
+	// They come after the default Baseplate Middleware and before
+	// InjectLogCorrelation.
 	Middlewares []Middleware
 
 	// OnShutdown is an optional list of functions that can be run when
@@ -183,6 +196,13 @@ func (args ServerArgs) ValidateAndSetDefaults() (ServerArgs, error) {
 	for _, endpoint := range args.Endpoints {
 		errs = append(errs, endpoint.Validate())
 	}
+	if args.Router != nil {
+		if args.EndpointRegistry == nil {
+			args.EndpointRegistry = args.Router
+		} else if registry, ok := args.EndpointRegistry.(*Router); !ok || registry != args.Router {
+			errs = append(errs, errors.New("argument EndpointRegistry must be empty or the same as Router"))
+		}
+	}
 	if args.EndpointRegistry == nil {
 		args.EndpointRegistry = http.NewServeMux()
 	}
@@ -210,6 +230,9 @@ func (args ServerArgs) SetupEndpoints() (ServerArgs, error) {
 		Logger:          args.Logger,
 	})
 	wrappers = append(wrappers, args.Middlewares...)
+	// After args.Middlewares, so the server span injected by InjectServerSpan in
+	// args.Middlewares (if any) is already in the context.
+	wrappers = append(wrappers, InjectLogCorrelation)
 
 	factory := httpHandlerFactory{middlewares: wrappers}
 	for pattern, endpoint := range args.Endpoints {
@@ -219,6 +242,9 @@ func (args ServerArgs) SetupEndpoints() (ServerArgs, error) {
 		}
 		args.EndpointRegistry.Handle(string(pattern), handler)
 	}
+	if args.Router != nil {
+		args.Router.setMiddlewares(wrappers)
+	}
 	return args, nil
 }
 
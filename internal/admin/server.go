@@ -23,6 +23,8 @@ const (
 //
 //	metrics       - serve /metrics for prometheus
 //	profiling     - serve /debug/pprof for profiling, ref: https://pkg.go.dev/net/http/pprof
+//	health        - serve /health for detailed health reports, after healthbp.RegisterAdminHandler is called
+//	log level     - serve /log/level to view and change log levels at runtime, ref: log.LevelHTTPHandler
 var Mux = http.NewServeMux()
 
 var baseplateGoCollectors = collectors.WithGoCollectorRuntimeMetrics(
@@ -39,6 +41,7 @@ func init() {
 	Mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
 	Mux.Handle("/metrics", promhttp.Handler())
+	Mux.Handle(log.LevelAdminPath, log.LevelHTTPHandler())
 
 	// Unregister the default GoCollector, and reregister with baseplate defaults
 	if prometheus.Unregister(collectors.NewGoCollector()) {
@@ -12,9 +12,9 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"golang.org/x/time/rate"
 
 	faultmetrics "github.com/reddit/baseplate.go/internal/faults/metrics"
+	"github.com/reddit/baseplate.go/log"
 )
 
 // Headers is an interface to be implemented by the caller to allow
@@ -64,8 +64,6 @@ type Injector[T any] struct {
 
 	defaultAbort Abort[T]
 
-	chatty *rate.Limiter // Rate limiter for logs.
-
 	selected func(int) bool
 	sleep    func(context.Context, time.Duration) error
 }
@@ -95,6 +93,13 @@ func defaultSleep(ctx context.Context, d time.Duration) error {
 	return nil
 }
 
+// logSampler allows each log message once per minute per client, shared by
+// all the Injectors.
+var logSampler = log.NewSampler("faults", log.SamplingConfig{
+	Interval: time.Minute,
+	First:    1,
+})
+
 // NewInjector creates a new Injector with the provided parameters.
 func NewInjector[T any](clientName, callerName string, abortCodeMin, abortCodeMax int, option ...func(*Injector[T])) *Injector[T] {
 	i := &Injector[T]{
@@ -102,7 +107,6 @@ func NewInjector[T any](clientName, callerName string, abortCodeMin, abortCodeMa
 		callerName:   callerName,
 		abortCodeMin: abortCodeMin,
 		abortCodeMax: abortCodeMax,
-		chatty:       rate.NewLimiter(rate.Every(1*time.Minute), 1),
 		selected:     defaultSelected,
 		sleep:        defaultSleep,
 	}
@@ -146,12 +150,12 @@ func (i *Injector[T]) Inject(ctx context.Context, params InjectParameters[T]) (T
 	}
 
 	infof := func(format string, args ...interface{}) {
-		if i.chatty == nil || i.chatty.Allow() {
+		if logSampler.Allow(i.clientName + format) {
 			slog.With("caller", i.callerName).InfoContext(ctx, fmt.Sprintf(format, args...))
 		}
 	}
 	warnf := func(format string, args ...interface{}) {
-		if i.chatty == nil || i.chatty.Allow() {
+		if logSampler.Allow(i.clientName + format) {
 			slog.With("caller", i.callerName).WarnContext(ctx, fmt.Sprintf(format, args...))
 		}
 	}
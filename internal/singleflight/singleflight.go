@@ -0,0 +1,116 @@
+// Package singleflight provides a context aware duplicate call suppression
+// mechanism, used by the request coalescing client middlewares.
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Group collapses concurrent calls with the same key into a single call.
+//
+// Unlike golang.org/x/sync/singleflight, every caller of Do only waits for the
+// shared call as long as its own context allows, and the shared call is
+// canceled when all of its callers are gone instead of by any single caller.
+//
+// The zero value is ready to use.
+type Group[T any] struct {
+	lock  sync.Mutex
+	calls map[string]*call[T]
+}
+
+type call[T any] struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	// guarded by Group.lock
+	waiters int
+
+	// only written before done is closed
+	val T
+	err error
+}
+
+// Do executes fn once for all the concurrent callers with the same key, and
+// returns its results to all of them.
+//
+// fn is called with a context derived from the context of the first caller
+// (so it carries the values of the first caller), but without its deadline.
+// It's not canceled when the first caller's context is done, only when all the
+// callers waiting on it have returned, so the callers with later deadlines
+// still get the results after the first caller gave up.
+//
+// shared reports whether the results come from a call started by another
+// caller.
+// If ctx is done before the shared call finishes, Do returns ctx.Err().
+//
+// A panic in fn is recovered and returned as an error to all the callers.
+func (g *Group[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (v T, shared bool, err error) {
+	g.lock.Lock()
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		g.lock.Unlock()
+		v, err = g.wait(ctx, key, c)
+		return v, true, err
+	}
+
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &call[T]{
+		done:    make(chan struct{}),
+		cancel:  cancel,
+		waiters: 1,
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	g.calls[key] = c
+	g.lock.Unlock()
+
+	go g.run(callCtx, key, c, fn)
+	v, err = g.wait(ctx, key, c)
+	return v, false, err
+}
+
+func (g *Group[T]) run(ctx context.Context, key string, c *call[T], fn func(ctx context.Context) (T, error)) {
+	defer c.cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("singleflight: panic in shared call: %v", r)
+		}
+		g.forget(key, c)
+		close(c.done)
+	}()
+
+	c.val, c.err = fn(ctx)
+}
+
+func (g *Group[T]) wait(ctx context.Context, key string, c *call[T]) (T, error) {
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+	}
+
+	g.lock.Lock()
+	c.waiters--
+	if c.waiters == 0 {
+		// Nobody is waiting for the results anymore, cancel the shared call and
+		// let the next caller start a new one.
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		c.cancel()
+	}
+	g.lock.Unlock()
+	var zero T
+	return zero, ctx.Err()
+}
+
+func (g *Group[T]) forget(key string, c *call[T]) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
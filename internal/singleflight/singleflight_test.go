@@ -0,0 +1,195 @@
+package singleflight_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/reddit/baseplate.go/internal/singleflight"
+)
+
+func TestGroupDo(t *testing.T) {
+	var g singleflight.Group[int]
+	var calls atomic.Int64
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const n = 5
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int64
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, shared, err := g.Do(context.Background(), "key", fn)
+			if err != nil {
+				t.Error(err)
+			}
+			if v != 42 {
+				t.Errorf("Do got %d, want 42", v)
+			}
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	waitForCalls(t, &calls, 1)
+	// Give the other goroutines time to join the call.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected fn to be called once, got %d", got)
+	}
+	if got := sharedCount.Load(); got != n-1 {
+		t.Errorf("Expected %d shared results, got %d", n-1, got)
+	}
+
+	// The key should be forgotten after the call finishes.
+	release = make(chan struct{})
+	close(release)
+	if _, shared, _ := g.Do(context.Background(), "key", fn); shared {
+		t.Error("Expected a new call after the previous one finished")
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected fn to be called twice, got %d", got)
+	}
+}
+
+func TestGroupDoCallerDeadline(t *testing.T) {
+	var g singleflight.Group[int]
+	started := make(chan struct{})
+	fnCtx := make(chan context.Context, 1)
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	defer cancelFirst()
+	go g.Do(firstCtx, "key", func(ctx context.Context) (int, error) {
+		fnCtx <- ctx
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, shared, err := g.Do(ctx, "key", func(ctx context.Context) (int, error) {
+		t.Error("Expected the call without deadline to be joined")
+		return 0, nil
+	})
+	if !shared {
+		t.Error("Expected the result to be shared")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := (<-fnCtx).Err(); err != nil {
+		t.Errorf("Expected the shared call to keep running for the first caller, got %v", err)
+	}
+}
+
+func TestGroupDoStaggeredDeadlines(t *testing.T) {
+	var g singleflight.Group[int]
+	var calls atomic.Int64
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("Expected the shared call without deadline")
+		}
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	// The first caller has the earliest deadline, the others join the call with
+	// later deadlines.
+	type result struct {
+		v      int
+		shared bool
+		err    error
+	}
+	const n = 3
+	results := make([]chan result, n)
+	for i := range results {
+		results[i] = make(chan result, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i*500+100)*time.Millisecond)
+		defer cancel()
+		go func() {
+			v, shared, err := g.Do(ctx, "key", fn)
+			results[i] <- result{v: v, shared: shared, err: err}
+		}()
+		waitForCalls(t, &calls, 1)
+	}
+
+	if r := <-results[0]; !errors.Is(r.err, context.DeadlineExceeded) {
+		t.Errorf("Expected the first caller to give up with %v, got %v", context.DeadlineExceeded, r.err)
+	}
+	close(release)
+	for i := 1; i < n; i++ {
+		if r := <-results[i]; r.err != nil || r.v != 42 || !r.shared {
+			t.Errorf("Expected caller #%d to get the shared result, got v=%d, shared=%v, err=%v", i, r.v, r.shared, r.err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected fn to be called once, got %d", got)
+	}
+}
+
+func TestGroupDoAbandoned(t *testing.T) {
+	var g singleflight.Group[int]
+	fnCtx := make(chan context.Context, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fnCtx
+		cancel()
+	}()
+	_, _, err := g.Do(ctx, "key", func(ctx context.Context) (int, error) {
+		fnCtx <- ctx
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+
+	v, shared, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+	if err != nil || shared || v != 1 {
+		t.Errorf("Expected a new call after the previous one was abandoned, got v=%d, shared=%v, err=%v", v, shared, err)
+	}
+}
+
+func TestGroupDoPanic(t *testing.T) {
+	var g singleflight.Group[int]
+	_, _, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+		panic("oops")
+	})
+	if err == nil {
+		t.Error("Expected error from panic, got nil")
+	}
+}
+
+func waitForCalls(t *testing.T, calls *atomic.Int64, n int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d calls", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -6,6 +6,29 @@ package log
 type Config struct {
 	// Level is the log level you want to set your service to.
 	Level Level `yaml:"level"`
+
+	// NamedLevels are the independent levels of the named loggers,
+	// for example:
+	//
+	//     namedLevels:
+	//       thriftbp: debug
+	//
+	// See SetNamedLevel for more details.
+	NamedLevels map[string]Level `yaml:"namedLevels"`
+
+	// Sampling configures the sampling of the log entries, keyed by their level
+	// and message, to prevent the logs from being flooded by hot paths.
+	//
+	// Optional. When it's nil, sampling is disabled.
+	// See SetSampling for more details.
+	Sampling *SamplingConfig `yaml:"sampling"`
+
+	// SlogDefault makes the default slog logger write through the global
+	// logger, honoring the same levels and sampling.
+	//
+	// Optional. When it's false, the default slog logger is left untouched.
+	// See SetSlogDefault for more details.
+	SlogDefault bool `yaml:"slogDefault"`
 }
 
 // InitFromConfig initializes the log package using the given Config and JSON
@@ -16,4 +39,15 @@ func InitFromConfig(cfg Config) {
 	}
 	level := cfg.Level
 	InitLoggerJSON(level)
+	for name, l := range cfg.NamedLevels {
+		if err := SetNamedLevel(name, l); err != nil {
+			Errorw("Failed to set named log level", "name", name, "err", err)
+		}
+	}
+	if cfg.Sampling != nil {
+		SetSampling(*cfg.Sampling)
+	}
+	if cfg.SlogDefault {
+		SetSlogDefault()
+	}
 }
@@ -3,6 +3,7 @@ package log
 import (
 	"context"
 	"fmt"
+	"log/slog"
 
 	"github.com/getsentry/sentry-go"
 	"go.uber.org/zap"
@@ -16,11 +17,18 @@ type contextKeyType struct{}
 
 var contextKey contextKeyType
 
+type correlationKeyType struct{}
+
+var correlationKey correlationKeyType
+
 func init() {
 	copyContext := func(dst, src context.Context) context.Context {
 		if logger, ok := src.Value(contextKey).(*zap.SugaredLogger); ok && logger != nil {
 			dst = context.WithValue(dst, contextKey, logger)
 		}
+		if fields, ok := CorrelationFromContext(src); ok {
+			dst = context.WithValue(dst, correlationKey, fields)
+		}
 		return dst
 	}
 	detach.Register(detach.Hooks{
@@ -33,7 +41,10 @@ func init() {
 
 // logger keys for attached data.
 const (
-	traceIDKey = "traceID"
+	traceIDKey       = "traceID"
+	spanIDKey        = "spanID"
+	endpointKey      = "endpoint"
+	callerServiceKey = "callerService"
 )
 
 // AttachArgs are used to create loggers and sentry hubs to be attached to
@@ -69,6 +80,11 @@ func Attach(ctx context.Context, args AttachArgs) context.Context {
 		}
 	})
 	ctx = context.WithValue(ctx, sentry.HubContextKey, hub)
+	if args.TraceID != "" {
+		fields, _ := CorrelationFromContext(ctx)
+		fields.TraceID = args.TraceID
+		ctx = context.WithValue(ctx, correlationKey, fields)
+	}
 
 	// create and attach the logger
 	const additional = 1 // Number of non-AdditionalPairs fields in AttachArgs struct.
@@ -108,3 +124,71 @@ func C(ctx context.Context) *zap.SugaredLogger {
 	}
 	return internalv2compat.GlobalLogger()
 }
+
+// CorrelationFields are the fields used to correlate the logs of a request
+// with its trace.
+//
+// They are attached to the context object by the server middlewares of
+// httpbp, thriftbp and grpcbp, and logged by both the logger returned by C and
+// the slog handler created by NewContextHandler, with the keys "traceID",
+// "spanID", "endpoint" and "callerService".
+type CorrelationFields struct {
+	TraceID  string
+	SpanID   string
+	Endpoint string
+	// The name of the caller service, usually from the "User-Agent" header.
+	Caller string
+}
+
+func (f CorrelationFields) attrs() []slog.Attr {
+	attrs := make([]slog.Attr, 0, 4)
+	for _, kv := range [...][2]string{
+		{traceIDKey, f.TraceID},
+		{spanIDKey, f.SpanID},
+		{endpointKey, f.Endpoint},
+		{callerServiceKey, f.Caller},
+	} {
+		if kv[1] != "" {
+			attrs = append(attrs, slog.String(kv[0], kv[1]))
+		}
+	}
+	return attrs
+}
+
+// AttachCorrelation attaches the non-empty CorrelationFields into the context
+// object, merging with the ones already attached.
+//
+// The fields are also added to the logger attached to the context object (see
+// C), unless they are already attached with the same values.
+func AttachCorrelation(ctx context.Context, fields CorrelationFields) context.Context {
+	existing, _ := CorrelationFromContext(ctx)
+	merged := existing
+	var kv []interface{}
+	for _, f := range [...]struct {
+		key      string
+		existing *string
+		value    string
+	}{
+		{traceIDKey, &merged.TraceID, fields.TraceID},
+		{spanIDKey, &merged.SpanID, fields.SpanID},
+		{endpointKey, &merged.Endpoint, fields.Endpoint},
+		{callerServiceKey, &merged.Caller, fields.Caller},
+	} {
+		if f.value != "" && f.value != *f.existing {
+			*f.existing = f.value
+			kv = append(kv, zap.String(f.key, f.value))
+		}
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, correlationKey, merged)
+	return context.WithValue(ctx, contextKey, C(ctx).With(kv...))
+}
+
+// CorrelationFromContext returns the CorrelationFields attached to the context
+// object, if any.
+func CorrelationFromContext(ctx context.Context) (CorrelationFields, bool) {
+	fields, ok := ctx.Value(correlationKey).(CorrelationFields)
+	return fields, ok
+}
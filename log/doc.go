@@ -14,4 +14,12 @@
 // instead of creating one to use logger, you should use the global one:
 //
 //	log.Errorw("Something went wrong!", "err", err)
+//
+// The level of the global logger can be changed at runtime via SetLevel or the
+// LevelAdminPath endpoint of the admin server,
+// and named sub-loggers (see Named) can have independent levels,
+// which are also honored by the default slog logger used by other Baseplate.go
+// packages after SetSlogDefault is called, for example:
+//
+//	log.SetNamedLevel("thriftbp", log.DebugLevel)
 package log
@@ -0,0 +1,469 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	//lint:ignore SA1019 This library is internal only, not actually deprecated
+	"github.com/reddit/baseplate.go/internalv2compat"
+)
+
+// LevelAdminPath is the path the handler returned by LevelHTTPHandler is
+// registered to on the internal admin server.
+const LevelAdminPath = "/log/level"
+
+// LoggerNameKey is the slog attribute key LevelHandler reads the logger name
+// from, see LevelHandler for more details.
+const LoggerNameKey = "logger"
+
+// baseplatePackagePrefix is trimmed from the package paths when deriving logger
+// names for slog records, so records logged by thriftbp are named "thriftbp".
+const baseplatePackagePrefix = "github.com/reddit/baseplate.go/"
+
+// ErrInvalidLevel is the error returned by SetLevel and SetNamedLevel when
+// the level is not one of the defined Level values.
+var ErrInvalidLevel = errors.New("log: invalid level")
+
+// levels is the registry of the global and named levels used by the global
+// logger and LevelHandler.
+var levels = newLevelRegistry()
+
+// GetLevel returns the current level of the global logger.
+func GetLevel() Level {
+	return fromZapLevel(levels.globalLevel().Level())
+}
+
+// SetLevel changes the level of the global logger at runtime.
+//
+// It only takes effect after the global logger is initialized by one of the
+// InitLogger functions with a level other than NopLevel.
+// It also affects the slog loggers using LevelHandler.
+//
+// It returns an error wrapping ErrInvalidLevel and keeps the current level
+// when level is not one of the defined Level values.
+func SetLevel(level Level) error {
+	return levels.set("", level, 0)
+}
+
+// GetNamedLevels returns a copy of all the named levels currently set.
+func GetNamedLevels() map[string]Level {
+	levels.lock.RLock()
+	defer levels.lock.RUnlock()
+	m := make(map[string]Level, len(levels.named))
+	for name, l := range levels.named {
+		m[name] = fromZapLevel(l)
+	}
+	return m
+}
+
+// SetNamedLevel sets an independent level for the named logger at runtime,
+// overriding the level of the global logger.
+//
+// Names are hierarchical: a level set for "thriftbp" also applies to loggers
+// named "thriftbp.client" (zap) or "thriftbp/internal" (slog),
+// unless a more specific level is also set.
+//
+// Passing an empty level removes the named level,
+// so the named logger follows the global level again.
+//
+// It returns an error wrapping ErrInvalidLevel and keeps the current level
+// when level is neither empty nor one of the defined Level values.
+func SetNamedLevel(name string, level Level) error {
+	return levels.set(name, level, 0)
+}
+
+// Named returns a named sub-logger of the global logger,
+// which honors the level set for name via SetNamedLevel or Config.NamedLevels.
+//
+// The sub-logger is derived from the global logger at the time of the call,
+// so it should be called after the global logger is initialized.
+func Named(name string) *zap.SugaredLogger {
+	return internalv2compat.GlobalLogger().
+		// The global logger skips one extra caller for the top level functions.
+		WithOptions(zap.AddCallerSkip(-1)).
+		Named(name)
+}
+
+// LevelHTTPHandler returns the http.Handler to view and change the levels at
+// runtime.
+//
+// It's registered to the internal admin server at LevelAdminPath.
+//
+// GET requests return the current levels as JSON.
+//
+// PUT and POST requests change a level with the following form or query
+// values:
+//
+// - level: The new level, required. Empty level is only allowed with name,
+// which removes the named level.
+//
+// - name: The name of the logger, optional. When it's empty the global level
+// is changed.
+//
+// - revert: A duration (e.g. "10m"), optional. When set, the level is
+// reverted to the previous one after the duration.
+//
+// They return the levels after the change as JSON.
+func LevelHTTPHandler() http.Handler {
+	return http.HandlerFunc(serveLevels)
+}
+
+type levelsResponse struct {
+	Level Level            `json:"level"`
+	Named map[string]Level `json:"named"`
+}
+
+func serveLevels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		name := r.FormValue("name")
+		level := Level(strings.ToLower(r.FormValue("level")))
+		var revert time.Duration
+		if s := r.FormValue("revert"); s != "" {
+			var err error
+			revert, err = time.ParseDuration(s)
+			if err != nil || revert < 0 {
+				http.Error(w, fmt.Sprintf("invalid revert duration %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := levels.set(name, level, revert); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Infow(
+			"Log level changed",
+			"name", name,
+			"level", level,
+			"revert", revert,
+		)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(levelsResponse{
+		Level: GetLevel(),
+		Named: GetNamedLevels(),
+	})
+}
+
+// valid returns true if l is a known Level.
+func (l Level) valid() bool {
+	switch l {
+	case NopLevel, DebugLevel, InfoLevel, WarnLevel, ErrorLevel, PanicLevel, FatalLevel:
+		return true
+	default:
+		return false
+	}
+}
+
+func fromZapLevel(l zapcore.Level) Level {
+	switch l {
+	case zapcore.DebugLevel:
+		return DebugLevel
+	case zapcore.InfoLevel:
+		return InfoLevel
+	case zapcore.WarnLevel:
+		return WarnLevel
+	case zapcore.ErrorLevel, zapcore.DPanicLevel:
+		return ErrorLevel
+	case zapcore.PanicLevel:
+		return PanicLevel
+	case zapcore.FatalLevel:
+		return FatalLevel
+	default:
+		return NopLevel
+	}
+}
+
+func fromSlogLevel(l slog.Level) zapcore.Level {
+	switch {
+	case l < slog.LevelInfo:
+		return zapcore.DebugLevel
+	case l < slog.LevelWarn:
+		return zapcore.InfoLevel
+	case l < slog.LevelError:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.ErrorLevel
+	}
+}
+
+// noNamedLevels is the value of levelRegistry.namedMin when there's no named
+// level set.
+const noNamedLevels = math.MaxInt32
+
+type levelRegistry struct {
+	// global is replaced by InitLoggerWithConfig with the level of its config,
+	// so it's a pointer that can be swapped atomically.
+	global atomic.Pointer[zap.AtomicLevel]
+
+	// namedMin is the minimal level of all the named levels,
+	// used as the fast path to skip the named levels lookup.
+	namedMin atomic.Int32
+
+	lock   sync.RWMutex
+	named  map[string]zapcore.Level
+	timers map[string]*time.Timer
+}
+
+func newLevelRegistry() *levelRegistry {
+	r := &levelRegistry{
+		named:  make(map[string]zapcore.Level),
+		timers: make(map[string]*time.Timer),
+	}
+	r.setGlobal(zap.NewAtomicLevelAt(zapcore.InfoLevel))
+	r.namedMin.Store(noNamedLevels)
+	return r
+}
+
+func (r *levelRegistry) globalLevel() zap.AtomicLevel {
+	return *r.global.Load()
+}
+
+// setGlobal replaces the global level with level, so the changes made to level
+// by its other holders are also honored.
+func (r *levelRegistry) setGlobal(level zap.AtomicLevel) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.global.Store(&level)
+}
+
+// enabledAny returns true if l is enabled by the global level or any of the
+// named levels.
+func (r *levelRegistry) enabledAny(l zapcore.Level) bool {
+	return r.globalLevel().Enabled(l) || int32(l) >= r.namedMin.Load()
+}
+
+// enabled returns true if l is enabled for the logger name.
+//
+// The level of the longest matching name is used,
+// falls back to the global level if none matches.
+func (r *levelRegistry) enabled(name string, l zapcore.Level) bool {
+	if name == "" || r.namedMin.Load() == noNamedLevels {
+		return r.globalLevel().Enabled(l)
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for {
+		if level, ok := r.named[name]; ok {
+			return level.Enabled(l)
+		}
+		i := strings.LastIndexAny(name, "./")
+		if i < 0 {
+			return r.globalLevel().Enabled(l)
+		}
+		name = name[:i]
+	}
+}
+
+// set sets the level of the logger name, or the global level when name is
+// empty.
+//
+// Empty level removes the named level, and is invalid for the global level.
+// When revertAfter > 0, the previous level is restored after it.
+func (r *levelRegistry) set(name string, level Level, revertAfter time.Duration) error {
+	if !level.valid() && (level != "" || name == "") {
+		return fmt.Errorf("%w: %q", ErrInvalidLevel, level)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.setLocked(name, level, revertAfter)
+	return nil
+}
+
+func (r *levelRegistry) setLocked(name string, level Level, revertAfter time.Duration) {
+	var previous Level
+	if name == "" {
+		previous = fromZapLevel(r.globalLevel().Level())
+		r.globalLevel().SetLevel(level.ToZapLevel())
+	} else {
+		if l, ok := r.named[name]; ok {
+			previous = fromZapLevel(l)
+		}
+		if level == "" {
+			delete(r.named, name)
+		} else {
+			r.named[name] = level.ToZapLevel()
+		}
+		r.updateNamedMinLocked()
+	}
+
+	if timer := r.timers[name]; timer != nil {
+		timer.Stop()
+		delete(r.timers, name)
+	}
+	if revertAfter > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(revertAfter, func() {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+			// Only revert if it's not changed again in the meantime.
+			if r.timers[name] == timer {
+				r.setLocked(name, previous, 0)
+			}
+		})
+		r.timers[name] = timer
+	}
+}
+
+func (r *levelRegistry) updateNamedMinLocked() {
+	lowest := int32(noNamedLevels)
+	for _, l := range r.named {
+		lowest = min(lowest, int32(l))
+	}
+	r.namedMin.Store(lowest)
+}
+
+// leveledCore is a zapcore.Core filtering entries by the global and named
+// levels in the registry, instead of the level of the wrapped core,
+// and the global sampling.
+type leveledCore struct {
+	zapcore.Core
+
+	levels *levelRegistry
+}
+
+func (c leveledCore) Enabled(l zapcore.Level) bool {
+	return c.levels.enabledAny(l)
+}
+
+func (c leveledCore) With(fields []zapcore.Field) zapcore.Core {
+	return leveledCore{
+		Core:   c.Core.With(fields),
+		levels: c.levels,
+	}
+}
+
+func (c leveledCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.levels.enabled(ent.LoggerName, ent.Level) && globalSampler.Load().allowEntry(ent.Level, ent.Message) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// LevelHandler is a slog.Handler wrapper filtering records by the global and
+// named levels of this package, so the slog logs honor SetLevel and
+// SetNamedLevel the same way as the zap global logger.
+//
+// The logger name of a record is:
+//
+// - The value of the LoggerNameKey attribute added via WithAttrs
+// (e.g. slog.With(log.LoggerNameKey, "foo")), if any.
+//
+// - Otherwise the package path of the caller, with
+// "github.com/reddit/baseplate.go/" prefix trimmed.
+// For example records logged by thriftbp are named "thriftbp".
+//
+// Records passing the levels and the sampling set via SetSampling are passed
+// to the wrapped handler without checking its own level.
+//
+// SetSlogDefault sets the default slog logger to a LevelHandler writing the
+// records through the global zap logger,
+// so the slog logs used throughout this library share the format and levels
+// of the zap logs.
+//
+// It should be created via NewLevelHandler.
+type LevelHandler struct {
+	next slog.Handler
+	name string
+}
+
+var _ slog.Handler = (*LevelHandler)(nil)
+
+// NewLevelHandler wraps next into a LevelHandler.
+func NewLevelHandler(next slog.Handler) *LevelHandler {
+	return &LevelHandler{next: next}
+}
+
+// Enabled implements slog.Handler.
+func (h *LevelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return levels.enabledAny(fromSlogLevel(level))
+}
+
+// Handle implements slog.Handler.
+func (h *LevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	name := h.name
+	if name == "" && levels.namedMin.Load() != noNamedLevels {
+		name = callerPackage(r.PC)
+	}
+	level := fromSlogLevel(r.Level)
+	if !levels.enabled(name, level) || !globalSampler.Load().allowEntry(level, r.Message) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	name := h.name
+	for _, attr := range attrs {
+		if attr.Key == LoggerNameKey {
+			name = attr.Value.String()
+		}
+	}
+	return &LevelHandler{
+		next: h.next.WithAttrs(attrs),
+		name: name,
+	}
+}
+
+// WithGroup implements slog.Handler.
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{
+		next: h.next.WithGroup(name),
+		name: h.name,
+	}
+}
+
+// callerPackages caches the package paths of the program counters.
+var callerPackages sync.Map // map[uintptr]string
+
+func callerPackage(pc uintptr) string {
+	if pc == 0 {
+		return ""
+	}
+	if pkg, ok := callerPackages.Load(pc); ok {
+		return pkg.(string)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	// Function is in the form of "path/to/pkg.(*Type).Method.func1",
+	// the package path ends at the first "." after the last "/".
+	pkg := frame.Function
+	start := strings.LastIndexByte(pkg, '/') + 1
+	if i := strings.IndexByte(pkg[start:], '.'); i >= 0 {
+		pkg = pkg[:start+i]
+	}
+	pkg = strings.TrimPrefix(pkg, baseplatePackagePrefix)
+	callerPackages.Store(pc, pkg)
+	return pkg
+}
+
+// SetSlogDefault sets the default slog logger to write through the global zap
+// logger, filtered by LevelHandler and with the correlation fields added by
+// ContextHandler.
+//
+// It's not called by the InitLogger functions, so services configuring slog
+// themselves are not affected. InitFromConfig calls it when
+// Config.SlogDefault is true.
+func SetSlogDefault() {
+	slog.SetDefault(slog.New(NewLevelHandler(NewContextHandler(zapHandler{}))))
+}
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func resetLevels(t *testing.T) {
+	t.Helper()
+	levels = newLevelRegistry()
+	t.Cleanup(func() {
+		levels = newLevelRegistry()
+	})
+}
+
+func TestLeveledCore(t *testing.T) {
+	resetLevels(t)
+
+	buf := new(bytes.Buffer)
+	logger := zap.New(leveledCore{
+		Core:   initCore(buf),
+		levels: levels,
+	})
+
+	SetNamedLevel("thriftbp", DebugLevel)
+	SetNamedLevel("thriftbp.client", ErrorLevel)
+
+	logger.Debug("global debug")
+	logger.Info("global info")
+	logger.Named("thriftbp").Debug("thriftbp debug")
+	logger.Named("thriftbp").Named("server").Debug("thriftbp.server debug")
+	logger.Named("thriftbp").Named("client").Warn("thriftbp.client warn")
+	logger.Named("httpbp").Debug("httpbp debug")
+
+	SetLevel(WarnLevel)
+	logger.Info("global info after change")
+	SetNamedLevel("thriftbp", "")
+	logger.Named("thriftbp").Debug("thriftbp debug after reset")
+
+	got := buf.String()
+	for _, msg := range []string{"global info", "thriftbp debug", "thriftbp.server debug"} {
+		if !strings.Contains(got, `"msg":"`+msg+`"`) {
+			t.Errorf("Expected %q to be logged, got %s", msg, got)
+		}
+	}
+	for _, msg := range []string{
+		"global debug",
+		"thriftbp.client warn",
+		"httpbp debug",
+		"global info after change",
+		"thriftbp debug after reset",
+	} {
+		if strings.Contains(got, `"msg":"`+msg+`"`) {
+			t.Errorf("Expected %q not to be logged, got %s", msg, got)
+		}
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	resetLevels(t)
+
+	buf := new(bytes.Buffer)
+	logger := slog.New(NewLevelHandler(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	})))
+
+	logger.Debug("global debug")
+	logger.Info("global info")
+	// Records logged in this package are named "log".
+	SetNamedLevel("log", DebugLevel)
+	logger.Debug("package debug")
+	SetNamedLevel("foo", ErrorLevel)
+	logger.With(LoggerNameKey, "foo").Warn("foo warn")
+	logger.With(LoggerNameKey, "bar").Debug("bar debug")
+
+	got := buf.String()
+	for _, msg := range []string{"global info", "package debug"} {
+		if !strings.Contains(got, "msg=\""+msg+"\"") {
+			t.Errorf("Expected %q to be logged, got %s", msg, got)
+		}
+	}
+	for _, msg := range []string{"global debug", "foo warn", "bar debug"} {
+		if strings.Contains(got, "msg=\""+msg+"\"") {
+			t.Errorf("Expected %q not to be logged, got %s", msg, got)
+		}
+	}
+}
+
+func TestLevelHTTPHandler(t *testing.T) {
+	resetLevels(t)
+
+	handler := LevelHTTPHandler()
+	serve := func(t *testing.T, method, query string, expectedCode int) levelsResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, LevelAdminPath+query, nil))
+		if w.Code != expectedCode {
+			t.Fatalf("Expected status code %d, got %d: %s", expectedCode, w.Code, w.Body.String())
+		}
+		var resp levelsResponse
+		if expectedCode == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+			}
+		}
+		return resp
+	}
+
+	if resp := serve(t, http.MethodGet, "", http.StatusOK); resp.Level != InfoLevel || len(resp.Named) != 0 {
+		t.Errorf("Unexpected initial levels %+v", resp)
+	}
+
+	resp := serve(t, http.MethodPut, "?name=thriftbp&level=debug", http.StatusOK)
+	if resp.Named["thriftbp"] != DebugLevel {
+		t.Errorf("Expected thriftbp level to be debug, got %+v", resp)
+	}
+
+	resp = serve(t, http.MethodPost, "?level=warn&revert=10ms", http.StatusOK)
+	if resp.Level != WarnLevel {
+		t.Errorf("Expected global level to be warn, got %+v", resp)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if level := GetLevel(); level != InfoLevel {
+		t.Errorf("Expected global level to be reverted to info, got %q", level)
+	}
+
+	resp = serve(t, http.MethodPut, "?name=thriftbp&level=", http.StatusOK)
+	if len(resp.Named) != 0 {
+		t.Errorf("Expected thriftbp level to be removed, got %+v", resp)
+	}
+
+	serve(t, http.MethodPut, "?level=foo", http.StatusBadRequest)
+	serve(t, http.MethodPut, "?level=", http.StatusBadRequest)
+	serve(t, http.MethodPut, "?level=debug&revert=foo", http.StatusBadRequest)
+	serve(t, http.MethodDelete, "", http.StatusMethodNotAllowed)
+}
+
+func TestSetLevelInvalid(t *testing.T) {
+	resetLevels(t)
+
+	for _, level := range []Level{"", "debgu"} {
+		if err := SetLevel(level); !errors.Is(err, ErrInvalidLevel) {
+			t.Errorf("SetLevel(%q) expected %v, got %v", level, ErrInvalidLevel, err)
+		}
+	}
+	if level := GetLevel(); level != InfoLevel {
+		t.Errorf("Expected global level to stay info, got %q", level)
+	}
+
+	if err := SetNamedLevel("thriftbp", "debgu"); !errors.Is(err, ErrInvalidLevel) {
+		t.Errorf("SetNamedLevel expected %v, got %v", ErrInvalidLevel, err)
+	}
+	if named := GetNamedLevels(); len(named) != 0 {
+		t.Errorf("Expected no named levels, got %+v", named)
+	}
+}
@@ -92,15 +92,31 @@ func InitLoggerJSON(logLevel Level) {
 // fields to strings, to prevent the loss of precision by json log ingester.
 // As a result, some of the cfg might get lost during this wrapping, namely
 // OutputPaths and ErrorOutputPaths.
+//
+// cfg.Level becomes the global level that can be changed at runtime via
+// SetLevel (or cfg.Level.SetLevel), and the named levels set via SetNamedLevel
+// are also honored. When cfg.Level is the zero value, logLevel is used instead.
+// The default slog logger is left untouched, use SetSlogDefault to make it
+// write through the global logger honoring the same levels.
 func InitLoggerWithConfig(logLevel Level, cfg zap.Config) error {
 	if logLevel == NopLevel {
 		internalv2compat.SetGlobalLogger(zap.NewNop().Sugar())
 		return nil
 	}
+	if cfg.Level == (zap.AtomicLevel{}) {
+		cfg.Level = zap.NewAtomicLevelAt(logLevel.ToZapLevel())
+	}
+	levels.setGlobal(cfg.Level)
+	// The levels are checked by leveledCore instead,
+	// so the named levels can be lower than the global one.
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 	l, err := cfg.Build(
 		zap.AddCallerSkip(1),
 		zap.WrapCore(func(core zapcore.Core) zapcore.Core {
-			return wrappedCore{Core: core}
+			return leveledCore{
+				Core:   wrappedCore{Core: core},
+				levels: levels,
+			}
 		}),
 	)
 	if err != nil {
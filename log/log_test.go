@@ -5,6 +5,10 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
 	//lint:ignore SA1019 This library is internal only, not actually deprecated
 	"github.com/reddit/baseplate.go/internalv2compat"
 )
@@ -28,3 +32,65 @@ func TestInitSentry(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestInitLoggerWithConfig(t *testing.T) {
+	resetLevels(t)
+	t.Cleanup(func() {
+		InitLogger(InfoLevel)
+	})
+
+	t.Run("zero-level", func(t *testing.T) {
+		if err := InitLoggerWithConfig(InfoLevel, zap.Config{Encoding: "json"}); err != nil {
+			t.Fatal(err)
+		}
+		if level := GetLevel(); level != InfoLevel {
+			t.Errorf("Expected global level to be %q, got %q", InfoLevel, level)
+		}
+	})
+
+	t.Run("atomic-level", func(t *testing.T) {
+		cfg := zap.Config{
+			Encoding: "json",
+			Level:    zap.NewAtomicLevelAt(zapcore.WarnLevel),
+		}
+		if err := InitLoggerWithConfig(InfoLevel, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if level := GetLevel(); level != WarnLevel {
+			t.Errorf("Expected global level to be %q, got %q", WarnLevel, level)
+		}
+		cfg.Level.SetLevel(zapcore.ErrorLevel)
+		if level := GetLevel(); level != ErrorLevel {
+			t.Errorf("Expected global level to follow cfg.Level to %q, got %q", ErrorLevel, level)
+		}
+		if err := SetLevel(DebugLevel); err != nil {
+			t.Fatal(err)
+		}
+		if level := cfg.Level.Level(); level != zapcore.DebugLevel {
+			t.Errorf("Expected SetLevel to change cfg.Level to %v, got %v", zapcore.DebugLevel, level)
+		}
+	})
+}
+
+func TestInitSentryTracesSampleRate(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		cfg  SentryConfig
+		want float64
+	}{
+		{name: "default", want: 0},
+		{name: "set", cfg: SentryConfig{TracesSampleRate: 0.01}, want: 0.01},
+		{name: "invalid", cfg: SentryConfig{TracesSampleRate: 2}, want: 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			closer, err := InitSentry(c.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closer.Close()
+			if got := sentry.CurrentHub().Client().Options().TracesSampleRate; got != c.want {
+				t.Errorf("TracesSampleRate got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
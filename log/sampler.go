@@ -0,0 +1,168 @@
+package log
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/reddit/baseplate.go/internal/prometheusbpint"
+)
+
+const samplerLabel = "log_sampler"
+
+var suppressedCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "baseplate_log_suppressed_total",
+	Help: "Total number of log entries suppressed by log samplers",
+}, []string{samplerLabel})
+
+// GlobalSamplerName is the name of the sampler configured via SetSampling or
+// Config.Sampling, used as the label of the suppressed counter.
+const GlobalSamplerName = "global"
+
+// DefaultSampling is the SamplingConfig used by the noisy log call sites in
+// Baseplate.go packages (e.g. thriftbp client pools and breakerbp).
+var DefaultSampling = SamplingConfig{
+	Interval:   time.Second,
+	First:      10,
+	Thereafter: 100,
+}
+
+// SamplingConfig defines the config of a Sampler.
+//
+// Can be deserialized from YAML.
+type SamplingConfig struct {
+	// Interval of the sampling,
+	// all the counts are reset at the beginning of every interval.
+	//
+	// When Interval <= 0, sampling is disabled and all entries are allowed.
+	Interval time.Duration `yaml:"interval"`
+
+	// The first First entries with the same key in every interval are allowed.
+	First int `yaml:"first"`
+
+	// After the first First entries, every Thereafter-th entry with the same key
+	// in the same interval is allowed.
+	//
+	// When Thereafter <= 0, all of them are suppressed.
+	Thereafter int `yaml:"thereafter"`
+}
+
+// samplerCounters is the number of counters used by a Sampler.
+//
+// The keys are hashed into the counters,
+// so different keys might share the same counter on hash collisions.
+const samplerCounters = 1024
+
+// Sampler samples log entries by their keys,
+// allowing the first N entries per interval then every Mth.
+//
+// The number of suppressed entries is reported by the
+// baseplate_log_suppressed_total counter, labeled by the name of the Sampler.
+//
+// A nil *Sampler allows all entries.
+//
+// It should be created via NewSampler.
+type Sampler struct {
+	cfg        SamplingConfig
+	counters   [samplerCounters]samplerCounter
+	suppressed prometheus.Counter
+}
+
+// NewSampler creates a new Sampler.
+//
+// It returns nil when cfg.Interval <= 0, which allows all entries.
+func NewSampler(name string, cfg SamplingConfig) *Sampler {
+	if cfg.Interval <= 0 {
+		return nil
+	}
+	return &Sampler{
+		cfg: cfg,
+		suppressed: suppressedCounter.With(prometheus.Labels{
+			samplerLabel: name,
+		}),
+	}
+}
+
+// Allow returns true if the entry with the key should be logged.
+//
+// The key is usually the message of the log entry, optionally combined with
+// other values identifying the call site (e.g. the pool name).
+func (s *Sampler) Allow(key string) bool {
+	if s == nil {
+		return true
+	}
+	return s.allow(hashString(fnvOffset32, key))
+}
+
+func (s *Sampler) allowEntry(level zapcore.Level, msg string) bool {
+	if s == nil {
+		return true
+	}
+	h := (fnvOffset32 ^ uint32(byte(level))) * fnvPrime32
+	return s.allow(hashString(h, msg))
+}
+
+// FNV-1a constants, same as hash/fnv.
+const (
+	fnvOffset32 = 2166136261
+	fnvPrime32  = 16777619
+)
+
+// hashString is FNV-1a without the allocations of hash/fnv.
+func hashString(h uint32, s string) uint32 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= fnvPrime32
+	}
+	return h
+}
+
+func (s *Sampler) allow(hash uint32) bool {
+	n := s.counters[hash%samplerCounters].inc(time.Now(), s.cfg.Interval)
+	first := uint64(max(s.cfg.First, 0))
+	if n <= first {
+		return true
+	}
+	if s.cfg.Thereafter > 0 && (n-first)%uint64(s.cfg.Thereafter) == 0 {
+		return true
+	}
+	s.suppressed.Inc()
+	return false
+}
+
+type samplerCounter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+}
+
+// inc increases the counter and returns the count after the increase.
+func (c *samplerCounter) inc(now time.Time, interval time.Duration) uint64 {
+	tn := now.UnixNano()
+	resetAt := c.resetAt.Load()
+	if resetAt > tn {
+		return c.count.Add(1)
+	}
+	c.count.Store(1)
+	if !c.resetAt.CompareAndSwap(resetAt, tn+interval.Nanoseconds()) {
+		// Lost the race with another reset.
+		return c.count.Add(1)
+	}
+	return 1
+}
+
+// globalSampler is the sampler applied to the global logger and LevelHandler.
+var globalSampler atomic.Pointer[Sampler]
+
+// SetSampling sets the sampling of the global logger and the default slog
+// logger, keyed by the level and message of the log entries.
+//
+// Passing a cfg with Interval <= 0 disables the sampling.
+//
+// The sampling is applied after the level checks,
+// so entries filtered out by the levels are not counted.
+func SetSampling(cfg SamplingConfig) {
+	globalSampler.Store(NewSampler(GlobalSamplerName, cfg))
+}
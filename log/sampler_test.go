@@ -0,0 +1,93 @@
+package log
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestSampler(t *testing.T) {
+	var nilSampler *Sampler
+	if !nilSampler.Allow("foo") {
+		t.Error("Expected nil sampler to allow all entries")
+	}
+	if s := NewSampler("test-disabled", SamplingConfig{}); s != nil {
+		t.Errorf("Expected nil sampler for zero config, got %+v", s)
+	}
+
+	const name = "test-sampler"
+	s := NewSampler(name, SamplingConfig{
+		Interval:   time.Hour,
+		First:      2,
+		Thereafter: 3,
+	})
+	var allowed []int
+	for i := 1; i <= 10; i++ {
+		if s.Allow("foo") {
+			allowed = append(allowed, i)
+		}
+	}
+	if got, want := allowed, []int{1, 2, 5, 8}; !slices.Equal(got, want) {
+		t.Errorf("Allowed entries got %v, want %v", got, want)
+	}
+	if !s.Allow("bar") {
+		t.Error("Expected the first entry of a different key to be allowed")
+	}
+	counter := suppressedCounter.With(prometheus.Labels{samplerLabel: name})
+	if got := testutil.ToFloat64(counter); got != 6 {
+		t.Errorf("Expected 6 suppressed entries, got %v", got)
+	}
+
+	s = NewSampler(name, SamplingConfig{
+		Interval: time.Millisecond,
+		First:    1,
+	})
+	if !s.Allow("foo") || s.Allow("foo") {
+		t.Error("Expected only the first entry to be allowed")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !s.Allow("foo") {
+		t.Error("Expected the first entry of the next interval to be allowed")
+	}
+}
+
+func TestGlobalSampling(t *testing.T) {
+	resetLevels(t)
+	SetSampling(SamplingConfig{
+		Interval: time.Hour,
+		First:    1,
+	})
+	t.Cleanup(func() {
+		SetSampling(SamplingConfig{})
+	})
+
+	buf := new(bytes.Buffer)
+	logger := zap.New(leveledCore{
+		Core:   initCore(buf),
+		levels: levels,
+	})
+	slogger := slog.New(NewLevelHandler(slog.NewTextHandler(buf, nil)))
+	for i := 0; i < 3; i++ {
+		logger.Info("zap")
+		logger.Warn("zap")
+		slogger.Info("slog")
+	}
+
+	got := buf.String()
+	for msg, want := range map[string]int{
+		`"level":"info","msg":"zap"`: 1,
+		`"level":"warn","msg":"zap"`: 1,
+		`msg=slog`:                   1,
+	} {
+		if n := strings.Count(got, msg); n != want {
+			t.Errorf("Expected %q to be logged %d times, got %d: %s", msg, want, n, got)
+		}
+	}
+}
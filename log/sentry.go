@@ -32,6 +32,14 @@ type SentryConfig struct {
 	// SampleRate between 0 and 1, default is 1.
 	SampleRate *float64 `yaml:"sampleRate"`
 
+	// TracesSampleRate is the sample rate of the Sentry transactions created by
+	// tracing.SentryCreateServerSpanHook, between 0 and 1.
+	//
+	// Default is 0, which disables the Sentry transactions.
+	// As every sampled request is sent to Sentry as a transaction, it should be
+	// kept low for services with high traffic.
+	TracesSampleRate float64 `yaml:"tracesSampleRate"`
+
 	// The name of your service.
 	//
 	// By default sentry extracts hostname reported by the kernel for this field.
@@ -75,6 +83,7 @@ func InitSentry(cfg SentryConfig) (io.Closer, error) {
 	if cfg.SampleRate != nil && *cfg.SampleRate >= 0 && *cfg.SampleRate <= 1 {
 		sampleRate = *cfg.SampleRate
 	}
+	tracesSampleRate := min(max(cfg.TracesSampleRate, 0), 1)
 
 	// Improve legibility of Sentry errors by using the error message as header
 	// instead of the error type and marking stack trace frame from
@@ -101,12 +110,13 @@ func InitSentry(cfg SentryConfig) (io.Closer, error) {
 	}
 
 	if err := sentry.Init(sentry.ClientOptions{
-		Dsn:          cfg.DSN,
-		SampleRate:   sampleRate,
-		ServerName:   cfg.ServerName,
-		Environment:  cfg.Environment,
-		IgnoreErrors: cfg.IgnoreErrors,
-		BeforeSend:   beforeSend,
+		Dsn:              cfg.DSN,
+		SampleRate:       sampleRate,
+		TracesSampleRate: tracesSampleRate,
+		ServerName:       cfg.ServerName,
+		Environment:      cfg.Environment,
+		IgnoreErrors:     cfg.IgnoreErrors,
+		BeforeSend:       beforeSend,
 	}); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,259 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	//lint:ignore SA1019 This library is internal only, not actually deprecated
+	"github.com/reddit/baseplate.go/internalv2compat"
+)
+
+// Field keys used by SpanHandler when mirroring a slog.Record into a span.
+const (
+	SpanLogKeyLevel   = "level"
+	SpanLogKeyMessage = "message"
+)
+
+// SpanHandler is a slog.Handler wrapper that mirrors records at warn level or
+// above into the span found in the context, as span logs (via
+// opentracing.Span.LogFields).
+//
+// All records are still passed to the wrapped handler.
+// The span is looked up via opentracing.SpanFromContext,
+// so it works with tracing.Span without importing the tracing package.
+// Records logged without a context (e.g. slog.Warn instead of
+// slog.WarnContext) or with a context without span are not mirrored.
+//
+// It should be created via NewSpanHandler.
+type SpanHandler struct {
+	next slog.Handler
+
+	// The attrs added via WithAttrs, already converted into span log fields.
+	fields []otlog.Field
+	// The group prefix added via WithGroup, with trailing ".".
+	prefix string
+}
+
+var _ slog.Handler = (*SpanHandler)(nil)
+
+// NewSpanHandler wraps next into a SpanHandler.
+func NewSpanHandler(next slog.Handler) *SpanHandler {
+	return &SpanHandler{next: next}
+}
+
+// Enabled implements slog.Handler.
+func (h *SpanHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *SpanHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			fields := make([]otlog.Field, 0, 2+len(h.fields)+r.NumAttrs())
+			fields = append(
+				fields,
+				otlog.String(SpanLogKeyLevel, r.Level.String()),
+				otlog.String(SpanLogKeyMessage, r.Message),
+			)
+			fields = append(fields, h.fields...)
+			r.Attrs(func(attr slog.Attr) bool {
+				fields = appendSpanLogFields(fields, h.prefix, attr)
+				return true
+			})
+			span.LogFields(fields...)
+		}
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *SpanHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]otlog.Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(fields, h.fields)
+	for _, attr := range attrs {
+		fields = appendSpanLogFields(fields, h.prefix, attr)
+	}
+	return &SpanHandler{
+		next:   h.next.WithAttrs(attrs),
+		fields: fields,
+		prefix: h.prefix,
+	}
+}
+
+// WithGroup implements slog.Handler.
+func (h *SpanHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SpanHandler{
+		next:   h.next.WithGroup(name),
+		fields: h.fields,
+		prefix: h.prefix + name + ".",
+	}
+}
+
+func appendSpanLogFields(fields []otlog.Field, prefix string, attr slog.Attr) []otlog.Field {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix = prefix + attr.Key + "."
+		}
+		for _, a := range value.Group() {
+			fields = appendSpanLogFields(fields, prefix, a)
+		}
+		return fields
+	}
+	if attr.Key == "" {
+		return fields
+	}
+	return append(fields, otlog.String(prefix+attr.Key, value.String()))
+}
+
+// ContextHandler is a slog.Handler wrapper adding the CorrelationFields
+// attached to the context object (see AttachCorrelation) to the records.
+//
+// Records logged without a context (e.g. slog.Info instead of
+// slog.InfoContext) are passed to the wrapped handler unchanged.
+//
+// SetSlogDefault sets the default slog logger to include a ContextHandler.
+//
+// It should be created via NewContextHandler.
+type ContextHandler struct {
+	next slog.Handler
+}
+
+var _ slog.Handler = (*ContextHandler)(nil)
+
+// NewContextHandler wraps next into a ContextHandler.
+func NewContextHandler(next slog.Handler) *ContextHandler {
+	return &ContextHandler{next: next}
+}
+
+// Enabled implements slog.Handler.
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if fields, ok := CorrelationFromContext(ctx); ok {
+		r = r.Clone()
+		r.AddAttrs(fields.attrs()...)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler.
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{next: h.next.WithGroup(name)}
+}
+
+// zapHandler is a slog.Handler writing the records through the core of the
+// global zap logger at the time of the record.
+//
+// It does not filter the records by itself, the levels are checked by the
+// LevelHandler wrapping it.
+type zapHandler struct {
+	fields []zap.Field
+	// The group prefix added via WithGroup, with trailing ".".
+	prefix string
+}
+
+func (zapHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h zapHandler) Handle(_ context.Context, r slog.Record) error {
+	entry := zapcore.Entry{
+		Level:   fromSlogLevel(r.Level),
+		Time:    r.Time,
+		Message: r.Message,
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		entry.Caller = zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, true)
+		entry.Caller.Function = frame.Function
+	}
+	fields := make([]zap.Field, len(h.fields), len(h.fields)+r.NumAttrs())
+	copy(fields, h.fields)
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendZapFields(fields, h.prefix, attr)
+		return true
+	})
+	return internalv2compat.GlobalLogger().Desugar().Core().Write(entry, fields)
+}
+
+func (h zapHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]zap.Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(fields, h.fields)
+	for _, attr := range attrs {
+		fields = appendZapFields(fields, h.prefix, attr)
+	}
+	return zapHandler{
+		fields: fields,
+		prefix: h.prefix,
+	}
+}
+
+func (h zapHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return zapHandler{
+		fields: h.fields,
+		prefix: h.prefix + name + ".",
+	}
+}
+
+func appendZapFields(fields []zap.Field, prefix string, attr slog.Attr) []zap.Field {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix = prefix + attr.Key + "."
+		}
+		for _, a := range value.Group() {
+			fields = appendZapFields(fields, prefix, a)
+		}
+		return fields
+	}
+	if attr.Key == "" {
+		return fields
+	}
+	key := prefix + attr.Key
+	switch value.Kind() {
+	case slog.KindString:
+		return append(fields, zap.String(key, value.String()))
+	case slog.KindInt64:
+		return append(fields, zap.Int64(key, value.Int64()))
+	case slog.KindUint64:
+		return append(fields, zap.Uint64(key, value.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, zap.Float64(key, value.Float64()))
+	case slog.KindBool:
+		return append(fields, zap.Bool(key, value.Bool()))
+	case slog.KindDuration:
+		return append(fields, zap.Duration(key, value.Duration()))
+	case slog.KindTime:
+		return append(fields, zap.Time(key, value.Time()))
+	default:
+		if err, ok := value.Any().(error); ok {
+			return append(fields, zap.NamedError(key, err))
+		}
+		return append(fields, zap.Any(key, value.Any()))
+	}
+}
@@ -0,0 +1,95 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+
+	"github.com/reddit/baseplate.go/log"
+)
+
+func TestSpanHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(log.NewSpanHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	})))
+
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("test").(*mocktracer.MockSpan)
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+	logger.InfoContext(ctx, "info")
+	logger.With("foo", "bar").WithGroup("g").WarnContext(ctx, "warn", "n", 1, slog.Group("sub", "k", "v"))
+	logger.ErrorContext(context.Background(), "no span")
+
+	logs := span.Logs()
+	if len(logs) != 1 {
+		t.Fatalf("Expected 1 span log, got %+v", logs)
+	}
+	actual := make(map[string]string)
+	for _, f := range logs[0].Fields {
+		actual[f.Key] = f.ValueString
+	}
+	expected := map[string]string{
+		log.SpanLogKeyLevel:   "WARN",
+		log.SpanLogKeyMessage: "warn",
+		"foo":                 "bar",
+		"g.n":                 "1",
+		"g.sub.k":             "v",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected span log fields %v, got %v", expected, actual)
+	}
+
+	// Only the error log passes the level of the wrapped handler.
+	output := buf.String()
+	if strings.Contains(output, "warn") || !strings.Contains(output, "no span") {
+		t.Errorf("Unexpected output from the wrapped handler: %q", output)
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(log.NewContextHandler(slog.NewTextHandler(&buf, nil)))
+
+	ctx := log.Attach(context.Background(), log.AttachArgs{TraceID: "trace"})
+	ctx = log.AttachCorrelation(ctx, log.CorrelationFields{
+		TraceID:  "trace",
+		SpanID:   "span",
+		Endpoint: "endpoint",
+	})
+	ctx = log.AttachCorrelation(ctx, log.CorrelationFields{Caller: "caller"})
+
+	fields, ok := log.CorrelationFromContext(ctx)
+	if !ok {
+		t.Fatal("Expected correlation fields in context")
+	}
+	if want := (log.CorrelationFields{
+		TraceID:  "trace",
+		SpanID:   "span",
+		Endpoint: "endpoint",
+		Caller:   "caller",
+	}); fields != want {
+		t.Errorf("Got correlation fields %+v, want %+v", fields, want)
+	}
+
+	logger.InfoContext(ctx, "with context")
+	logger.Info("without context")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", lines)
+	}
+	const suffix = ` traceID=trace spanID=span endpoint=endpoint callerService=caller`
+	if !strings.HasSuffix(lines[0], suffix) {
+		t.Errorf("Expected %q to end with %q", lines[0], suffix)
+	}
+	if strings.Contains(lines[1], "traceID") {
+		t.Errorf("Expected no correlation fields in %q", lines[1])
+	}
+}
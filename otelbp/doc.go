@@ -0,0 +1,22 @@
+// Package otelbp bridges OpenTelemetry instrumented libraries into baseplate
+// tracing and Prometheus metrics.
+//
+// The TracerProvider in this package creates OpenTelemetry spans backed by
+// tracing.Span: spans started with a context that carries a tracing.Span
+// become children of it, and all of them are sampled and recorded through the
+// same tracing.Tracer as the rest of the service.
+//
+// The MeterProvider created by NewMeterProvider exports all the OpenTelemetry
+// metrics through the same Prometheus registry used by other baseplate.go
+// packages.
+//
+// Call InitGlobalProviders early in your main function, after
+// tracing.InitGlobalTracer, to register both as the OpenTelemetry global
+// providers:
+//
+//	mp, err := otelbp.InitGlobalProviders(otelbp.MeterProviderArgs{})
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer mp.Shutdown(context.Background())
+package otelbp
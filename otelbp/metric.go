@@ -0,0 +1,249 @@
+package otelbp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/reddit/baseplate.go/internal/prometheusbpint"
+	"github.com/reddit/baseplate.go/prometheusbp"
+)
+
+// MeterProviderArgs defines the args used in NewMeterProvider.
+type MeterProviderArgs struct {
+	// The Prometheus registerer to export the metrics to.
+	//
+	// Optional, if it's nil the same registry used by all the other
+	// baseplate.go packages will be used.
+	Registerer prometheus.Registerer
+
+	// Additional options to be passed into sdkmetric.NewMeterProvider,
+	// for example views or resources.
+	//
+	// Optional. Reader options should not be used here as the reader is
+	// provided by NewMeterProvider.
+	Options []sdkmetric.Option
+}
+
+// NewMeterProvider creates an OpenTelemetry MeterProvider,
+// with all its metrics exported through Prometheus.
+//
+// The metrics are converted at scrape time following Prometheus and
+// prometheusbp conventions:
+//
+// - Dots and other invalid characters in metric names and attribute keys are
+// replaced with underscores.
+//
+// - Well-known units are added as suffixes (e.g. "_seconds", "_bytes").
+//
+// - Monotonic sums are exported as counters with "_total" suffix,
+// other sums and gauges are exported as gauges.
+//
+// - Histograms in seconds use prometheusbp.DefaultLatencyBuckets instead of
+// OpenTelemetry's default buckets.
+//
+// Exponential histograms and summaries are not supported and will be skipped.
+//
+// Attributes are exported as labels,
+// so all the data points of the same instrument should use the same set of
+// attribute keys.
+//
+// The caller should call Shutdown on the returned MeterProvider when it's no
+// longer needed.
+func NewMeterProvider(args MeterProviderArgs) (*sdkmetric.MeterProvider, error) {
+	registerer := args.Registerer
+	if registerer == nil {
+		registerer = prometheusbpint.GlobalRegistry
+	}
+
+	reader := sdkmetric.NewManualReader()
+	opts := make([]sdkmetric.Option, 0, len(args.Options)+2)
+	opts = append(opts, sdkmetric.WithView(sdkmetric.NewView(
+		sdkmetric.Instrument{
+			Kind: sdkmetric.InstrumentKindHistogram,
+			Unit: "s",
+		},
+		sdkmetric.Stream{
+			Aggregation: sdkmetric.AggregationExplicitBucketHistogram{
+				Boundaries: prometheusbp.DefaultLatencyBuckets,
+			},
+		},
+	)))
+	opts = append(opts, args.Options...)
+	opts = append(opts, sdkmetric.WithReader(reader))
+	mp := sdkmetric.NewMeterProvider(opts...)
+
+	if err := registerer.Register(collector{reader: reader}); err != nil {
+		mp.Shutdown(context.Background())
+		return nil, fmt.Errorf("otelbp.NewMeterProvider: failed to register prometheus collector: %w", err)
+	}
+	return mp, nil
+}
+
+// InitGlobalProviders sets a new TracerProvider and a new MeterProvider created
+// by NewMeterProvider as the OpenTelemetry global providers.
+//
+// It returns the MeterProvider so that the caller can shut it down.
+func InitGlobalProviders(args MeterProviderArgs) (*sdkmetric.MeterProvider, error) {
+	mp, err := NewMeterProvider(args)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(NewTracerProvider())
+	otel.SetMeterProvider(mp)
+	return mp, nil
+}
+
+// collector is an unchecked prometheus.Collector reading the OpenTelemetry
+// metrics from reader at scrape time.
+type collector struct {
+	reader sdkmetric.Reader
+}
+
+// Describe implements prometheus.Collector.
+//
+// It describes nothing as the metrics are only known at scrape time,
+// which makes it an unchecked collector.
+func (collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	var rm metricdata.ResourceMetrics
+	if err := c.reader.Collect(context.Background(), &rm); err != nil {
+		if errors.Is(err, sdkmetric.ErrReaderShutdown) {
+			return
+		}
+		ch <- prometheus.NewInvalidMetric(
+			prometheus.NewDesc("otelbp_collect_error", "Failed to collect OpenTelemetry metrics", nil, nil),
+			err,
+		)
+		return
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			collectMetric(ch, m)
+		}
+	}
+}
+
+func collectMetric(ch chan<- prometheus.Metric, m metricdata.Metrics) {
+	name := metricName(m.Name, m.Unit)
+	switch data := m.Data.(type) {
+	case metricdata.Sum[int64]:
+		collectSum(ch, name, m.Description, data.IsMonotonic, data.DataPoints)
+	case metricdata.Sum[float64]:
+		collectSum(ch, name, m.Description, data.IsMonotonic, data.DataPoints)
+	case metricdata.Gauge[int64]:
+		collectPoints(ch, name, m.Description, prometheus.GaugeValue, data.DataPoints)
+	case metricdata.Gauge[float64]:
+		collectPoints(ch, name, m.Description, prometheus.GaugeValue, data.DataPoints)
+	case metricdata.Histogram[int64]:
+		collectHistogram(ch, name, m.Description, data.DataPoints)
+	case metricdata.Histogram[float64]:
+		collectHistogram(ch, name, m.Description, data.DataPoints)
+	}
+}
+
+func collectSum[N int64 | float64](
+	ch chan<- prometheus.Metric,
+	name, help string,
+	monotonic bool,
+	points []metricdata.DataPoint[N],
+) {
+	if !monotonic {
+		collectPoints(ch, name, help, prometheus.GaugeValue, points)
+		return
+	}
+	if !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	collectPoints(ch, name, help, prometheus.CounterValue, points)
+}
+
+func collectPoints[N int64 | float64](
+	ch chan<- prometheus.Metric,
+	name, help string,
+	valueType prometheus.ValueType,
+	points []metricdata.DataPoint[N],
+) {
+	for _, dp := range points {
+		keys, values := labels(dp.Attributes)
+		desc := prometheus.NewDesc(name, help, keys, nil)
+		m, err := prometheus.NewConstMetric(desc, valueType, float64(dp.Value), values...)
+		if err != nil {
+			m = prometheus.NewInvalidMetric(desc, err)
+		}
+		ch <- m
+	}
+}
+
+func collectHistogram[N int64 | float64](
+	ch chan<- prometheus.Metric,
+	name, help string,
+	points []metricdata.HistogramDataPoint[N],
+) {
+	for _, dp := range points {
+		keys, values := labels(dp.Attributes)
+		desc := prometheus.NewDesc(name, help, keys, nil)
+		// OpenTelemetry bucket counts are per bucket,
+		// while Prometheus ones are cumulative.
+		buckets := make(map[float64]uint64, len(dp.Bounds))
+		var cumulative uint64
+		for i, bound := range dp.Bounds {
+			cumulative += dp.BucketCounts[i]
+			buckets[bound] = cumulative
+		}
+		m, err := prometheus.NewConstHistogram(desc, dp.Count, float64(dp.Sum), buckets, values...)
+		if err != nil {
+			m = prometheus.NewInvalidMetric(desc, err)
+		}
+		ch <- m
+	}
+}
+
+// unitSuffixes maps the well-known UCUM units used by OpenTelemetry to
+// Prometheus metric name suffixes.
+var unitSuffixes = map[string]string{
+	"s":  "_seconds",
+	"ms": "_milliseconds",
+	"By": "_bytes",
+}
+
+func metricName(name, unit string) string {
+	name = sanitizeName(name)
+	if suffix := unitSuffixes[unit]; suffix != "" && !strings.HasSuffix(name, suffix) {
+		name += suffix
+	}
+	return name
+}
+
+func labels(set attribute.Set) (keys, values []string) {
+	keys = make([]string, 0, set.Len())
+	values = make([]string, 0, set.Len())
+	for iter := set.Iter(); iter.Next(); {
+		kv := iter.Attribute()
+		keys = append(keys, sanitizeName(string(kv.Key)))
+		values = append(values, kv.Value.Emit())
+	}
+	return keys, values
+}
+
+// sanitizeName replaces all the characters not allowed in Prometheus metric
+// names and label keys with underscores.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,86 @@
+package otelbp_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/reddit/baseplate.go/otelbp"
+)
+
+func TestMeterProvider(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mp, err := otelbp.NewMeterProvider(otelbp.MeterProviderArgs{
+		Registerer: reg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		mp.Shutdown(context.Background())
+	})
+
+	ctx := context.Background()
+	meter := mp.Meter("test")
+	attrs := metric.WithAttributes(attribute.String("http.method", "GET"))
+
+	counter, err := meter.Int64Counter("test.requests", metric.WithDescription("Requests"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Add(ctx, 2, attrs)
+
+	inflight, err := meter.Int64UpDownCounter("test.inflight", metric.WithDescription("In flight"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inflight.Add(ctx, 3)
+	inflight.Add(ctx, -1)
+
+	latency, err := meter.Float64Histogram(
+		"test.latency",
+		metric.WithDescription("Latency"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latency.Record(ctx, 0.003, attrs)
+
+	const expected = `
+# HELP test_requests_total Requests
+# TYPE test_requests_total counter
+test_requests_total{http_method="GET"} 2
+# HELP test_inflight In flight
+# TYPE test_inflight gauge
+test_inflight 2
+# HELP test_latency_seconds Latency
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{http_method="GET",le="0.0001"} 0
+test_latency_seconds_bucket{http_method="GET",le="0.0005"} 0
+test_latency_seconds_bucket{http_method="GET",le="0.001"} 0
+test_latency_seconds_bucket{http_method="GET",le="0.0025"} 0
+test_latency_seconds_bucket{http_method="GET",le="0.005"} 1
+test_latency_seconds_bucket{http_method="GET",le="0.01"} 1
+test_latency_seconds_bucket{http_method="GET",le="0.025"} 1
+test_latency_seconds_bucket{http_method="GET",le="0.05"} 1
+test_latency_seconds_bucket{http_method="GET",le="0.1"} 1
+test_latency_seconds_bucket{http_method="GET",le="0.25"} 1
+test_latency_seconds_bucket{http_method="GET",le="0.5"} 1
+test_latency_seconds_bucket{http_method="GET",le="1"} 1
+test_latency_seconds_bucket{http_method="GET",le="5"} 1
+test_latency_seconds_bucket{http_method="GET",le="15"} 1
+test_latency_seconds_bucket{http_method="GET",le="30"} 1
+test_latency_seconds_bucket{http_method="GET",le="+Inf"} 1
+test_latency_seconds_sum{http_method="GET"} 0.003
+test_latency_seconds_count{http_method="GET"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,255 @@
+package otelbp
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+
+	"github.com/reddit/baseplate.go/tracing"
+)
+
+// TagKeyScopeName is the span tag key of the name of the OpenTelemetry
+// instrumentation scope (the name passed into TracerProvider.Tracer) that
+// created the span.
+const TagKeyScopeName = "otel.scope.name"
+
+// Span log keys used when recording OpenTelemetry span events.
+const (
+	logKeyEvent     = "event"
+	logValueErrored = "error"
+)
+
+// TracerProvider is an OpenTelemetry trace.TracerProvider backed by baseplate
+// tracing.
+//
+// It should be created by NewTracerProvider.
+type TracerProvider struct {
+	embedded.TracerProvider
+}
+
+var _ trace.TracerProvider = (*TracerProvider)(nil)
+
+// NewTracerProvider creates a new TracerProvider.
+//
+// The spans are created by the global tracing.Tracer when they don't have a
+// baseplate parent span,
+// so tracing.InitGlobalTracer should be called before using it.
+func NewTracerProvider() *TracerProvider {
+	return &TracerProvider{}
+}
+
+// Tracer implements trace.TracerProvider.
+func (tp *TracerProvider) Tracer(name string, _ ...trace.TracerOption) trace.Tracer {
+	return &tracer{
+		provider: tp,
+		scope:    name,
+	}
+}
+
+type tracer struct {
+	embedded.Tracer
+
+	provider *TracerProvider
+	scope    string
+}
+
+// Start implements trace.Tracer.
+//
+// The new span is created as:
+//
+// - A child of the tracing.Span in ctx, if any.
+//
+// - A server span via tracing.StartSpanFromHeaders, if ctx carries a remote
+// OpenTelemetry span context instead.
+//
+// - A top level span otherwise.
+//
+// The returned context carries the new span both as an OpenTelemetry span and
+// as an opentracing span, so both OpenTelemetry and baseplate instrumentation
+// using it create children of the new span.
+func (t *tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	if cfg.NewRoot() {
+		ctx = opentracing.ContextWithSpan(ctx, nil)
+		ctx = trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+	}
+	startOpts := []opentracing.StartSpanOption{
+		tracing.SpanTypeOption{Type: spanType(cfg.SpanKind())},
+		opentracing.StartTime(cfg.Timestamp()),
+	}
+
+	var bpSpan *tracing.Span
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		var otSpan opentracing.Span
+		otSpan, ctx = opentracing.StartSpanFromContextWithTracer(ctx, parent.Tracer(), name, startOpts...)
+		bpSpan = tracing.AsSpan(otSpan)
+	} else if sc := trace.SpanContextFromContext(ctx); sc.IsValid() && sc.IsRemote() {
+		sampled := sc.IsSampled()
+		ctx, bpSpan = tracing.StartSpanFromHeaders(ctx, name, tracing.Headers{
+			TraceID:    sc.TraceID().String(),
+			SpanID:     sc.SpanID().String(),
+			Sampled:    &sampled,
+			TraceState: sc.TraceState().String(),
+		})
+	} else {
+		var otSpan opentracing.Span
+		otSpan, ctx = opentracing.StartSpanFromContext(ctx, name, startOpts...)
+		bpSpan = tracing.AsSpan(otSpan)
+	}
+
+	bpSpan.SetTag(TagKeyScopeName, t.scope)
+	setAttributes(bpSpan, cfg.Attributes())
+
+	s := &span{
+		provider: t.provider,
+		span:     bpSpan,
+	}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func spanType(kind trace.SpanKind) tracing.SpanType {
+	switch kind {
+	case trace.SpanKindServer, trace.SpanKindConsumer:
+		return tracing.SpanTypeServer
+	case trace.SpanKindClient, trace.SpanKindProducer:
+		return tracing.SpanTypeClient
+	default:
+		return tracing.SpanTypeLocal
+	}
+}
+
+// span is an OpenTelemetry trace.Span wrapping a tracing.Span.
+type span struct {
+	embedded.Span
+
+	provider *TracerProvider
+	span     *tracing.Span
+
+	lock  sync.Mutex
+	ended bool
+	err   error
+}
+
+var _ trace.Span = (*span)(nil)
+
+// End implements trace.Span.
+//
+// It stops the underlying tracing.Span,
+// with the error set via SetStatus, if any.
+func (s *span) End(opts ...trace.SpanEndOption) {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	err := s.err
+	s.lock.Unlock()
+
+	cfg := trace.NewSpanEndConfig(opts...)
+	finishOpts := tracing.FinishOptions{Err: err}.Convert()
+	finishOpts.FinishTime = cfg.Timestamp()
+	s.span.FinishWithOptions(finishOpts)
+}
+
+// AddEvent implements trace.Span.
+//
+// The event is recorded as a span log.
+func (s *span) AddEvent(name string, opts ...trace.EventOption) {
+	cfg := trace.NewEventConfig(opts...)
+	s.span.LogFields(logFields(otlog.String(logKeyEvent, name), cfg.Attributes())...)
+}
+
+// AddLink implements trace.Span.
+//
+// Links are not supported by baseplate tracing and it's a no-op.
+func (s *span) AddLink(trace.Link) {}
+
+// IsRecording implements trace.Span.
+func (s *span) IsRecording() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.ended
+}
+
+// RecordError implements trace.Span.
+//
+// The error is recorded as a span log.
+// Same as OpenTelemetry SDK, it does not mark the span as failed,
+// use SetStatus for that.
+func (s *span) RecordError(err error, opts ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+	cfg := trace.NewEventConfig(opts...)
+	fields := logFields(otlog.String(logKeyEvent, logValueErrored), cfg.Attributes())
+	s.span.LogFields(append(fields, otlog.Error(err))...)
+}
+
+// SpanContext implements trace.Span.
+func (s *span) SpanContext() trace.SpanContext {
+	// Reuse the ID conversions in tracing.W3CPropagator,
+	// as baseplate trace and span ids are not always in OpenTelemetry format.
+	carrier := propagation.MapCarrier{}
+	tracing.W3CPropagator{}.Inject(s.span, carrier)
+	ctx := propagation.TraceContext{}.Extract(context.Background(), carrier)
+	return trace.SpanContextFromContext(ctx).WithRemote(false)
+}
+
+// SetStatus implements trace.Span.
+//
+// Setting an error status makes the underlying tracing.Span stopped with an
+// error.
+func (s *span) SetStatus(code codes.Code, description string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch code {
+	case codes.Error:
+		if description == "" {
+			description = code.String()
+		}
+		s.err = errors.New(description)
+	case codes.Ok:
+		s.err = nil
+	}
+}
+
+// SetName implements trace.Span.
+func (s *span) SetName(name string) {
+	s.span.SetOperationName(name)
+}
+
+// SetAttributes implements trace.Span.
+//
+// The attributes are set as span tags.
+func (s *span) SetAttributes(kv ...attribute.KeyValue) {
+	setAttributes(s.span, kv)
+}
+
+// TracerProvider implements trace.Span.
+func (s *span) TracerProvider() trace.TracerProvider {
+	return s.provider
+}
+
+func setAttributes(s *tracing.Span, attrs []attribute.KeyValue) {
+	for _, kv := range attrs {
+		s.SetTag(string(kv.Key), kv.Value.Emit())
+	}
+}
+
+func logFields(first otlog.Field, attrs []attribute.KeyValue) []otlog.Field {
+	fields := make([]otlog.Field, 0, len(attrs)+2)
+	fields = append(fields, first)
+	for _, kv := range attrs {
+		fields = append(fields, otlog.String(string(kv.Key), kv.Value.Emit()))
+	}
+	return fields
+}
@@ -0,0 +1,150 @@
+package otelbp_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/reddit/baseplate.go/otelbp"
+	"github.com/reddit/baseplate.go/tracing"
+)
+
+type fakeRecorder struct {
+	lock  sync.Mutex
+	spans []tracing.ZipkinSpan
+}
+
+func (r *fakeRecorder) Record(_ context.Context, span tracing.ZipkinSpan) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+	return nil
+}
+
+func (r *fakeRecorder) Close() error {
+	return nil
+}
+
+func (r *fakeRecorder) recorded() []tracing.ZipkinSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.spans
+}
+
+func initTracer(t *testing.T) *fakeRecorder {
+	t.Helper()
+	recorder := &fakeRecorder{}
+	if err := tracing.InitGlobalTracer(tracing.Config{
+		SampleRate: 1,
+		Recorder:   recorder,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tracing.InitGlobalTracer(tracing.Config{})
+	})
+	return recorder
+}
+
+func binaryAnnotations(zs tracing.ZipkinSpan) map[string]interface{} {
+	m := make(map[string]interface{}, len(zs.BinaryAnnotations))
+	for _, ba := range zs.BinaryAnnotations {
+		m[ba.Key] = ba.Value
+	}
+	return m
+}
+
+func TestTracerProviderChildSpan(t *testing.T) {
+	recorder := initTracer(t)
+
+	ctx, server := tracing.StartTopLevelServerSpan(context.Background(), "server")
+	tracer := otelbp.NewTracerProvider().Tracer("test-library")
+	ctx, span := tracer.Start(
+		ctx,
+		"otel-client",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("foo", "bar")),
+	)
+	if got := trace.SpanFromContext(ctx); got != span {
+		t.Errorf("Expected the span to be attached to the context, got %v", got)
+	}
+	// Both otel and baseplate spans started from ctx are children of span.
+	_, grandchild := tracer.Start(ctx, "otel-local")
+	grandchild.End()
+
+	sc := span.SpanContext()
+	if !sc.IsValid() || !sc.IsSampled() || sc.IsRemote() {
+		t.Errorf("Unexpected span context %+v", sc)
+	}
+	span.AddEvent("cache miss")
+	span.SetStatus(codes.Error, "dummy")
+	span.End()
+	if span.IsRecording() {
+		t.Error("Expected span to stop recording after End")
+	}
+	if err := server.Stop(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.recorded()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %+v", spans)
+	}
+	grandchildSpan, childSpan, serverSpan := spans[0], spans[1], spans[2]
+	if childSpan.Name != "otel-client" || childSpan.ParentID != serverSpan.SpanID || childSpan.TraceID != serverSpan.TraceID {
+		t.Errorf("Expected otel-client span to be child of %+v, got %+v", serverSpan, childSpan)
+	}
+	if grandchildSpan.ParentID != childSpan.SpanID {
+		t.Errorf("Expected otel-local span to be child of %+v, got %+v", childSpan, grandchildSpan)
+	}
+	tags := binaryAnnotations(childSpan)
+	for key, expected := range map[string]string{
+		"foo":                                  "bar",
+		otelbp.TagKeyScopeName:                 "test-library",
+		tracing.ZipkinBinaryAnnotationKeyError: "true",
+	} {
+		if fmt.Sprint(tags[key]) != expected {
+			t.Errorf("Expected tag %q to be %v, got %v", key, expected, tags[key])
+		}
+	}
+	var foundEvent bool
+	for _, ta := range childSpan.TimeAnnotations {
+		if ta.Key == "event=cache miss" {
+			foundEvent = true
+		}
+	}
+	if !foundEvent {
+		t.Errorf("Expected event in span logs, got %+v", childSpan.TimeAnnotations)
+	}
+}
+
+func TestTracerProviderRemoteParent(t *testing.T) {
+	recorder := initTracer(t)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+	_, span := otelbp.NewTracerProvider().Tracer("test").Start(ctx, "server", trace.WithSpanKind(trace.SpanKindServer))
+	if got := span.SpanContext().TraceID(); got != traceID {
+		t.Errorf("Expected trace id %v, got %v", traceID, got)
+	}
+	span.End()
+
+	spans := recorder.recorded()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %+v", spans)
+	}
+	if spans[0].TraceID != traceID.String() || spans[0].ParentID != spanID.String() {
+		t.Errorf("Expected span to continue the remote trace, got %+v", spans[0])
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimitbp
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the rate limit config of a Limiter.
+//
+// Can be deserialized from YAML, e.g.:
+//
+//	classes:
+//	  caller:
+//	    default:
+//	      rate: 100
+//	      burst: 200
+//	    keys:
+//	      batch-service:
+//	        rate: 10
+//	      trusted-service:
+//	        rate: 0 # no limit
+//	  oauth_client:
+//	    keys:
+//	      some-client-id:
+//	        rate: 5
+type Config struct {
+	// Classes maps the key classes to their configs.
+	//
+	// Key classes without a KeyFunc in the Limiter are ignored.
+	Classes map[string]ClassConfig `yaml:"classes"`
+}
+
+// ClassConfig is the rate limit config of a key class.
+type ClassConfig struct {
+	// Default is the Limit applied to every key without an override in Keys.
+	//
+	// If Default is nil, only the keys in Keys are limited.
+	Default *Limit `yaml:"default"`
+
+	// Keys overrides the Limit of the given keys.
+	Keys map[string]Limit `yaml:"keys"`
+}
+
+// Limit defines the token bucket of a key.
+type Limit struct {
+	// Rate is the number of requests allowed per second.
+	//
+	// Rate <= 0 means no limit.
+	Rate float64 `yaml:"rate"`
+
+	// Burst is the max number of requests allowed at once.
+	//
+	// Optional, default to Rate rounded up (with a minimum of 1).
+	Burst int `yaml:"burst"`
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return max(1, int(math.Ceil(l.Rate)))
+}
+
+// limit returns the Limit of the key and whether the key should be limited.
+func (c ClassConfig) limit(key string) (Limit, bool) {
+	limit, ok := c.Keys[key]
+	if !ok {
+		if c.Default == nil {
+			return Limit{}, false
+		}
+		limit = *c.Default
+	}
+	return limit, limit.Rate > 0
+}
+
+// ParseConfig parses Config from YAML.
+//
+// It's the filewatcher.Parser used by WatchLimiter.
+func ParseConfig(r io.Reader) (Config, error) {
+	var cfg Config
+	if err := yaml.NewDecoder(r).Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,11 @@
+// Package ratelimitbp provides per-caller rate limiting for Baseplate servers.
+//
+// A Limiter keeps a token bucket for every key of every key class, e.g. every
+// calling service (from the baseplate headers, see IncomingCaller) for the
+// "caller" key class, with the rates configured via
+// Config, which can be loaded from a YAML file and hot-reloaded via
+// WatchLimiter.
+//
+// The Limiter is protocol agnostic, use httpbp.RateLimit and thriftbp.RateLimit
+// to apply it to HTTP and thrift servers.
+package ratelimitbp
@@ -0,0 +1,346 @@
+package ratelimitbp
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/filewatcher/v2"
+	"github.com/reddit/baseplate.go/headerbp"
+	"github.com/reddit/baseplate.go/internal/prometheusbpint"
+)
+
+// The key classes of the KeyFuncs returned by DefaultKeyFuncs.
+const (
+	KeyClassCaller      = "caller"
+	KeyClassOAuthClient = "oauth_client"
+)
+
+const (
+	keyClassLabel = "ratelimit_key_class"
+	resultLabel   = "ratelimit_result"
+
+	resultAllowed = "allowed"
+	resultLimited = "limited"
+)
+
+var requestsCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "ratelimitbp_requests_total",
+	Help: "Total number of requests checked by rate limiters",
+}, []string{keyClassLabel, resultLabel})
+
+// DefaultMaxKeys is the default max number of keys a Limiter keeps a token
+// bucket for.
+const DefaultMaxKeys = 10000
+
+// KeyFunc extracts the rate limit key of the request from its context.
+//
+// It shall return ("", false) when the request has no key of its key class,
+// so it's not limited by the key class.
+type KeyFunc func(ctx context.Context) (key string, ok bool)
+
+// CallerHeader is the baseplate header (see headerbp) identifying the calling
+// service, used as the caller of the request by httpbp.RateLimit and
+// thriftbp.RateLimit.
+const CallerHeader = "x-bp-caller"
+
+type callerContextKey struct{}
+
+// WithCaller returns a context with the calling service of the request set,
+// to be read by CallerKey.
+//
+// httpbp.RateLimit and thriftbp.RateLimit call it with IncomingCaller, so it
+// only needs to be called directly when using Limiter with other servers.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// IncomingCaller returns the caller of the request from CallerHeader in the
+// baseplate headers received by the server (see headerbp.IncomingHeader).
+//
+// When the request has no such header, it returns fallback instead, usually
+// the "User-Agent" header set by the Baseplate clients. Note that unlike the
+// verified baseplate headers, the callers can set any "User-Agent" they like
+// (including a different one per request to get a new token bucket every
+// time), so the Default limit of KeyClassCaller should not be relied on to
+// protect the server from untrusted callers.
+func IncomingCaller(ctx context.Context, fallback string) string {
+	if caller, ok := headerbp.IncomingHeader(ctx, CallerHeader); ok && caller != "" {
+		return caller
+	}
+	return fallback
+}
+
+// CallerKey is the KeyFunc returning the calling service of the request, as
+// set by WithCaller.
+func CallerKey(ctx context.Context) (string, bool) {
+	caller, _ := ctx.Value(callerContextKey{}).(string)
+	return caller, caller != ""
+}
+
+// OAuthClientKey returns the KeyFunc returning the OAuth client id of the edge
+// context of the request.
+//
+// It requires the edge context implementation to implement
+// ecinterface.OAuthClientIDGetter, otherwise no request has a key.
+//
+// If impl is nil, ecinterface.Get() is used.
+func OAuthClientKey(impl ecinterface.Interface) KeyFunc {
+	return func(ctx context.Context) (string, bool) {
+		impl := impl
+		if impl == nil {
+			impl = ecinterface.Get()
+		}
+		getter, ok := impl.(ecinterface.OAuthClientIDGetter)
+		if !ok {
+			return "", false
+		}
+		return getter.OAuthClientID(ctx)
+	}
+}
+
+// DefaultKeyFuncs returns the default KeyFuncs used by Limiter:
+//
+// - KeyClassCaller: CallerKey
+//
+// - KeyClassOAuthClient: OAuthClientKey(nil)
+func DefaultKeyFuncs() map[string]KeyFunc {
+	return map[string]KeyFunc{
+		KeyClassCaller:      CallerKey,
+		KeyClassOAuthClient: OAuthClientKey(nil),
+	}
+}
+
+// LimitedError is the error returned by Limiter.Allow when the request exceeds
+// the rate limit of its key.
+type LimitedError struct {
+	// The key class and key of the exceeded rate limit.
+	Class string
+	Key   string
+
+	// RetryAfter is the duration after which the request would be allowed.
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf(
+		"ratelimitbp: rate limit of %s %q exceeded, retry after %v",
+		e.Class,
+		e.Key,
+		e.RetryAfter,
+	)
+}
+
+// LimiterArgs defines the args used by NewLimiter and WatchLimiter.
+type LimiterArgs struct {
+	// KeyFuncs maps the key classes to the KeyFuncs extracting their keys.
+	//
+	// Optional, default to DefaultKeyFuncs().
+	KeyFuncs map[string]KeyFunc
+
+	// MaxKeys is the max number of keys to keep a token bucket for.
+	//
+	// When there are more keys, the token bucket of the least recently used key
+	// is evicted, and a new full token bucket will be created when the evicted
+	// key is seen again.
+	//
+	// Optional, default to DefaultMaxKeys.
+	MaxKeys int
+}
+
+// Limiter limits the requests with token buckets per key.
+//
+// It should be created via NewLimiter or WatchLimiter.
+type Limiter struct {
+	config  func() Config
+	closer  func() error
+	classes []classKeyFunc
+	maxKeys int
+
+	lock    sync.Mutex
+	buckets map[bucketKey]*list.Element // values are *bucket in lru
+	lru     *list.List                  // front is the most recently used
+}
+
+type classKeyFunc struct {
+	class string
+	key   KeyFunc
+}
+
+type bucketKey struct {
+	class string
+	key   string
+}
+
+type bucket struct {
+	key     bucketKey
+	limit   Limit
+	limiter *rate.Limiter
+}
+
+// NewLimiter creates a Limiter with a static Config.
+func NewLimiter(cfg Config, args LimiterArgs) *Limiter {
+	return newLimiter(
+		func() Config {
+			return cfg
+		},
+		func() error {
+			return nil
+		},
+		args,
+	)
+}
+
+// NewLimiterWithWatcher creates a Limiter with the Config from fw.
+//
+// Closing the Limiter closes fw.
+func NewLimiterWithWatcher(fw filewatcher.FileWatcher[Config], args LimiterArgs) *Limiter {
+	return newLimiter(fw.Get, fw.Close, args)
+}
+
+// WatchLimiter creates a Limiter with the Config parsed from the YAML file at
+// path, which will be hot-reloaded when the file changes.
+//
+// Context should come with a timeout otherwise this might block forever, i.e.
+// if the path never becomes available.
+//
+// The Limiter should be closed to stop watching the file.
+func WatchLimiter(ctx context.Context, path string, args LimiterArgs, options ...filewatcher.Option) (*Limiter, error) {
+	fw, err := filewatcher.New(ctx, path, ParseConfig, options...)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimitbp: failed to watch %q: %w", path, err)
+	}
+	return NewLimiterWithWatcher(fw, args), nil
+}
+
+func newLimiter(config func() Config, closer func() error, args LimiterArgs) *Limiter {
+	keyFuncs := args.KeyFuncs
+	if keyFuncs == nil {
+		keyFuncs = DefaultKeyFuncs()
+	}
+	classes := make([]classKeyFunc, 0, len(keyFuncs))
+	for class, key := range keyFuncs {
+		classes = append(classes, classKeyFunc{class: class, key: key})
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].class < classes[j].class
+	})
+	maxKeys := args.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &Limiter{
+		config:  config,
+		closer:  closer,
+		classes: classes,
+		maxKeys: maxKeys,
+		buckets: make(map[bucketKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Allow checks the request against the rate limits of all its keys.
+//
+// It returns nil if the request is allowed, or *LimitedError if any of the
+// rate limits is exceeded, in which case no token is taken from the other
+// token buckets.
+func (l *Limiter) Allow(ctx context.Context) error {
+	cfg := l.config()
+	if len(cfg.Classes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var (
+		checked      []string
+		reservations []*rate.Reservation
+	)
+	for _, c := range l.classes {
+		classCfg, ok := cfg.Classes[c.class]
+		if !ok {
+			continue
+		}
+		key, ok := c.key(ctx)
+		if !ok || key == "" {
+			continue
+		}
+		limit, ok := classCfg.limit(key)
+		if !ok {
+			continue
+		}
+
+		r := l.bucket(c.class, key, limit).ReserveN(now, 1)
+		if delay := r.DelayFrom(now); !r.OK() || delay > 0 {
+			r.CancelAt(now)
+			for _, r := range reservations {
+				r.CancelAt(now)
+			}
+			requestsCounter.With(prometheus.Labels{
+				keyClassLabel: c.class,
+				resultLabel:   resultLimited,
+			}).Inc()
+			return &LimitedError{
+				Class:      c.class,
+				Key:        key,
+				RetryAfter: delay,
+			}
+		}
+		checked = append(checked, c.class)
+		reservations = append(reservations, r)
+	}
+	for _, class := range checked {
+		requestsCounter.With(prometheus.Labels{
+			keyClassLabel: class,
+			resultLabel:   resultAllowed,
+		}).Inc()
+	}
+	return nil
+}
+
+// bucket returns the token bucket of the key, updated to the limit.
+//
+// It evicts the least recently used token buckets when there are more than
+// maxKeys of them.
+func (l *Limiter) bucket(class, key string, limit Limit) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	k := bucketKey{class: class, key: key}
+	elem, ok := l.buckets[k]
+	if !ok {
+		for l.lru.Len() >= l.maxKeys {
+			oldest := l.lru.Back()
+			l.lru.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).key)
+		}
+		b := &bucket{
+			key:     k,
+			limit:   limit,
+			limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.burst()),
+		}
+		l.buckets[k] = l.lru.PushFront(b)
+		return b.limiter
+	}
+	l.lru.MoveToFront(elem)
+	b := elem.Value.(*bucket)
+	if b.limit != limit {
+		// The config was reloaded.
+		b.limit = limit
+		b.limiter.SetLimit(rate.Limit(limit.Rate))
+		b.limiter.SetBurst(limit.burst())
+	}
+	return b.limiter
+}
+
+// Close stops watching the config file, if any.
+func (l *Limiter) Close() error {
+	return l.closer()
+}
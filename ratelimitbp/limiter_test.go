@@ -0,0 +1,194 @@
+package ratelimitbp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/reddit/baseplate.go/filewatcher/v2/fwtest"
+	"github.com/reddit/baseplate.go/headerbp"
+	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+)
+
+func callerContext(caller string) context.Context {
+	return WithCaller(context.Background(), caller)
+}
+
+func checkAllow(t *testing.T, l *Limiter, ctx context.Context, expectLimited bool) {
+	t.Helper()
+	err := l.Allow(ctx)
+	var limited *LimitedError
+	if got := errors.As(err, &limited); got != expectLimited {
+		t.Fatalf("Expected limited to be %v, got error %v", expectLimited, err)
+	}
+	if expectLimited && limited.RetryAfter <= 0 {
+		t.Errorf("Expected positive RetryAfter, got %+v", limited)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Config{
+		Classes: map[string]ClassConfig{
+			KeyClassCaller: {
+				Default: &Limit{Rate: 0.001, Burst: 2},
+				Keys: map[string]Limit{
+					"small":     {Rate: 0.001},
+					"unlimited": {Rate: 0},
+				},
+			},
+		},
+	}, LimiterArgs{})
+
+	defer promtest.NewPrometheusMetricTest(t, "allowed", requestsCounter, prometheus.Labels{
+		keyClassLabel: KeyClassCaller,
+		resultLabel:   resultAllowed,
+	}).CheckDelta(4)
+	defer promtest.NewPrometheusMetricTest(t, "limited", requestsCounter, prometheus.Labels{
+		keyClassLabel: KeyClassCaller,
+		resultLabel:   resultLimited,
+	}).CheckDelta(2)
+
+	// Default limit, per caller.
+	checkAllow(t, l, callerContext("foo"), false)
+	checkAllow(t, l, callerContext("foo"), false)
+	checkAllow(t, l, callerContext("foo"), true)
+	checkAllow(t, l, callerContext("bar"), false)
+
+	// Overrides.
+	checkAllow(t, l, callerContext("small"), false)
+	checkAllow(t, l, callerContext("small"), true)
+	for i := 0; i < 10; i++ {
+		checkAllow(t, l, callerContext("unlimited"), false)
+	}
+
+	// No caller.
+	checkAllow(t, l, context.Background(), false)
+}
+
+func TestLimiterReload(t *testing.T) {
+	const initial = `
+classes:
+  a:
+    default:
+      rate: 0.001
+      burst: 2
+  b:
+    default:
+      rate: 0.001
+`
+	fw, err := fwtest.NewFakeFilewatcher(strings.NewReader(initial), ParseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(k string) KeyFunc {
+		return func(context.Context) (string, bool) {
+			return k, true
+		}
+	}
+	l := NewLimiterWithWatcher(fw, LimiterArgs{
+		KeyFuncs: map[string]KeyFunc{
+			"a": key("x"),
+			"b": key("y"),
+		},
+	})
+	defer l.Close()
+
+	ctx := context.Background()
+	checkAllow(t, l, ctx, false)
+	// Limited by b, the token taken from a should be returned.
+	checkAllow(t, l, ctx, true)
+
+	if err := fw.Update(strings.NewReader(`
+classes:
+  a:
+    default:
+      rate: 0.001
+      burst: 2
+`)); err != nil {
+		t.Fatal(err)
+	}
+	checkAllow(t, l, ctx, false)
+	checkAllow(t, l, ctx, true)
+
+	// Raising the rate takes effect on the existing bucket,
+	// starting from the next request.
+	if err := fw.Update(strings.NewReader(`
+classes:
+  a:
+    default:
+      rate: 1000
+`)); err != nil {
+		t.Fatal(err)
+	}
+	l.Allow(ctx)
+	time.Sleep(10 * time.Millisecond)
+	checkAllow(t, l, ctx, false)
+}
+
+func TestLimiterMaxKeys(t *testing.T) {
+	l := NewLimiter(Config{
+		Classes: map[string]ClassConfig{
+			KeyClassCaller: {
+				Default: &Limit{Rate: 0.001},
+			},
+		},
+	}, LimiterArgs{MaxKeys: 2})
+
+	checkAllow(t, l, callerContext("foo"), false)
+	checkAllow(t, l, callerContext("bar"), false)
+	checkAllow(t, l, callerContext("foo"), true)
+	// Evicts bar, the least recently used, so it doesn't share a bucket with the
+	// other keys.
+	checkAllow(t, l, callerContext("baz"), false)
+	checkAllow(t, l, callerContext("foo"), true)
+	checkAllow(t, l, callerContext("bar"), false)
+	if n := len(l.buckets); n != 2 {
+		t.Errorf("Expected 2 token buckets, got %d", n)
+	}
+}
+
+func TestWatchLimiter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	if err := os.WriteFile(path, []byte(`
+classes:
+  caller:
+    keys:
+      foo:
+        rate: 0.001
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	l, err := WatchLimiter(ctx, path, LimiterArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	checkAllow(t, l, callerContext("foo"), false)
+	checkAllow(t, l, callerContext("foo"), true)
+	checkAllow(t, l, callerContext("bar"), false)
+	checkAllow(t, l, callerContext("bar"), false)
+}
+
+func TestIncomingCaller(t *testing.T) {
+	ctx := context.Background()
+	if got := IncomingCaller(ctx, "user-agent"); got != "user-agent" {
+		t.Errorf("Expected the fallback without baseplate headers, got %q", got)
+	}
+
+	headers := headerbp.NewIncomingHeaders()
+	headers.RecordHeader("X-Bp-Caller", "caller")
+	ctx = headers.SetOnContext(ctx)
+	if got := IncomingCaller(ctx, "user-agent"); got != "caller" {
+		t.Errorf("Expected the caller from the baseplate headers, got %q", got)
+	}
+}
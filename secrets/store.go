@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/reddit/baseplate.go/filewatcher"
@@ -38,6 +39,9 @@ type Store struct {
 	// calling unsafeSecretHandlerFunc directly
 	mu                      sync.Mutex
 	unsafeSecretHandlerFunc SecretHandlerFunc
+
+	// The unix nano timestamp of the last successful secrets parsing.
+	lastUpdated atomic.Int64
 }
 
 // NewStore returns a new instance of Store by configuring it
@@ -90,6 +94,7 @@ func (s *Store) parser(r io.Reader) (any, error) {
 		return nil, err
 	}
 
+	s.lastUpdated.Store(time.Now().UnixNano())
 	s.secretHandlerFunc(secrets)
 
 	return secrets, nil
@@ -101,6 +106,7 @@ func (s *Store) dirParser(dir fs.FS) (any, error) {
 		return nil, err
 	}
 
+	s.lastUpdated.Store(time.Now().UnixNano())
 	s.secretHandlerFunc(secrets)
 
 	return secrets, nil
@@ -149,6 +155,15 @@ func (s *Store) Close() error {
 	return nil
 }
 
+// LastUpdated returns the time the secrets were last successfully loaded from
+// the file.
+//
+// It can be used to detect stale secrets, e.g. when the fetcher daemon stopped
+// updating the file, or the updated file failed to parse.
+func (s *Store) LastUpdated() time.Time {
+	return time.Unix(0, s.lastUpdated.Load())
+}
+
 // AddMiddlewares registers new middlewares to the store.
 //
 // Every AddMiddlewares call will cause all already registered middlewares to be
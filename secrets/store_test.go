@@ -319,6 +319,10 @@ func TestSecretFileIsUpdated(t *testing.T) {
 	if string(secret.Value) != expected {
 		t.Fatalf("expected secret to be %s, actual: %s", expected, secret.Value)
 	}
+	firstUpdated := store.LastUpdated()
+	if time.Since(firstUpdated) > time.Minute {
+		t.Errorf("expected LastUpdated to be recent, actual: %v", firstUpdated)
+	}
 
 	updated := `{
 		"secrets": {
@@ -352,6 +356,9 @@ func TestSecretFileIsUpdated(t *testing.T) {
 	if string(secret.Value) != expected {
 		t.Fatalf("expected secret to be %s, actual: %s", expected, secret.Value)
 	}
+	if lastUpdated := store.LastUpdated(); !lastUpdated.After(firstUpdated) {
+		t.Errorf("expected LastUpdated to be after %v, actual: %v", firstUpdated, lastUpdated)
+	}
 }
 
 type mockMiddleware struct {
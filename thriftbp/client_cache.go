@@ -0,0 +1,430 @@
+package thriftbp
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/log"
+	"github.com/reddit/baseplate.go/redis/cache/redisx"
+	"github.com/reddit/baseplate.go/transport"
+)
+
+// DefaultCacheRefreshTimeout is the default timeout of the background calls to
+// refresh the stale responses in CacheResponses.
+const DefaultCacheRefreshTimeout = 5 * time.Second
+
+// The results of the requests to CacheResponses, reported as the
+// thrift_cache_result label.
+const (
+	cacheResultHit   = "hit"
+	cacheResultMiss  = "miss"
+	cacheResultStale = "stale"
+)
+
+// CachedResponse is a response cached by CacheResponses.
+type CachedResponse struct {
+	// Payload is the result TStruct serialized with TBinaryProtocol.
+	Payload []byte
+
+	// Expiration is when the response becomes stale.
+	Expiration time.Time
+}
+
+// ResponseCache is the storage backend used by CacheResponses.
+//
+// All the implementations must be safe to be used concurrently.
+type ResponseCache interface {
+	// Get returns the response cached with the key.
+	//
+	// When the response is not cached (or already evicted), it shall return
+	// ok=false with nil error.
+	Get(ctx context.Context, key string) (resp CachedResponse, ok bool, err error)
+
+	// Set caches the response with the key, for at least ttl.
+	Set(ctx context.Context, key string, resp CachedResponse, ttl time.Duration) error
+}
+
+// CacheResponsesArgs are the args to be passed into CacheResponses function.
+type CacheResponsesArgs struct {
+	// ServiceSlug is the slug of the thrift service the client is calling.
+	//
+	// It's used as the thrift_client_name label of the metrics, and the prefix of
+	// the cache keys so different services can share the same ResponseCache.
+	//
+	// Required.
+	ServiceSlug string
+
+	// Cache is the storage backend of the cached responses,
+	// for example NewLRUResponseCache or NewRedisResponseCache.
+	//
+	// Required.
+	Cache ResponseCache
+
+	// Methods are the read-only methods to cache the responses for, and their
+	// TTLs. The responses stay fresh for the TTL after they are cached.
+	//
+	// The methods not in Methods are never cached.
+	Methods map[string]time.Duration
+
+	// KeyHeaders are the THeaders that change the responses, their values are
+	// part of the cache keys.
+	//
+	// transport.HeaderEdgeRequest is read from the edge request context in the
+	// context (via EdgeContextImpl), as it's only set as a THeader by the inner
+	// ForwardEdgeRequestContext middleware.
+	//
+	// Optional. See CacheResponses for the hazard of leaving it empty.
+	KeyHeaders []string
+
+	// EdgeContextImpl is used to serialize the edge request context when
+	// KeyHeaders contains transport.HeaderEdgeRequest.
+	//
+	// Optional. If it's nil, the global one from ecinterface.Get will be used.
+	EdgeContextImpl ecinterface.Interface
+
+	// StaleWhileRevalidate is the duration the responses are still served after
+	// their TTL, while they are being refreshed by background calls.
+	//
+	// Optional. If it's <=0, the expired responses are never served.
+	StaleWhileRevalidate time.Duration
+
+	// RefreshTimeout is the timeout of the background calls to refresh the
+	// stale responses.
+	//
+	// Optional. If it's <=0, DefaultCacheRefreshTimeout will be used.
+	RefreshTimeout time.Duration
+}
+
+// CacheResponses returns a thrift.ClientMiddleware that caches the successful
+// responses of the configured read-only methods.
+//
+// The responses are keyed by ServiceSlug, the method and the args serialized
+// with TBinaryProtocol, so the same call with the same args is served from the
+// cache until the TTL of the method. Note that thrift serializes maps in random
+// order, so the calls with map args with more than one elements are unlikely
+// to be served from the cache.
+//
+// The headers (including the edge request context) are not part of the cache
+// keys unless they are listed in KeyHeaders. Only cache the methods whose
+// responses don't depend on the caller (e.g. the user of the edge request
+// context), or list the headers they depend on in KeyHeaders, otherwise the
+// callers could receive the responses meant for other callers.
+//
+// When StaleWhileRevalidate is set, the stale responses are still served for
+// StaleWhileRevalidate after their TTL, while a single background call per key
+// (with the same context values as the call triggered it, except for its span)
+// refreshes the cached response.
+//
+// Errors from the ResponseCache are logged and treated as cache misses.
+// The responses with errors (including the exceptions defined in thrift IDL)
+// are never cached.
+//
+// It reports the thriftbp_client_cache_requests_total counter with labels:
+//
+//   - thrift_method: the method of the endpoint called
+//   - thrift_client_name: ServiceSlug
+//   - thrift_cache_result: "hit", "miss" or "stale"
+//
+// This middleware should be added before the BaseplateDefaultClientMiddlewares
+// (by passing it into NewBaseplateClientPool), so the cache hits skip the
+// upstream calls altogether.
+func CacheResponses(args CacheResponsesArgs) thrift.ClientMiddleware {
+	refreshTimeout := args.RefreshTimeout
+	if refreshTimeout <= 0 {
+		refreshTimeout = DefaultCacheRefreshTimeout
+	}
+	var refreshing sync.Map
+
+	keyHeaders := keyHeadersFunc(args.KeyHeaders, args.EdgeContextImpl)
+
+	return func(next thrift.TClient) thrift.TClient {
+		// callAndCache calls next and caches the result on success.
+		callAndCache := func(ctx context.Context, key string, ttl time.Duration, method string, a, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			meta, err := next.Call(ctx, method, a, result)
+			if err != nil {
+				return meta, err
+			}
+			if err := thrift.ExtractExceptionFromResult(result); err != nil {
+				return meta, nil
+			}
+			payload, err := serializeTStruct(ctx, result)
+			if err != nil {
+				log.C(ctx).Errorw("thriftbp.CacheResponses: failed to serialize result", "method", method, "err", err)
+				return meta, nil
+			}
+			resp := CachedResponse{
+				Payload:    payload,
+				Expiration: time.Now().Add(ttl),
+			}
+			if err := args.Cache.Set(ctx, key, resp, ttl+max(args.StaleWhileRevalidate, 0)); err != nil {
+				log.C(ctx).Errorw("thriftbp.CacheResponses: failed to set cache", "method", method, "err", err)
+			}
+			return meta, nil
+		}
+
+		refresh := func(ctx context.Context, key string, ttl time.Duration, method string, a, result thrift.TStruct) {
+			if _, loaded := refreshing.LoadOrStore(key, struct{}{}); loaded {
+				return
+			}
+			// Copy the args, as the caller could reuse them after it returns.
+			argsCopy, err := copyTStruct(ctx, a)
+			if err != nil {
+				refreshing.Delete(key)
+				log.C(ctx).Errorw("thriftbp.CacheResponses: failed to copy args", "method", method, "err", err)
+				return
+			}
+			// The span of the caller is finished when it returns, so the
+			// background call must not be its child.
+			ctx = opentracing.ContextWithSpan(context.WithoutCancel(ctx), nil)
+			go func() {
+				defer refreshing.Delete(key)
+
+				ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+				defer cancel()
+				// Use a new result TStruct, as the original one is returned to the
+				// caller.
+				result := reflect.New(reflect.TypeOf(result).Elem()).Interface().(thrift.TStruct)
+				if _, err := callAndCache(ctx, key, ttl, method, argsCopy, result); err != nil {
+					log.C(ctx).Warnw("thriftbp.CacheResponses: failed to refresh stale response", "method", method, "err", err)
+				}
+			}()
+		}
+
+		return thrift.WrappedTClient{
+			Wrapped: func(ctx context.Context, method string, a, result thrift.TStruct) (thrift.ResponseMeta, error) {
+				ttl, ok := args.Methods[method]
+				if !ok || result == nil {
+					return next.Call(ctx, method, a, result)
+				}
+
+				key, err := cacheKey(ctx, args.ServiceSlug, method, a, keyHeaders(ctx))
+				if err != nil {
+					log.C(ctx).Errorw("thriftbp.CacheResponses: failed to serialize args", "method", method, "err", err)
+					return next.Call(ctx, method, a, result)
+				}
+
+				resp, ok, err := args.Cache.Get(ctx, key)
+				if err != nil {
+					log.C(ctx).Errorw("thriftbp.CacheResponses: failed to get cache", "method", method, "err", err)
+					ok = false
+				}
+				if stale := time.Now().After(resp.Expiration); ok && (!stale || args.StaleWhileRevalidate > 0) {
+					err := deserializeTStruct(ctx, resp.Payload, result)
+					if err == nil {
+						if stale {
+							countCacheRequest(args.ServiceSlug, method, cacheResultStale)
+							refresh(ctx, key, ttl, method, a, result)
+						} else {
+							countCacheRequest(args.ServiceSlug, method, cacheResultHit)
+						}
+						return thrift.ResponseMeta{}, nil
+					}
+					log.C(ctx).Errorw("thriftbp.CacheResponses: failed to deserialize cached result", "method", method, "err", err)
+				}
+
+				countCacheRequest(args.ServiceSlug, method, cacheResultMiss)
+				return callAndCache(ctx, key, ttl, method, a, result)
+			},
+		}
+	}
+}
+
+func countCacheRequest(slug, method, result string) {
+	clientCacheRequestsCounter.With(prometheus.Labels{
+		methodLabel:      method,
+		clientNameLabel:  slug,
+		cacheResultLabel: result,
+	}).Inc()
+}
+
+// keyHeadersFunc returns the function to read the values of the headers to be
+// used in the keys of CacheResponses and CoalesceRequests, in the format of
+// "${header}: ${value}".
+func keyHeadersFunc(headers []string, ecImpl ecinterface.Interface) func(ctx context.Context) []string {
+	return func(ctx context.Context) []string {
+		if len(headers) == 0 {
+			return nil
+		}
+		values := make([]string, 0, len(headers))
+		for _, h := range headers {
+			var v string
+			if h == transport.HeaderEdgeRequest {
+				impl := ecImpl
+				if impl == nil {
+					impl = ecinterface.Get()
+				}
+				v, _ = impl.ContextToHeader(ctx)
+			} else {
+				v, _ = header(ctx, h)
+			}
+			values = append(values, h+": "+v)
+		}
+		return values
+	}
+}
+
+// cacheKey returns the cache key in the format of
+// "${slug}:${method}:${sha256 of serialized args and key headers}".
+func cacheKey(ctx context.Context, slug, method string, args thrift.TStruct, keyHeaders []string) (string, error) {
+	payload, err := serializeTStruct(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write(payload)
+	for _, h := range keyHeaders {
+		hash.Write([]byte("\n" + h))
+	}
+	return slug + ":" + method + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// serializeTStruct serializes s with TBinaryProtocol, the same way as
+// thrifttest.CopyTStruct.
+func serializeTStruct(ctx context.Context, s thrift.TStruct) ([]byte, error) {
+	buf := thrift.NewTMemoryBuffer()
+	proto := thrift.NewTBinaryProtocolConf(buf, nil)
+	if err := s.Write(ctx, proto); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func deserializeTStruct(ctx context.Context, payload []byte, s thrift.TStruct) error {
+	buf := thrift.NewTMemoryBuffer()
+	buf.Write(payload)
+	return s.Read(ctx, thrift.NewTBinaryProtocolConf(buf, nil))
+}
+
+// copyTStruct returns a deep copy of s.
+func copyTStruct(ctx context.Context, s thrift.TStruct) (thrift.TStruct, error) {
+	payload, err := serializeTStruct(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	c := reflect.New(reflect.TypeOf(s).Elem()).Interface().(thrift.TStruct)
+	if err := deserializeTStruct(ctx, payload, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type lruResponseCache struct {
+	maxEntries int
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently used
+}
+
+type lruEntry struct {
+	key      string
+	resp     CachedResponse
+	deadline time.Time
+}
+
+// NewLRUResponseCache returns an in-process ResponseCache, evicting the least
+// recently used responses when there are more than maxEntries responses.
+func NewLRUResponseCache(maxEntries int) ResponseCache {
+	return &lruResponseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *lruResponseCache) Get(_ context.Context, key string) (CachedResponse, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return CachedResponse{}, false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.deadline) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return CachedResponse{}, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.resp, true, nil
+}
+
+func (c *lruResponseCache) Set(_ context.Context, key string, resp CachedResponse, ttl time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := &lruEntry{
+		key:      key,
+		resp:     resp,
+		deadline: time.Now().Add(ttl),
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+type redisResponseCache struct {
+	client redisx.Syncx
+}
+
+// NewRedisResponseCache returns a ResponseCache backed by redis via redisx, to
+// share the cached responses across the instances of a service.
+func NewRedisResponseCache(client redisx.Syncx) ResponseCache {
+	return redisResponseCache{client: client}
+}
+
+// The value stored in redis is the expiration in unix nanoseconds as a 8-byte
+// big endian integer, followed by the payload.
+const redisResponseHeaderSize = 8
+
+var errInvalidRedisResponse = errors.New("thriftbp: invalid cached response in redis")
+
+func (c redisResponseCache) Get(ctx context.Context, key string) (CachedResponse, bool, error) {
+	var value []byte
+	if err := c.client.Do(ctx, &value, "GET", key); err != nil {
+		return CachedResponse{}, false, err
+	}
+	if value == nil {
+		return CachedResponse{}, false, nil
+	}
+	if len(value) < redisResponseHeaderSize {
+		return CachedResponse{}, false, fmt.Errorf("%w: %q", errInvalidRedisResponse, key)
+	}
+	return CachedResponse{
+		Expiration: time.Unix(0, int64(binary.BigEndian.Uint64(value))),
+		Payload:    value[redisResponseHeaderSize:],
+	}, true, nil
+}
+
+func (c redisResponseCache) Set(ctx context.Context, key string, resp CachedResponse, ttl time.Duration) error {
+	value := make([]byte, redisResponseHeaderSize, redisResponseHeaderSize+len(resp.Payload))
+	binary.BigEndian.PutUint64(value, uint64(resp.Expiration.UnixNano()))
+	value = append(value, resp.Payload...)
+	return c.client.Do(ctx, nil, "SET", key, value, "PX", max(ttl.Milliseconds(), 1))
+}
+
+var (
+	_ ResponseCache = (*lruResponseCache)(nil)
+	_ ResponseCache = redisResponseCache{}
+)
@@ -0,0 +1,344 @@
+package thriftbp
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/google/go-cmp/cmp"
+	"github.com/joomcode/redispipe/redis"
+	"github.com/joomcode/redispipe/redisconn"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/reddit/baseplate.go/ecinterface"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+	"github.com/reddit/baseplate.go/redis/cache/redisx"
+	"github.com/reddit/baseplate.go/transport"
+)
+
+type countingIsHealthyService struct {
+	calls atomic.Int64
+	err   error
+}
+
+func (s *countingIsHealthyService) IsHealthy(ctx context.Context, _ *baseplatethrift.IsHealthyRequest) (bool, error) {
+	s.calls.Add(1)
+	return true, s.err
+}
+
+func newCachedClient(t *testing.T, handler *countingIsHealthyService, args CacheResponsesArgs) baseplatethrift.BaseplateServiceV2 {
+	t.Helper()
+
+	addr, _ := startManagedServer(t, ServerConfig{}, handler)
+	args.ServiceSlug = t.Name()
+	pool := newTestClientPool(t, ClientPoolConfig{
+		ServiceSlug:    t.Name(),
+		Addr:           addr,
+		MaxConnections: 2,
+	}, CacheResponses(args))
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	return baseplatethrift.NewBaseplateServiceV2Client(pool.TClient())
+}
+
+func cacheRequestsTest(t *testing.T, result string) *promtest.PrometheusMetricTest {
+	return promtest.NewPrometheusMetricTest(t, result, clientCacheRequestsCounter, prometheus.Labels{
+		methodLabel:      "is_healthy",
+		clientNameLabel:  t.Name(),
+		cacheResultLabel: result,
+	})
+}
+
+func callIsHealthy(t *testing.T, client baseplatethrift.BaseplateServiceV2) error {
+	t.Helper()
+
+	_, err := client.IsHealthy(context.Background(), &baseplatethrift.IsHealthyRequest{
+		Probe: baseplatethrift.IsHealthyProbePtr(baseplatethrift.IsHealthyProbe_READINESS),
+	})
+	return err
+}
+
+func TestCacheResponses(t *testing.T) {
+	defer cacheRequestsTest(t, cacheResultHit).CheckDelta(1)
+	defer cacheRequestsTest(t, cacheResultMiss).CheckDelta(2)
+
+	handler := &countingIsHealthyService{}
+	client := newCachedClient(t, handler, CacheResponsesArgs{
+		Cache: NewLRUResponseCache(10),
+		Methods: map[string]time.Duration{
+			"is_healthy": 50 * time.Millisecond,
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := callIsHealthy(t, client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := handler.calls.Load(); got != 1 {
+		t.Errorf("Expected the second call to be served from cache, got %d upstream calls", got)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if err := callIsHealthy(t, client); err != nil {
+		t.Fatal(err)
+	}
+	if got := handler.calls.Load(); got != 2 {
+		t.Errorf("Expected the call after TTL to be a cache miss, got %d upstream calls", got)
+	}
+}
+
+func TestCacheResponsesStaleWhileRevalidate(t *testing.T) {
+	defer cacheRequestsTest(t, cacheResultHit).CheckDelta(1)
+	defer cacheRequestsTest(t, cacheResultStale).CheckDelta(1)
+	defer cacheRequestsTest(t, cacheResultMiss).CheckDelta(1)
+
+	handler := &countingIsHealthyService{}
+	client := newCachedClient(t, handler, CacheResponsesArgs{
+		Cache: NewLRUResponseCache(10),
+		Methods: map[string]time.Duration{
+			"is_healthy": 50 * time.Millisecond,
+		},
+		StaleWhileRevalidate: time.Second,
+	})
+
+	if err := callIsHealthy(t, client); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(80 * time.Millisecond)
+	if err := callIsHealthy(t, client); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "background refresh", func() bool {
+		return handler.calls.Load() == 2
+	})
+	// Wait for the refreshed response to be cached.
+	time.Sleep(10 * time.Millisecond)
+	if err := callIsHealthy(t, client); err != nil {
+		t.Fatal(err)
+	}
+	if got := handler.calls.Load(); got != 2 {
+		t.Errorf("Expected the call after refresh to be a cache hit, got %d upstream calls", got)
+	}
+}
+
+func TestCacheResponsesErrorsNotCached(t *testing.T) {
+	defer cacheRequestsTest(t, cacheResultMiss).CheckDelta(2)
+
+	handler := &countingIsHealthyService{err: errors.New("unhealthy")}
+	client := newCachedClient(t, handler, CacheResponsesArgs{
+		Cache: NewLRUResponseCache(10),
+		Methods: map[string]time.Duration{
+			"is_healthy": time.Minute,
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := callIsHealthy(t, client); err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+	}
+	if got := handler.calls.Load(); got != 2 {
+		t.Errorf("Expected errors not to be cached, got %d upstream calls", got)
+	}
+}
+
+func TestCacheResponsesUncachedMethods(t *testing.T) {
+	handler := &countingIsHealthyService{}
+	client := newCachedClient(t, handler, CacheResponsesArgs{
+		Cache: NewLRUResponseCache(10),
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := callIsHealthy(t, client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := handler.calls.Load(); got != 2 {
+		t.Errorf("Expected methods not configured to never be cached, got %d upstream calls", got)
+	}
+}
+
+func TestCacheResponsesRefreshCopiesArgs(t *testing.T) {
+	ecImpl := ecinterface.Mock()
+	ctx, err := ecImpl.HeaderToContext(context.Background(), "edge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = opentracing.ContextWithSpan(ctx, opentracing.NoopTracer{}.StartSpan("caller"))
+
+	refreshed := make(chan baseplatethrift.IsHealthyProbe, 1)
+	var calls atomic.Int64
+	next := thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, a, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			result.(*baseplatethrift.BaseplateServiceV2IsHealthyResult).Success = thrift.BoolPtr(true)
+			if calls.Add(1) > 1 {
+				if span := opentracing.SpanFromContext(ctx); span != nil {
+					t.Errorf("Expected the refresh not to use the span of the caller, got %v", span)
+				}
+				refreshed <- a.(*baseplatethrift.BaseplateServiceV2IsHealthyArgs).GetRequest().GetProbe()
+			}
+			return thrift.ResponseMeta{}, nil
+		},
+	}
+	client := CacheResponses(CacheResponsesArgs{
+		ServiceSlug: t.Name(),
+		Cache:       NewLRUResponseCache(10),
+		Methods: map[string]time.Duration{
+			"is_healthy": time.Nanosecond,
+		},
+		StaleWhileRevalidate: time.Minute,
+		KeyHeaders:           []string{transport.HeaderEdgeRequest},
+		EdgeContextImpl:      ecImpl,
+	})(next)
+
+	args := &baseplatethrift.BaseplateServiceV2IsHealthyArgs{
+		Request: &baseplatethrift.IsHealthyRequest{
+			Probe: baseplatethrift.IsHealthyProbePtr(baseplatethrift.IsHealthyProbe_READINESS),
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call(ctx, "is_healthy", args, &baseplatethrift.BaseplateServiceV2IsHealthyResult{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The caller reusing the args after the stale response is returned.
+	args.Request.Probe = baseplatethrift.IsHealthyProbePtr(baseplatethrift.IsHealthyProbe_LIVENESS)
+
+	select {
+	case probe := <-refreshed:
+		if probe != baseplatethrift.IsHealthyProbe_READINESS {
+			t.Errorf("Expected the refresh to be called with the original args, got %v", probe)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the refresh")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	ctx := context.Background()
+	key := func(probe baseplatethrift.IsHealthyProbe, keyHeaders ...string) string {
+		t.Helper()
+		k, err := cacheKey(ctx, "slug", "is_healthy", &baseplatethrift.BaseplateServiceV2IsHealthyArgs{
+			Request: &baseplatethrift.IsHealthyRequest{
+				Probe: baseplatethrift.IsHealthyProbePtr(probe),
+			},
+		}, keyHeaders)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	if key(baseplatethrift.IsHealthyProbe_READINESS) != key(baseplatethrift.IsHealthyProbe_READINESS) {
+		t.Error("Expected the same args to have the same key")
+	}
+	if key(baseplatethrift.IsHealthyProbe_READINESS) == key(baseplatethrift.IsHealthyProbe_LIVENESS) {
+		t.Error("Expected different args to have different keys")
+	}
+	if key(baseplatethrift.IsHealthyProbe_READINESS, "User: a") == key(baseplatethrift.IsHealthyProbe_READINESS, "User: b") {
+		t.Error("Expected different key headers to have different keys")
+	}
+}
+
+func TestKeyHeadersFunc(t *testing.T) {
+	ecImpl := ecinterface.Mock()
+	ctx, err := ecImpl.HeaderToContext(context.Background(), "edge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = thrift.SetHeader(ctx, "user", "foo")
+
+	got := keyHeadersFunc([]string{"User", "Other", transport.HeaderEdgeRequest}, ecImpl)(ctx)
+	want := []string{"User: foo", "Other: ", transport.HeaderEdgeRequest + ": edge"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("keyHeaders (-got +want):\n%s", diff)
+	}
+	if got := keyHeadersFunc(nil, ecImpl)(ctx); got != nil {
+		t.Errorf("Expected nil without key headers, got %q", got)
+	}
+}
+
+func TestLRUResponseCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUResponseCache(2)
+	set := func(key string, ttl time.Duration) {
+		t.Helper()
+		if err := cache.Set(ctx, key, CachedResponse{Payload: []byte(key)}, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	has := func(key string) bool {
+		t.Helper()
+		resp, ok, err := cache.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok && string(resp.Payload) != key {
+			t.Errorf("Get(%q) got payload %q", key, resp.Payload)
+		}
+		return ok
+	}
+
+	set("a", time.Minute)
+	set("b", time.Minute)
+	// Make "a" the most recently used, so "b" is evicted.
+	has("a")
+	set("c", time.Minute)
+	if !has("a") || has("b") || !has("c") {
+		t.Errorf("Expected b to be evicted, got a=%v, b=%v, c=%v", has("a"), has("b"), has("c"))
+	}
+
+	set("d", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if has("d") {
+		t.Error("Expected d to be expired")
+	}
+}
+
+func TestRedisResponseCache(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	sender, err := redisconn.Connect(ctx, s.Addr(), redisconn.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sender.Close)
+	cache := NewRedisResponseCache(redisx.Syncx{Sync: redisx.BaseSync{
+		SyncCtx: redis.SyncCtx{S: sender},
+	}})
+
+	if _, ok, err := cache.Get(ctx, "key"); ok || err != nil {
+		t.Errorf("Get on missing key got ok=%v, err=%v", ok, err)
+	}
+
+	want := CachedResponse{
+		Payload:    []byte("payload"),
+		Expiration: time.Unix(0, time.Now().UnixNano()),
+	}
+	if err := cache.Set(ctx, "key", want, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := cache.Get(ctx, "key")
+	if err != nil || !ok {
+		t.Fatalf("Get got ok=%v, err=%v", ok, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Cached response mismatch (-want +got):\n%s", diff)
+	}
+
+	s.FastForward(2 * time.Minute)
+	if _, ok, err := cache.Get(ctx, "key"); ok || err != nil {
+		t.Errorf("Get on expired key got ok=%v, err=%v", ok, err)
+	}
+}
@@ -0,0 +1,132 @@
+package thriftbp
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/internal/singleflight"
+	"github.com/reddit/baseplate.go/log"
+)
+
+// CoalesceRequestsArgs are the args to be passed into CoalesceRequests
+// function.
+type CoalesceRequestsArgs struct {
+	// ServiceSlug is the slug of the thrift service the client is calling.
+	//
+	// It's used as the thrift_client_name label of the metrics.
+	//
+	// Required.
+	ServiceSlug string
+
+	// Methods are the thrift methods to coalesce.
+	//
+	// Only idempotent reads should be listed here.
+	// Calls to the methods not listed are always passed through.
+	Methods []string
+
+	// KeyHeaders are the THeaders that change the responses, the calls are
+	// only coalesced when they have the same values of them.
+	//
+	// transport.HeaderEdgeRequest is read from the edge request context in the
+	// context (via EdgeContextImpl), as it's only set as a THeader by the inner
+	// ForwardEdgeRequestContext middleware.
+	//
+	// Optional. See CoalesceRequests for the hazard of leaving it empty.
+	KeyHeaders []string
+
+	// EdgeContextImpl is used to serialize the edge request context when
+	// KeyHeaders contains transport.HeaderEdgeRequest.
+	//
+	// Optional. If it's nil, the global one from ecinterface.Get will be used.
+	EdgeContextImpl ecinterface.Interface
+}
+
+// coalescedResult is the result of a call shared by the coalesced callers.
+type coalescedResult struct {
+	payload []byte
+	meta    thrift.ResponseMeta
+}
+
+// CoalesceRequests returns a ClientMiddleware that collapses concurrent calls
+// to the same method with the same args into a single call to the server
+// (also known as singleflight), and fans out its result to all the callers.
+//
+// This is useful to protect the upstream service from a burst of identical
+// reads, for example on a cache miss storm.
+//
+// The calls are identical when they have the same args and the same values of
+// KeyHeaders. The other headers (including the edge request context) are not
+// compared, so any header that changes the response MUST be listed in
+// KeyHeaders, otherwise the callers could receive the responses meant for
+// other callers.
+//
+// The shared call is made with the context values (including the headers) of
+// the first caller, but without its deadline, and it's only canceled when all
+// the callers waiting on it are gone.
+// Every caller only waits on the shared call until its own context is done, so
+// the callers with later deadlines still get the result after the first caller
+// gave up.
+//
+// The callers joining an in-flight call are counted in
+// thriftbp_client_coalesced_requests_total counter.
+//
+// It should be the first (outermost) middleware passed into
+// NewBaseplateClientPool, so a coalesced call only goes through the other
+// middlewares once.
+func CoalesceRequests(args CoalesceRequestsArgs) thrift.ClientMiddleware {
+	methods := make(map[string]bool, len(args.Methods))
+	for _, m := range args.Methods {
+		methods[m] = true
+	}
+	keyHeaders := keyHeadersFunc(args.KeyHeaders, args.EdgeContextImpl)
+	var group singleflight.Group[coalescedResult]
+
+	return func(next thrift.TClient) thrift.TClient {
+		return thrift.WrappedTClient{
+			Wrapped: func(ctx context.Context, method string, a, result thrift.TStruct) (thrift.ResponseMeta, error) {
+				if !methods[method] || result == nil {
+					return next.Call(ctx, method, a, result)
+				}
+
+				key, err := cacheKey(ctx, args.ServiceSlug, method, a, keyHeaders(ctx))
+				if err != nil {
+					log.C(ctx).Errorw("thriftbp.CoalesceRequests: failed to serialize args", "method", method, "err", err)
+					return next.Call(ctx, method, a, result)
+				}
+
+				r, shared, err := group.Do(ctx, key, func(ctx context.Context) (coalescedResult, error) {
+					// Use a copy of the args and a new result TStruct, as the caller
+					// might have already returned when the call finishes.
+					a, err := copyTStruct(ctx, a)
+					if err != nil {
+						return coalescedResult{}, err
+					}
+					result := reflect.New(reflect.TypeOf(result).Elem()).Interface().(thrift.TStruct)
+					meta, err := next.Call(ctx, method, a, result)
+					if err != nil {
+						return coalescedResult{meta: meta}, err
+					}
+					payload, err := serializeTStruct(ctx, result)
+					if err != nil {
+						return coalescedResult{meta: meta}, err
+					}
+					return coalescedResult{payload: payload, meta: meta}, nil
+				})
+				if shared {
+					clientCoalescedRequestsCounter.With(prometheus.Labels{
+						methodLabel:     method,
+						clientNameLabel: args.ServiceSlug,
+					}).Inc()
+				}
+				if err != nil {
+					return r.meta, err
+				}
+				return r.meta, deserializeTStruct(ctx, r.payload, result)
+			},
+		}
+	}
+}
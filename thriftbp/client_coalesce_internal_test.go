@@ -0,0 +1,172 @@
+package thriftbp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+)
+
+type slowIsHealthyService struct {
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (s *slowIsHealthyService) IsHealthy(ctx context.Context, req *baseplatethrift.IsHealthyRequest) (bool, error) {
+	s.calls.Add(1)
+	<-s.release
+	return req.GetProbe() == baseplatethrift.IsHealthyProbe_READINESS, nil
+}
+
+func newCoalescedPool(t *testing.T, handler *slowIsHealthyService, args CoalesceRequestsArgs) ClientPool {
+	t.Helper()
+
+	addr, _ := startManagedServer(t, ServerConfig{}, handler)
+	args.ServiceSlug = t.Name()
+	pool := newTestClientPool(t, ClientPoolConfig{
+		ServiceSlug:    t.Name(),
+		Addr:           addr,
+		MaxConnections: 10,
+	}, CoalesceRequests(args))
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	return pool
+}
+
+// newIsHealthyClient returns a new client of the pool, as the generated clients are not
+// safe to be used concurrently.
+func newIsHealthyClient(pool ClientPool) baseplatethrift.BaseplateServiceV2 {
+	return baseplatethrift.NewBaseplateServiceV2Client(pool.TClient())
+}
+
+func TestCoalesceRequests(t *testing.T) {
+	const n = 5
+	defer promtest.NewPrometheusMetricTest(t, "coalesced", clientCoalescedRequestsCounter, prometheus.Labels{
+		methodLabel:     "is_healthy",
+		clientNameLabel: t.Name(),
+	}).CheckDelta(2 * (n - 1))
+
+	handler := &slowIsHealthyService{release: make(chan struct{})}
+	pool := newCoalescedPool(t, handler, CoalesceRequestsArgs{
+		Methods: []string{"is_healthy"},
+	})
+
+	var wg sync.WaitGroup
+	for _, probe := range []baseplatethrift.IsHealthyProbe{
+		baseplatethrift.IsHealthyProbe_READINESS,
+		baseplatethrift.IsHealthyProbe_LIVENESS,
+	} {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := newIsHealthyClient(pool).IsHealthy(context.Background(), &baseplatethrift.IsHealthyRequest{
+					Probe: baseplatethrift.IsHealthyProbePtr(probe),
+				})
+				if err != nil {
+					t.Error(err)
+				}
+				if want := probe == baseplatethrift.IsHealthyProbe_READINESS; got != want {
+					t.Errorf("IsHealthy(%v) got %v, want %v", probe, got, want)
+				}
+			}()
+		}
+	}
+	waitFor(t, "upstream calls", func() bool {
+		return handler.calls.Load() == 2
+	})
+	// Give the other callers time to join the in-flight calls.
+	time.Sleep(50 * time.Millisecond)
+	close(handler.release)
+	wg.Wait()
+
+	if got := handler.calls.Load(); got != 2 {
+		t.Errorf("Expected one upstream call per distinct args, got %d", got)
+	}
+}
+
+func TestCoalesceRequestsUncoalescedMethods(t *testing.T) {
+	const n = 3
+	handler := &slowIsHealthyService{release: make(chan struct{})}
+	pool := newCoalescedPool(t, handler, CoalesceRequestsArgs{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := callIsHealthy(t, newIsHealthyClient(pool)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitFor(t, "upstream calls", func() bool {
+		return handler.calls.Load() == n
+	})
+	close(handler.release)
+	wg.Wait()
+}
+
+func TestCoalesceRequestsKeyHeaders(t *testing.T) {
+	handler := &slowIsHealthyService{release: make(chan struct{})}
+	pool := newCoalescedPool(t, handler, CoalesceRequestsArgs{
+		Methods:    []string{"is_healthy"},
+		KeyHeaders: []string{"User"},
+	})
+
+	var wg sync.WaitGroup
+	for _, user := range []string{"foo", "bar"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := AddClientHeader(context.Background(), "User", user)
+			if _, err := newIsHealthyClient(pool).IsHealthy(ctx, &baseplatethrift.IsHealthyRequest{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitFor(t, "upstream calls", func() bool {
+		return handler.calls.Load() == 2
+	})
+	close(handler.release)
+	wg.Wait()
+}
+
+func TestCoalesceRequestsCallerDeadline(t *testing.T) {
+	handler := &slowIsHealthyService{release: make(chan struct{})}
+	pool := newCoalescedPool(t, handler, CoalesceRequestsArgs{
+		Methods: []string{"is_healthy"},
+	})
+
+	first := make(chan error, 1)
+	go func() {
+		first <- callIsHealthy(t, newIsHealthyClient(pool))
+	}()
+	waitFor(t, "upstream call", func() bool {
+		return handler.calls.Load() == 1
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := newIsHealthyClient(pool).IsHealthy(ctx, &baseplatethrift.IsHealthyRequest{
+		Probe: baseplatethrift.IsHealthyProbePtr(baseplatethrift.IsHealthyProbe_READINESS),
+	})
+	if err == nil {
+		t.Error("Expected the caller with a short deadline to fail, got nil")
+	}
+
+	close(handler.release)
+	if err := <-first; err != nil {
+		t.Errorf("Expected the first caller to succeed, got %v", err)
+	}
+	if got := handler.calls.Load(); got != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", got)
+	}
+}
@@ -49,6 +49,10 @@ var (
 	_ error = (*PoolError)(nil)
 )
 
+// poolLogSampler samples the logs of client pool errors,
+// which happen on every request when the pool is exhausted.
+var poolLogSampler = log.NewSampler("thriftbp_client_pool", log.DefaultSampling)
+
 // ClientPoolConfig is the configuration struct for creating a new ClientPool.
 type ClientPoolConfig struct {
 	// ServiceSlug is a short identifier for the thrift service you are creating
@@ -234,6 +238,54 @@ type ClientPoolConfig struct {
 	//
 	// Optional. Default is false.
 	UseZlib bool `yaml:"useZlib"`
+
+	// The multiplexed service name of the thrift service on the server, for
+	// servers serving more than one thrift services via
+	// thrift.TMultiplexedProcessor (see ServerConfig.MultiplexedProcessors).
+	//
+	// Optional. If empty, the requests are sent without multiplexed service name
+	// and are handled by the default processor of the server.
+	MultiplexedServiceName string `yaml:"multiplexedServiceName"`
+
+	// HealthProbeInterval enables active health probing of the idle connections
+	// in the pool when it's positive.
+	//
+	// Every connection not used for longer than HealthProbeInterval is probed
+	// with HealthProbe in the background, and replaced with a new connection if
+	// the probe fails, so that the broken connections are not handed to the
+	// calls. We emit thriftbp_client_pool_health_probes_total and
+	// thriftbp_client_pool_replaced_connections_total counters with
+	// thrift_success tag to provide observability into the probes.
+	//
+	// A connection being probed is not handed to the calls, the pool opens a
+	// new connection instead of waiting for the probe.
+	//
+	// Similar to MaxConnectionAge, there will be one additional timer per
+	// connection in the pool to do the probing.
+	//
+	// HealthProbeTimeout is the timeout of a single probe, default to 1 second
+	// (see DefaultHealthProbeTimeout).
+	//
+	// HealthProbe is the function to probe the connections, default to
+	// IsHealthyProbe. Services not implementing BaseplateServiceV2 can use a
+	// different endpoint to ping the server instead.
+	HealthProbeInterval time.Duration `yaml:"healthProbeInterval"`
+	HealthProbeTimeout  time.Duration `yaml:"healthProbeTimeout"`
+	HealthProbe         HealthProbe   `yaml:"-"`
+
+	// MinIdleConnections enables the warm-up mode of the pool when it's
+	// positive.
+	//
+	// In warm-up mode, the pool opens new connections in the background every
+	// WarmUpInterval, to keep at least MinIdleConnections idle connections ready
+	// to be used (without exceeding MaxConnections in total), so that the calls
+	// don't need to pay the cost of opening new connections during traffic
+	// spikes. We emit thriftbp_client_pool_warm_up_connections_total counter
+	// with thrift_success tag to provide observability into the warm-up.
+	//
+	// WarmUpInterval is default to 1 second (see DefaultWarmUpInterval).
+	MinIdleConnections int           `yaml:"minIdleConnections"`
+	WarmUpInterval     time.Duration `yaml:"warmUpInterval"`
 }
 
 // Validate checks ClientPoolConfig for any missing or erroneous values.
@@ -244,6 +296,9 @@ func (c ClientPoolConfig) Validate() error {
 	if c.InitialConnections > c.MaxConnections {
 		return ErrConfigInvalidConnections
 	}
+	if c.MinIdleConnections > c.MaxConnections {
+		return ErrConfigInvalidMinIdleConnections
+	}
 	return nil
 }
 
@@ -286,6 +341,9 @@ func (c BaseplateClientPoolConfig) Validate() error {
 	if c.InitialConnections > c.MaxConnections {
 		errs = append(errs, ErrConfigInvalidConnections)
 	}
+	if c.MinIdleConnections > c.MaxConnections {
+		errs = append(errs, ErrConfigInvalidMinIdleConnections)
+	}
 	return errors.Join(errs...)
 }
 
@@ -491,6 +549,17 @@ func newClientPool(
 	if cfg.MaxConnectionAgeJitter != nil {
 		jitter = *cfg.MaxConnectionAgeJitter
 	}
+	probe := ttlClientProbe{
+		probe:    cfg.HealthProbe,
+		interval: cfg.HealthProbeInterval,
+		timeout:  cfg.HealthProbeTimeout,
+	}
+	if probe.probe == nil {
+		probe.probe = IsHealthyProbe
+	}
+	if probe.timeout <= 0 {
+		probe.timeout = DefaultHealthProbeTimeout
+	}
 	opener := func() (clientpool.Client, error) {
 		// opener is only called in 2 scenarios:
 		//
@@ -508,8 +577,10 @@ func newClientPool(
 		return newClient(
 			tConfig,
 			cfg.ServiceSlug,
+			cfg.MultiplexedServiceName,
 			cfg.MaxConnectionAge,
 			jitter,
+			probe,
 			genAddr,
 			proto,
 		)
@@ -568,18 +639,31 @@ func newClientPool(
 	clientPoolClosedConnectionsCounter.With(labels)
 	clientPoolReleaseErrorCounter.With(labels)
 
+	if filler, ok := pool.(clientpool.Filler); ok && cfg.MinIdleConnections > 0 {
+		interval := cfg.WarmUpInterval
+		if interval <= 0 {
+			interval = DefaultWarmUpInterval
+		}
+		var ctx context.Context
+		ctx, pooledClient.stopWarmUp = context.WithCancel(context.Background())
+		pooledClient.warmUpDone = make(chan struct{})
+		go pooledClient.warmUp(ctx, filler, cfg.MinIdleConnections, interval)
+	}
+
 	return pooledClient, nil
 }
 
 func newClient(
 	cfg *thrift.TConfiguration,
 	slug string,
+	multiplexedService string,
 	maxConnectionAge time.Duration,
 	maxConnectionAgeJitter float64,
+	probe ttlClientProbe,
 	genAddr AddressGenerator,
 	protoFactory thrift.TProtocolFactory,
 ) (*ttlClient, error) {
-	return newTTLClient(func() (thrift.TClient, *countingDelegateTransport, error) {
+	client, err := newTTLClient(func() (thrift.TClient, *countingDelegateTransport, error) {
 		addr, err := genAddr()
 		if err != nil {
 			return nil, nil, fmt.Errorf("thriftbp: error getting next address for new Thrift client: %w", err)
@@ -601,11 +685,20 @@ func newClient(
 			return nil, nil, fmt.Errorf("thriftbp: error opening TSocket to %q for new Thrift client: %w", addr, err)
 		}
 
-		return thrift.NewTStandardClient(
-			protoFactory.GetProtocol(transport),
-			protoFactory.GetProtocol(transport),
-		), transport, nil
+		iprot := protoFactory.GetProtocol(transport)
+		oprot := protoFactory.GetProtocol(transport)
+		if multiplexedService != "" {
+			return newMultiplexedClient(multiplexedService, iprot, oprot), transport, nil
+		}
+		return thrift.NewTStandardClient(iprot, oprot), transport, nil
 	}, maxConnectionAge, maxConnectionAgeJitter, slug)
+	if err != nil {
+		return nil, err
+	}
+	if probe.interval > 0 {
+		client.startProbing(probe)
+	}
+	return client, nil
 }
 
 type clientPool struct {
@@ -614,6 +707,20 @@ type clientPool struct {
 	slug string
 
 	wrappedClient thrift.TClient
+
+	// only set when the warm-up mode is enabled.
+	stopWarmUp context.CancelFunc
+	warmUpDone chan struct{}
+}
+
+// Close stops the background warm-up (if enabled), then closes the underlying
+// pool.
+func (p *clientPool) Close() error {
+	if p.stopWarmUp != nil {
+		p.stopWarmUp()
+		<-p.warmUpDone
+	}
+	return p.Pool.Close()
 }
 
 func (p *clientPool) TClient() thrift.TClient {
@@ -682,11 +789,13 @@ func (p *clientPool) getClient() (_ Client, err error) {
 				"thrift_pool": p.slug,
 			}).Inc()
 		}
-		log.Errorw(
-			"Failed to get client from pool",
-			"pool", p.slug,
-			"err", err,
-		)
+		if poolLogSampler.Allow("get:" + p.slug) {
+			log.Errorw(
+				"Failed to get client from pool",
+				"pool", p.slug,
+				"err", err,
+			)
+		}
 		return nil, err
 	}
 	return c.(Client), nil
@@ -694,11 +803,13 @@ func (p *clientPool) getClient() (_ Client, err error) {
 
 func (p *clientPool) releaseClient(c Client) {
 	if err := p.Pool.Release(c); err != nil {
-		log.Errorw(
-			"Failed to release client back to pool",
-			"pool", p.slug,
-			"err", err,
-		)
+		if poolLogSampler.Allow("release:" + p.slug) {
+			log.Errorw(
+				"Failed to release client back to pool",
+				"pool", p.slug,
+				"err", err,
+			)
+		}
 		clientPoolReleaseErrorCounter.With(prometheus.Labels{
 			"thrift_pool": p.slug,
 		}).Inc()
@@ -0,0 +1,97 @@
+package thriftbp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/reddit/baseplate.go/clientpool"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/log"
+)
+
+// DefaultHealthProbeTimeout is the default timeout of a single health probe
+// when ClientPoolConfig.HealthProbeInterval is set.
+const DefaultHealthProbeTimeout = time.Second
+
+// DefaultWarmUpInterval is the default interval to open connections in the
+// background when ClientPoolConfig.MinIdleConnections is set.
+const DefaultWarmUpInterval = time.Second
+
+// HealthProbe defines the function used to probe the health of an idle
+// connection in a ClientPool.
+//
+// The client passed in is the raw client of the connection, without any of
+// the middlewares of the ClientPool.
+// A non-nil error means the connection is broken and should be replaced.
+type HealthProbe func(ctx context.Context, client thrift.TClient) error
+
+// ErrUnhealthy is the error returned by IsHealthyProbe when the server
+// reports that it's not healthy.
+var ErrUnhealthy = errors.New("thriftbp: server is not healthy")
+
+// IsHealthyProbe is the default HealthProbe.
+//
+// It calls the is_healthy endpoint defined in BaseplateServiceV2 with the
+// LIVENESS probe.
+//
+// thrift.TApplicationException errors (e.g. the server does not implement the
+// is_healthy endpoint) are not treated as failures, as they still mean the
+// connection is working.
+func IsHealthyProbe(ctx context.Context, client thrift.TClient) error {
+	healthy, err := baseplatethrift.NewBaseplateServiceV2Client(client).IsHealthy(
+		ctx,
+		&baseplatethrift.IsHealthyRequest{
+			Probe: baseplatethrift.IsHealthyProbePtr(baseplatethrift.IsHealthyProbe_LIVENESS),
+		},
+	)
+	if err != nil {
+		var ae thrift.TApplicationException
+		if errors.As(err, &ae) {
+			return nil
+		}
+		return err
+	}
+	if !healthy {
+		return ErrUnhealthy
+	}
+	return nil
+}
+
+// warmUp keeps at least minIdle idle connections in the pool by opening new
+// connections every interval, until ctx is canceled.
+func (p *clientPool) warmUp(ctx context.Context, filler clientpool.Filler, minIdle int, interval time.Duration) {
+	defer close(p.warmUpDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		opened, err := filler.Fill(minIdle)
+		clientPoolWarmUpConnectionsCounter.With(prometheus.Labels{
+			"thrift_pool":    p.slug,
+			"thrift_success": "true",
+		}).Add(float64(opened))
+		if err != nil {
+			clientPoolWarmUpConnectionsCounter.With(prometheus.Labels{
+				"thrift_pool":    p.slug,
+				"thrift_success": "false",
+			}).Inc()
+			if poolLogSampler.Allow("warmup:" + p.slug) {
+				log.Warnw(
+					"Failed to open idle connections for pool",
+					"pool", p.slug,
+					"err", err,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package thriftbp
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/reddit/baseplate.go/ecinterface"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/prometheusbp"
+	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+)
+
+type isHealthyService bool
+
+func (s isHealthyService) IsHealthy(ctx context.Context, _ *baseplatethrift.IsHealthyRequest) (bool, error) {
+	return bool(s), nil
+}
+
+func newTestClientPool(t *testing.T, cfg ClientPoolConfig, middlewares ...thrift.ClientMiddleware) ClientPool {
+	t.Helper()
+
+	cfg.ConnectTimeout = time.Second
+	cfg.SocketTimeout = time.Second
+	cfg.EdgeContextImpl = ecinterface.Mock()
+	pool, err := NewBaseplateClientPool(cfg, middlewares...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func healthCounterTest(t *testing.T, counter *prometheus.CounterVec, slug string, success bool) *promtest.PrometheusMetricTest {
+	return promtest.NewPrometheusMetricTest(t, slug, counter, prometheus.Labels{
+		"thrift_pool":    slug,
+		"thrift_success": prometheusbp.BoolString(success),
+	})
+}
+
+func TestIsHealthyProbe(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		healthy bool
+		want    error
+	}{
+		{name: "healthy", healthy: true},
+		{name: "unhealthy", healthy: false, want: ErrUnhealthy},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			addr, _ := startManagedServer(t, ServerConfig{}, isHealthyService(c.healthy))
+			client := newRawClient(t, addr)
+			if err := IsHealthyProbe(context.Background(), client.Client_()); !errors.Is(err, c.want) {
+				t.Errorf("IsHealthyProbe got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestClientPoolHealthProbe(t *testing.T) {
+	const slug = "health-probe-test"
+	addr, _ := startManagedServer(t, ServerConfig{}, nil)
+
+	var probes atomic.Int64
+	done := make(chan struct{})
+	defer close(done)
+	pool := newTestClientPool(t, ClientPoolConfig{
+		ServiceSlug:         slug,
+		Addr:                addr,
+		InitialConnections:  1,
+		MaxConnections:      1,
+		HealthProbeInterval: 10 * time.Millisecond,
+		HealthProbe: func(ctx context.Context, client thrift.TClient) error {
+			switch probes.Add(1) {
+			case 1:
+				return errors.New("broken")
+			case 2, 3:
+				return IsHealthyProbe(ctx, client)
+			default:
+				// Block the later probes until the pool is closed, so they are
+				// not reported.
+				select {
+				case <-done:
+				case <-ctx.Done():
+				}
+				return ctx.Err()
+			}
+		},
+	})
+	failedProbes := healthCounterTest(t, clientPoolHealthProbesCounter, slug, false)
+	succeededProbes := healthCounterTest(t, clientPoolHealthProbesCounter, slug, true)
+	replaced := healthCounterTest(t, clientPoolReplacedConnectionsCounter, slug, true)
+
+	waitFor(t, "probes", func() bool {
+		return probes.Load() >= 4
+	})
+
+	client := baseplatethrift.NewBaseplateServiceV2Client(pool.TClient())
+	if _, err := client.IsHealthy(context.Background(), &baseplatethrift.IsHealthyRequest{}); err != nil {
+		t.Errorf("Expected the replaced connection to work, got %v", err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	failedProbes.CheckDelta(1)
+	succeededProbes.CheckDelta(2)
+	replaced.CheckDelta(1)
+}
+
+func TestClientPoolHealthProbeSkipsBusyConnections(t *testing.T) {
+	const slug = "health-probe-busy-test"
+	addr, _ := startManagedServer(t, ServerConfig{}, nil)
+
+	var probes atomic.Int64
+	pool := newTestClientPool(t, ClientPoolConfig{
+		ServiceSlug:         slug,
+		Addr:                addr,
+		InitialConnections:  1,
+		MaxConnections:      1,
+		HealthProbeInterval: 50 * time.Millisecond,
+		HealthProbe: func(ctx context.Context, client thrift.TClient) error {
+			probes.Add(1)
+			return nil
+		},
+	})
+	t.Cleanup(func() {
+		pool.Close()
+	})
+
+	// Keep the connection used more frequently than the probe interval.
+	client := baseplatethrift.NewBaseplateServiceV2Client(pool.TClient())
+	for start := time.Now(); time.Since(start) < 200*time.Millisecond; {
+		if _, err := client.IsHealthy(context.Background(), &baseplatethrift.IsHealthyRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := probes.Load(); n != 0 {
+		t.Errorf("Expected no probes on the recently used connection, got %d", n)
+	}
+}
+
+func TestClientPoolHealthProbeDoesNotBlockCallers(t *testing.T) {
+	const slug = "health-probe-blocking-test"
+	addr, _ := startManagedServer(t, ServerConfig{}, nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var probes atomic.Int64
+	pool := newTestClientPool(t, ClientPoolConfig{
+		ServiceSlug:         slug,
+		Addr:                addr,
+		InitialConnections:  1,
+		MaxConnections:      2,
+		HealthProbeInterval: 10 * time.Millisecond,
+		HealthProbeTimeout:  10 * time.Second,
+		HealthProbe: func(ctx context.Context, client thrift.TClient) error {
+			if probes.Add(1) == 1 {
+				close(started)
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+			}
+			return nil
+		},
+	})
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	defer close(release)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client := baseplatethrift.NewBaseplateServiceV2Client(pool.TClient())
+	if _, err := client.IsHealthy(ctx, &baseplatethrift.IsHealthyRequest{}); err != nil {
+		t.Errorf("Expected the call not to be blocked by the probe, got %v", err)
+	}
+}
+
+func TestClientPoolWarmUp(t *testing.T) {
+	const slug = "warm-up-test"
+	defer healthCounterTest(t, clientPoolWarmUpConnectionsCounter, slug, true).CheckDelta(2)
+
+	addr, _ := startManagedServer(t, ServerConfig{}, nil)
+	pool := newTestClientPool(t, ClientPoolConfig{
+		ServiceSlug:        slug,
+		Addr:               addr,
+		MaxConnections:     3,
+		MinIdleConnections: 2,
+		WarmUpInterval:     10 * time.Millisecond,
+	})
+
+	waitFor(t, "warm-up", func() bool {
+		return pool.(*clientPool).NumAllocated() == 2
+	})
+	// Wait for a few more warm-up intervals to make sure it doesn't over open.
+	time.Sleep(50 * time.Millisecond)
+	if n := pool.(*clientPool).NumAllocated(); n != 2 {
+		t.Errorf("Expected 2 idle connections, got %d", n)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientPoolConfigMinIdleConnections(t *testing.T) {
+	cfg := ClientPoolConfig{
+		MaxConnections:     1,
+		MinIdleConnections: 2,
+	}
+	if err := cfg.Validate(); !errors.Is(err, ErrConfigInvalidMinIdleConnections) {
+		t.Errorf("Expected %v, got %v", ErrConfigInvalidMinIdleConnections, err)
+	}
+	if err := BaseplateClientPoolConfig(cfg).Validate(); !errors.Is(err, ErrConfigInvalidMinIdleConnections) {
+		t.Errorf("Expected %v, got %v", ErrConfigInvalidMinIdleConnections, err)
+	}
+}
@@ -14,4 +14,8 @@
 // On the server side,
 // this package provides middleware implementations for EdgeRequestContext
 // handling and tracing propagation according to Baseplate spec.
+//
+// A single server can also serve more than one thrift services via
+// thrift.TMultiplexedProcessor, see ServerConfig.MultiplexedProcessors and
+// ClientPoolConfig.MultiplexedServiceName.
 package thriftbp
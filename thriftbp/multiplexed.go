@@ -0,0 +1,134 @@
+package thriftbp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// NewMultiplexedProcessor returns a thrift.TMultiplexedProcessor serving the
+// given processors, keyed by their multiplexed service names, and the optional
+// defaultProcessor serving the requests without multiplexed service names.
+//
+// Every processor is wrapped with the middlewares returned by the middlewares
+// function (which can be nil), called with the un-instrumented processor,
+// so each service can have its own set of middlewares (for example,
+// BaseplateDefaultProcessorMiddlewares with ServiceName set to
+// GetThriftServiceName(processor)).
+//
+// The middlewares of the multiplexed services are called with the endpoint
+// names in "${service}:${method}" format (the same as wrapping a
+// thrift.TMultiplexedProcessor directly with thrift.WrapProcessor), so each
+// service gets its own thrift_method label in the Prometheus metrics, and its
+// own service label in headerbp.
+//
+// The clients of the multiplexed services need to set the multiplexed service
+// name. Clients created by NewBaseplateClientPool can do so via
+// ClientPoolConfig.MultiplexedServiceName.
+//
+// You generally don't need to use this directly, set
+// ServerConfig.MultiplexedProcessors instead.
+func NewMultiplexedProcessor(
+	defaultProcessor thrift.TProcessor,
+	processors map[string]thrift.TProcessor,
+	middlewares func(processor thrift.TProcessor) []thrift.ProcessorMiddleware,
+) *thrift.TMultiplexedProcessor {
+	getMiddlewares := func(processor thrift.TProcessor) []thrift.ProcessorMiddleware {
+		if middlewares == nil {
+			return nil
+		}
+		return middlewares(processor)
+	}
+
+	mux := thrift.NewTMultiplexedProcessor()
+	if defaultProcessor != nil {
+		mux.RegisterDefault(thrift.WrapProcessor(defaultProcessor, getMiddlewares(defaultProcessor)...))
+	}
+	for service, processor := range processors {
+		wrappers := getMiddlewares(processor)
+		for method, processorFunc := range processor.ProcessorMap() {
+			name := service + thrift.MULTIPLEXED_SEPARATOR + method
+			wrapped := processorFunc
+			// Add middlewares in reverse so the first in the list is the outermost,
+			// same as thrift.WrapProcessor.
+			for i := len(wrappers) - 1; i >= 0; i-- {
+				wrapped = wrappers[i](name, wrapped)
+			}
+			processor.AddToProcessorMap(method, wrapped)
+		}
+		mux.RegisterProcessor(service, processor)
+	}
+	return mux
+}
+
+// splitMultiplexedName splits the endpoint name in "${service}:${method}"
+// format into service and method.
+//
+// If name is not in that format, service will be empty and method will be
+// name.
+func splitMultiplexedName(name string) (service, method string) {
+	if service, method, ok := strings.Cut(name, thrift.MULTIPLEXED_SEPARATOR); ok {
+		return service, method
+	}
+	return "", name
+}
+
+// multiplexedClient is a thrift.TClient calling the multiplexed service on the
+// server.
+//
+// We can't just use thrift.TStandardClient with thrift.TMultiplexedProtocol,
+// as thrift.TStandardClient only writes the THeaders when the output protocol
+// is a *thrift.THeaderProtocol.
+type multiplexedClient struct {
+	*thrift.TStandardClient
+
+	iprot thrift.TProtocol
+	oprot thrift.TProtocol
+	mux   *thrift.TMultiplexedProtocol
+
+	seqID int32
+}
+
+func newMultiplexedClient(service string, iprot, oprot thrift.TProtocol) *multiplexedClient {
+	return &multiplexedClient{
+		TStandardClient: thrift.NewTStandardClient(iprot, oprot),
+		iprot:           iprot,
+		oprot:           oprot,
+		mux:             thrift.NewTMultiplexedProtocol(oprot, service),
+	}
+}
+
+// Call implements thrift.TClient.
+func (c *multiplexedClient) Call(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+	c.seqID++
+	seqID := c.seqID
+
+	if hp, ok := c.oprot.(*thrift.THeaderProtocol); ok {
+		hp.ClearWriteHeaders()
+		for _, key := range thrift.GetWriteHeaderList(ctx) {
+			if value, ok := thrift.GetHeader(ctx, key); ok {
+				hp.SetWriteHeader(key, value)
+			}
+		}
+	}
+	if err := c.Send(ctx, c.mux, seqID, method, args); err != nil {
+		return thrift.ResponseMeta{}, err
+	}
+
+	// method is oneway
+	if result == nil {
+		return thrift.ResponseMeta{}, nil
+	}
+
+	err := c.Recv(ctx, c.iprot, seqID, method, result)
+	var headers thrift.THeaderMap
+	if hp, ok := c.iprot.(*thrift.THeaderProtocol); ok {
+		headers = hp.GetReadHeaders()
+	}
+	return thrift.ResponseMeta{
+		Headers: headers,
+	}, err
+}
+
+var _ thrift.TClient = (*multiplexedClient)(nil)
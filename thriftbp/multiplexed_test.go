@@ -0,0 +1,245 @@
+package thriftbp_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/google/go-cmp/cmp"
+
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/ratelimitbp"
+	"github.com/reddit/baseplate.go/thriftbp"
+	"github.com/reddit/baseplate.go/thriftbp/thrifttest"
+	"github.com/reddit/baseplate.go/transport"
+)
+
+type multiplexedService struct {
+	healthy bool
+
+	lock       sync.Mutex
+	userAgents []string
+}
+
+func (s *multiplexedService) IsHealthy(ctx context.Context, _ *baseplatethrift.IsHealthyRequest) (bool, error) {
+	ua, _ := thrift.GetHeader(ctx, transport.HeaderUserAgent)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.userAgents = append(s.userAgents, ua)
+	return s.healthy, nil
+}
+
+type nameRecorder struct {
+	lock  sync.Mutex
+	names []string
+}
+
+func (r *nameRecorder) middleware(name string, next thrift.TProcessorFunction) thrift.TProcessorFunction {
+	return thrift.WrappedTProcessorFunction{
+		Wrapped: func(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
+			r.lock.Lock()
+			r.names = append(r.names, name)
+			r.lock.Unlock()
+			return next.Process(ctx, seqID, in, out)
+		},
+	}
+}
+
+func TestMultiplexedServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	store := newSecretsStore(t)
+
+	const clientName = "multiplexed-test"
+	healthy := &multiplexedService{healthy: true}
+	unhealthy := &multiplexedService{healthy: false}
+	recorder := &nameRecorder{}
+	server, err := thrifttest.NewBaseplateServer(thrifttest.ServerConfig{
+		Processor: baseplatethrift.NewBaseplateServiceV2Processor(healthy),
+		MultiplexedProcessors: map[string]thrift.TProcessor{
+			"healthy":   baseplatethrift.NewBaseplateServiceV2Processor(healthy),
+			"unhealthy": baseplatethrift.NewBaseplateServiceV2Processor(unhealthy),
+		},
+		SecretStore: store,
+		ClientConfig: thriftbp.ClientPoolConfig{
+			ClientName: clientName,
+		},
+		ProcessorMiddlewares: []thrift.ProcessorMiddleware{recorder.middleware},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Start(ctx)
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	for _, c := range []struct {
+		service string
+		want    bool
+	}{
+		{service: "", want: true},
+		{service: "healthy", want: true},
+		{service: "unhealthy", want: false},
+	} {
+		t.Run(c.service, func(t *testing.T) {
+			pool := server.ClientPool
+			if c.service != "" {
+				var err error
+				pool, err = server.NewMultiplexedClientPool(c.service)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			client := baseplatethrift.NewBaseplateServiceV2Client(pool.TClient())
+			got, err := client.IsHealthy(ctx, &baseplatethrift.IsHealthyRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("IsHealthy got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	recorder.lock.Lock()
+	names := recorder.names
+	recorder.lock.Unlock()
+	sort.Strings(names)
+	if diff := cmp.Diff([]string{"healthy:is_healthy", "is_healthy", "unhealthy:is_healthy"}, names); diff != "" {
+		t.Errorf("Middleware names mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, s := range []*multiplexedService{healthy, unhealthy} {
+		s.lock.Lock()
+		for _, ua := range s.userAgents {
+			if ua != clientName {
+				t.Errorf("Expected the %q header to be %q, got %q", transport.HeaderUserAgent, clientName, ua)
+			}
+		}
+		s.lock.Unlock()
+	}
+}
+
+// isHealthyErrorResult is the result of is_healthy, with a baseplate.Error
+// exception as field 1 that the IDL doesn't declare.
+type isHealthyErrorResult struct {
+	Error *baseplatethrift.Error `thrift:"error,1"`
+}
+
+func (r *isHealthyErrorResult) Read(ctx context.Context, p thrift.TProtocol) error {
+	if _, err := p.ReadStructBegin(ctx); err != nil {
+		return err
+	}
+	for {
+		_, typeID, id, err := p.ReadFieldBegin(ctx)
+		if err != nil {
+			return err
+		}
+		if typeID == thrift.STOP {
+			break
+		}
+		if id == 1 && typeID == thrift.STRUCT {
+			r.Error = baseplatethrift.NewError()
+			err = r.Error.Read(ctx, p)
+		} else {
+			err = p.Skip(ctx, typeID)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.ReadFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	return p.ReadStructEnd(ctx)
+}
+
+func (r *isHealthyErrorResult) Write(context.Context, thrift.TProtocol) error {
+	return errors.New("isHealthyErrorResult: write not supported")
+}
+
+func TestMultiplexedRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	limiter := ratelimitbp.NewLimiter(ratelimitbp.Config{
+		Classes: map[string]ratelimitbp.ClassConfig{
+			"custom": {
+				Default: &ratelimitbp.Limit{Rate: 0.001},
+			},
+		},
+	}, ratelimitbp.LimiterArgs{
+		KeyFuncs: map[string]ratelimitbp.KeyFunc{
+			"custom": func(context.Context) (string, bool) {
+				return "key", true
+			},
+		},
+	})
+	service := &multiplexedService{healthy: true}
+	server, err := thrifttest.NewBaseplateServer(thrifttest.ServerConfig{
+		MultiplexedProcessors: map[string]thrift.TProcessor{
+			"declared":   baseplatethrift.NewBaseplateServiceV2Processor(service),
+			"undeclared": baseplatethrift.NewBaseplateServiceV2Processor(service),
+		},
+		SecretStore: newSecretsStore(t),
+		ProcessorMiddlewares: []thrift.ProcessorMiddleware{
+			thriftbp.RateLimit(thriftbp.RateLimitArgs{
+				Limiter: limiter,
+				ErrorFieldIDs: map[string]int16{
+					"declared:is_healthy": 1,
+				},
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Start(ctx)
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	newPool := func(t *testing.T, service string) thriftbp.ClientPool {
+		t.Helper()
+		pool, err := server.NewMultiplexedClientPool(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pool
+	}
+
+	// The first request uses up the limit.
+	client := baseplatethrift.NewBaseplateServiceV2Client(newPool(t, "declared").TClient())
+	if _, err := client.IsHealthy(ctx, &baseplatethrift.IsHealthyRequest{}); err != nil {
+		t.Fatalf("Expected the first request to be allowed, got %v", err)
+	}
+
+	t.Run("declared", func(t *testing.T) {
+		_, err := newPool(t, "declared").TClient().Call(
+			ctx,
+			"is_healthy",
+			baseplatethrift.NewBaseplateServiceV2IsHealthyArgs(),
+			&isHealthyErrorResult{},
+		)
+		var bpErr *baseplatethrift.Error
+		if !errors.As(err, &bpErr) ||
+			bpErr.GetCode() != int32(baseplatethrift.ErrorCode_TOO_MANY_REQUESTS) ||
+			!bpErr.GetRetryable() {
+			t.Errorf("Expected a retryable TOO_MANY_REQUESTS error, got %v", err)
+		}
+	})
+
+	t.Run("undeclared", func(t *testing.T) {
+		client := baseplatethrift.NewBaseplateServiceV2Client(newPool(t, "undeclared").TClient())
+		_, err := client.IsHealthy(ctx, &baseplatethrift.IsHealthyRequest{})
+		var appErr thrift.TApplicationException
+		if !errors.As(err, &appErr) || appErr.TypeId() != thrift.UNKNOWN_APPLICATION_EXCEPTION {
+			t.Errorf("Expected an UNKNOWN_APPLICATION_EXCEPTION, got %v", err)
+		}
+	})
+}
@@ -22,6 +22,7 @@ const (
 	baseplateStatusLabel     = "thrift_baseplate_status"
 	baseplateStatusCodeLabel = "thrift_baseplate_status_code"
 	clientNameLabel          = "thrift_client_name"
+	cacheResultLabel         = "thrift_cache_result"
 )
 
 var (
@@ -95,11 +96,43 @@ var (
 	}, clientActiveRequestsLabels)
 )
 
+const (
+	closeReasonLabel = "thrift_close_reason"
+)
+
 var (
 	serverConnectionsGauge = promauto.With(prometheusbpint.GlobalRegistry).NewGauge(prometheus.GaugeOpts{
 		Name: "thriftbp_server_connections",
 		Help: "The number of client connections established to the service",
 	})
+
+	serverClosedConnectionsCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "thriftbp_server_closed_connections_total",
+		Help: "The number of client connections closed by the server",
+	}, []string{
+		closeReasonLabel,
+	})
+)
+
+var (
+	clientCacheRequestsCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "thriftbp_client_cache_requests_total",
+		Help: "The number of requests to the cached methods of thrift clients, by cache result",
+	}, []string{
+		methodLabel,
+		clientNameLabel,
+		cacheResultLabel,
+	})
+)
+
+var (
+	clientCoalescedRequestsCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "thriftbp_client_coalesced_requests_total",
+		Help: "The number of thrift client requests served by the result of another identical in-flight request",
+	}, []string{
+		methodLabel,
+		clientNameLabel,
+	})
 )
 
 var (
@@ -207,6 +240,30 @@ var (
 		"thrift_success",
 	})
 
+	clientPoolHealthProbesCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "thriftbp_client_pool_health_probes_total",
+		Help: "The number of health probes done on the idle connections of a thrift client pool",
+	}, []string{
+		"thrift_pool",
+		"thrift_success",
+	})
+
+	clientPoolReplacedConnectionsCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "thriftbp_client_pool_replaced_connections_total",
+		Help: "The number of connections failed health probes and replaced in the background for a thrift client pool",
+	}, []string{
+		"thrift_pool",
+		"thrift_success",
+	})
+
+	clientPoolWarmUpConnectionsCounter = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "thriftbp_client_pool_warm_up_connections_total",
+		Help: "The number of connections opened in the background to keep the min idle connections of a thrift client pool",
+	}, []string{
+		"thrift_pool",
+		"thrift_success",
+	})
+
 	clientPoolMaxSizeGauge = promauto.With(prometheusbpint.GlobalRegistry).NewGaugeVec(prometheus.GaugeOpts{
 		Name: "thrift_client_pool_max_size",
 		Help: "The configured max size of a thrift client pool",
@@ -22,11 +22,27 @@ import (
 // by NewBaseplateServer. Please refer to the documentation for each field to
 // see how is it used.
 type ServerConfig struct {
-	// Required, used by both NewServer and NewBaseplateServer.
+	// Required (unless MultiplexedProcessors is set), used by both NewServer and
+	// NewBaseplateServer.
 	//
 	// This is the thrift processor implementation to handle endpoints.
+	//
+	// When MultiplexedProcessors is also set, this is the default processor
+	// handling the requests without multiplexed service names, and can be nil.
 	Processor thrift.TProcessor
 
+	// Optional, used by both NewServer and NewBaseplateServer.
+	//
+	// The additional thrift processors to serve on the same server via
+	// thrift.TMultiplexedProcessor, keyed by their multiplexed service names.
+	// Clients of these services need to set the multiplexed service name, see
+	// ClientPoolConfig.MultiplexedServiceName.
+	//
+	// Each of the processors is wrapped with the middlewares separately, see
+	// NewMultiplexedProcessor for more details. In NewBaseplateServer, each of
+	// them gets its own ServiceName in BaseplateDefaultProcessorMiddlewares.
+	MultiplexedProcessors map[string]thrift.TProcessor
+
 	// Optional, used by both NewServer and NewBaseplateServer.
 	//
 	// For NewServer, this defines all the middlewares to wrap the server with.
@@ -70,9 +86,36 @@ type ServerConfig struct {
 	// Report the number of clients connected to the server as a runtime gauge
 	// with metric name of 'thrift.connections'
 	//
-	// Deprecated: This feature is removed.
+	// Deprecated: This feature is removed. The number of connections is always
+	// reported as the thriftbp_server_connections Prometheus gauge.
 	ReportConnectionCount bool
 
+	// Optional, used by both NewServer and NewBaseplateServer.
+	//
+	// The max number of concurrent client connections. The connections accepted
+	// when the server already has MaxConnections connections are closed
+	// immediately, so the clients can connect to other servers instead.
+	//
+	// 0 means unlimited.
+	MaxConnections int
+
+	// Optional, used by both NewServer and NewBaseplateServer.
+	//
+	// The max number of requests served by a client connection. The response of
+	// the last request comes with the "Connection: close" THeader (see
+	// HeaderConnection), and the connection is closed after the response.
+	//
+	// 0 means unlimited.
+	MaxRequestsPerConnection int
+
+	// Optional, used by both NewServer and NewBaseplateServer.
+	//
+	// The client connections without any request for longer than
+	// IdleConnectionTimeout are closed.
+	//
+	// 0 means the idle connections are never closed by the server.
+	IdleConnectionTimeout time.Duration
+
 	// Optional, used only by NewServer.
 	// In NewBaseplateServer the address set in bp.Config() will be used instead.
 	//
@@ -105,6 +148,14 @@ type ServerConfig struct {
 // NewServer returns a thrift.TSimpleServer using the THeader transport
 // and protocol to serve the given TProcessor which is wrapped with the
 // given ProcessorMiddlewares.
+//
+// The client connections of the server are managed according to the
+// MaxConnections, MaxRequestsPerConnection and IdleConnectionTimeout configs,
+// and reported as the thriftbp_server_connections Prometheus gauge.
+// When the server is closed via the baseplate.Server returned by
+// ApplyBaseplate, the connections are drained first: the idle ones are closed
+// immediately, and the others are closed after their in-flight requests, with
+// the "Connection: close" THeader set on the responses when possible.
 func NewServer(cfg ServerConfig) (*thrift.TSimpleServer, error) {
 	var transport thrift.TServerTransport
 	if cfg.Socket == nil {
@@ -125,9 +176,24 @@ func NewServer(cfg ServerConfig) (*thrift.TSimpleServer, error) {
 	middlewares = append(middlewares, cfg.Middlewares...)
 	middlewares = append(middlewares, recoverPanik)
 
-	server := thrift.NewTSimpleServer4(
-		thrift.WrapProcessor(cfg.Processor, middlewares...),
-		transport,
+	var processor thrift.TProcessor
+	if len(cfg.MultiplexedProcessors) > 0 {
+		processor = NewMultiplexedProcessor(
+			cfg.Processor,
+			cfg.MultiplexedProcessors,
+			func(thrift.TProcessor) []thrift.ProcessorMiddleware {
+				return middlewares
+			},
+		)
+	} else {
+		processor = thrift.WrapProcessor(cfg.Processor, middlewares...)
+	}
+
+	server := thrift.NewTSimpleServerFactory4(
+		managedProcessorFactory{
+			processor: processor,
+		},
+		newManagedServerTransport(transport, cfg),
 		thrift.NewTHeaderTransportFactoryConf(nil, nil),
 		thrift.NewTHeaderProtocolFactoryConf(nil),
 	)
@@ -144,15 +210,25 @@ func NewBaseplateServer(
 	bp baseplate.Baseplate,
 	cfg ServerConfig,
 ) (baseplate.Server, error) {
-	middlewares := BaseplateDefaultProcessorMiddlewares(
-		DefaultProcessorMiddlewaresArgs{
-			EdgeContextImpl:     bp.EdgeContextImpl(),
-			ServiceName:         GetThriftServiceName(cfg.Processor),
-			ErrorSpanSuppressor: cfg.ErrorSpanSuppressor,
-		},
-	)
-	middlewares = append(middlewares, cfg.Middlewares...)
-	cfg.Middlewares = middlewares
+	middlewares := func(processor thrift.TProcessor) []thrift.ProcessorMiddleware {
+		middlewares := BaseplateDefaultProcessorMiddlewares(
+			DefaultProcessorMiddlewaresArgs{
+				EdgeContextImpl:     bp.EdgeContextImpl(),
+				ServiceName:         GetThriftServiceName(processor),
+				ErrorSpanSuppressor: cfg.ErrorSpanSuppressor,
+			},
+		)
+		return append(middlewares, cfg.Middlewares...)
+	}
+	if len(cfg.MultiplexedProcessors) > 0 {
+		// The processors are already wrapped with the middlewares here, so NewServer
+		// only needs to add its own middlewares on top of the mux.
+		cfg.Processor = NewMultiplexedProcessor(cfg.Processor, cfg.MultiplexedProcessors, middlewares)
+		cfg.MultiplexedProcessors = nil
+		cfg.Middlewares = nil
+	} else {
+		cfg.Middlewares = middlewares(cfg.Processor)
+	}
 
 	cfg.Addr = bp.GetConfig().Addr
 	cfg.Socket = nil
@@ -188,6 +264,9 @@ func (s impl) Serve() error {
 }
 
 func (s impl) Close() error {
+	if t, ok := s.srv.ServerTransport().(*managedServerTransport); ok {
+		t.drain()
+	}
 	return s.srv.Stop()
 }
 
@@ -0,0 +1,396 @@
+package thriftbp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HeaderConnection is the THeader set on the last response of a connection by
+// the servers created by NewServer, with HeaderConnectionClose as the value, to
+// tell the clients that the connection will be closed after the response, so
+// they should reconnect (possibly to another server) for the next request.
+//
+// The clients created by NewBaseplateClientPool close such connections upon
+// receiving the response.
+const (
+	HeaderConnection      = "Connection"
+	HeaderConnectionClose = "close"
+)
+
+// The reasons of the connections closed by the server.
+const (
+	closeReasonMaxConnections = "max_connections"
+	closeReasonMaxRequests    = "max_requests"
+	closeReasonIdle           = "idle"
+	closeReasonDrain          = "drain"
+)
+
+// minIdleCheckInterval is the min interval of checking idle connections.
+const minIdleCheckInterval = 10 * time.Millisecond
+
+// managedServerTransport is a thrift.TServerTransport managing the connections
+// it accepts:
+//
+// - It keeps the serverConnectionsGauge up to date.
+//
+// - It closes the connections accepted over maxConnections.
+//
+// - It closes the connections idle for longer than idleTimeout.
+//
+// - It closes all the connections as soon as they are idle after drain is
+// called.
+//
+// Together with managedProcessorFactory, it also closes the connections after
+// maxRequests requests.
+type managedServerTransport struct {
+	thrift.TServerTransport
+
+	maxConnections int
+	maxRequests    int
+	idleTimeout    time.Duration
+
+	lock     sync.Mutex
+	conns    map[*managedConn]struct{}
+	draining bool
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+func newManagedServerTransport(trans thrift.TServerTransport, cfg ServerConfig) *managedServerTransport {
+	return &managedServerTransport{
+		TServerTransport: trans,
+		maxConnections:   cfg.MaxConnections,
+		maxRequests:      cfg.MaxRequestsPerConnection,
+		idleTimeout:      cfg.IdleConnectionTimeout,
+		conns:            make(map[*managedConn]struct{}),
+		stop:             make(chan struct{}),
+	}
+}
+
+// Listen implements thrift.TServerTransport, and starts closing idle
+// connections if idleTimeout is set.
+func (t *managedServerTransport) Listen() error {
+	if err := t.TServerTransport.Listen(); err != nil {
+		return err
+	}
+	if t.idleTimeout > 0 {
+		go t.reapIdleConns()
+	}
+	return nil
+}
+
+// Accept implements thrift.TServerTransport.
+//
+// The connections accepted when the server is already at maxConnections or
+// draining are closed immediately.
+func (t *managedServerTransport) Accept() (thrift.TTransport, error) {
+	for {
+		trans, err := t.TServerTransport.Accept()
+		if err != nil {
+			return nil, err
+		}
+		c := &managedConn{
+			TTransport: trans,
+			server:     t,
+		}
+		c.touch()
+		if reason, ok := t.add(c); !ok {
+			trans.Close()
+			countClosedConnection(reason)
+			continue
+		}
+		return c, nil
+	}
+}
+
+// Close implements thrift.TServerTransport.
+func (t *managedServerTransport) Close() error {
+	t.stopReaping()
+	return t.TServerTransport.Close()
+}
+
+// Interrupt implements thrift.TServerTransport.
+func (t *managedServerTransport) Interrupt() error {
+	t.stopReaping()
+	return t.TServerTransport.Interrupt()
+}
+
+func (t *managedServerTransport) add(c *managedConn) (reason string, ok bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.draining {
+		return closeReasonDrain, false
+	}
+	if t.maxConnections > 0 && len(t.conns) >= t.maxConnections {
+		return closeReasonMaxConnections, false
+	}
+	t.conns[c] = struct{}{}
+	serverConnectionsGauge.Inc()
+	return "", true
+}
+
+func (t *managedServerTransport) remove(c *managedConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.conns[c]; ok {
+		delete(t.conns, c)
+		serverConnectionsGauge.Dec()
+	}
+}
+
+func (t *managedServerTransport) isDraining() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.draining
+}
+
+func (t *managedServerTransport) snapshot() []*managedConn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	conns := make([]*managedConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// drain stops accepting new connections, closes the idle connections, and
+// makes the other connections to be closed after their in-flight requests.
+func (t *managedServerTransport) drain() {
+	t.lock.Lock()
+	t.draining = true
+	t.lock.Unlock()
+	t.stopReaping()
+
+	for _, c := range t.snapshot() {
+		c.closeWhenIdle(closeReasonDrain)
+	}
+}
+
+func (t *managedServerTransport) stopReaping() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+}
+
+func (t *managedServerTransport) reapIdleConns() {
+	interval := t.idleTimeout / 2
+	if interval < minIdleCheckInterval {
+		interval = minIdleCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			for _, c := range t.snapshot() {
+				if c.idleSince(now) >= t.idleTimeout {
+					c.closeIfIdleFor(t.idleTimeout, closeReasonIdle)
+				}
+			}
+		}
+	}
+}
+
+// managedConn is a connection accepted by managedServerTransport.
+type managedConn struct {
+	thrift.TTransport
+
+	server *managedServerTransport
+
+	lastActive atomic.Int64 // UnixNano
+
+	lock sync.Mutex
+	// busy is true from the first byte of a request read until its response
+	// is written.
+	busy bool
+	// closeAfterRequest is set when the connection should be closed after the
+	// in-flight request.
+	closeAfterRequest bool
+	// closedByServer is set when the connection is closed by the server
+	// between requests.
+	closedByServer bool
+
+	// only accessed by the goroutine serving the connection.
+	requests int
+
+	closeOnce sync.Once
+}
+
+// Read implements thrift.TTransport.
+//
+// The errors caused by the server closing the connection are returned as
+// END_OF_FILE, so they are not logged as errors by thrift.TSimpleServer.
+func (c *managedConn) Read(p []byte) (int, error) {
+	n, err := c.TTransport.Read(p)
+	// Touch and mark the connection as busy under the same lock, so the reaper
+	// can't observe it as idle after the bytes of a request are read.
+	c.lock.Lock()
+	c.touch()
+	if n > 0 {
+		c.busy = true
+	}
+	closed := c.closedByServer
+	c.lock.Unlock()
+	if err != nil && closed {
+		return n, thrift.NewTTransportException(thrift.END_OF_FILE, "thriftbp: connection closed by server")
+	}
+	return n, err
+}
+
+// Write implements thrift.TTransport.
+func (c *managedConn) Write(p []byte) (int, error) {
+	n, err := c.TTransport.Write(p)
+	c.touch()
+	return n, err
+}
+
+// Close implements thrift.TTransport.
+func (c *managedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.server.remove(c)
+	})
+	return c.TTransport.Close()
+}
+
+func (c *managedConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *managedConn) idleSince(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, c.lastActive.Load()))
+}
+
+// closeIfIdle closes the connection if there's no in-flight request.
+func (c *managedConn) closeIfIdle(reason string) bool {
+	return c.closeIfIdleFor(0, reason)
+}
+
+// closeIfIdleFor closes the connection if there's no in-flight request and it
+// has been idle for at least timeout.
+//
+// The idle time is checked again while holding the lock, as the connection
+// might have read a new request since the caller checked it.
+func (c *managedConn) closeIfIdleFor(timeout time.Duration, reason string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.busy || c.closedByServer {
+		return false
+	}
+	if timeout > 0 && c.idleSince(time.Now()) < timeout {
+		return false
+	}
+	c.closedByServer = true
+	// Closing the underlying transport unblocks the read of the next request.
+	c.TTransport.Close()
+	countClosedConnection(reason)
+	return true
+}
+
+// closeWhenIdle closes the connection if there's no in-flight request,
+// or after the in-flight request otherwise.
+func (c *managedConn) closeWhenIdle(reason string) {
+	if c.closeIfIdle(reason) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.closedByServer {
+		c.closeAfterRequest = true
+	}
+}
+
+// startRequest is called before processing a request, and returns true if it's
+// the last request of the connection.
+func (c *managedConn) startRequest() (last bool, reason string) {
+	c.requests++
+	c.lock.Lock()
+	c.busy = true
+	c.lock.Unlock()
+	if c.server.isDraining() {
+		return true, closeReasonDrain
+	}
+	if c.server.maxRequests > 0 && c.requests >= c.server.maxRequests {
+		return true, closeReasonMaxRequests
+	}
+	return false, ""
+}
+
+// endRequest is called after processing a request, and returns true if the
+// connection should be closed.
+func (c *managedConn) endRequest() bool {
+	c.touch()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.busy = false
+	return c.closeAfterRequest
+}
+
+// managedProcessorFactory is a thrift.TProcessorFactory working with
+// managedServerTransport to close the connections after their last requests.
+type managedProcessorFactory struct {
+	processor thrift.TProcessor
+}
+
+func (f managedProcessorFactory) GetProcessor(trans thrift.TTransport) thrift.TProcessor {
+	c, ok := trans.(*managedConn)
+	if !ok {
+		return f.processor
+	}
+	return managedProcessor{
+		TProcessor: f.processor,
+		conn:       c,
+	}
+}
+
+type managedProcessor struct {
+	thrift.TProcessor
+
+	conn *managedConn
+}
+
+// Process implements thrift.TProcessor.
+//
+// When the request is the last one of the connection, it sets the
+// "Connection: close" THeader on the response, and returns false to make
+// thrift.TSimpleServer close the connection after the response.
+func (p managedProcessor) Process(ctx context.Context, in, out thrift.TProtocol) (bool, thrift.TException) {
+	last, reason := p.conn.startRequest()
+	if last {
+		if helper, ok := thrift.GetResponseHelper(ctx); ok {
+			helper.SetHeader(HeaderConnection, HeaderConnectionClose)
+		}
+	}
+	ok, err := p.TProcessor.Process(ctx, in, out)
+	if p.conn.endRequest() && !last {
+		// Draining started during the request, it's too late to set the
+		// header.
+		last, reason = true, closeReasonDrain
+	}
+	if last {
+		countClosedConnection(reason)
+		return false, err
+	}
+	return ok, err
+}
+
+func countClosedConnection(reason string) {
+	serverClosedConnectionsCounter.With(prometheus.Labels{
+		closeReasonLabel: reason,
+	}).Inc()
+}
+
+var (
+	_ thrift.TServerTransport  = (*managedServerTransport)(nil)
+	_ thrift.TTransport        = (*managedConn)(nil)
+	_ thrift.TProcessorFactory = managedProcessorFactory{}
+	_ thrift.TProcessor        = managedProcessor{}
+)
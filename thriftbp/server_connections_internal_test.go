@@ -0,0 +1,267 @@
+package thriftbp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/reddit/baseplate.go"
+	"github.com/reddit/baseplate.go/ecinterface"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/prometheusbp/promtest"
+)
+
+type blockingIsHealthyService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingIsHealthyService) IsHealthy(ctx context.Context, _ *baseplatethrift.IsHealthyRequest) (bool, error) {
+	if s.started != nil {
+		close(s.started)
+		<-s.release
+	}
+	return true, nil
+}
+
+func startManagedServer(t *testing.T, cfg ServerConfig, handler baseplatethrift.BaseplateServiceV2) (addr string, srv baseplate.Server) {
+	t.Helper()
+
+	socket, err := thrift.NewTServerSocket("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := socket.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	if handler == nil {
+		handler = &blockingIsHealthyService{}
+	}
+	cfg.Socket = socket
+	cfg.Processor = baseplatethrift.NewBaseplateServiceV2Processor(handler)
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = ApplyBaseplate(nil, server)
+	go srv.Serve()
+	t.Cleanup(func() {
+		srv.Close()
+	})
+	return socket.Addr().String(), srv
+}
+
+type rawClient struct {
+	*baseplatethrift.BaseplateServiceV2Client
+
+	trans thrift.TTransport
+}
+
+func newRawClient(t *testing.T, addr string) rawClient {
+	t.Helper()
+
+	cfg := &thrift.TConfiguration{
+		ConnectTimeout: time.Second,
+		SocketTimeout:  time.Second,
+	}
+	trans := thrift.NewTSocketConf(addr, cfg)
+	if err := trans.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		trans.Close()
+	})
+	proto := thrift.NewTHeaderProtocolConf(trans, cfg)
+	return rawClient{
+		BaseplateServiceV2Client: baseplatethrift.NewBaseplateServiceV2Client(thrift.NewTStandardClient(proto, proto)),
+		trans:                    trans,
+	}
+}
+
+// call calls IsHealthy and returns whether the response has the
+// "Connection: close" header.
+func (c rawClient) call(ctx context.Context) (connectionClose bool, err error) {
+	if _, err := c.IsHealthy(ctx, &baseplatethrift.IsHealthyRequest{}); err != nil {
+		return false, err
+	}
+	return c.LastResponseMeta_().Headers[HeaderConnection] == HeaderConnectionClose, nil
+}
+
+func closedConnectionsTest(t *testing.T, reason string) *promtest.PrometheusMetricTest {
+	return promtest.NewPrometheusMetricTest(t, reason, serverClosedConnectionsCounter, prometheus.Labels{
+		closeReasonLabel: reason,
+	})
+}
+
+func TestServerMaxRequestsPerConnection(t *testing.T) {
+	defer closedConnectionsTest(t, closeReasonMaxRequests).CheckDelta(1)
+
+	addr, _ := startManagedServer(t, ServerConfig{MaxRequestsPerConnection: 2}, nil)
+	client := newRawClient(t, addr)
+	ctx := context.Background()
+
+	for i, want := range []bool{false, true} {
+		got, err := client.call(ctx)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got != want {
+			t.Errorf("#%d: Expected connection close header to be %v, got %v", i, want, got)
+		}
+	}
+	if _, err := client.call(ctx); err == nil {
+		t.Error("Expected error on closed connection, got nil")
+	}
+}
+
+func TestServerMaxConnections(t *testing.T) {
+	defer closedConnectionsTest(t, closeReasonMaxConnections).CheckDelta(1)
+	connections := promtest.NewPrometheusMetricTest(t, "connections", serverConnectionsGauge, nil)
+
+	addr, _ := startManagedServer(t, ServerConfig{MaxConnections: 1}, nil)
+	ctx := context.Background()
+
+	first := newRawClient(t, addr)
+	if _, err := first.call(ctx); err != nil {
+		t.Fatal(err)
+	}
+	connections.CheckDelta(1)
+
+	second := newRawClient(t, addr)
+	if _, err := second.call(ctx); err == nil {
+		t.Error("Expected error over max connections, got nil")
+	}
+	connections.CheckDelta(1)
+
+	first.trans.Close()
+	// Wait for the server to notice the closed connection.
+	time.Sleep(50 * time.Millisecond)
+	connections.CheckDelta(0)
+
+	third := newRawClient(t, addr)
+	if _, err := third.call(ctx); err != nil {
+		t.Errorf("Expected the connection to be accepted after the first one closed, got %v", err)
+	}
+}
+
+func TestServerIdleConnectionTimeout(t *testing.T) {
+	defer closedConnectionsTest(t, closeReasonIdle).CheckDelta(1)
+	defer promtest.NewPrometheusMetricTest(t, "connections", serverConnectionsGauge, nil).CheckDelta(0)
+
+	addr, _ := startManagedServer(t, ServerConfig{IdleConnectionTimeout: 50 * time.Millisecond}, nil)
+	client := newRawClient(t, addr)
+	ctx := context.Background()
+
+	if _, err := client.call(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, err := client.call(ctx); err == nil {
+		t.Error("Expected error on idle connection closed by the server, got nil")
+	}
+}
+
+func TestServerDrain(t *testing.T) {
+	defer closedConnectionsTest(t, closeReasonDrain).CheckDelta(2)
+
+	handler := &blockingIsHealthyService{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	addr, srv := startManagedServer(t, ServerConfig{}, handler)
+	ctx := context.Background()
+
+	idle := newRawClient(t, addr)
+	busy := newRawClient(t, addr)
+	results := make(chan error, 1)
+	go func() {
+		_, err := busy.call(ctx)
+		results <- err
+	}()
+	<-handler.started
+
+	// Without draining, the idle connection would block Close forever.
+	closed := make(chan error, 1)
+	go func() {
+		closed <- srv.Close()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(handler.release)
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after draining")
+	}
+	if err := <-results; err != nil {
+		t.Errorf("Expected the in-flight request to succeed, got %v", err)
+	}
+	if _, err := idle.call(ctx); err == nil {
+		t.Error("Expected error on drained connection, got nil")
+	}
+}
+
+func TestClientPoolConnectionClose(t *testing.T) {
+	addr, _ := startManagedServer(t, ServerConfig{MaxRequestsPerConnection: 1}, nil)
+	pool, err := NewBaseplateClientPool(ClientPoolConfig{
+		ServiceSlug:        "test",
+		Addr:               addr,
+		InitialConnections: 1,
+		MaxConnections:     1,
+		ConnectTimeout:     time.Second,
+		SocketTimeout:      time.Second,
+		EdgeContextImpl:    ecinterface.Mock(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	client := baseplatethrift.NewBaseplateServiceV2Client(pool.TClient())
+
+	// Every connection is closed by the server after one request,
+	// which should be replaced by the pool.
+	for i := 0; i < 3; i++ {
+		if _, err := client.IsHealthy(context.Background(), &baseplatethrift.IsHealthyRequest{}); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+	}
+}
+
+func TestManagedConnCloseIfIdleAfterRead(t *testing.T) {
+	const timeout = time.Minute
+	buf := thrift.NewTMemoryBuffer()
+	buf.WriteString("request")
+	c := &managedConn{
+		TTransport: buf,
+		server:     &managedServerTransport{},
+	}
+	c.lastActive.Store(time.Now().Add(-2 * timeout).UnixNano())
+
+	// The reaper observed the connection as idle, but a request arrived before
+	// it tried to close it.
+	if c.idleSince(time.Now()) < timeout {
+		t.Fatal("Expected the connection to be idle")
+	}
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if c.closeIfIdleFor(timeout, closeReasonIdle) {
+		t.Error("Expected the connection with a request being read not to be closed")
+	}
+
+	c.endRequest()
+	if c.closeIfIdleFor(timeout, closeReasonIdle) {
+		t.Error("Expected the connection recently active not to be closed")
+	}
+	if !c.closeIfIdle(closeReasonDrain) {
+		t.Error("Expected the connection without in-flight request to be closed")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/reddit/baseplate.go/iobp"
 	"github.com/reddit/baseplate.go/log"
 	"github.com/reddit/baseplate.go/prometheusbp"
+	"github.com/reddit/baseplate.go/ratelimitbp"
 	"github.com/reddit/baseplate.go/tracing"
 	"github.com/reddit/baseplate.go/transport"
 )
@@ -28,6 +29,7 @@ import (
 var (
 	_ thrift.ProcessorMiddleware = ExtractDeadlineBudget
 	_ thrift.ProcessorMiddleware = AbandonCanceledRequests
+	_ thrift.ProcessorMiddleware = InjectLogCorrelation
 )
 
 // DefaultProcessorMiddlewaresArgs are the args to be passed into
@@ -74,17 +76,20 @@ type DefaultProcessorMiddlewaresArgs struct {
 //
 // 2. InjectServerSpan
 //
-// 3. InjectEdgeContext
+// 3. InjectLogCorrelation
 //
-// 4. ReportPayloadSizeMetrics
+// 4. InjectEdgeContext
 //
-// 5. PrometheusServerMiddleware
+// 5. ReportPayloadSizeMetrics
+//
+// 6. PrometheusServerMiddleware
 func BaseplateDefaultProcessorMiddlewares(args DefaultProcessorMiddlewaresArgs) []thrift.ProcessorMiddleware {
 	return []thrift.ProcessorMiddleware{
 		// Method descriptor middleware needs to be first to support proper telemetry
 		ServerMethodDescriptorMiddleware(args.ServiceName),
 		ExtractDeadlineBudget,
 		InjectServerSpanWithArgs(MonitorServerArgs{ServiceSlug: args.ServiceName}),
+		InjectLogCorrelation,
 		InjectEdgeContext(args.EdgeContextImpl),
 		ReportPayloadSizeMetrics(0),
 		PrometheusServerMiddleware,
@@ -177,6 +182,179 @@ func InjectServerSpanWithArgs(args MonitorServerArgs) thrift.ProcessorMiddleware
 	}
 }
 
+// InjectLogCorrelation is a thrift.ProcessorMiddleware that attaches
+// log.CorrelationFields into the `next` context,
+// so that the logs of the request (via log.C and slog) carry the trace and
+// span ids of the server span, the endpoint name and the caller (from the
+// "User-Agent" (transport.HeaderUserAgent) header).
+//
+// It should be used after InjectServerSpan.
+func InjectLogCorrelation(name string, next thrift.TProcessorFunction) thrift.TProcessorFunction {
+	return thrift.WrappedTProcessorFunction{
+		Wrapped: func(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
+			caller, _ := header(ctx, transport.HeaderUserAgent)
+			ctx = tracing.AttachLogCorrelation(ctx, name, caller)
+			return next.Process(ctx, seqID, in, out)
+		},
+	}
+}
+
+// RateLimitRetryAfterDetailKey is the key of the baseplate.Error Details
+// returned by RateLimit containing the duration after which the request would
+// be allowed, in milliseconds.
+const RateLimitRetryAfterDetailKey = "retry_after_ms"
+
+// RateLimitArgs are the args to be passed into RateLimit function.
+type RateLimitArgs struct {
+	// Limiter is required.
+	Limiter *ratelimitbp.Limiter
+
+	// ErrorFieldIDs maps the endpoint names to the field ids of the
+	// baseplate.Error exception they declare, e.g. {"get_user": 1} for
+	// "User get_user() throws (1: baseplate.Error error)".
+	//
+	// Rejected requests to the endpoints not in ErrorFieldIDs get a
+	// thrift.TApplicationException instead, as there's no way to tell which
+	// exceptions they declare. The clients don't retry those, so every endpoint
+	// should be in ErrorFieldIDs, and a warning is logged for each one that is
+	// not when RateLimit wraps it.
+	//
+	// For multiplexed services the endpoint names are in the form of
+	// "service:method".
+	ErrorFieldIDs map[string]int16
+}
+
+// RateLimit is a thrift.ProcessorMiddleware rejecting the requests exceeding
+// the rate limits of args.Limiter.
+//
+// The rejected requests get a retryable baseplate.Error with the code
+// TOO_MANY_REQUESTS, without calling the endpoint, if the endpoint is in
+// args.ErrorFieldIDs, or a thrift.TApplicationException otherwise.
+//
+// The caller of the request (for ratelimitbp.CallerKey) is read from the
+// baseplate headers (see ratelimitbp.IncomingCaller), falling back to the
+// "User-Agent" (transport.HeaderUserAgent) header set by the Baseplate clients
+// to their ClientName when there's none.
+// Both the baseplate headers and ratelimitbp.OAuthClientKey rely on the
+// BaseplateDefaultProcessorMiddlewares (ServerBaseplateHeadersMiddleware and
+// InjectEdgeContext), so RateLimit should be used after them.
+func RateLimit(args RateLimitArgs) thrift.ProcessorMiddleware {
+	return func(name string, next thrift.TProcessorFunction) thrift.TProcessorFunction {
+		fieldID, declared := args.ErrorFieldIDs[name]
+		if !declared {
+			slog.Warn(
+				"thriftbp.RateLimit: endpoint not in ErrorFieldIDs, rejected requests will get a non-retryable TApplicationException",
+				"endpoint", name,
+			)
+		}
+		return thrift.WrappedTProcessorFunction{
+			Wrapped: func(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
+				userAgent, _ := header(ctx, transport.HeaderUserAgent)
+				ctx = ratelimitbp.WithCaller(ctx, ratelimitbp.IncomingCaller(ctx, userAgent))
+				err := args.Limiter.Allow(ctx)
+				if err == nil {
+					return next.Process(ctx, seqID, in, out)
+				}
+				bpErr := &baseplate.Error{
+					Code:      thrift.Int32Ptr(int32(baseplate.ErrorCode_TOO_MANY_REQUESTS)),
+					Message:   thrift.StringPtr("rate limit exceeded"),
+					Retryable: thrift.BoolPtr(true),
+				}
+				var limited *ratelimitbp.LimitedError
+				if errors.As(err, &limited) {
+					bpErr.Details = map[string]string{
+						RateLimitRetryAfterDetailKey: strconv.FormatInt(limited.RetryAfter.Milliseconds(), 10),
+					}
+				}
+				if !declared {
+					return writeApplicationExceptionReply(ctx, name, seqID, thrift.NewTApplicationException(
+						thrift.UNKNOWN_APPLICATION_EXCEPTION,
+						err.Error(),
+					), in, out)
+				}
+				return writeExceptionReply(ctx, name, seqID, fieldID, bpErr, in, out)
+			},
+		}
+	}
+}
+
+// writeExceptionReply skips the args of the request and writes a reply with
+// bpErr as the exception field with the given id, as the generated processor
+// functions do for the exceptions declared in the IDL.
+//
+// name can be in the "${service}:${method}" format of multiplexed services,
+// the reply is always written with the bare method name as the clients expect.
+func writeExceptionReply(
+	ctx context.Context,
+	name string,
+	seqID int32,
+	fieldID int16,
+	bpErr *baseplate.Error,
+	in, out thrift.TProtocol,
+) (bool, thrift.TException) {
+	if err := skipArgs(ctx, in); err != nil {
+		return false, err
+	}
+
+	_, method := splitMultiplexedName(name)
+	for _, write := range []func() error{
+		func() error { return out.WriteMessageBegin(ctx, method, thrift.REPLY, seqID) },
+		func() error { return out.WriteStructBegin(ctx, method+"_result") },
+		func() error { return out.WriteFieldBegin(ctx, "error", thrift.STRUCT, fieldID) },
+		func() error { return bpErr.Write(ctx, out) },
+		func() error { return out.WriteFieldEnd(ctx) },
+		func() error { return out.WriteFieldStop(ctx) },
+		func() error { return out.WriteStructEnd(ctx) },
+		func() error { return out.WriteMessageEnd(ctx) },
+		func() error { return out.Flush(ctx) },
+	} {
+		if err := write(); err != nil {
+			return false, thrift.WrapTException(err)
+		}
+	}
+	return true, bpErr
+}
+
+// writeApplicationExceptionReply skips the args of the request and writes
+// appErr as the reply, as the generated processor functions do for the
+// undeclared errors.
+//
+// Like writeExceptionReply, the reply is written with the bare method name.
+func writeApplicationExceptionReply(
+	ctx context.Context,
+	name string,
+	seqID int32,
+	appErr thrift.TApplicationException,
+	in, out thrift.TProtocol,
+) (bool, thrift.TException) {
+	if err := skipArgs(ctx, in); err != nil {
+		return false, err
+	}
+
+	_, method := splitMultiplexedName(name)
+	for _, write := range []func() error{
+		func() error { return out.WriteMessageBegin(ctx, method, thrift.EXCEPTION, seqID) },
+		func() error { return appErr.Write(ctx, out) },
+		func() error { return out.WriteMessageEnd(ctx) },
+		func() error { return out.Flush(ctx) },
+	} {
+		if err := write(); err != nil {
+			return false, thrift.WrapTException(err)
+		}
+	}
+	return true, appErr
+}
+
+func skipArgs(ctx context.Context, in thrift.TProtocol) thrift.TException {
+	if err := thrift.SkipDefaultDepth(ctx, in, thrift.STRUCT); err != nil {
+		return thrift.WrapTException(err)
+	}
+	if err := in.ReadMessageEnd(ctx); err != nil {
+		return thrift.WrapTException(err)
+	}
+	return nil
+}
+
 // InitializeEdgeContext sets an edge request context created from the Thrift
 // headers set on the context onto the context and configures Thrift to forward
 // the edge requent context header on any Thrift calls made by the server.
@@ -481,8 +659,12 @@ func PrometheusServerMiddleware(method string, next thrift.TProcessorFunction) t
 }
 
 // ServerBaseplateHeadersMiddleware is a middleware that extracts baseplate headers from the incoming request and adds them to the context.
+//
+// For multiplexed services (see NewMultiplexedProcessor), the multiplexed
+// service name is used as the service of the headers.
 func ServerBaseplateHeadersMiddleware() thrift.ProcessorMiddleware {
 	return func(name string, next thrift.TProcessorFunction) thrift.TProcessorFunction {
+		service, method := splitMultiplexedName(name)
 		return thrift.WrappedTProcessorFunction{
 			Wrapped: func(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
 				readHeaderList := thrift.GetReadHeaderList(ctx)
@@ -491,7 +673,7 @@ func ServerBaseplateHeadersMiddleware() thrift.ProcessorMiddleware {
 				}
 
 				headers := headerbp.NewIncomingHeaders(
-					headerbp.WithThriftService("" /* service */, name),
+					headerbp.WithThriftService(service, method),
 				)
 				for _, k := range readHeaderList {
 					v, _ := thrift.GetHeader(ctx, k)
@@ -9,6 +9,9 @@ import (
 	"github.com/apache/thrift/lib/go/thrift"
 
 	"github.com/reddit/baseplate.go/ecinterface"
+	"github.com/reddit/baseplate.go/headerbp"
+	baseplatethrift "github.com/reddit/baseplate.go/internal/gen-go/reddit/baseplate"
+	"github.com/reddit/baseplate.go/ratelimitbp"
 	"github.com/reddit/baseplate.go/thriftbp"
 	"github.com/reddit/baseplate.go/thriftbp/thrifttest"
 	"github.com/reddit/baseplate.go/tracing"
@@ -248,3 +251,217 @@ func TestPanicMiddleware(t *testing.T) {
 		}
 	})
 }
+
+func TestRateLimit(t *testing.T) {
+	const (
+		name  = "method"
+		seqID = 42
+	)
+	limiter := ratelimitbp.NewLimiter(ratelimitbp.Config{
+		Classes: map[string]ratelimitbp.ClassConfig{
+			"custom": {
+				Default: &ratelimitbp.Limit{Rate: 0.001},
+			},
+		},
+	}, ratelimitbp.LimiterArgs{
+		KeyFuncs: map[string]ratelimitbp.KeyFunc{
+			"custom": func(context.Context) (string, bool) {
+				return "key", true
+			},
+		},
+	})
+
+	var called int
+	process := thriftbp.RateLimit(thriftbp.RateLimitArgs{
+		Limiter: limiter,
+		ErrorFieldIDs: map[string]int16{
+			name: 1,
+		},
+	})(name, thrift.WrappedTProcessorFunction{
+		Wrapped: func(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
+			called++
+			return true, nil
+		},
+	})
+
+	call := func(t *testing.T) (bool, thrift.TException, thrift.TProtocol) {
+		t.Helper()
+		ctx := context.Background()
+		in := thrift.NewTBinaryProtocolConf(thrift.NewTMemoryBuffer(), nil)
+		args := baseplatethrift.NewBaseplateServiceV2IsHealthyArgs()
+		args.Request = baseplatethrift.NewIsHealthyRequest()
+		if err := args.Write(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+		if err := in.WriteMessageEnd(ctx); err != nil {
+			t.Fatal(err)
+		}
+		out := thrift.NewTBinaryProtocolConf(thrift.NewTMemoryBuffer(), nil)
+		ok, err := process.Process(ctx, seqID, in, out)
+		return ok, err, out
+	}
+
+	if ok, err, _ := call(t); !ok || err != nil || called != 1 {
+		t.Fatalf("Expected the first call to be processed, got %v, %v, called %d", ok, err, called)
+	}
+
+	ok, err, out := call(t)
+	if !ok || called != 1 {
+		t.Errorf("Expected the second call to be rejected, got %v, called %d", ok, called)
+	}
+	var bpErr *baseplatethrift.Error
+	if !errors.As(err, &bpErr) ||
+		bpErr.GetCode() != int32(baseplatethrift.ErrorCode_TOO_MANY_REQUESTS) ||
+		!bpErr.GetRetryable() ||
+		bpErr.GetDetails()[thriftbp.RateLimitRetryAfterDetailKey] == "" {
+		t.Errorf("Unexpected error %#v", err)
+	}
+
+	// Read the reply.
+	ctx := context.Background()
+	gotName, typeID, gotSeqID, readErr := out.ReadMessageBegin(ctx)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if gotName != name || typeID != thrift.REPLY || gotSeqID != seqID {
+		t.Errorf("Unexpected message %q, %v, %d", gotName, typeID, gotSeqID)
+	}
+	if _, err := out.ReadStructBegin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, fieldType, fieldID, readErr := out.ReadFieldBegin(ctx)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if fieldType != thrift.STRUCT || fieldID != 1 {
+		t.Errorf("Unexpected field %v, %d", fieldType, fieldID)
+	}
+	var replied baseplatethrift.Error
+	if err := replied.Read(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+	if replied.GetCode() != int32(baseplatethrift.ErrorCode_TOO_MANY_REQUESTS) {
+		t.Errorf("Unexpected replied error %#v", replied)
+	}
+}
+
+func TestRateLimitUndeclaredError(t *testing.T) {
+	const (
+		name  = "method"
+		seqID = 42
+	)
+	limiter := ratelimitbp.NewLimiter(ratelimitbp.Config{
+		Classes: map[string]ratelimitbp.ClassConfig{
+			"custom": {
+				Default: &ratelimitbp.Limit{Rate: 0.001},
+			},
+		},
+	}, ratelimitbp.LimiterArgs{
+		KeyFuncs: map[string]ratelimitbp.KeyFunc{
+			"custom": func(context.Context) (string, bool) {
+				return "key", true
+			},
+		},
+	})
+	process := thriftbp.RateLimit(thriftbp.RateLimitArgs{
+		Limiter: limiter,
+		ErrorFieldIDs: map[string]int16{
+			"other": 1,
+		},
+	})(name, thrift.WrappedTProcessorFunction{
+		Wrapped: func(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
+			return true, nil
+		},
+	})
+
+	ctx := context.Background()
+	call := func() (bool, thrift.TException, thrift.TProtocol) {
+		in := thrift.NewTBinaryProtocolConf(thrift.NewTMemoryBuffer(), nil)
+		if err := baseplatethrift.NewBaseplateServiceV2IsHealthyArgs().Write(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+		if err := in.WriteMessageEnd(ctx); err != nil {
+			t.Fatal(err)
+		}
+		out := thrift.NewTBinaryProtocolConf(thrift.NewTMemoryBuffer(), nil)
+		ok, err := process.Process(ctx, seqID, in, out)
+		return ok, err, out
+	}
+	if _, err, _ := call(); err != nil {
+		t.Fatalf("Expected the first call to be processed, got %v", err)
+	}
+	ok, err, out := call()
+	var appErr thrift.TApplicationException
+	if !ok || !errors.As(err, &appErr) {
+		t.Fatalf("Expected TApplicationException, got %v, %#v", ok, err)
+	}
+
+	gotName, typeID, gotSeqID, readErr := out.ReadMessageBegin(ctx)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if gotName != name || typeID != thrift.EXCEPTION || gotSeqID != seqID {
+		t.Errorf("Unexpected message %q, %v, %d", gotName, typeID, gotSeqID)
+	}
+	replied := thrift.NewTApplicationException(0, "")
+	if err := replied.Read(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+	if replied.Error() != appErr.Error() {
+		t.Errorf("Expected replied error %q, got %q", appErr.Error(), replied.Error())
+	}
+}
+
+func TestRateLimitCaller(t *testing.T) {
+	limiter := ratelimitbp.NewLimiter(ratelimitbp.Config{
+		Classes: map[string]ratelimitbp.ClassConfig{
+			ratelimitbp.KeyClassCaller: {
+				Default: &ratelimitbp.Limit{Rate: 0.001},
+			},
+		},
+	}, ratelimitbp.LimiterArgs{})
+	process := thriftbp.RateLimit(thriftbp.RateLimitArgs{
+		Limiter: limiter,
+	})("is_healthy", thrift.WrappedTProcessorFunction{
+		Wrapped: func(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
+			return true, nil
+		},
+	})
+
+	for _, c := range []struct {
+		caller   string
+		bpCaller string
+		limited  bool
+	}{
+		{caller: "foo"},
+		{caller: "foo", limited: true},
+		{caller: "bar"},
+		{},
+		{},
+		// The caller from the baseplate headers takes precedence over User-Agent.
+		{caller: "baz", bpCaller: "qux"},
+		{caller: "other", bpCaller: "qux", limited: true},
+	} {
+		ctx := context.Background()
+		if c.caller != "" {
+			ctx = thrift.SetHeader(ctx, transport.HeaderUserAgent, c.caller)
+		}
+		if c.bpCaller != "" {
+			headers := headerbp.NewIncomingHeaders()
+			headers.RecordHeader(ratelimitbp.CallerHeader, c.bpCaller)
+			ctx = headers.SetOnContext(ctx)
+		}
+		in := thrift.NewTBinaryProtocolConf(thrift.NewTMemoryBuffer(), nil)
+		if err := baseplatethrift.NewBaseplateServiceV2IsHealthyArgs().Write(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+		if err := in.WriteMessageEnd(ctx); err != nil {
+			t.Fatal(err)
+		}
+		out := thrift.NewTBinaryProtocolConf(thrift.NewTMemoryBuffer(), nil)
+		_, err := process.Process(ctx, 1, in, out)
+		if got := err != nil; got != c.limited {
+			t.Errorf("%q: expected limited %v, got error %v", c.caller, c.limited, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package thrifttest
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
@@ -56,9 +57,21 @@ const (
 // ServerConfig can be used to pass in custom configuration options for the
 // server and/or client created by NewBaseplateServer.
 type ServerConfig struct {
-	// Required, the processor to handle endpoints.
+	// Required (unless MultiplexedProcessors is set), the processor to handle
+	// endpoints.
+	//
+	// When MultiplexedProcessors is also set, this is the default processor
+	// handling the requests without multiplexed service names, and can be nil.
 	Processor thrift.TProcessor
 
+	// Optional, the additional processors to serve via
+	// thrift.TMultiplexedProcessor, keyed by their multiplexed service names.
+	//
+	// Use Server.NewMultiplexedClientPool to create ClientPools for them.
+	//
+	// See thriftbp.ServerConfig.MultiplexedProcessors for more details.
+	MultiplexedProcessors map[string]thrift.TProcessor
+
 	// Required, the secret store.
 	SecretStore *secrets.Store
 
@@ -100,7 +113,37 @@ type Server struct {
 
 	// ClientPool provides a thriftbp.ClientPool that connects to this Server and
 	// can be used for making Thrift client objects to interact with this Server.
+	//
+	// When the Server has MultiplexedProcessors, ClientPool connects to the
+	// default processor, unless ClientConfig.MultiplexedServiceName is set.
 	ClientPool thriftbp.ClientPool
+
+	clientConfig      thriftbp.ClientPoolConfig
+	clientMiddlewares []thrift.ClientMiddleware
+
+	lock             sync.Mutex
+	multiplexedPools []thriftbp.ClientPool
+}
+
+// NewMultiplexedClientPool returns a new thriftbp.ClientPool connecting to the
+// multiplexed service of the given name on this Server, with the same
+// configuration as ClientPool, except that "-${service}" is appended to the
+// ServiceSlug.
+//
+// The returned ClientPool is closed when the Server is closed.
+func (s *Server) NewMultiplexedClientPool(service string) (thriftbp.ClientPool, error) {
+	cfg := s.clientConfig
+	cfg.ServiceSlug += "-" + service
+	cfg.MultiplexedServiceName = service
+	pool, err := thriftbp.NewBaseplateClientPool(cfg, s.clientMiddlewares...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.multiplexedPools = append(s.multiplexedPools, pool)
+	return pool, nil
 }
 
 // Start starts the server using baseplate.Serve in a background goroutine and
@@ -121,6 +164,11 @@ func (s *Server) Close() error {
 	if s.ClientPool != nil {
 		closers.Add(s.ClientPool)
 	}
+	s.lock.Lock()
+	for _, pool := range s.multiplexedPools {
+		closers.Add(pool)
+	}
+	s.lock.Unlock()
 	closers.Add(s.Server, s.Baseplate())
 	return closers.Close()
 }
@@ -150,17 +198,30 @@ func NewBaseplateServer(cfg ServerConfig) (*Server, error) {
 		Store:           cfg.SecretStore,
 		EdgeContextImpl: cfg.EdgeContextImpl,
 	})
-	middlewares := thriftbp.BaseplateDefaultProcessorMiddlewares(
-		thriftbp.DefaultProcessorMiddlewaresArgs{
-			EdgeContextImpl:     bp.EdgeContextImpl(),
-			ErrorSpanSuppressor: cfg.ErrorSpanSuppressor,
-		},
-	)
-	middlewares = append(middlewares, cfg.ProcessorMiddlewares...)
+	middlewares := func(serviceName string) []thrift.ProcessorMiddleware {
+		middlewares := thriftbp.BaseplateDefaultProcessorMiddlewares(
+			thriftbp.DefaultProcessorMiddlewaresArgs{
+				EdgeContextImpl:     bp.EdgeContextImpl(),
+				ErrorSpanSuppressor: cfg.ErrorSpanSuppressor,
+				ServiceName:         serviceName,
+			},
+		)
+		return append(middlewares, cfg.ProcessorMiddlewares...)
+	}
 	serverCfg := thriftbp.ServerConfig{
-		Socket:      socket,
-		Processor:   cfg.Processor,
-		Middlewares: middlewares,
+		Socket: socket,
+	}
+	if len(cfg.MultiplexedProcessors) > 0 {
+		serverCfg.Processor = thriftbp.NewMultiplexedProcessor(
+			cfg.Processor,
+			cfg.MultiplexedProcessors,
+			func(processor thrift.TProcessor) []thrift.ProcessorMiddleware {
+				return middlewares(thriftbp.GetThriftServiceName(processor))
+			},
+		)
+	} else {
+		serverCfg.Processor = cfg.Processor
+		serverCfg.Middlewares = middlewares("")
 	}
 
 	srv, err := thriftbp.NewServer(serverCfg)
@@ -193,5 +254,7 @@ func NewBaseplateServer(cfg ServerConfig) (*Server, error) {
 		return nil, err
 	}
 	server.ClientPool = pool
+	server.clientConfig = cfg.ClientConfig
+	server.clientMiddlewares = cfg.ClientMiddlewares
 	return server, nil
 }
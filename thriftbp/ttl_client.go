@@ -29,6 +29,11 @@ type ttlClientState struct {
 	expiration time.Time // if expiration is zero, then the client will be kept open indefinetly.
 	timer      *time.Timer
 	closed     bool
+	lastUsed   time.Time
+	probeTimer *time.Timer // only set when health probing is enabled.
+	// probing is only set while a health probe is using the connection, and
+	// is closed when the probe finishes.
+	probing chan struct{}
 }
 
 // renew updates expiration and timer in s base on the given timestamp and
@@ -48,6 +53,9 @@ type ttlClient struct {
 	ttl       time.Duration
 	slug      string
 
+	// configs needed for health probing to work, only set by startProbing
+	probe ttlClientProbe
+
 	// state guarded by lock (buffer-1 channel)
 	state chan *ttlClientState
 }
@@ -64,11 +72,25 @@ func (c *ttlClient) Close() error {
 	if state.timer != nil {
 		state.timer.Stop()
 	}
+	if state.probeTimer != nil {
+		state.probeTimer.Stop()
+	}
 	return state.transport.Close()
 }
 
 func (c *ttlClient) Call(ctx context.Context, method string, args, result thrift.TStruct) (_ thrift.ResponseMeta, err error) {
 	state := <-c.state
+	for state.probing != nil {
+		// The connection is being probed, wait for the probe to finish.
+		probing := state.probing
+		c.state <- state
+		select {
+		case <-probing:
+		case <-ctx.Done():
+			return thrift.ResponseMeta{}, ctx.Err()
+		}
+		state = <-c.state
+	}
 	defer func() {
 		c.state <- state
 	}()
@@ -83,7 +105,14 @@ func (c *ttlClient) Call(ctx context.Context, method string, args, result thrift
 		clientPayloadSizeRequestBytes.With(labels).Observe(float64(written))
 		clientPayloadSizeResponseBytes.With(labels).Observe(float64(read))
 	}()
-	return state.client.Call(ctx, method, args, result)
+	meta, err := state.client.Call(ctx, method, args, result)
+	state.lastUsed = time.Now()
+	if meta.Headers[HeaderConnection] == HeaderConnectionClose {
+		// The server is closing the connection after this response,
+		// close it so it's replaced by the pool upon next use.
+		state.transport.Close()
+	}
+	return meta, err
 }
 
 // IsOpen implements Client interface.
@@ -92,11 +121,17 @@ func (c *ttlClient) Call(ctx context.Context, method string, args, result thrift
 // if that returns false, it returns false.
 // Otherwise it checks TTL,
 // returns false if TTL has passed and also close the underlying TTransport.
+//
+// It also returns false when the connection is being probed, so the pool
+// replaces it instead of waiting for the probe.
 func (c *ttlClient) IsOpen() bool {
 	state := <-c.state
 	defer func() {
 		c.state <- state
 	}()
+	if state.probing != nil {
+		return false
+	}
 	if !state.transport.IsOpen() {
 		return false
 	}
@@ -145,6 +180,112 @@ func (c *ttlClient) refresh() {
 	}).Inc()
 }
 
+// ttlClientProbe defines the health probing of a ttlClient.
+type ttlClientProbe struct {
+	probe    HealthProbe
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// startProbing starts probing the health of the connection in the background
+// with the given probe.
+//
+// It must be called before c is shared with other goroutines.
+func (c *ttlClient) startProbing(probe ttlClientProbe) {
+	state := <-c.state
+	defer func() {
+		c.state <- state
+	}()
+	c.probe = probe
+	state.probeTimer = time.AfterFunc(probe.interval, c.probeHealth)
+
+	// Register the counters so they can be monitored
+	for _, success := range []bool{true, false} {
+		labels := prometheus.Labels{
+			"thrift_pool": c.slug,
+			successLabel:  prometheusbp.BoolString(success),
+		}
+		clientPoolHealthProbesCounter.With(labels)
+		clientPoolReplacedConnectionsCounter.With(labels)
+	}
+}
+
+// probeHealth is called by the probe timer to probe the connection if it's
+// idle, and replace it if the probe fails.
+//
+// The state lock is not held during the probe, so the callers are not blocked
+// by it (see IsOpen and Call).
+func (c *ttlClient) probeHealth() {
+	state := <-c.state
+	if state.closed {
+		c.state <- state
+		return
+	}
+	if time.Since(state.lastUsed) < c.probe.interval {
+		// The connection was used recently (including by a call we just waited
+		// for), which is as good as a probe.
+		state.probeTimer.Reset(c.probe.interval)
+		c.state <- state
+		return
+	}
+	probing := make(chan struct{})
+	state.probing = probing
+	client, transport := state.client, state.transport
+	c.state <- state
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.probe.timeout)
+	defer cancel()
+	err := c.probe.probe(ctx, client)
+	// The payload of the probes are not reported as the client payload size.
+	transport.getBytesAndReset()
+
+	state = <-c.state
+	defer func() {
+		c.state <- state
+	}()
+	state.probing = nil
+	close(probing)
+	if state.closed {
+		// Closed during the probe, most likely by the pool that found it being
+		// probed.
+		return
+	}
+	defer state.probeTimer.Reset(c.probe.interval)
+
+	state.lastUsed = time.Now()
+	clientPoolHealthProbesCounter.With(prometheus.Labels{
+		"thrift_pool": c.slug,
+		successLabel:  prometheusbp.BoolString(err == nil),
+	}).Inc()
+	if err == nil || state.transport != transport {
+		// Either healthy, or already replaced by refresh during the probe.
+		return
+	}
+
+	client, transport, err = c.generator()
+	if err != nil {
+		// We cannot replace this connection in the background,
+		// close it so it will be replaced by the pool upon next use.
+		state.transport.Close()
+		clientPoolReplacedConnectionsCounter.With(prometheus.Labels{
+			"thrift_pool": c.slug,
+			successLabel:  prometheusbp.BoolString(false),
+		}).Inc()
+		return
+	}
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	state.renew(time.Now(), c)
+	state.client = client
+	state.transport.Close()
+	state.transport = transport
+	clientPoolReplacedConnectionsCounter.With(prometheus.Labels{
+		"thrift_pool": c.slug,
+		successLabel:  prometheusbp.BoolString(true),
+	}).Inc()
+}
+
 // newTTLClient creates a ttlClient with a thrift TTransport and ttl+jitter.
 func newTTLClient(generator ttlClientGenerator, ttl time.Duration, jitter float64, slug string) (*ttlClient, error) {
 	client, transport, err := generator()
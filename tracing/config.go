@@ -26,6 +26,25 @@ type Config struct {
 	// headers from the client.
 	SampleRate float64 `yaml:"sampleRate"`
 
+	// SamplingRules overrides SampleRate for matching operations (span names).
+	//
+	// The first matching rule is used.
+	// Similar to SampleRate,
+	// they only affect top level spans created inside this service.
+	SamplingRules []SamplingRule `yaml:"samplingRules"`
+
+	// Sampler, if non-nil, makes the sampling decisions for top level spans
+	// created inside this service, and SampleRate and SamplingRules will be
+	// ignored.
+	Sampler Sampler `yaml:"-"`
+
+	// TailSampling configures sampling of the traces rooted in this service
+	// that were not sampled by SampleRate/SamplingRules/Sampler,
+	// based on their outcome (errors and latency).
+	//
+	// See TailSamplingConfig for more details.
+	TailSampling TailSamplingConfig `yaml:"tailSampling"`
+
 	// Logger, if non-nil, will be used to log additional informations Record
 	// returned certain errors.
 	Logger log.Wrapper `yaml:"logger"`
@@ -46,8 +65,12 @@ type Config struct {
 	//
 	// QueueName should not contain "traces-" prefix, it will be auto added.
 	//
-	// If QueueName is empty, no spans will be sampled,
+	// If QueueName, ZipkinHTTP.Endpoint, OTLPHTTP.Endpoint are all empty and
+	// Recorder is nil, no spans will be sampled,
 	// including the ones with debug flag set.
+	//
+	// At most one of QueueName, ZipkinHTTP.Endpoint, OTLPHTTP.Endpoint and
+	// Recorder can be set.
 	QueueName string `yaml:"queueName"`
 
 	// The max size of the message queue (number of messages).
@@ -65,11 +88,35 @@ type Config struct {
 	// can handle hex trace ids (Baseplate.go v0.8.0+ or Baseplate.py v2.0.0+).
 	UseHex bool `yaml:"useHex"`
 
+	// When ZipkinHTTP.Endpoint is non-empty,
+	// sampled spans will be sent in batches directly to a Zipkin compatible
+	// collector in Zipkin v2 json format, without going through the sidecar.
+	//
+	// See NewZipkinHTTPRecorder for more details.
+	ZipkinHTTP HTTPRecorderConfig `yaml:"zipkinHTTP"`
+
+	// When OTLPHTTP.Endpoint is non-empty,
+	// sampled spans will be sent in batches directly to an OpenTelemetry
+	// collector using OTLP/HTTP, without going through the sidecar.
+	//
+	// Namespace will be used as the service.name resource attribute.
+	//
+	// See NewOTLPHTTPRecorder for more details.
+	OTLPHTTP HTTPRecorderConfig `yaml:"otlpHTTP"`
+
+	// Recorder, if non-nil, will be used to record the sampled spans,
+	// for example a custom SpanRecorder implementation.
+	//
+	// The tracer takes the ownership of Recorder,
+	// and closes it when the tracer is closed.
+	Recorder SpanRecorder `yaml:"-"`
+
 	// In test code,
 	// this field can be used to set the message queue the tracer publishes to,
 	// usually an *mqsend.MockMessageQueue.
 	//
-	// This field will be ignored when QueueName is non-empty,
+	// This field will be ignored when any of QueueName, ZipkinHTTP.Endpoint,
+	// OTLPHTTP.Endpoint and Recorder is set,
 	// to help avoiding footgun prod code.
 	//
 	// DO NOT USE IN PROD CODE.
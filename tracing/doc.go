@@ -11,4 +11,16 @@
 // importing this package will call opentracing.SetGlobalTracer automatically
 // with a Tracer implementation that does not send spans anywhere.
 // Call InitGlobalTracer early in your main function to setup spans sampling.
+//
+// Sampled spans are recorded through a SpanRecorder.
+// By default they are sent to the Baseplate.py tracing publishing sidecar via
+// a POSIX message queue (Config.QueueName),
+// but they can also be sent in batches directly to a Zipkin compatible
+// collector (Config.ZipkinHTTP) or an OpenTelemetry collector (Config.OTLPHTTP).
+//
+// Traces started inside this service are sampled by Config.SampleRate,
+// which can be overridden per operation by Config.SamplingRules,
+// or replaced completely by a custom Sampler (Config.Sampler).
+// Config.TailSampling can additionally keep the traces that were not sampled
+// but ended up with errors or being slow.
 package tracing
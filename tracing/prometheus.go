@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/reddit/baseplate.go/internal/prometheusbpint"
+)
+
+const (
+	recorderLabel = "tracing_recorder"
+	reasonLabel   = "tracing_reason"
+	sampledLabel  = "tracing_sampled"
+	stageLabel    = "tracing_sampling_stage"
+)
+
+// Values for stageLabel.
+const (
+	samplingStageHead = "head"
+	samplingStageTail = "tail"
+)
+
+// Values for reasonLabel.
+const (
+	dropReasonBufferFull  = "buffer_full"
+	dropReasonTooLarge    = "too_large"
+	dropReasonTimedOut    = "timed_out"
+	dropReasonSendFailure = "send_failure"
+	dropReasonClosed      = "closed"
+)
+
+var (
+	recordedSpansTotal = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "tracing_recorder_spans_recorded_total",
+		Help: "Total number of spans successfully handed to the tracing backend",
+	}, []string{recorderLabel})
+
+	droppedSpansTotal = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "tracing_recorder_spans_dropped_total",
+		Help: "Total number of sampled spans dropped before reaching the tracing backend",
+	}, []string{recorderLabel, reasonLabel})
+
+	bufferedSpans = promauto.With(prometheusbpint.GlobalRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tracing_recorder_buffered_spans",
+		Help: "Number of spans currently buffered waiting to be sent to the tracing backend",
+	}, []string{recorderLabel})
+
+	samplerSpansTotal = promauto.With(prometheusbpint.GlobalRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "tracing_sampler_spans_total",
+		Help: "Total number of stopped spans by their sampling decision",
+	}, []string{sampledLabel, stageLabel})
+)
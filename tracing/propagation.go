@@ -0,0 +1,391 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// HeaderCarrier is the interface used by Propagators to read and write the
+// tracing headers of a request.
+//
+// http.Header implements this interface.
+// gRPC metadata can be adapted to it by grpcbp.
+type HeaderCarrier interface {
+	// Get returns the first value associated with key,
+	// or empty string if there's no value associated with key.
+	Get(key string) string
+
+	// Set sets the value associated with key, replacing any existing values.
+	Set(key, value string)
+}
+
+// Propagator extracts the trace context from the headers of an incoming
+// request, and injects the trace context of a span into the headers of an
+// outgoing request, in a specific header format.
+type Propagator interface {
+	// Extract reads the trace context from carrier.
+	//
+	// ok should be false when none of the headers of the format is present,
+	// so other Propagators can be tried instead.
+	Extract(carrier HeaderCarrier) (headers Headers, ok bool)
+
+	// Inject writes the trace context of span into carrier,
+	// with span being the parent of the outgoing request.
+	Inject(span *Span, carrier HeaderCarrier)
+}
+
+// Propagators is a list of Propagators that implements Propagator itself.
+//
+// Extract returns the result of the first Propagator in the list that
+// succeeds, and Inject writes the headers of every Propagator in the list.
+type Propagators []Propagator
+
+var _ Propagator = Propagators(nil)
+
+// Extract implements Propagator.
+func (ps Propagators) Extract(carrier HeaderCarrier) (Headers, bool) {
+	for _, p := range ps {
+		if headers, ok := p.Extract(carrier); ok {
+			return headers, true
+		}
+	}
+	return Headers{}, false
+}
+
+// Inject implements Propagator.
+func (ps Propagators) Inject(span *Span, carrier HeaderCarrier) {
+	for _, p := range ps {
+		p.Inject(span, carrier)
+	}
+}
+
+// PropagationFormat is the name of a supported tracing header format.
+//
+// Can be deserialized from YAML.
+type PropagationFormat string
+
+// PropagationFormat values.
+const (
+	// PropagationFormatBaseplate is the Baseplate headers used by all
+	// Baseplate services (X-Trace, X-Span, X-Parent, X-Sampled, X-Flags for
+	// HTTP, Trace, Span, Parent, Sampled, Flags for thrift and gRPC).
+	PropagationFormatBaseplate PropagationFormat = "baseplate"
+
+	// PropagationFormatW3C is the W3C Trace Context headers
+	// (traceparent and tracestate).
+	PropagationFormatW3C PropagationFormat = "w3c"
+
+	// PropagationFormatB3 is the B3 single header (b3).
+	//
+	// When extracting, the B3 multi headers are also accepted.
+	PropagationFormatB3 PropagationFormat = "b3"
+
+	// PropagationFormatB3Multi is the B3 multi headers
+	// (X-B3-TraceId, X-B3-SpanId, X-B3-ParentSpanId, X-B3-Sampled, X-B3-Flags).
+	//
+	// When extracting, the B3 single header is also accepted.
+	PropagationFormatB3Multi PropagationFormat = "b3multi"
+)
+
+// NewPropagators creates Propagators from the list of format names,
+// for example read from the configuration of the service.
+//
+// The Baseplate headers are different between transports,
+// so the caller should pass in the transport's implementation as baseplate,
+// which will be used for PropagationFormatBaseplate.
+//
+// If formats is empty, Propagators with only baseplate will be returned.
+func NewPropagators(baseplate Propagator, formats ...PropagationFormat) (Propagators, error) {
+	if len(formats) == 0 {
+		return Propagators{baseplate}, nil
+	}
+	ps := make(Propagators, 0, len(formats))
+	for _, f := range formats {
+		switch f {
+		case PropagationFormatBaseplate:
+			ps = append(ps, baseplate)
+		case PropagationFormatW3C:
+			ps = append(ps, W3CPropagator{})
+		case PropagationFormatB3:
+			ps = append(ps, B3Propagator{SingleHeader: true})
+		case PropagationFormatB3Multi:
+			ps = append(ps, B3Propagator{})
+		default:
+			return nil, fmt.Errorf("tracing.NewPropagators: unknown propagation format %q", f)
+		}
+	}
+	return ps, nil
+}
+
+// W3C Trace Context headers.
+//
+// Reference: https://www.w3.org/TR/trace-context/
+const (
+	W3CTraceParentHeader = "traceparent"
+	W3CTraceStateHeader  = "tracestate"
+)
+
+const (
+	w3cVersion        = "00"
+	w3cInvalidVersion = "ff"
+	w3cFlagSampled    = 0x01
+
+	// The max length of tracestate header we propagate.
+	w3cMaxTraceStateLength = 512
+)
+
+// W3CPropagator is a Propagator for W3C Trace Context headers.
+//
+// W3C Trace Context requires 128-bit trace ids and 64-bit span ids in hex.
+// Incoming ids are kept as-is, so they will be the same in the spans we
+// record.
+// When injecting, 64-bit ids are left padded with zeros,
+// and ids that are not in hex (e.g. the decimal ids generated when
+// Config.UseHex is false) are converted in the same way the Zipkin and OTLP
+// recorders convert them.
+//
+// The tracestate header is propagated as-is to the child spans and outgoing
+// requests.
+type W3CPropagator struct{}
+
+var _ Propagator = W3CPropagator{}
+
+// Extract implements Propagator.
+func (W3CPropagator) Extract(carrier HeaderCarrier) (Headers, bool) {
+	traceparent := strings.TrimSpace(carrier.Get(W3CTraceParentHeader))
+	if traceparent == "" {
+		return Headers{}, false
+	}
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 ||
+		len(parts[0]) != 2 ||
+		parts[0] == w3cInvalidVersion ||
+		(parts[0] == w3cVersion && len(parts) != 4) ||
+		!isNonZeroHex(parts[1], 32) ||
+		!isNonZeroHex(parts[2], 16) ||
+		len(parts[3]) != 2 {
+
+		logMalformedHeader(W3CTraceParentHeader, traceparent)
+		return Headers{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		logMalformedHeader(W3CTraceParentHeader, traceparent)
+		return Headers{}, false
+	}
+
+	sampled := flags[0]&w3cFlagSampled != 0
+	headers := Headers{
+		TraceID: strings.ToLower(parts[1]),
+		SpanID:  strings.ToLower(parts[2]),
+		Sampled: &sampled,
+	}
+	if state := carrier.Get(W3CTraceStateHeader); len(state) <= w3cMaxTraceStateLength {
+		headers.TraceState = state
+	}
+	return headers, true
+}
+
+// Inject implements Propagator.
+func (W3CPropagator) Inject(span *Span, carrier HeaderCarrier) {
+	var flags byte
+	if span.Sampled() || span.trace.isDebugSet() {
+		flags |= w3cFlagSampled
+	}
+	carrier.Set(W3CTraceParentHeader, fmt.Sprintf(
+		"%s-%s-%s-%02x",
+		w3cVersion,
+		hexTraceID128(span.TraceID()),
+		hexSpanID(span.ID()),
+		flags,
+	))
+	if state := span.TraceState(); state != "" {
+		carrier.Set(W3CTraceStateHeader, state)
+	}
+}
+
+// B3 headers.
+//
+// Reference: https://github.com/openzipkin/b3-propagation
+const (
+	B3SingleHeader       = "b3"
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+	B3FlagsHeader        = "X-B3-Flags"
+)
+
+const (
+	b3SampledTrue  = "1"
+	b3SampledFalse = "0"
+	b3Debug        = "d"
+)
+
+// B3Propagator is a Propagator for B3 headers.
+//
+// When extracting, both the single header and the multi headers are accepted,
+// with the single header taking precedence.
+// When injecting, SingleHeader controls which one is written.
+//
+// Both 64-bit and 128-bit trace ids are supported.
+// The B3 debug flag is mapped to FlagMaskDebug.
+type B3Propagator struct {
+	// If true, Inject writes the single b3 header instead of the multi
+	// X-B3-* headers.
+	SingleHeader bool
+}
+
+var _ Propagator = B3Propagator{}
+
+// Extract implements Propagator.
+func (B3Propagator) Extract(carrier HeaderCarrier) (Headers, bool) {
+	if single := strings.TrimSpace(carrier.Get(B3SingleHeader)); single != "" {
+		return extractB3Single(single)
+	}
+	return extractB3Multi(carrier)
+}
+
+func extractB3Single(value string) (Headers, bool) {
+	var headers Headers
+	parts := strings.Split(value, "-")
+	if len(parts) == 1 {
+		// Sampling decision only.
+		if !setB3Sampling(&headers, parts[0]) {
+			logMalformedHeader(B3SingleHeader, value)
+			return Headers{}, false
+		}
+		return headers, true
+	}
+
+	if len(parts) > 4 || !isB3TraceID(parts[0]) || !isNonZeroHex(parts[1], 16) {
+		logMalformedHeader(B3SingleHeader, value)
+		return Headers{}, false
+	}
+	headers.TraceID = strings.ToLower(parts[0])
+	headers.SpanID = strings.ToLower(parts[1])
+	if len(parts) > 2 && !setB3Sampling(&headers, parts[2]) {
+		logMalformedHeader(B3SingleHeader, value)
+		return Headers{}, false
+	}
+	// The optional 4th part is the parent of the caller span, which we don't
+	// need.
+	return headers, true
+}
+
+func extractB3Multi(carrier HeaderCarrier) (Headers, bool) {
+	var headers Headers
+	traceID := carrier.Get(B3TraceIDHeader)
+	spanID := carrier.Get(B3SpanIDHeader)
+	sampled := carrier.Get(B3SampledHeader)
+	flags := carrier.Get(B3FlagsHeader)
+	if traceID == "" && spanID == "" && sampled == "" && flags == "" {
+		return headers, false
+	}
+
+	if traceID != "" || spanID != "" {
+		if !isB3TraceID(traceID) || !isNonZeroHex(spanID, 16) {
+			logMalformedHeader(B3TraceIDHeader, traceID+"/"+spanID)
+			return Headers{}, false
+		}
+		headers.TraceID = strings.ToLower(traceID)
+		headers.SpanID = strings.ToLower(spanID)
+	}
+	if flags == b3SampledTrue {
+		setB3Sampling(&headers, b3Debug)
+	} else if sampled != "" {
+		switch strings.ToLower(sampled) {
+		case "true":
+			sampled = b3SampledTrue
+		case "false":
+			sampled = b3SampledFalse
+		}
+		if !setB3Sampling(&headers, sampled) {
+			logMalformedHeader(B3SampledHeader, sampled)
+		}
+	}
+	return headers, true
+}
+
+func setB3Sampling(headers *Headers, value string) bool {
+	var sampled bool
+	switch value {
+	default:
+		return false
+	case b3SampledFalse:
+	case b3SampledTrue:
+		sampled = true
+	case b3Debug:
+		sampled = true
+		headers.Flags = fmt.Sprint(FlagMaskDebug)
+	}
+	headers.Sampled = &sampled
+	return true
+}
+
+// Inject implements Propagator.
+func (p B3Propagator) Inject(span *Span, carrier HeaderCarrier) {
+	traceID := hexTraceID(span.TraceID())
+	spanID := hexSpanID(span.ID())
+	var parentID string
+	if span.ParentID() != "" {
+		parentID = hexSpanID(span.ParentID())
+	}
+	sampling := b3SampledFalse
+	if span.trace.isDebugSet() {
+		sampling = b3Debug
+	} else if span.Sampled() {
+		sampling = b3SampledTrue
+	}
+
+	if p.SingleHeader {
+		value := traceID + "-" + spanID + "-" + sampling
+		if parentID != "" {
+			value += "-" + parentID
+		}
+		carrier.Set(B3SingleHeader, value)
+		return
+	}
+
+	carrier.Set(B3TraceIDHeader, traceID)
+	carrier.Set(B3SpanIDHeader, spanID)
+	if parentID != "" {
+		carrier.Set(B3ParentSpanIDHeader, parentID)
+	}
+	if sampling == b3Debug {
+		// Debug implies sampled, and the spec says X-B3-Sampled should not be
+		// sent along with it.
+		carrier.Set(B3FlagsHeader, b3SampledTrue)
+	} else {
+		carrier.Set(B3SampledHeader, sampling)
+	}
+}
+
+func isB3TraceID(id string) bool {
+	return isNonZeroHex(id, 16) || isNonZeroHex(id, 32)
+}
+
+// isNonZeroHex returns true if s is a hex string of the given length and not
+// all zeros.
+func isNonZeroHex(s string, length int) bool {
+	return len(s) == length && isHex(s) && strings.Trim(s, "0") != ""
+}
+
+// hexTraceID128 converts a trace id into 32 digits lowercase hex.
+func hexTraceID128(id string) string {
+	h := hexTraceID(id)
+	if len(h) == 16 {
+		h = "0000000000000000" + h
+	}
+	return h
+}
+
+func logMalformedHeader(name, value string) {
+	globalTracer.logger.Log(context.Background(), fmt.Sprintf(
+		"Malformed %s header: %q",
+		name,
+		value,
+	))
+}
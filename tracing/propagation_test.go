@@ -0,0 +1,305 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+
+	"github.com/reddit/baseplate.go/tracing"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestPropagatorExtract(t *testing.T) {
+	for _, c := range []struct {
+		label      string
+		propagator tracing.Propagator
+		headers    map[string]string
+		expected   tracing.Headers
+		ok         bool
+	}{
+		{
+			label:      "w3c/none",
+			propagator: tracing.W3CPropagator{},
+		},
+		{
+			label:      "w3c/sampled",
+			propagator: tracing.W3CPropagator{},
+			headers: map[string]string{
+				"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+				"tracestate":  "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE",
+			},
+			expected: tracing.Headers{
+				TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+				SpanID:     "00f067aa0ba902b7",
+				Sampled:    boolPtr(true),
+				TraceState: "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE",
+			},
+			ok: true,
+		},
+		{
+			label:      "w3c/not-sampled",
+			propagator: tracing.W3CPropagator{},
+			headers: map[string]string{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			},
+			expected: tracing.Headers{
+				TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				SpanID:  "00f067aa0ba902b7",
+				Sampled: boolPtr(false),
+			},
+			ok: true,
+		},
+		{
+			label:      "w3c/zero-trace-id",
+			propagator: tracing.W3CPropagator{},
+			headers: map[string]string{
+				"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			},
+		},
+		{
+			label:      "w3c/invalid-version",
+			propagator: tracing.W3CPropagator{},
+			headers: map[string]string{
+				"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+		},
+		{
+			label:      "w3c/64-bit",
+			propagator: tracing.W3CPropagator{},
+			headers: map[string]string{
+				"traceparent": "00-a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+		},
+		{
+			label:      "b3/single",
+			propagator: tracing.B3Propagator{},
+			headers: map[string]string{
+				"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90",
+			},
+			expected: tracing.Headers{
+				TraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+				SpanID:  "e457b5a2e4d86bd1",
+				Sampled: boolPtr(true),
+			},
+			ok: true,
+		},
+		{
+			label:      "b3/single-debug",
+			propagator: tracing.B3Propagator{},
+			headers: map[string]string{
+				"b3": "64fe8b2a57d3eff7-e457b5a2e4d86bd1-d",
+			},
+			expected: tracing.Headers{
+				TraceID: "64fe8b2a57d3eff7",
+				SpanID:  "e457b5a2e4d86bd1",
+				Flags:   "1",
+				Sampled: boolPtr(true),
+			},
+			ok: true,
+		},
+		{
+			label:      "b3/single-deny",
+			propagator: tracing.B3Propagator{},
+			headers: map[string]string{
+				"b3": "0",
+			},
+			expected: tracing.Headers{
+				Sampled: boolPtr(false),
+			},
+			ok: true,
+		},
+		{
+			label:      "b3/multi",
+			propagator: tracing.B3Propagator{SingleHeader: true},
+			headers: map[string]string{
+				"X-B3-TraceId":      "463ac35c9f6413ad48485a3953bb6124",
+				"X-B3-SpanId":       "a2fb4a1d1a96d312",
+				"X-B3-ParentSpanId": "0020000000000001",
+				"X-B3-Sampled":      "true",
+			},
+			expected: tracing.Headers{
+				TraceID: "463ac35c9f6413ad48485a3953bb6124",
+				SpanID:  "a2fb4a1d1a96d312",
+				Sampled: boolPtr(true),
+			},
+			ok: true,
+		},
+		{
+			label:      "b3/multi-malformed",
+			propagator: tracing.B3Propagator{},
+			headers: map[string]string{
+				"X-B3-TraceId": "not-hex",
+				"X-B3-SpanId":  "a2fb4a1d1a96d312",
+			},
+		},
+		{
+			label: "composite/first-wins",
+			propagator: tracing.Propagators{
+				tracing.B3Propagator{},
+				tracing.W3CPropagator{},
+			},
+			headers: map[string]string{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"b3":          "64fe8b2a57d3eff7-e457b5a2e4d86bd1-0",
+			},
+			expected: tracing.Headers{
+				TraceID: "64fe8b2a57d3eff7",
+				SpanID:  "e457b5a2e4d86bd1",
+				Sampled: boolPtr(false),
+			},
+			ok: true,
+		},
+		{
+			label: "composite/fallback",
+			propagator: tracing.Propagators{
+				tracing.B3Propagator{},
+				tracing.W3CPropagator{},
+			},
+			headers: map[string]string{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expected: tracing.Headers{
+				TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				SpanID:  "00f067aa0ba902b7",
+				Sampled: boolPtr(true),
+			},
+			ok: true,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			h := make(http.Header)
+			for k, v := range c.headers {
+				h.Set(k, v)
+			}
+			headers, ok := c.propagator.Extract(h)
+			if ok != c.ok {
+				t.Errorf("Expected ok %v, got %v", c.ok, ok)
+			}
+			if headers.TraceID != c.expected.TraceID ||
+				headers.SpanID != c.expected.SpanID ||
+				headers.Flags != c.expected.Flags ||
+				headers.TraceState != c.expected.TraceState {
+
+				t.Errorf("Expected headers %+v, got %+v", c.expected, headers)
+			}
+			expectedSampled, expectedSet := c.expected.ParseSampled()
+			sampled, set := headers.ParseSampled()
+			if expectedSampled != sampled || expectedSet != set {
+				t.Errorf("Expected sampled %v/%v, got %v/%v", expectedSampled, expectedSet, sampled, set)
+			}
+		})
+	}
+}
+
+func TestPropagatorInject(t *testing.T) {
+	ctx, server := tracing.StartSpanFromHeaders(
+		context.Background(),
+		"server",
+		tracing.Headers{
+			TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID:     "00f067aa0ba902b7",
+			Sampled:    boolPtr(true),
+			TraceState: "rojo=00f067aa0ba902b7",
+		},
+	)
+	child, _ := opentracing.StartSpanFromContext(
+		ctx,
+		"client",
+		tracing.SpanTypeOption{Type: tracing.SpanTypeClient},
+	)
+	span := tracing.AsSpan(child)
+
+	t.Run("w3c", func(t *testing.T) {
+		h := make(http.Header)
+		tracing.W3CPropagator{}.Inject(span, h)
+		const (
+			expectedPrefix = "00-4bf92f3577b34da6a3ce929d0e0e4736-"
+			expectedSuffix = "-01"
+		)
+		if got := h.Get("traceparent"); !strings.HasPrefix(got, expectedPrefix) || !strings.HasSuffix(got, expectedSuffix) {
+			t.Errorf("Expected traceparent %q<span-id>%q, got %q", expectedPrefix, expectedSuffix, got)
+		}
+		if got := h.Get("tracestate"); got != "rojo=00f067aa0ba902b7" {
+			t.Errorf("Expected tracestate to be propagated, got %q", got)
+		}
+
+		// Round trip.
+		headers, ok := tracing.W3CPropagator{}.Extract(h)
+		if !ok {
+			t.Fatalf("Failed to extract injected headers %v", h)
+		}
+		if headers.TraceID != server.TraceID() {
+			t.Errorf("Expected trace id %q, got %q", server.TraceID(), headers.TraceID)
+		}
+	})
+
+	t.Run("b3-single", func(t *testing.T) {
+		h := make(http.Header)
+		tracing.B3Propagator{SingleHeader: true}.Inject(span, h)
+		headers, ok := tracing.B3Propagator{}.Extract(h)
+		if !ok {
+			t.Fatalf("Failed to extract injected headers %v", h)
+		}
+		if headers.TraceID != server.TraceID() {
+			t.Errorf("Expected trace id %q, got %q", server.TraceID(), headers.TraceID)
+		}
+		if sampled, _ := headers.ParseSampled(); !sampled {
+			t.Errorf("Expected sampled, got %v", h)
+		}
+	})
+
+	t.Run("b3-multi", func(t *testing.T) {
+		h := make(http.Header)
+		tracing.B3Propagator{}.Inject(span, h)
+		if got := h.Get("X-B3-ParentSpanId"); got == "" {
+			t.Errorf("Expected X-B3-ParentSpanId to be set, got %v", h)
+		}
+		if got := h.Get("X-B3-Sampled"); got != "1" {
+			t.Errorf("Expected X-B3-Sampled to be 1, got %q", got)
+		}
+	})
+
+	t.Run("64-bit-dec", func(t *testing.T) {
+		_, span := tracing.StartSpanFromHeaders(
+			context.Background(),
+			"server",
+			tracing.Headers{
+				TraceID: "12345",
+				SpanID:  "67890",
+			},
+		)
+		h := make(http.Header)
+		tracing.W3CPropagator{}.Inject(span, h)
+		headers, ok := tracing.W3CPropagator{}.Extract(h)
+		if !ok {
+			t.Fatalf("Failed to extract injected headers %v", h)
+		}
+		const expected = "00000000000000000000000000003039"
+		if headers.TraceID != expected {
+			t.Errorf("Expected trace id %q, got %q", expected, headers.TraceID)
+		}
+	})
+}
+
+func TestNewPropagators(t *testing.T) {
+	if _, err := tracing.NewPropagators(tracing.W3CPropagator{}, "unknown"); err == nil {
+		t.Error("Expected error for unknown format, got nil")
+	}
+	ps, err := tracing.NewPropagators(
+		tracing.W3CPropagator{},
+		tracing.PropagationFormatBaseplate,
+		tracing.PropagationFormatB3,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 {
+		t.Errorf("Expected 2 propagators, got %#v", ps)
+	}
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/reddit/baseplate.go/log"
+	"github.com/reddit/baseplate.go/mqsend"
+)
+
+// SpanRecorder records sampled spans into a tracing backend.
+//
+// Tracer.Record calls Record for every sampled span after it's stopped,
+// and Tracer.Close calls Close, which should flush all the spans still
+// buffered before returning.
+//
+// Implementations must be safe to be used concurrently.
+type SpanRecorder interface {
+	// Record records a finished span.
+	//
+	// Implementations backed by a remote backend should not block on network
+	// calls here, but buffer the span and send it asynchronously instead.
+	Record(ctx context.Context, span ZipkinSpan) error
+
+	// Close flushes the buffered spans and releases the resources used by the
+	// recorder.
+	//
+	// After Close is called, all future Record calls will be dropped.
+	Close() error
+}
+
+// Names of the SpanRecorder implementations in this package,
+// used as the tracing_recorder label in metrics.
+const (
+	RecorderNameMessageQueue = "mqsend"
+	RecorderNameZipkinHTTP   = "zipkin_http"
+	RecorderNameOTLPHTTP     = "otlp_http"
+)
+
+// MessageQueueRecorder is a SpanRecorder implementation that sends each span
+// serialized in json into a POSIX message queue,
+// which requires the Baseplate.py tracing publishing sidecar to read from the
+// queue and forward the spans to the backend.
+//
+// The message queue itself works as the bounded buffer,
+// so there's no batching done in MessageQueueRecorder.
+type MessageQueueRecorder struct {
+	// The message queue to send spans to, required.
+	Queue mqsend.MessageQueue
+
+	// The max timeout applied to Record calls.
+	//
+	// If the passed in context object has an earlier deadline set,
+	// that deadline will be respected instead.
+	//
+	// If Timeout <= 0, Record would run in non-blocking mode,
+	// that it fails immediately if the queue is full.
+	Timeout time.Duration
+
+	// Logger, if non-nil, will be used to log additional information when the
+	// span is too large or the queue is full.
+	Logger log.Wrapper
+}
+
+var _ SpanRecorder = MessageQueueRecorder{}
+
+// Record implements SpanRecorder.
+func (r MessageQueueRecorder) Record(ctx context.Context, zs ZipkinSpan) error {
+	data, err := json.Marshal(zs)
+	if err != nil {
+		droppedSpansTotal.WithLabelValues(RecorderNameMessageQueue, dropReasonSendFailure).Inc()
+		return err
+	}
+
+	if ctx.Err() != nil {
+		// The request context is already canceled.
+		// Use background to make sure we are still able to send out the span,
+		ctx = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	err = r.Queue.Send(ctx, data)
+	switch {
+	case err == nil:
+		recordedSpansTotal.WithLabelValues(RecorderNameMessageQueue).Inc()
+	case errors.As(err, new(mqsend.MessageTooLargeError)):
+		droppedSpansTotal.WithLabelValues(RecorderNameMessageQueue, dropReasonTooLarge).Inc()
+		r.Logger.Log(ctx, fmt.Sprintf(
+			"Span is too big, max allowed size is %d. This can be caused by an excess amount of tags. Error: %v",
+			MaxSpanSize,
+			err,
+		))
+	case errors.As(err, new(mqsend.TimedOutError)):
+		droppedSpansTotal.WithLabelValues(RecorderNameMessageQueue, dropReasonTimedOut).Inc()
+		r.Logger.Log(
+			ctx,
+			"Trace queue is full. Is trace sidecar healthy? Error: "+err.Error(),
+		)
+	default:
+		droppedSpansTotal.WithLabelValues(RecorderNameMessageQueue, dropReasonSendFailure).Inc()
+	}
+	return err
+}
+
+// Close implements SpanRecorder by closing the underlying message queue.
+func (r MessageQueueRecorder) Close() error {
+	return r.Queue.Close()
+}
@@ -0,0 +1,367 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/reddit/baseplate.go/log"
+)
+
+// Default values for HTTPRecorderConfig.
+const (
+	DefaultHTTPRecorderBatchSize     = 100
+	DefaultHTTPRecorderBatchInterval = time.Second
+	DefaultHTTPRecorderMaxBufferSize = 10000
+	DefaultHTTPRecorderSendTimeout   = time.Second * 5
+	DefaultHTTPRecorderFlushTimeout  = time.Second * 5
+)
+
+// ErrRecorderClosed is the error returned by Record calls on a SpanRecorder
+// that's already closed.
+var ErrRecorderClosed = errors.New("tracing: span recorder is closed")
+
+// ErrRecorderBufferFull is the error returned by Record calls on an http
+// SpanRecorder when its buffer is full and the span is dropped.
+var ErrRecorderBufferFull = errors.New("tracing: span recorder buffer is full")
+
+// HTTPRecorderConfig is the configuration for the SpanRecorder
+// implementations sending batches of spans to a collector over HTTP.
+//
+// Can be deserialized from YAML.
+type HTTPRecorderConfig struct {
+	// The full URL of the collector endpoint, required.
+	//
+	// For Zipkin this is usually "http://host:9411/api/v2/spans",
+	// for OTLP/HTTP this is usually "http://host:4318/v1/traces".
+	Endpoint string `yaml:"endpoint"`
+
+	// Additional headers to be sent with every request to the collector,
+	// for example authentication headers.
+	Headers map[string]string `yaml:"headers"`
+
+	// The max number of spans to be sent in a single request.
+	//
+	// If it's <= 0, DefaultHTTPRecorderBatchSize will be used instead.
+	BatchSize int `yaml:"batchSize"`
+
+	// The max time a span will be buffered before being sent,
+	// if the batch was never filled.
+	//
+	// If it's <= 0, DefaultHTTPRecorderBatchInterval will be used instead.
+	BatchInterval time.Duration `yaml:"batchInterval"`
+
+	// The max number of spans that can be buffered.
+	//
+	// When the buffer is full, new spans will be dropped instead of blocking
+	// the caller, and the drop will be counted in the
+	// tracing_recorder_spans_dropped_total metric.
+	//
+	// If it's <= 0, DefaultHTTPRecorderMaxBufferSize will be used instead.
+	MaxBufferSize int `yaml:"maxBufferSize"`
+
+	// The timeout for a single request to the collector.
+	//
+	// If it's <= 0, DefaultHTTPRecorderSendTimeout will be used instead.
+	SendTimeout time.Duration `yaml:"sendTimeout"`
+
+	// The max time Close will wait for the buffered spans to be flushed.
+	//
+	// If it's <= 0, DefaultHTTPRecorderFlushTimeout will be used instead.
+	FlushTimeout time.Duration `yaml:"flushTimeout"`
+
+	// The http client used to send the requests.
+	//
+	// If it's nil, http.DefaultClient will be used instead.
+	Client *http.Client `yaml:"-"`
+
+	// Logger, if non-nil, will be used to log failed requests to the
+	// collector.
+	Logger log.Wrapper `yaml:"logger"`
+}
+
+func (cfg HTTPRecorderConfig) withDefaults() HTTPRecorderConfig {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultHTTPRecorderBatchSize
+	}
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = DefaultHTTPRecorderBatchInterval
+	}
+	if cfg.MaxBufferSize <= 0 {
+		cfg.MaxBufferSize = DefaultHTTPRecorderMaxBufferSize
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = DefaultHTTPRecorderSendTimeout
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = DefaultHTTPRecorderFlushTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return cfg
+}
+
+// batchEncoder encodes a batch of spans into the request body of the
+// collector's wire format.
+type batchEncoder interface {
+	contentType() string
+	encode(spans []ZipkinSpan) ([]byte, error)
+}
+
+// httpRecorder is the batching SpanRecorder implementation shared by the
+// Zipkin and OTLP recorders.
+type httpRecorder struct {
+	name    string
+	cfg     HTTPRecorderConfig
+	encoder batchEncoder
+
+	spans chan ZipkinSpan
+	flush chan chan struct{}
+
+	closeOnce sync.Once
+	closeLock sync.RWMutex
+	closed    bool
+	done      chan struct{}
+}
+
+func newHTTPRecorder(name string, cfg HTTPRecorderConfig, encoder batchEncoder) (*httpRecorder, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("tracing: HTTPRecorderConfig.Endpoint is required")
+	}
+	cfg = cfg.withDefaults()
+	r := &httpRecorder{
+		name:    name,
+		cfg:     cfg,
+		encoder: encoder,
+
+		spans: make(chan ZipkinSpan, cfg.MaxBufferSize),
+		flush: make(chan chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go r.loop()
+	return r, nil
+}
+
+// Record implements SpanRecorder.
+//
+// It never blocks.
+// When the buffer is full, the span is dropped and ErrRecorderBufferFull is
+// returned.
+func (r *httpRecorder) Record(_ context.Context, zs ZipkinSpan) error {
+	r.closeLock.RLock()
+	defer r.closeLock.RUnlock()
+	if r.closed {
+		droppedSpansTotal.WithLabelValues(r.name, dropReasonClosed).Inc()
+		return ErrRecorderClosed
+	}
+	select {
+	case r.spans <- zs:
+		bufferedSpans.WithLabelValues(r.name).Inc()
+		return nil
+	default:
+		droppedSpansTotal.WithLabelValues(r.name, dropReasonBufferFull).Inc()
+		return ErrRecorderBufferFull
+	}
+}
+
+// Flush sends all the currently buffered spans to the collector,
+// and blocks until it's done or ctx is done.
+func (r *httpRecorder) Flush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case r.flush <- ack:
+	case <-r.done:
+		return ErrRecorderClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close implements SpanRecorder.
+//
+// It stops accepting new spans, then flushes the buffered ones,
+// waiting up to FlushTimeout for that to finish.
+func (r *httpRecorder) Close() error {
+	r.closeOnce.Do(func() {
+		r.closeLock.Lock()
+		r.closed = true
+		close(r.spans)
+		r.closeLock.Unlock()
+	})
+	timer := time.NewTimer(r.cfg.FlushTimeout)
+	defer timer.Stop()
+	select {
+	case <-r.done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf(
+			"tracing: timed out after %v flushing %s span recorder",
+			r.cfg.FlushTimeout,
+			r.name,
+		)
+	}
+}
+
+func (r *httpRecorder) loop() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.BatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]ZipkinSpan, 0, r.cfg.BatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		r.send(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case zs, ok := <-r.spans:
+			if !ok {
+				send()
+				return
+			}
+			bufferedSpans.WithLabelValues(r.name).Dec()
+			batch = append(batch, zs)
+			if len(batch) >= r.cfg.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case ack := <-r.flush:
+			r.drain(&batch, send)
+			send()
+			close(ack)
+		}
+	}
+}
+
+// drain moves all the spans currently in the buffer into batch,
+// sending full batches along the way.
+func (r *httpRecorder) drain(batch *[]ZipkinSpan, send func()) {
+	for {
+		select {
+		case zs, ok := <-r.spans:
+			if !ok {
+				return
+			}
+			bufferedSpans.WithLabelValues(r.name).Dec()
+			*batch = append(*batch, zs)
+			if len(*batch) >= r.cfg.BatchSize {
+				send()
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (r *httpRecorder) send(batch []ZipkinSpan) {
+	if err := r.post(batch); err != nil {
+		droppedSpansTotal.WithLabelValues(r.name, dropReasonSendFailure).Add(float64(len(batch)))
+		r.cfg.Logger.Log(context.Background(), fmt.Sprintf(
+			"Failed to send %d spans to %s collector %q: %v",
+			len(batch),
+			r.name,
+			r.cfg.Endpoint,
+			err,
+		))
+		return
+	}
+	recordedSpansTotal.WithLabelValues(r.name).Add(float64(len(batch)))
+}
+
+func (r *httpRecorder) post(batch []ZipkinSpan) error {
+	body, err := r.encoder.encode(batch)
+	if err != nil {
+		return fmt.Errorf("encode spans: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.SendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", r.encoder.contentType())
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected http status %q", resp.Status)
+	}
+	return nil
+}
+
+// ZipkinHTTPRecorder is a SpanRecorder sending batches of spans to a Zipkin
+// compatible collector in Zipkin v2 json format over HTTP.
+//
+// Zipkin v2 requires hex trace and span ids.
+// Ids that are not already 16 or 32 digits hex (e.g. the decimal ids generated
+// when Config.UseHex is false) are converted to 16 digits hex,
+// so the parent-child relationships are preserved.
+type ZipkinHTTPRecorder struct {
+	*httpRecorder
+}
+
+var _ SpanRecorder = ZipkinHTTPRecorder{}
+
+// NewZipkinHTTPRecorder creates a new ZipkinHTTPRecorder.
+//
+// It starts a background goroutine sending the spans,
+// Close should be called to flush the buffered spans and stop it.
+func NewZipkinHTTPRecorder(cfg HTTPRecorderConfig) (ZipkinHTTPRecorder, error) {
+	r, err := newHTTPRecorder(RecorderNameZipkinHTTP, cfg, zipkinV2Encoder{})
+	if err != nil {
+		return ZipkinHTTPRecorder{}, err
+	}
+	return ZipkinHTTPRecorder{httpRecorder: r}, nil
+}
+
+// OTLPHTTPRecorder is a SpanRecorder sending batches of spans to an
+// OpenTelemetry collector using OTLP/HTTP in binary protobuf encoding.
+//
+// Trace and span ids are converted into the fixed size binary ids OTLP
+// requires, in the same way ZipkinHTTPRecorder converts them.
+type OTLPHTTPRecorder struct {
+	*httpRecorder
+}
+
+var _ SpanRecorder = OTLPHTTPRecorder{}
+
+// NewOTLPHTTPRecorder creates a new OTLPHTTPRecorder.
+//
+// serviceName will be reported as the service.name resource attribute.
+//
+// It starts a background goroutine sending the spans,
+// Close should be called to flush the buffered spans and stop it.
+func NewOTLPHTTPRecorder(serviceName string, cfg HTTPRecorderConfig) (OTLPHTTPRecorder, error) {
+	r, err := newHTTPRecorder(RecorderNameOTLPHTTP, cfg, otlpEncoder{serviceName: serviceName})
+	if err != nil {
+		return OTLPHTTPRecorder{}, err
+	}
+	return OTLPHTTPRecorder{httpRecorder: r}, nil
+}
@@ -0,0 +1,240 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpInstrumentationScope is the instrumentation scope name reported in OTLP
+// payloads.
+const otlpInstrumentationScope = "github.com/reddit/baseplate.go/tracing"
+
+// Field numbers and enum values from opentelemetry-proto,
+// opentelemetry/proto/collector/trace/v1/trace_service.proto and its
+// dependencies.
+//
+// We encode the messages by hand instead of depending on the generated code,
+// as the recorder only ever writes a small subset of the protocol.
+const (
+	// ExportTraceServiceRequest
+	otlpRequestResourceSpans protowire.Number = 1
+
+	// ResourceSpans
+	otlpResourceSpansResource   protowire.Number = 1
+	otlpResourceSpansScopeSpans protowire.Number = 2
+
+	// Resource
+	otlpResourceAttributes protowire.Number = 1
+
+	// ScopeSpans
+	otlpScopeSpansScope protowire.Number = 1
+	otlpScopeSpansSpans protowire.Number = 2
+
+	// InstrumentationScope
+	otlpScopeName protowire.Number = 1
+
+	// Span
+	otlpSpanTraceID      protowire.Number = 1
+	otlpSpanSpanID       protowire.Number = 2
+	otlpSpanParentSpanID protowire.Number = 4
+	otlpSpanName         protowire.Number = 5
+	otlpSpanKind         protowire.Number = 6
+	otlpSpanStartTime    protowire.Number = 7
+	otlpSpanEndTime      protowire.Number = 8
+	otlpSpanAttributes   protowire.Number = 9
+	otlpSpanEvents       protowire.Number = 11
+	otlpSpanStatus       protowire.Number = 15
+
+	// Span.Event
+	otlpEventTime protowire.Number = 1
+	otlpEventName protowire.Number = 2
+
+	// Status
+	otlpStatusCode protowire.Number = 3
+
+	// KeyValue
+	otlpKeyValueKey   protowire.Number = 1
+	otlpKeyValueValue protowire.Number = 2
+
+	// AnyValue
+	otlpAnyValueString protowire.Number = 1
+	otlpAnyValueBool   protowire.Number = 2
+	otlpAnyValueInt    protowire.Number = 3
+	otlpAnyValueDouble protowire.Number = 4
+)
+
+// OTLP Span.SpanKind and Status.StatusCode values.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindClient   = 3
+
+	otlpStatusCodeError = 2
+)
+
+// otlpServiceNameKey is the semantic convention resource attribute key for
+// the service name.
+const otlpServiceNameKey = "service.name"
+
+type otlpEncoder struct {
+	serviceName string
+}
+
+func (otlpEncoder) contentType() string {
+	return "application/x-protobuf"
+}
+
+// encode encodes spans into a single ExportTraceServiceRequest message.
+func (e otlpEncoder) encode(spans []ZipkinSpan) ([]byte, error) {
+	var scopeSpans []byte
+	scopeSpans = appendMessage(scopeSpans, otlpScopeSpansScope, func(b []byte) []byte {
+		return appendString(b, otlpScopeName, otlpInstrumentationScope)
+	})
+
+	serviceName := e.serviceName
+	for _, zs := range spans {
+		if serviceName == "" {
+			serviceName = spanServiceName(zs)
+		}
+		scopeSpans = appendMessage(scopeSpans, otlpScopeSpansSpans, func(b []byte) []byte {
+			return appendOTLPSpan(b, zs)
+		})
+	}
+
+	var resourceSpans []byte
+	resourceSpans = appendMessage(resourceSpans, otlpResourceSpansResource, func(b []byte) []byte {
+		return appendKeyValue(b, otlpResourceAttributes, otlpServiceNameKey, serviceName)
+	})
+	resourceSpans = protowire.AppendTag(resourceSpans, otlpResourceSpansScopeSpans, protowire.BytesType)
+	resourceSpans = protowire.AppendBytes(resourceSpans, scopeSpans)
+
+	var req []byte
+	req = protowire.AppendTag(req, otlpRequestResourceSpans, protowire.BytesType)
+	req = protowire.AppendBytes(req, resourceSpans)
+	return req, nil
+}
+
+func appendOTLPSpan(b []byte, zs ZipkinSpan) []byte {
+	b = appendRawBytes(b, otlpSpanTraceID, otlpTraceID(zs.TraceID))
+	b = appendRawBytes(b, otlpSpanSpanID, otlpSpanID(zs.SpanID))
+	if zs.ParentID != "" {
+		b = appendRawBytes(b, otlpSpanParentSpanID, otlpSpanID(zs.ParentID))
+	}
+	b = appendString(b, otlpSpanName, zs.Name)
+
+	kind := otlpSpanKindInternal
+	for _, ta := range zs.TimeAnnotations {
+		switch zipkinSpanKind(ta.Key) {
+		case zipkinKindServer:
+			kind = otlpSpanKindServer
+		case zipkinKindClient:
+			kind = otlpSpanKindClient
+		}
+	}
+	b = protowire.AppendTag(b, otlpSpanKind, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(kind))
+
+	start := zs.Start.ToTime()
+	end := start.Add(zs.Duration.ToDuration())
+	b = protowire.AppendTag(b, otlpSpanStartTime, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(start.UnixNano()))
+	b = protowire.AppendTag(b, otlpSpanEndTime, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(end.UnixNano()))
+
+	var isError bool
+	for _, ba := range zs.BinaryAnnotations {
+		if ba.Key == ZipkinBinaryAnnotationKeyError {
+			isError, _ = strconv.ParseBool(annotationValueString(ba.Value))
+		}
+		b = appendKeyValue(b, otlpSpanAttributes, ba.Key, ba.Value)
+	}
+
+	for _, ta := range zs.TimeAnnotations {
+		if zipkinSpanKind(ta.Key) != "" {
+			continue
+		}
+		b = appendMessage(b, otlpSpanEvents, func(b []byte) []byte {
+			b = protowire.AppendTag(b, otlpEventTime, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, uint64(ta.Timestamp.ToTime().UnixNano()))
+			return appendString(b, otlpEventName, ta.Key)
+		})
+	}
+
+	if isError {
+		b = appendMessage(b, otlpSpanStatus, func(b []byte) []byte {
+			b = protowire.AppendTag(b, otlpStatusCode, protowire.VarintType)
+			return protowire.AppendVarint(b, otlpStatusCodeError)
+		})
+	}
+	return b
+}
+
+func spanServiceName(zs ZipkinSpan) string {
+	for _, ba := range zs.BinaryAnnotations {
+		if ba.Endpoint.ServiceName != "" {
+			return ba.Endpoint.ServiceName
+		}
+	}
+	return ""
+}
+
+// appendMessage appends an embedded message field, with its content written
+// by the encode function.
+func appendMessage(b []byte, num protowire.Number, encode func([]byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, encode(nil))
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendRawBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendKeyValue appends a KeyValue message field.
+func appendKeyValue(b []byte, num protowire.Number, key string, value interface{}) []byte {
+	return appendMessage(b, num, func(b []byte) []byte {
+		b = appendString(b, otlpKeyValueKey, key)
+		return appendMessage(b, otlpKeyValueValue, func(b []byte) []byte {
+			return appendAnyValue(b, value)
+		})
+	})
+}
+
+func appendAnyValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case bool:
+		b = protowire.AppendTag(b, otlpAnyValueBool, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int:
+		b = protowire.AppendTag(b, otlpAnyValueInt, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v))
+	case int64:
+		b = protowire.AppendTag(b, otlpAnyValueInt, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v))
+	case float64:
+		b = protowire.AppendTag(b, otlpAnyValueDouble, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v))
+	default:
+		return appendString(b, otlpAnyValueString, annotationValueString(value))
+	}
+}
+
+// otlpTraceID converts a trace id into the 16 bytes binary form.
+func otlpTraceID(id string) []byte {
+	b, _ := hex.DecodeString(hexTraceID128(id))
+	return b
+}
+
+// otlpSpanID converts a span id into the 8 bytes binary form.
+func otlpSpanID(id string) []byte {
+	b, _ := hex.DecodeString(hexSpanID(id))
+	return b
+}
@@ -0,0 +1,301 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/reddit/baseplate.go/tracing"
+)
+
+type collector struct {
+	*httptest.Server
+
+	lock        sync.Mutex
+	bodies      [][]byte
+	contentType string
+}
+
+func newCollector(tb testing.TB) *collector {
+	tb.Helper()
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			tb.Errorf("Failed to read request body: %v", err)
+		}
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.bodies = append(c.bodies, body)
+		c.contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	tb.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) requests() [][]byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.bodies
+}
+
+func initTracerWithRecorder(t *testing.T, cfg tracing.Config) {
+	t.Helper()
+	cfg.SampleRate = 1
+	cfg.Namespace = "test-service"
+	if err := tracing.InitGlobalTracer(cfg); err != nil {
+		t.Fatalf("InitGlobalTracer returned error: %v", err)
+	}
+	t.Cleanup(func() {
+		tracing.InitGlobalTracer(tracing.Config{})
+	})
+}
+
+func TestZipkinHTTPRecorder(t *testing.T) {
+	c := newCollector(t)
+	initTracerWithRecorder(t, tracing.Config{
+		ZipkinHTTP: tracing.HTTPRecorderConfig{
+			Endpoint: c.URL,
+			// Make sure the spans are only sent by the flush on Close.
+			BatchSize:     100,
+			BatchInterval: time.Hour,
+		},
+	})
+
+	_, server := tracing.StartSpanFromHeaders(
+		context.Background(),
+		"server",
+		tracing.Headers{
+			TraceID: "12345",
+			SpanID:  "67890",
+			Sampled: &[]bool{true}[0],
+		},
+	)
+	child := tracing.AsSpan(opentracing.StartSpan(
+		"client",
+		opentracing.ChildOf(server),
+		tracing.SpanTypeOption{Type: tracing.SpanTypeClient},
+	))
+	child.SetTag("foo", "bar")
+	if err := child.Stop(context.Background(), errors.New("dummy")); err != nil {
+		t.Fatalf("child.Stop returned error: %v", err)
+	}
+	if err := server.Stop(context.Background(), nil); err != nil {
+		t.Fatalf("server.Stop returned error: %v", err)
+	}
+
+	if n := len(c.requests()); n != 0 {
+		t.Errorf("Expected no requests before close, got %d", n)
+	}
+	if err := tracing.CloseTracer(); err != nil {
+		t.Fatalf("CloseTracer returned error: %v", err)
+	}
+
+	reqs := c.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("Expected 1 request after close, got %d", len(reqs))
+	}
+	if c.contentType != "application/json" {
+		t.Errorf("Expected content type application/json, got %q", c.contentType)
+	}
+
+	type span struct {
+		TraceID       string            `json:"traceId"`
+		ID            string            `json:"id"`
+		ParentID      string            `json:"parentId"`
+		Name          string            `json:"name"`
+		Kind          string            `json:"kind"`
+		Timestamp     int64             `json:"timestamp"`
+		Tags          map[string]string `json:"tags"`
+		LocalEndpoint struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"localEndpoint"`
+	}
+	var spans []span
+	if err := json.Unmarshal(reqs[0], &spans); err != nil {
+		t.Fatalf("Failed to unmarshal zipkin payload %q: %v", reqs[0], err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %+v", spans)
+	}
+
+	clientSpan, serverSpan := spans[0], spans[1]
+	if serverSpan.Name != "server" || serverSpan.Kind != "SERVER" {
+		t.Errorf("Unexpected server span: %+v", serverSpan)
+	}
+	if clientSpan.Name != "client" || clientSpan.Kind != "CLIENT" {
+		t.Errorf("Unexpected client span: %+v", clientSpan)
+	}
+	const (
+		expectedTraceID  = "0000000000003039" // 12345
+		expectedParentID = "0000000000010932" // 67890
+	)
+	if serverSpan.TraceID != expectedTraceID || clientSpan.TraceID != expectedTraceID {
+		t.Errorf("Expected trace id %q, got %q and %q", expectedTraceID, serverSpan.TraceID, clientSpan.TraceID)
+	}
+	if serverSpan.ParentID != expectedParentID {
+		t.Errorf("Expected server parent id %q, got %q", expectedParentID, serverSpan.ParentID)
+	}
+	if clientSpan.ParentID != serverSpan.ID {
+		t.Errorf("Expected client parent id to be %q, got %q", serverSpan.ID, clientSpan.ParentID)
+	}
+	if clientSpan.Tags["foo"] != "bar" || clientSpan.Tags["error"] != "true" {
+		t.Errorf("Unexpected client span tags: %v", clientSpan.Tags)
+	}
+	if serverSpan.LocalEndpoint.ServiceName != "test-service" {
+		t.Errorf("Expected service name %q, got %q", "test-service", serverSpan.LocalEndpoint.ServiceName)
+	}
+	if serverSpan.Timestamp == 0 {
+		t.Error("Expected non-zero timestamp")
+	}
+}
+
+func TestOTLPHTTPRecorder(t *testing.T) {
+	c := newCollector(t)
+	initTracerWithRecorder(t, tracing.Config{
+		UseHex: true,
+		OTLPHTTP: tracing.HTTPRecorderConfig{
+			Endpoint:      c.URL,
+			BatchSize:     1,
+			BatchInterval: time.Hour,
+		},
+	})
+
+	span := tracing.AsSpan(opentracing.StartSpan(
+		"server",
+		tracing.SpanTypeOption{Type: tracing.SpanTypeServer},
+	))
+	span.SetTag("foo", "bar")
+	if err := span.Stop(context.Background(), nil); err != nil {
+		t.Fatalf("span.Stop returned error: %v", err)
+	}
+	if err := tracing.CloseTracer(); err != nil {
+		t.Fatalf("CloseTracer returned error: %v", err)
+	}
+
+	reqs := c.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(reqs))
+	}
+	if c.contentType != "application/x-protobuf" {
+		t.Errorf("Expected content type application/x-protobuf, got %q", c.contentType)
+	}
+
+	// ExportTraceServiceRequest.resource_spans.scope_spans.spans
+	spans := protoFields(t, reqs[0], 1, 2, 2)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if got := protoFields(t, spans[0], 5); len(got) != 1 || string(got[0]) != "server" {
+		t.Errorf("Expected span name %q, got %q", "server", got)
+	}
+	if got := protoFields(t, spans[0], 1); len(got) != 1 || len(got[0]) != 16 {
+		t.Errorf("Expected 16 bytes trace id, got %x", got)
+	}
+	if got := protoFields(t, spans[0], 2); len(got) != 1 || len(got[0]) != 8 {
+		t.Errorf("Expected 8 bytes span id, got %x", got)
+	}
+	// ExportTraceServiceRequest.resource_spans.resource.attributes.key
+	if got := protoFields(t, reqs[0], 1, 1, 1, 1); len(got) != 1 || string(got[0]) != "service.name" {
+		t.Errorf("Expected service.name resource attribute, got %q", got)
+	}
+	var foundTag bool
+	for _, attr := range protoFields(t, spans[0], 9) {
+		if key := protoFields(t, attr, 1); len(key) == 1 && string(key[0]) == "foo" {
+			foundTag = true
+		}
+	}
+	if !foundTag {
+		t.Error("Expected tag foo in span attributes")
+	}
+}
+
+func TestHTTPRecorderBufferFull(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(block) })
+
+	recorder, err := tracing.NewZipkinHTTPRecorder(tracing.HTTPRecorderConfig{
+		Endpoint:      server.URL,
+		BatchSize:     1,
+		MaxBufferSize: 1,
+		FlushTimeout:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close() })
+
+	var errs []error
+	for i := 0; i < 10; i++ {
+		errs = append(errs, recorder.Record(context.Background(), tracing.ZipkinSpan{}))
+	}
+	var full bool
+	for _, err := range errs {
+		if errors.Is(err, tracing.ErrRecorderBufferFull) {
+			full = true
+		}
+	}
+	if !full {
+		t.Errorf("Expected ErrRecorderBufferFull, got %v", errs)
+	}
+}
+
+func TestRecorderConfigConflict(t *testing.T) {
+	err := tracing.InitGlobalTracer(tracing.Config{
+		ZipkinHTTP: tracing.HTTPRecorderConfig{Endpoint: "http://localhost:9411"},
+		OTLPHTTP:   tracing.HTTPRecorderConfig{Endpoint: "http://localhost:4318"},
+	})
+	if err == nil {
+		t.Error("Expected error for conflicting recorders, got nil")
+	}
+}
+
+// protoFields returns the values of all the length-delimited fields matching
+// path in the protobuf encoded message b.
+func protoFields(tb testing.TB, b []byte, path ...protowire.Number) [][]byte {
+	tb.Helper()
+	var values [][]byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			tb.Fatalf("Failed to consume tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				tb.Fatalf("Failed to consume field %d: %v", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			tb.Fatalf("Failed to consume field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		if num != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			values = append(values, v)
+		} else {
+			values = append(values, protoFields(tb, v, path[1:]...)...)
+		}
+	}
+	return values
+}
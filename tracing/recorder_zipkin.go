@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Zipkin v2 span kinds.
+const (
+	zipkinKindServer = "SERVER"
+	zipkinKindClient = "CLIENT"
+)
+
+type zipkinV2Endpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+}
+
+type zipkinV2Annotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// zipkinV2Span defines a span in zipkin's v2 json format.
+//
+// Reference: https://zipkin.io/zipkin-api/#/default/post_spans
+type zipkinV2Span struct {
+	TraceID       string               `json:"traceId"`
+	ID            string               `json:"id"`
+	ParentID      string               `json:"parentId,omitempty"`
+	Name          string               `json:"name"`
+	Kind          string               `json:"kind,omitempty"`
+	Timestamp     int64                `json:"timestamp"`
+	Duration      int64                `json:"duration"`
+	Debug         bool                 `json:"debug,omitempty"`
+	LocalEndpoint *zipkinV2Endpoint    `json:"localEndpoint,omitempty"`
+	Annotations   []zipkinV2Annotation `json:"annotations,omitempty"`
+	Tags          map[string]string    `json:"tags,omitempty"`
+}
+
+type zipkinV2Encoder struct{}
+
+func (zipkinV2Encoder) contentType() string {
+	return "application/json"
+}
+
+func (zipkinV2Encoder) encode(spans []ZipkinSpan) ([]byte, error) {
+	converted := make([]zipkinV2Span, len(spans))
+	for i, zs := range spans {
+		converted[i] = toZipkinV2(zs)
+	}
+	return json.Marshal(converted)
+}
+
+func toZipkinV2(zs ZipkinSpan) zipkinV2Span {
+	span := zipkinV2Span{
+		TraceID:   hexTraceID(zs.TraceID),
+		ID:        hexSpanID(zs.SpanID),
+		Name:      zs.Name,
+		Timestamp: zs.Start.ToTime().UnixMicro(),
+		Duration:  zs.Duration.ToDuration().Microseconds(),
+	}
+	if zs.ParentID != "" {
+		span.ParentID = hexSpanID(zs.ParentID)
+	}
+
+	var endpoint *ZipkinEndpointInfo
+	for _, ta := range zs.TimeAnnotations {
+		endpoint = &ta.Endpoint
+		if kind := zipkinSpanKind(ta.Key); kind != "" {
+			// The well-known time annotations are replaced by span kind in v2.
+			span.Kind = kind
+			continue
+		}
+		span.Annotations = append(span.Annotations, zipkinV2Annotation{
+			Timestamp: ta.Timestamp.ToTime().UnixMicro(),
+			Value:     ta.Key,
+		})
+	}
+	if len(zs.BinaryAnnotations) > 0 {
+		span.Tags = make(map[string]string, len(zs.BinaryAnnotations))
+	}
+	for _, ba := range zs.BinaryAnnotations {
+		endpoint = &ba.Endpoint
+		value := annotationValueString(ba.Value)
+		if ba.Key == ZipkinBinaryAnnotationKeyDebug {
+			span.Debug, _ = strconv.ParseBool(value)
+			continue
+		}
+		span.Tags[ba.Key] = value
+	}
+	if endpoint != nil {
+		span.LocalEndpoint = &zipkinV2Endpoint{
+			ServiceName: endpoint.ServiceName,
+			IPv4:        endpoint.IPv4,
+		}
+	}
+	return span
+}
+
+func zipkinSpanKind(timeAnnotationKey string) string {
+	switch timeAnnotationKey {
+	case ZipkinTimeAnnotationKeyServerReceive, ZipkinTimeAnnotationKeyServerSend:
+		return zipkinKindServer
+	case ZipkinTimeAnnotationKeyClientReceive, ZipkinTimeAnnotationKeyClientSend:
+		return zipkinKindClient
+	}
+	return ""
+}
+
+func annotationValueString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// hexTraceID converts a trace id into either 16 or 32 digits lowercase hex.
+func hexTraceID(id string) string {
+	if len(id) == 32 && isHex(id) {
+		return strings.ToLower(id)
+	}
+	return hexSpanID(id)
+}
+
+// hexSpanID converts a span id into 16 digits lowercase hex.
+//
+// Ids already in that format are kept as-is, decimal uint64 ids are converted
+// to hex, and all other ids are hashed, so that the same input always maps to
+// the same output and parent-child relationships are preserved.
+func hexSpanID(id string) string {
+	if len(id) == 16 && isHex(id) {
+		return strings.ToLower(id)
+	}
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return fmt.Sprintf("%016x", n)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
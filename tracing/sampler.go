@@ -0,0 +1,275 @@
+package tracing
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/reddit/baseplate.go/randbp"
+)
+
+// SamplingParameters are the information available to a Sampler when making
+// the sampling decision of a new trace.
+type SamplingParameters struct {
+	// The operation name of the root span.
+	Name string
+
+	// The type of the root span.
+	SpanType SpanType
+
+	// The trace id of the new trace.
+	TraceID string
+}
+
+// Sampler makes the head sampling decision for traces started in this
+// service.
+//
+// It's only used for the top level spans created inside this service.
+// For spans created from upstream headers the sampling decision is inherited
+// from the headers instead.
+//
+// Implementations must be safe to be used concurrently.
+type Sampler interface {
+	ShouldSample(params SamplingParameters) bool
+}
+
+// SamplerFunc is an adapter to allow the use of ordinary functions as Sampler.
+type SamplerFunc func(params SamplingParameters) bool
+
+// ShouldSample implements Sampler.
+func (f SamplerFunc) ShouldSample(params SamplingParameters) bool {
+	return f(params)
+}
+
+// RateSampler is a Sampler that samples traces randomly with the given rate,
+// which should be in the range of [0, 1].
+type RateSampler float64
+
+// ShouldSample implements Sampler.
+func (r RateSampler) ShouldSample(_ SamplingParameters) bool {
+	return randbp.ShouldSampleWithRate(float64(r))
+}
+
+// maxRateLimitedOperations is the max number of distinct operation names a
+// RateLimitingSampler tracks individually.
+// Operations beyond that share a single limiter.
+const maxRateLimitedOperations = 1000
+
+// RateLimitingSampler is a Sampler that samples at most a fixed number of
+// traces per second for each operation name.
+//
+// It should be created by NewRateLimitingSampler.
+type RateLimitingSampler struct {
+	limit rate.Limit
+	burst int
+
+	lock     sync.Mutex
+	limiters map[string]*rate.Limiter
+	overflow *rate.Limiter
+}
+
+// NewRateLimitingSampler creates a RateLimitingSampler that samples at most
+// perSecond traces per second for each operation name.
+//
+// perSecond can be less than 1, for example 0.1 means 1 trace every 10
+// seconds.
+func NewRateLimitingSampler(perSecond float64) *RateLimitingSampler {
+	burst := int(perSecond)
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimitingSampler{
+		limit:    rate.Limit(perSecond),
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+		overflow: rate.NewLimiter(rate.Limit(perSecond), burst),
+	}
+}
+
+// ShouldSample implements Sampler.
+func (s *RateLimitingSampler) ShouldSample(params SamplingParameters) bool {
+	return s.limiter(params.Name).Allow()
+}
+
+func (s *RateLimitingSampler) limiter(name string) *rate.Limiter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if l, ok := s.limiters[name]; ok {
+		return l
+	}
+	if len(s.limiters) >= maxRateLimitedOperations {
+		return s.overflow
+	}
+	l := rate.NewLimiter(s.limit, s.burst)
+	s.limiters[name] = l
+	return l
+}
+
+// SamplingRule overrides the sample rate for matching operations.
+//
+// Can be deserialized from YAML.
+type SamplingRule struct {
+	// The operation name (span name) the rule applies to, required.
+	//
+	// It's matched using path.Match, so it can be a pattern like
+	// "/v1/users/*".
+	Operation string `yaml:"operation"`
+
+	// SampleRate should be in the range of [0, 1].
+	SampleRate float64 `yaml:"sampleRate"`
+
+	// If MaxPerSecond > 0,
+	// at most MaxPerSecond traces per second are sampled for each operation
+	// matching the rule, after applying SampleRate.
+	MaxPerSecond float64 `yaml:"maxPerSecond"`
+}
+
+type compiledRule struct {
+	rule    SamplingRule
+	limiter *RateLimitingSampler
+}
+
+// RuleSampler is a Sampler that applies the sample rate of the first
+// matching SamplingRule, and falls back to a default rate when no rule
+// matches.
+//
+// It should be created by NewRuleSampler.
+type RuleSampler struct {
+	defaultRate RateSampler
+	rules       []compiledRule
+}
+
+// NewRuleSampler creates a RuleSampler.
+//
+// It returns an error if any of the rules has a malformed Operation pattern.
+func NewRuleSampler(defaultRate float64, rules []SamplingRule) (*RuleSampler, error) {
+	s := &RuleSampler{
+		defaultRate: RateSampler(defaultRate),
+		rules:       make([]compiledRule, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Operation, ""); err != nil {
+			return nil, fmt.Errorf("tracing.NewRuleSampler: invalid operation %q: %w", rule.Operation, err)
+		}
+		compiled := compiledRule{rule: rule}
+		if rule.MaxPerSecond > 0 {
+			compiled.limiter = NewRateLimitingSampler(rule.MaxPerSecond)
+		}
+		s.rules = append(s.rules, compiled)
+	}
+	return s, nil
+}
+
+// ShouldSample implements Sampler.
+func (s *RuleSampler) ShouldSample(params SamplingParameters) bool {
+	for _, r := range s.rules {
+		if matched, _ := path.Match(r.rule.Operation, params.Name); !matched {
+			continue
+		}
+		if !randbp.ShouldSampleWithRate(r.rule.SampleRate) {
+			return false
+		}
+		return r.limiter == nil || r.limiter.ShouldSample(params)
+	}
+	return s.defaultRate.ShouldSample(params)
+}
+
+// DefaultTailSamplingMaxBufferedSpans is the default value of
+// TailSamplingConfig.MaxBufferedSpans.
+const DefaultTailSamplingMaxBufferedSpans = 1000
+
+// TailSamplingConfig is the configuration for tail-based sampling.
+//
+// Tail-based sampling only applies to traces rooted in this service
+// (top level spans created inside this service, not from upstream headers)
+// that were not sampled by the head Sampler.
+// The spans of those traces are buffered in memory until the root span stops,
+// and then either all recorded or all dropped, based on the outcome of the
+// trace.
+//
+// Can be deserialized from YAML.
+type TailSamplingConfig struct {
+	// If SampleErrors is true,
+	// traces with any span stopped with an error will be sampled.
+	SampleErrors bool `yaml:"sampleErrors"`
+
+	// If SlowThreshold > 0,
+	// traces with the root span taking at least SlowThreshold will be sampled.
+	SlowThreshold time.Duration `yaml:"slowThreshold"`
+
+	// The max number of spans buffered for a single trace.
+	// Spans beyond that are dropped.
+	//
+	// If it's <= 0, DefaultTailSamplingMaxBufferedSpans will be used instead.
+	MaxBufferedSpans int `yaml:"maxBufferedSpans"`
+}
+
+// Enabled returns true if any of the tail-based sampling conditions is
+// configured.
+func (cfg TailSamplingConfig) Enabled() bool {
+	return cfg.SampleErrors || cfg.SlowThreshold > 0
+}
+
+// tailTrace is the tail-based sampling state shared by all the spans of a
+// trace rooted in this service.
+type tailTrace struct {
+	cfg    TailSamplingConfig
+	rootID string
+
+	lock     sync.Mutex
+	buffered []ZipkinSpan
+	hasError bool
+	decided  bool
+	keep     bool
+}
+
+func newTailTrace(cfg TailSamplingConfig, rootID string) *tailTrace {
+	if cfg.MaxBufferedSpans <= 0 {
+		cfg.MaxBufferedSpans = DefaultTailSamplingMaxBufferedSpans
+	}
+	return &tailTrace{
+		cfg:    cfg,
+		rootID: rootID,
+	}
+}
+
+// onStop is called when a span of the trace stops without being head sampled.
+//
+// It returns the spans to be recorded, which is non-empty only when the trace
+// is decided to be kept, and the number of spans dropped.
+func (tt *tailTrace) onStop(t *trace, err error) (spans []ZipkinSpan, dropped int) {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	if tt.decided {
+		if tt.keep {
+			return []ZipkinSpan{t.toZipkinSpan()}, 0
+		}
+		return nil, 1
+	}
+
+	if err != nil {
+		tt.hasError = true
+	}
+
+	if t.spanID != tt.rootID {
+		if len(tt.buffered) >= tt.cfg.MaxBufferedSpans {
+			return nil, 1
+		}
+		tt.buffered = append(tt.buffered, t.toZipkinSpan())
+		return nil, 0
+	}
+
+	tt.decided = true
+	tt.keep = (tt.cfg.SampleErrors && tt.hasError) ||
+		(tt.cfg.SlowThreshold > 0 && t.stop.Sub(t.start) >= tt.cfg.SlowThreshold)
+	spans = append(tt.buffered, t.toZipkinSpan())
+	tt.buffered = nil
+	if !tt.keep {
+		return nil, len(spans)
+	}
+	return spans, 0
+}
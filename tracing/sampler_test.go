@@ -0,0 +1,217 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+
+	"github.com/reddit/baseplate.go/tracing"
+)
+
+type fakeRecorder struct {
+	lock  sync.Mutex
+	spans []tracing.ZipkinSpan
+}
+
+func (r *fakeRecorder) Record(_ context.Context, span tracing.ZipkinSpan) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+	return nil
+}
+
+func (r *fakeRecorder) Close() error {
+	return nil
+}
+
+func (r *fakeRecorder) recorded() []tracing.ZipkinSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.spans
+}
+
+func TestRuleSampler(t *testing.T) {
+	sampler, err := tracing.NewRuleSampler(0, []tracing.SamplingRule{
+		{
+			Operation:  "/health",
+			SampleRate: 0,
+		},
+		{
+			Operation:  "/v1/*",
+			SampleRate: 1,
+		},
+		{
+			Operation:    "limited",
+			SampleRate:   1,
+			MaxPerSecond: 0.001,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		expected bool
+	}{
+		{name: "/health", expected: false},
+		{name: "/v1/users", expected: true},
+		{name: "/v1/users/123", expected: false},
+		{name: "other", expected: false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got := sampler.ShouldSample(tracing.SamplingParameters{Name: c.name}); got != c.expected {
+				t.Errorf("ShouldSample(%q) expected %v, got %v", c.name, c.expected, got)
+			}
+		})
+	}
+
+	t.Run("max-per-second", func(t *testing.T) {
+		params := tracing.SamplingParameters{Name: "limited"}
+		if !sampler.ShouldSample(params) {
+			t.Error("Expected the first trace to be sampled")
+		}
+		if sampler.ShouldSample(params) {
+			t.Error("Expected the second trace to be rate limited")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := tracing.NewRuleSampler(0, []tracing.SamplingRule{{Operation: "["}}); err == nil {
+			t.Error("Expected error for malformed pattern, got nil")
+		}
+	})
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	sampler := tracing.NewRateLimitingSampler(2)
+	var sampled int
+	for i := 0; i < 10; i++ {
+		if sampler.ShouldSample(tracing.SamplingParameters{Name: "foo"}) {
+			sampled++
+		}
+	}
+	if sampled != 2 {
+		t.Errorf("Expected 2 sampled traces for foo, got %d", sampled)
+	}
+	if !sampler.ShouldSample(tracing.SamplingParameters{Name: "bar"}) {
+		t.Error("Expected operations to be rate limited independently")
+	}
+}
+
+func TestTailSampling(t *testing.T) {
+	for _, c := range []struct {
+		label    string
+		cfg      tracing.TailSamplingConfig
+		childErr error
+		sleep    time.Duration
+		expected int
+	}{
+		{
+			label:    "error",
+			cfg:      tracing.TailSamplingConfig{SampleErrors: true},
+			childErr: errors.New("dummy"),
+			expected: 2,
+		},
+		{
+			label:    "no-error",
+			cfg:      tracing.TailSamplingConfig{SampleErrors: true},
+			expected: 0,
+		},
+		{
+			label:    "slow",
+			cfg:      tracing.TailSamplingConfig{SlowThreshold: time.Millisecond},
+			sleep:    5 * time.Millisecond,
+			expected: 2,
+		},
+		{
+			label:    "fast",
+			cfg:      tracing.TailSamplingConfig{SlowThreshold: time.Hour},
+			expected: 0,
+		},
+		{
+			label: "buffer-limit",
+			cfg: tracing.TailSamplingConfig{
+				SampleErrors:     true,
+				MaxBufferedSpans: 1,
+			},
+			childErr: errors.New("dummy"),
+			// root span + 1 buffered child span, the other child span is dropped.
+			expected: 2,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			recorder := &fakeRecorder{}
+			if err := tracing.InitGlobalTracer(tracing.Config{
+				SampleRate:   0,
+				TailSampling: c.cfg,
+				Recorder:     recorder,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				tracing.InitGlobalTracer(tracing.Config{})
+			})
+
+			root := tracing.AsSpan(opentracing.StartSpan(
+				"root",
+				tracing.SpanTypeOption{Type: tracing.SpanTypeServer},
+			))
+			children := 1
+			if c.cfg.MaxBufferedSpans > 0 {
+				children = c.cfg.MaxBufferedSpans + 1
+			}
+			for i := 0; i < children; i++ {
+				child := tracing.AsSpan(opentracing.StartSpan(
+					"child",
+					opentracing.ChildOf(root),
+					tracing.SpanTypeOption{Type: tracing.SpanTypeClient},
+				))
+				if err := child.Stop(context.Background(), c.childErr); err != nil {
+					t.Fatalf("child.Stop returned error: %v", err)
+				}
+			}
+			if n := len(recorder.recorded()); n != 0 {
+				t.Errorf("Expected no spans recorded before the root span stops, got %d", n)
+			}
+
+			time.Sleep(c.sleep)
+			if err := root.Stop(context.Background(), nil); err != nil {
+				t.Fatalf("root.Stop returned error: %v", err)
+			}
+			if n := len(recorder.recorded()); n != c.expected {
+				t.Errorf("Expected %d spans recorded, got %d", c.expected, n)
+			}
+		})
+	}
+}
+
+func TestSamplerOverride(t *testing.T) {
+	recorder := &fakeRecorder{}
+	if err := tracing.InitGlobalTracer(tracing.Config{
+		Sampler: tracing.SamplerFunc(func(params tracing.SamplingParameters) bool {
+			return params.SpanType == tracing.SpanTypeServer
+		}),
+		Recorder: recorder,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tracing.InitGlobalTracer(tracing.Config{})
+	})
+
+	for _, typ := range []tracing.SpanType{tracing.SpanTypeServer, tracing.SpanTypeLocal} {
+		span := tracing.AsSpan(opentracing.StartSpan("span", tracing.SpanTypeOption{Type: typ}))
+		if err := span.Stop(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spans := recorder.recorded()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span recorded, got %+v", spans)
+	}
+}
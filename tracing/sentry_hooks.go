@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Sentry tag keys set on the transactions and spans created by
+// SentryCreateServerSpanHook.
+const (
+	SentryTagKeyTraceID = "baseplate.trace_id"
+	SentryTagKeySpanID  = "baseplate.span_id"
+)
+
+// SentryBreadcrumbCategory is the category of the breadcrumbs recorded from
+// client spans by SentryCreateServerSpanHook.
+const SentryBreadcrumbCategory = "baseplate.client"
+
+// SentryCreateServerSpanHook registers each server Span with hooks reporting
+// performance data to Sentry:
+//
+// - The server Span is reported as a Sentry transaction, named after the Span.
+//
+// - All its child Spans (recursively) are reported as Sentry spans of that
+// transaction.
+//
+// - Client Spans are also recorded as breadcrumbs into the sentry.Hub of the
+// request, so they are attached to the errors reported later in the same
+// request (e.g. by ErrorReporterCreateServerSpanHook).
+//
+// The transactions are sampled by Sentry via the TracesSampleRate of the
+// sentry client, which log.InitSentry sets to log.SentryConfig.TracesSampleRate
+// (default to 0, which disables the transactions). Keep it low, as every
+// sampled request is sent to Sentry as a transaction.
+// Breadcrumbs are always recorded.
+type SentryCreateServerSpanHook struct{}
+
+// OnCreateServerSpan registers the sentry span hook on a server Span.
+func (SentryCreateServerSpanHook) OnCreateServerSpan(span *Span) error {
+	span.AddHooks(&sentrySpanHook{})
+	return nil
+}
+
+// sentrySpanHook reports a Span as a Sentry transaction or span.
+//
+// Each Span has its own sentrySpanHook.
+type sentrySpanHook struct {
+	// The sentry span of the parent Span, nil for server Spans.
+	parent *sentry.Span
+	// The sentry span of this Span, set by OnPostStart.
+	sentry *sentry.Span
+}
+
+// OnCreateChild registers a sentry span hook on the child Span.
+func (h *sentrySpanHook) OnCreateChild(_, child *Span) error {
+	child.AddHooks(&sentrySpanHook{parent: h.sentry})
+	return nil
+}
+
+// OnPostStart starts the Sentry transaction or span.
+func (h *sentrySpanHook) OnPostStart(span *Span) error {
+	op := "baseplate." + span.SpanType().String()
+	setStart := func(s *sentry.Span) {
+		if !span.trace.start.IsZero() {
+			s.StartTime = span.trace.start
+		}
+		s.Description = span.Name()
+	}
+	switch {
+	case span.SpanType() == SpanTypeServer:
+		// Use a clone of the hub so that concurrent transactions don't overwrite
+		// each other's transaction names.
+		ctx := sentry.SetHubOnContext(context.Background(), span.getHub().Clone())
+		h.sentry = sentry.StartSpan(ctx, op, sentry.TransactionName(span.Name()), setStart)
+	case h.parent != nil:
+		h.sentry = h.parent.StartChild(op, setStart)
+	default:
+		return nil
+	}
+	h.sentry.SetTag(SentryTagKeyTraceID, span.TraceID())
+	h.sentry.SetTag(SentryTagKeySpanID, span.ID())
+	return nil
+}
+
+// OnPreStop finishes the Sentry transaction or span,
+// and records the breadcrumb for client Spans.
+func (h *sentrySpanHook) OnPreStop(span *Span, err error) error {
+	if h.sentry != nil {
+		h.sentry.Status = sentrySpanStatus(err)
+		h.sentry.Finish()
+	}
+	if span.SpanType() == SpanTypeClient {
+		breadcrumb := &sentry.Breadcrumb{
+			Category:  SentryBreadcrumbCategory,
+			Message:   span.Name(),
+			Level:     sentry.LevelInfo,
+			Timestamp: time.Now(),
+		}
+		if !span.trace.start.IsZero() {
+			breadcrumb.Data = map[string]interface{}{
+				"duration_ms": time.Since(span.trace.start).Milliseconds(),
+			}
+		}
+		if err != nil {
+			breadcrumb.Level = sentry.LevelError
+			if breadcrumb.Data == nil {
+				breadcrumb.Data = make(map[string]interface{}, 1)
+			}
+			breadcrumb.Data["error"] = err.Error()
+		}
+		span.getHub().AddBreadcrumb(breadcrumb, nil)
+	}
+	return nil
+}
+
+func sentrySpanStatus(err error) sentry.SpanStatus {
+	switch {
+	case err == nil:
+		return sentry.SpanStatusOK
+	case errors.Is(err, context.DeadlineExceeded):
+		return sentry.SpanStatusDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return sentry.SpanStatusCanceled
+	default:
+		return sentry.SpanStatusInternalError
+	}
+}
+
+var (
+	_ CreateServerSpanHook = SentryCreateServerSpanHook{}
+	_ CreateChildSpanHook  = (*sentrySpanHook)(nil)
+	_ StartStopSpanHook    = (*sentrySpanHook)(nil)
+)
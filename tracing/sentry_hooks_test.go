@@ -0,0 +1,150 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/opentracing/opentracing-go"
+
+	"github.com/reddit/baseplate.go/tracing"
+)
+
+// fakeSentryTransport is a sentry.Transport collecting the events sent.
+type fakeSentryTransport struct {
+	lock   sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *fakeSentryTransport) Configure(sentry.ClientOptions) {}
+
+func (t *fakeSentryTransport) Flush(time.Duration) bool {
+	return true
+}
+
+func (t *fakeSentryTransport) SendEvent(event *sentry.Event) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *fakeSentryTransport) Events() []*sentry.Event {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.events
+}
+
+func sentryHubContext(t *testing.T, tracesSampleRate float64) (context.Context, *fakeSentryTransport) {
+	t.Helper()
+	transport := &fakeSentryTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Transport:        transport,
+		TracesSampleRate: tracesSampleRate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := sentry.NewHub(client, sentry.NewScope())
+	return sentry.SetHubOnContext(context.Background(), hub), transport
+}
+
+func TestSentryCreateServerSpanHook(t *testing.T) {
+	tracing.RegisterCreateServerSpanHooks(tracing.SentryCreateServerSpanHook{})
+	defer tracing.ResetHooks()
+
+	ctx, transport := sentryHubContext(t, 1)
+	ctx, span := tracing.StartSpanFromHeaders(ctx, "endpoint", tracing.Headers{
+		TraceID: "12345",
+	})
+
+	localSpan, localCtx := opentracing.StartSpanFromContext(ctx, "local")
+	clientSpan, _ := opentracing.StartSpanFromContext(
+		localCtx,
+		"client.call",
+		tracing.SpanTypeOption{Type: tracing.SpanTypeClient},
+	)
+	clientErr := errors.New("client error")
+	tracing.AsSpan(clientSpan).Stop(ctx, clientErr)
+	tracing.AsSpan(localSpan).Stop(ctx, nil)
+
+	// Capture an error in the request after the client call,
+	// it should carry the breadcrumb.
+	sentry.GetHubFromContext(ctx).CaptureException(errors.New("handler error"))
+
+	span.Stop(ctx, context.DeadlineExceeded)
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %+v", len(events), events)
+	}
+
+	errorEvent := events[0]
+	if len(errorEvent.Breadcrumbs) != 1 {
+		t.Fatalf("Expected 1 breadcrumb, got %+v", errorEvent.Breadcrumbs)
+	}
+	breadcrumb := errorEvent.Breadcrumbs[0]
+	if breadcrumb.Category != tracing.SentryBreadcrumbCategory ||
+		breadcrumb.Message != "client.call" ||
+		breadcrumb.Level != sentry.LevelError ||
+		breadcrumb.Data["error"] != clientErr.Error() {
+		t.Errorf("Unexpected breadcrumb %+v", breadcrumb)
+	}
+
+	transaction := events[1]
+	if transaction.Type != "transaction" {
+		t.Errorf("Expected transaction event, got %q", transaction.Type)
+	}
+	if transaction.Transaction != "endpoint" {
+		t.Errorf("Expected transaction name %q, got %q", "endpoint", transaction.Transaction)
+	}
+	if got := transaction.Tags[tracing.SentryTagKeyTraceID]; got != "12345" {
+		t.Errorf("Expected trace id tag %q, got %q", "12345", got)
+	}
+	if tc, ok := transaction.Contexts["trace"].(*sentry.TraceContext); !ok || tc.Status != sentry.SpanStatusDeadlineExceeded {
+		t.Errorf("Expected deadline exceeded trace context, got %#v", transaction.Contexts["trace"])
+	}
+	if len(transaction.Spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %+v", transaction.Spans)
+	}
+	spans := make(map[string]*sentry.Span, len(transaction.Spans))
+	for _, s := range transaction.Spans {
+		spans[s.Description] = s
+	}
+	local, client := spans["local"], spans["client.call"]
+	if local == nil || client == nil {
+		t.Fatalf("Expected local and client.call spans, got %+v", spans)
+	}
+	if local.Op != "baseplate.local" || local.Status != sentry.SpanStatusOK {
+		t.Errorf("Unexpected local span %+v", local)
+	}
+	if client.Op != "baseplate.client" || client.Status != sentry.SpanStatusInternalError {
+		t.Errorf("Unexpected client span %+v", client)
+	}
+	if client.ParentSpanID != local.SpanID {
+		t.Errorf("Expected client span to be child of local span, got %+v", client)
+	}
+}
+
+func TestSentryCreateServerSpanHookUnsampled(t *testing.T) {
+	tracing.RegisterCreateServerSpanHooks(tracing.SentryCreateServerSpanHook{})
+	defer tracing.ResetHooks()
+
+	ctx, transport := sentryHubContext(t, 0)
+	ctx, span := tracing.StartSpanFromHeaders(ctx, "endpoint", tracing.Headers{
+		TraceID: "12345",
+	})
+	clientSpan, _ := opentracing.StartSpanFromContext(
+		ctx,
+		"client.call",
+		tracing.SpanTypeOption{Type: tracing.SpanTypeClient},
+	)
+	tracing.AsSpan(clientSpan).Stop(ctx, nil)
+	span.Stop(ctx, nil)
+
+	if events := transport.Events(); len(events) != 0 {
+		t.Errorf("Expected no transactions, got %+v", events)
+	}
+}
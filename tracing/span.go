@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -145,6 +146,12 @@ func (s Span) Sampled() bool {
 	return s.trace.sampled
 }
 
+// TraceState returns the W3C tracestate header received from upstream,
+// or empty string if it was not set.
+func (s Span) TraceState() string {
+	return s.trace.traceState
+}
+
 // StartTime the time that the span was started.
 func (s Span) StartTime() time.Time {
 	return s.trace.start
@@ -241,6 +248,8 @@ func (s Span) initChildSpan(child *Span) {
 	child.trace.traceID = s.trace.traceID
 	child.trace.sampled = s.trace.sampled
 	child.trace.flags = s.trace.flags
+	child.trace.traceState = s.trace.traceState
+	child.trace.tail = s.trace.tail
 	child.hub = s.hub
 
 	if child.spanType != SpanTypeServer {
@@ -277,7 +286,7 @@ func (s *Span) Stop(ctx context.Context, err error) error {
 	if s.trace.stop.IsZero() {
 		s.trace.stop = time.Now()
 	}
-	return s.trace.publish(ctx)
+	return s.trace.publish(ctx, err)
 }
 
 func (s *Span) preStop(err error) {
@@ -391,28 +400,88 @@ func (s *Span) Tracer() opentracing.Tracer {
 
 // LogFields implements opentracing.Span.
 //
-// In this implementation it's a no-op.
-func (s *Span) LogFields(fields ...otlog.Field) {}
+// The fields are recorded as a single timestamped annotation in the span,
+// formatted as space separated key=value pairs.
+// A span keeps at most MaxSpanLogs logs and MaxSpanLogsSize bytes of logs,
+// each truncated to MaxSpanLogSize bytes.
+//
+// Logs are only recorded when the span could be sampled,
+// otherwise it's a no-op.
+func (s *Span) LogFields(fields ...otlog.Field) {
+	s.logFields(time.Time{}, fields)
+}
 
 // LogKV implements opentracing.Span.
 //
-// In this implementation it's a no-op.
-func (s *Span) LogKV(alternatingKeyValues ...interface{}) {}
+// It's a shorthand for LogFields, with alternatingKeyValues converted by
+// opentracing log.InterleavedKVToFields.
+func (s *Span) LogKV(alternatingKeyValues ...interface{}) {
+	if !s.recordsLogs() {
+		return
+	}
+	fields, err := otlog.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		fields = []otlog.Field{otlog.Error(err)}
+	}
+	s.logFields(time.Time{}, fields)
+}
 
 // LogEvent implements opentracing.Span.
 //
-// it's deprecated in the interface and is a no-op here.
-func (s *Span) LogEvent(event string) {}
+// it's deprecated in the interface and is a shorthand for LogFields with a
+// single event field here.
+func (s *Span) LogEvent(event string) {
+	s.logFields(time.Time{}, []otlog.Field{otlog.String(logFieldEvent, event)})
+}
 
 // LogEventWithPayload implements opentracing.Span.
 //
-// it's deprecated in the interface and is a noop here.
-func (s *Span) LogEventWithPayload(event string, payload interface{}) {}
+// it's deprecated in the interface and is a shorthand for LogFields with event
+// and payload fields here.
+func (s *Span) LogEventWithPayload(event string, payload interface{}) {
+	s.logFields(time.Time{}, []otlog.Field{
+		otlog.String(logFieldEvent, event),
+		otlog.Object(logFieldPayload, payload),
+	})
+}
 
 // Log implements opentracing.Span.
 //
-// it's deprecated in the interface and is a no-op here.
-func (s *Span) Log(data opentracing.LogData) {}
+// it's deprecated in the interface and is a shorthand for LogFields with
+// data converted by LogData.ToLogRecord here.
+func (s *Span) Log(data opentracing.LogData) {
+	record := data.ToLogRecord()
+	s.logFields(record.Timestamp, record.Fields)
+}
+
+const (
+	logFieldEvent   = "event"
+	logFieldPayload = "payload"
+)
+
+// recordsLogs returns true if the logs added to the span could be published.
+func (s *Span) recordsLogs() bool {
+	return s.trace.shouldSample() || s.trace.tail != nil
+}
+
+func (s *Span) logFields(timestamp time.Time, fields []otlog.Field) {
+	if len(fields) == 0 || !s.recordsLogs() {
+		return
+	}
+	var sb strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(field.Key())
+		sb.WriteString("=")
+		fmt.Fprintf(&sb, "%v", field.Value())
+		if sb.Len() > MaxSpanLogSize {
+			break
+		}
+	}
+	s.trace.addLog(timestamp, sb.String())
+}
 
 // StartTopLevelServerSpan initializes a new, top level server span.
 //
@@ -444,6 +513,12 @@ type Headers struct {
 	// Sampled is whether this span was sampled by the upstream caller.  Uses
 	// a pointer to a bool so it can distinguish between set/not-set.
 	Sampled *bool
+
+	// TraceState is the vendor specific W3C tracestate header passed via
+	// upstream headers, it's propagated as-is to the child spans.
+	//
+	// Its value is only used when other headers are set.
+	TraceState string
 }
 
 // AnySet returns true if any of the values in the Headers are set, false otherwise.
@@ -572,6 +647,8 @@ func StartSpanFromHeaders(ctx context.Context, name string, headers Headers) (co
 		span.trace.sampled = sampled
 	}
 
+	span.trace.traceState = headers.TraceState
+
 	ctx = initRootSpan(ctx, span)
 
 	return ctx, span
@@ -597,6 +674,23 @@ func initRootSpan(ctx context.Context, s *Span) context.Context {
 	return ctx
 }
 
+// AttachLogCorrelation attaches log.CorrelationFields into the context object,
+// with the given endpoint and caller,
+// and the trace and span ids of the Span in the context object, if any.
+//
+// It's used by the server middlewares of httpbp, thriftbp and grpcbp.
+func AttachLogCorrelation(ctx context.Context, endpoint, caller string) context.Context {
+	fields := log.CorrelationFields{
+		Endpoint: endpoint,
+		Caller:   caller,
+	}
+	if span, ok := opentracing.SpanFromContext(ctx).(*Span); ok && span != nil {
+		fields.TraceID = span.TraceID()
+		fields.SpanID = span.ID()
+	}
+	return log.AttachCorrelation(ctx, fields)
+}
+
 var nopHub = sentry.NewHub(nil, sentry.NewScope())
 
 func getNopHub() *sentry.Hub {
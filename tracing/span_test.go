@@ -1,6 +1,8 @@
 package tracing
 
 import (
+	"encoding/json"
+	"errors"
 	"math/rand"
 	"reflect"
 	"strings"
@@ -9,6 +11,7 @@ import (
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
 
 	"github.com/reddit/baseplate.go/randbp"
 )
@@ -774,3 +777,99 @@ func TestSpanMetricsTags(t *testing.T) {
 		t.Errorf("Expected %v, got %v", expected, tags)
 	}
 }
+
+func TestSpanLogs(t *testing.T) {
+	span := newSpan(nil, "foo", SpanTypeLocal)
+	span.trace.sampled = true
+
+	span.LogKV("event", "cache miss", "key", 123)
+	span.LogFields(otlog.Error(errors.New("dummy")))
+	span.LogEvent(strings.Repeat("a", MaxSpanLogSize+1))
+	span.LogKV("odd")
+
+	zs := span.trace.toZipkinSpan()
+	expected := []string{
+		"event=cache miss key=123",
+		"error.object=dummy",
+		"event=" + strings.Repeat("a", MaxSpanLogSize-len("event=")),
+		"error.object=non-even keyValues len: 1",
+	}
+	var actual []string
+	for _, ta := range zs.TimeAnnotations {
+		actual = append(actual, ta.Key)
+		if ta.Timestamp.ToTime().IsZero() {
+			t.Errorf("Expected non-zero timestamp for log %q", ta.Key)
+		}
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected logs %q, got %q", expected, actual)
+	}
+
+	t.Run("max-logs", func(t *testing.T) {
+		span := newSpan(nil, "foo", SpanTypeLocal)
+		span.trace.sampled = true
+		for i := 0; i < MaxSpanLogs+2; i++ {
+			span.LogEvent("event")
+		}
+		zs := span.trace.toZipkinSpan()
+		if len(zs.TimeAnnotations) != MaxSpanLogs {
+			t.Errorf("Expected %d logs, got %d", MaxSpanLogs, len(zs.TimeAnnotations))
+		}
+		var dropped interface{}
+		for _, ba := range zs.BinaryAnnotations {
+			if ba.Key == tagKeyDroppedLogs {
+				dropped = ba.Value
+			}
+		}
+		if dropped != 2 {
+			t.Errorf("Expected 2 dropped logs, got %v", dropped)
+		}
+	})
+
+	t.Run("max-size", func(t *testing.T) {
+		tracer := &Tracer{
+			endpoint: ZipkinEndpointInfo{
+				ServiceName: strings.Repeat("s", 64),
+				IPv4:        "255.255.255.255",
+			},
+		}
+		span := newSpan(tracer, "foo", SpanTypeLocal)
+		span.trace.sampled = true
+		// Logs that are the most expensive to encode in JSON.
+		for i := 0; i < MaxSpanLogs; i++ {
+			span.LogEvent(strings.Repeat("<", MaxSpanLogSize))
+		}
+		zs := span.trace.toZipkinSpan()
+		data, err := json.Marshal(zs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > MaxSpanSize {
+			t.Errorf("Expected the span at the log limits to be at most %d bytes, got %d", MaxSpanSize, len(data))
+		}
+		if len(zs.TimeAnnotations) == 0 || len(zs.TimeAnnotations) >= MaxSpanLogs {
+			t.Errorf("Expected some of the logs to be dropped, got %d logs", len(zs.TimeAnnotations))
+		}
+
+		span = newSpan(tracer, "foo", SpanTypeLocal)
+		span.trace.sampled = true
+		for i := 0; i < MaxSpanLogs; i++ {
+			span.LogEvent(strings.Repeat("a", MaxSpanLogSize))
+		}
+		data, err = json.Marshal(span.trace.toZipkinSpan())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > MaxSpanSize {
+			t.Errorf("Expected the span at the log limits to be at most %d bytes, got %d", MaxSpanSize, len(data))
+		}
+	})
+
+	t.Run("not-sampled", func(t *testing.T) {
+		span := newSpan(nil, "foo", SpanTypeLocal)
+		span.LogEvent("event")
+		if n := len(span.trace.toZipkinSpan().TimeAnnotations); n != 0 {
+			t.Errorf("Expected no logs for not sampled span, got %d", n)
+		}
+	})
+}
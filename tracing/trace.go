@@ -2,7 +2,11 @@ package tracing
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/reddit/baseplate.go/randbp"
@@ -28,6 +32,29 @@ const (
 const (
 	counterKeyPrefix   = "counter."
 	baseplateComponent = "baseplate"
+
+	// The tag key used to report the number of logs dropped from a span because
+	// of MaxSpanLogs or MaxSpanLogsSize.
+	tagKeyDroppedLogs = "logs.dropped"
+)
+
+// Limits of the logs recorded into a span via LogFields, LogKV, etc.
+const (
+	// MaxSpanLogs is the max number of logs kept in a single span.
+	// Logs beyond that are dropped.
+	MaxSpanLogs = 128
+
+	// MaxSpanLogSize is the max size of a single log in bytes.
+	// Longer logs are truncated.
+	MaxSpanLogSize = 1024
+
+	// MaxSpanLogsSize is the max total size of the logs kept in a single span,
+	// in bytes as encoded in JSON.
+	// Logs beyond that are dropped.
+	//
+	// It leaves enough room in MaxSpanSize for the rest of the span, so a span
+	// with a lot of logs is not dropped as a whole for being too large.
+	MaxSpanLogsSize = 32 * 1024
 )
 
 type trace struct {
@@ -40,6 +67,14 @@ type trace struct {
 	sampled  bool
 	flags    int64
 
+	// traceState is the W3C tracestate header from upstream, if any.
+	traceState string
+
+	// tail is the tail-based sampling state of the trace,
+	// only set for traces rooted in this service when tail-based sampling is
+	// enabled and the trace was not head sampled.
+	tail *tailTrace
+
 	timeAnnotationReceiveKey string
 	timeAnnotationSendKey    string
 	start                    time.Time
@@ -47,6 +82,18 @@ type trace struct {
 
 	counters map[string]float64
 	tags     map[string]string
+
+	// logs can be added concurrently, e.g. by a slog.Handler,
+	// so they are guarded by logsLock.
+	logsLock    sync.Mutex
+	logs        []spanLog
+	logsSize    int
+	droppedLogs int
+}
+
+type spanLog struct {
+	timestamp time.Time
+	value     string
 }
 
 func newTrace(tracer *Tracer, name string) *trace {
@@ -76,6 +123,30 @@ func (t *trace) setTag(key string, value interface{}) {
 	t.tags[key] = fmt.Sprintf("%v", value)
 }
 
+func (t *trace) addLog(timestamp time.Time, value string) {
+	if len(value) > MaxSpanLogSize {
+		value = strings.ToValidUTF8(value[:MaxSpanLogSize], "")
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	// The size of the log as encoded in JSON, as escaping could make it a lot
+	// larger than len(value).
+	encoded, _ := json.Marshal(value)
+
+	t.logsLock.Lock()
+	defer t.logsLock.Unlock()
+	if len(t.logs) >= MaxSpanLogs || t.logsSize+len(encoded) > MaxSpanLogsSize {
+		t.droppedLogs++
+		return
+	}
+	t.logsSize += len(encoded)
+	t.logs = append(t.logs, spanLog{
+		timestamp: timestamp,
+		value:     value,
+	})
+}
+
 func (t *trace) toZipkinSpan() ZipkinSpan {
 	zs := ZipkinSpan{
 		TraceID:  t.traceID,
@@ -111,7 +182,28 @@ func (t *trace) toZipkinSpan() ZipkinSpan {
 		})
 	}
 
-	zs.BinaryAnnotations = make([]ZipkinBinaryAnnotation, 0, len(t.counters)+len(t.tags))
+	t.logsLock.Lock()
+	for _, l := range t.logs {
+		zs.TimeAnnotations = append(zs.TimeAnnotations, ZipkinTimeAnnotation{
+			Endpoint:  endpoint,
+			Key:       l.value,
+			Timestamp: timebp.TimestampMicrosecond(l.timestamp),
+		})
+	}
+	droppedLogs := t.droppedLogs
+	t.logsLock.Unlock()
+
+	zs.BinaryAnnotations = make([]ZipkinBinaryAnnotation, 0, len(t.counters)+len(t.tags)+1)
+	if droppedLogs > 0 {
+		zs.BinaryAnnotations = append(
+			zs.BinaryAnnotations,
+			ZipkinBinaryAnnotation{
+				Endpoint: endpoint,
+				Key:      tagKeyDroppedLogs,
+				Value:    droppedLogs,
+			},
+		)
+	}
 	for key, value := range t.counters {
 		zs.BinaryAnnotations = append(
 			zs.BinaryAnnotations,
@@ -155,11 +247,29 @@ func (t *trace) shouldSample() bool {
 	return t.sampled || t.isDebugSet()
 }
 
-func (t *trace) publish(ctx context.Context) error {
-	if !t.shouldSample() || t.tracer == nil {
+func (t *trace) publish(ctx context.Context, err error) error {
+	if t.tracer == nil {
+		return nil
+	}
+	if t.shouldSample() {
+		samplerSpansTotal.WithLabelValues("true", samplingStageHead).Inc()
+		return t.tracer.Record(ctx, t.toZipkinSpan())
+	}
+	if t.tail == nil {
+		samplerSpansTotal.WithLabelValues("false", samplingStageHead).Inc()
 		return nil
 	}
-	return t.tracer.Record(ctx, t.toZipkinSpan())
+
+	spans, dropped := t.tail.onStop(t, err)
+	if dropped > 0 {
+		samplerSpansTotal.WithLabelValues("false", samplingStageTail).Add(float64(dropped))
+	}
+	var errs []error
+	for _, zs := range spans {
+		samplerSpansTotal.WithLabelValues("true", samplingStageTail).Inc()
+		errs = append(errs, t.tracer.Record(ctx, zs))
+	}
+	return errors.Join(errs...)
 }
 
 // In opentracing spec, zero trace/span/parent ids have special meanings.
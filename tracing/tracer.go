@@ -2,12 +2,10 @@ package tracing
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
-	"time"
 
 	"github.com/opentracing/opentracing-go"
 
@@ -69,12 +67,12 @@ var globalTracer = Tracer{logger: log.NopWrapper}
 
 // A Tracer creates and manages spans.
 type Tracer struct {
-	sampleRate       float64
-	recorder         mqsend.MessageQueue
-	logger           log.Wrapper
-	endpoint         ZipkinEndpointInfo
-	maxRecordTimeout time.Duration
-	useHex           bool
+	sampler      Sampler
+	tailSampling TailSamplingConfig
+	recorder     SpanRecorder
+	logger       log.Wrapper
+	endpoint     ZipkinEndpointInfo
+	useHex       bool
 }
 
 // InitGlobalTracer initializes opentracing's global tracer.
@@ -89,25 +87,6 @@ func InitGlobalTracer(cfg Config) error {
 		return nil
 	}
 	var tracer Tracer
-	if cfg.QueueName != "" {
-		if cfg.MaxQueueSize <= 0 || cfg.MaxQueueSize > MaxQueueSize {
-			cfg.MaxQueueSize = MaxQueueSize
-		}
-		recorder, err := mqsend.OpenMessageQueue(mqsend.MessageQueueConfig{
-			Name:           QueueNamePrefix + cfg.QueueName,
-			MaxQueueSize:   cfg.MaxQueueSize,
-			MaxMessageSize: MaxSpanSize,
-		})
-		if err != nil {
-			return err
-		}
-		tracer.recorder = recorder
-	} else {
-		tracer.recorder = cfg.TestOnlyMockMessageQueue
-	}
-
-	tracer.sampleRate = cfg.SampleRate
-	tracer.useHex = cfg.UseHex
 
 	logger := cfg.Logger
 	if logger == nil {
@@ -115,7 +94,22 @@ func InitGlobalTracer(cfg Config) error {
 	}
 	tracer.logger = logger
 
-	tracer.maxRecordTimeout = cfg.MaxRecordTimeout
+	recorder, err := newRecorder(cfg, logger)
+	if err != nil {
+		return err
+	}
+	tracer.recorder = recorder
+
+	tracer.sampler = cfg.Sampler
+	if tracer.sampler == nil {
+		sampler, err := NewRuleSampler(cfg.SampleRate, cfg.SamplingRules)
+		if err != nil {
+			return err
+		}
+		tracer.sampler = sampler
+	}
+	tracer.tailSampling = cfg.TailSampling
+	tracer.useHex = cfg.UseHex
 
 	ip, err := runtimebp.GetFirstIPv4()
 	if err != nil {
@@ -131,6 +125,67 @@ func InitGlobalTracer(cfg Config) error {
 	return nil
 }
 
+// newRecorder creates the SpanRecorder configured in cfg.
+//
+// It returns nil SpanRecorder when no recorder is configured.
+func newRecorder(cfg Config, logger log.Wrapper) (SpanRecorder, error) {
+	var configured int
+	for _, set := range []bool{
+		cfg.QueueName != "",
+		cfg.ZipkinHTTP.Endpoint != "",
+		cfg.OTLPHTTP.Endpoint != "",
+		cfg.Recorder != nil,
+	} {
+		if set {
+			configured++
+		}
+	}
+	if configured > 1 {
+		return nil, errors.New(
+			"tracing: at most one of QueueName, ZipkinHTTP.Endpoint, OTLPHTTP.Endpoint and Recorder can be set",
+		)
+	}
+
+	switch {
+	case cfg.QueueName != "":
+		if cfg.MaxQueueSize <= 0 || cfg.MaxQueueSize > MaxQueueSize {
+			cfg.MaxQueueSize = MaxQueueSize
+		}
+		queue, err := mqsend.OpenMessageQueue(mqsend.MessageQueueConfig{
+			Name:           QueueNamePrefix + cfg.QueueName,
+			MaxQueueSize:   cfg.MaxQueueSize,
+			MaxMessageSize: MaxSpanSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return MessageQueueRecorder{
+			Queue:   queue,
+			Timeout: cfg.MaxRecordTimeout,
+			Logger:  logger,
+		}, nil
+	case cfg.ZipkinHTTP.Endpoint != "":
+		if cfg.ZipkinHTTP.Logger == nil {
+			cfg.ZipkinHTTP.Logger = logger
+		}
+		return NewZipkinHTTPRecorder(cfg.ZipkinHTTP)
+	case cfg.OTLPHTTP.Endpoint != "":
+		if cfg.OTLPHTTP.Logger == nil {
+			cfg.OTLPHTTP.Logger = logger
+		}
+		return NewOTLPHTTPRecorder(cfg.Namespace, cfg.OTLPHTTP)
+	case cfg.Recorder != nil:
+		return cfg.Recorder, nil
+	case cfg.TestOnlyMockMessageQueue != nil:
+		return MessageQueueRecorder{
+			Queue:   cfg.TestOnlyMockMessageQueue,
+			Timeout: cfg.MaxRecordTimeout,
+			Logger:  logger,
+		}, nil
+	}
+	return nil, nil
+}
+
 type closer struct{}
 
 func (closer) Close() error {
@@ -151,6 +206,8 @@ func InitGlobalTracerWithCloser(cfg Config) (io.Closer, error) {
 
 // Close closes the tracer's reporting.
 //
+// It flushes all the spans still buffered by the SpanRecorder before
+// returning.
 // After Close is called, no more spans will be sampled.
 func (t *Tracer) Close() error {
 	if t.recorder == nil {
@@ -161,7 +218,7 @@ func (t *Tracer) Close() error {
 	return err
 }
 
-// Record records a span with the Recorder.
+// Record records a span with the SpanRecorder.
 //
 // Span.Stop(), Span.Finish(), and Span.FinishWithOptions() call this function
 // automatically.
@@ -171,35 +228,7 @@ func (t *Tracer) Record(ctx context.Context, zs ZipkinSpan) error {
 	if t.recorder == nil {
 		return nil
 	}
-	data, err := json.Marshal(zs)
-	if err != nil {
-		return err
-	}
-
-	if ctx.Err() != nil {
-		// The request context is already canceled.
-		// Use background to make sure we are still able to send out the span,
-		ctx = context.Background()
-	}
-
-	timeout := t.maxRecordTimeout
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-	err = t.recorder.Send(ctx, data)
-	if errors.As(err, new(mqsend.MessageTooLargeError)) {
-		t.logger.Log(ctx, fmt.Sprintf(
-			"Span is too big, max allowed size is %d. This can be caused by an excess amount of tags. Error: %v",
-			MaxSpanSize,
-			err,
-		))
-	}
-	if errors.As(err, new(mqsend.TimedOutError)) {
-		t.logger.Log(
-			ctx,
-			"Trace queue is full. Is trace sidecar healthy? Error: "+err.Error(),
-		)
-	}
-	return err
+	return t.recorder.Record(ctx, zs)
 }
 
 // StartSpan implements opentracing.Tracer.
@@ -236,7 +265,14 @@ func (t *Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOp
 		parent.initChildSpan(span)
 	} else {
 		span.trace.traceID = t.newTraceID()
-		span.trace.sampled = randbp.ShouldSampleWithRate(t.sampleRate)
+		span.trace.sampled = t.shouldSample(SamplingParameters{
+			Name:     operationName,
+			SpanType: sso.Type,
+			TraceID:  span.trace.traceID,
+		})
+		if !span.trace.sampled && t.tailSampling.Enabled() {
+			span.trace.tail = newTailTrace(t.tailSampling, span.trace.spanID)
+		}
 		initRootSpan(context.Background(), span)
 	}
 
@@ -267,6 +303,13 @@ func (t *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.S
 	return nil, opentracing.ErrInvalidCarrier
 }
 
+func (t *Tracer) shouldSample(params SamplingParameters) bool {
+	if t.sampler == nil {
+		return false
+	}
+	return t.sampler.ShouldSample(params)
+}
+
 func (t *Tracer) newTraceID() string {
 	if t.useHex {
 		// For traces we just combine two 64-bit hex ids to get a 128-bit hex id.